@@ -0,0 +1,57 @@
+// cmd/camt/main.go
+//
+// camt is cmd/statements for camt.053 statements and camt.052 reports only,
+// with the flags it had before the other formats were added: -type 053 or
+// 052 in place of -format.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/token-cjg/minibank/internal/export"
+	"github.com/token-cjg/minibank/internal/logging"
+)
+
+func main() {
+	company := flag.Int64("company", 0, "company whose accounts to report (required)")
+	account := flag.Int64("account", 0, "report only this account id")
+	date := flag.String("date", "", "UTC day to report, YYYY-MM-DD (default yesterday for 053, today for 052)")
+	message := flag.String("type", "053", "053 for end-of-day statements, 052 for intraday reports")
+	dir := flag.String("out", ".", "directory to write the XML files to")
+	flag.Parse()
+
+	if err := logging.Setup(); err != nil {
+		fatal("logging", err)
+	}
+
+	format, err := camtFormat(*message)
+	if err != nil {
+		fatal("config", err)
+	}
+	j := export.Job{Company: *company, Account: *account, Format: format, Dir: *dir, Now: time.Now().UTC()}
+	if err := export.Exec(context.Background(), j, *date); err != nil {
+		fatal("export", err)
+	}
+}
+
+// camtFormat is the export format for a -type.
+func camtFormat(message string) (string, error) {
+	switch message {
+	case "053":
+		return export.FormatCamt053, nil
+	case "052":
+		return export.FormatCamt052, nil
+	}
+	return "", fmt.Errorf("-type must be 053 or 052, not %q", message)
+}
+
+// fatal logs err and exits; deferred calls do not run.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
+}
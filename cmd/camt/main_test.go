@@ -0,0 +1,18 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/token-cjg/minibank/internal/export"
+)
+
+func TestCamtFormat(t *testing.T) {
+	for message, want := range map[string]string{"053": export.FormatCamt053, "052": export.FormatCamt052} {
+		if got, err := camtFormat(message); err != nil || got != want {
+			t.Errorf("camtFormat(%q) = %q, %v; want %q", message, got, err, want)
+		}
+	}
+	if _, err := camtFormat("054"); err == nil {
+		t.Error("want an error for -type 054")
+	}
+}
@@ -4,26 +4,34 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/token-cjg/minibank/internal/logging"
 )
 
 func main() {
+	if err := logging.Setup(); err != nil {
+		fatal("logging", err)
+	}
+
 	ctx := context.Background()
 	db, err := sql.Open("pgx", os.Getenv("DATABASE_URL"))
 	if err != nil {
-		log.Fatalf("failed to open database: %v", err)
+		fatal("failed to open database", err)
 	}
 	defer db.Close()
 
 	if err := migrate(ctx, db); err != nil {
-		log.Fatalf("failed to migrate: %v", err)
+		fatal("failed to migrate", err)
 	}
 }
 
+// migrate runs every migration in order and records it in schema_migrations,
+// which the server's readiness check compares with the migrations it embeds.
+// Migrations are written to be idempotent, so re-running them is safe.
 func migrate(ctx context.Context, db *sql.DB) error {
 	migrationsDir := "migrations"
 	files, err := os.ReadDir(migrationsDir)
@@ -31,10 +39,25 @@ func migrate(ctx context.Context, db *sql.DB) error {
 		return fmt.Errorf("reading migrations directory: %v", err)
 	}
 
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    TEXT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return fmt.Errorf("creating schema_migrations: %v", err)
+	}
+
 	for _, file := range files {
+		if filepath.Ext(file.Name()) != ".sql" {
+			continue
+		}
 		if err := runMigration(ctx, db, filepath.Join(migrationsDir, file.Name())); err != nil {
 			return fmt.Errorf("running migration %s: %v", file.Name(), err)
 		}
+		if _, err := db.ExecContext(ctx,
+			`INSERT INTO schema_migrations (version) VALUES ($1) ON CONFLICT (version) DO NOTHING`,
+			file.Name()); err != nil {
+			return fmt.Errorf("recording migration %s: %v", file.Name(), err)
+		}
 	}
 	return nil
 }
@@ -50,3 +73,9 @@ func runMigration(ctx context.Context, db *sql.DB, file string) error {
 	}
 	return nil
 }
+
+// fatal logs err and exits; deferred calls do not run.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
+}
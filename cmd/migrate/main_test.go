@@ -113,8 +113,10 @@ func TestMigrate_Success(t *testing.T) {
 	defer db.Close()
 	ctx := context.Background()
 
-	// Expect the Exec of the dummy SQL.
+	// Expect the tracking table, the dummy SQL, then its version recorded.
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectExec("SELECT 1;").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO schema_migrations").WithArgs(fileName).WillReturnResult(sqlmock.NewResult(0, 1))
 
 	err = migrate(ctx, db)
 	if err != nil {
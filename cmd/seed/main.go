@@ -4,13 +4,15 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/token-cjg/minibank/internal/logging"
 )
 
 func main() {
@@ -20,29 +22,33 @@ func main() {
 	all := flag.Bool("all", false, "run every *.sql file in --dir in lexical order")
 	flag.Parse()
 
+	if err := logging.Setup(); err != nil {
+		fatal("logging", err)
+	}
+
 	dsn := os.Getenv("DATABASE_URL")
 	if dsn == "" {
-		log.Fatal("DATABASE_URL env var not set")
+		fatal("config", errors.New("DATABASE_URL env var not set"))
 	}
 
 	ctx := context.Background()
 	db, err := sql.Open("pgx", dsn)
 	if err != nil {
-		log.Fatalf("open db: %v", err)
+		fatal("open db", err)
 	}
 	defer db.Close()
 
 	if *all {
 		if err := runAll(ctx, db, *dir); err != nil {
-			log.Fatalf("seed: %v", err)
+			fatal("seed", err)
 		}
 	} else {
 		seedPath := filepath.Join(*dir, *file)
 		if err := runFile(ctx, db, seedPath); err != nil {
-			log.Fatalf("seed: %v", err)
+			fatal("seed", err)
 		}
 	}
-	log.Println("✅  seed completed")
+	slog.Info("✅  seed completed")
 }
 
 func runAll(ctx context.Context, db *sql.DB, dir string) error {
@@ -68,7 +74,7 @@ func runFile(ctx context.Context, db *sql.DB, path string) error {
 		return fmt.Errorf("read %s: %w", path, err)
 	}
 	if len(data) == 0 {
-		log.Printf("skip empty file %s", path)
+		slog.Info("skip empty file", "path", path)
 		return nil
 	}
 
@@ -83,3 +89,9 @@ func runFile(ctx context.Context, db *sql.DB, path string) error {
 	}
 	return tx.Commit()
 }
+
+// fatal logs err and exits; deferred calls do not run.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
+}
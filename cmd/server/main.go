@@ -1,38 +1,238 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/token-cjg/minibank/internal/api"
+	"github.com/token-cjg/minibank/internal/certs"
+	"github.com/token-cjg/minibank/internal/config"
 	"github.com/token-cjg/minibank/internal/db"
+	"github.com/token-cjg/minibank/internal/graphqlapi"
+	"github.com/token-cjg/minibank/internal/grpcapi"
+	"github.com/token-cjg/minibank/internal/live"
+	"github.com/token-cjg/minibank/internal/logging"
+	"github.com/token-cjg/minibank/internal/metrics"
 	"github.com/token-cjg/minibank/internal/repo"
+	"github.com/token-cjg/minibank/internal/tracing"
+	"github.com/token-cjg/minibank/internal/webhook"
+	"google.golang.org/grpc"
 )
 
 func main() {
-	pg, err := db.New()
+	cfg, err := config.Load(os.Args[1:], os.Getenv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	if cfg.PrintConfig {
+		fmt.Print(cfg.YAML())
+		return
+	}
+
+	level, _ := logging.ParseLevel(cfg.Log.Level) // checked by config.Validate
+	slog.SetDefault(logging.New(os.Stderr, level))
+	slog.Info("effective config", "config", cfg)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{Exporter: cfg.Tracing.Exporter})
 	if err != nil {
-		log.Fatalf("db: %v", err)
+		fatal("tracing", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	pg, err := db.Open(cfg.DB.URL, db.Pool{
+		MaxOpenConns:    cfg.DB.MaxOpenConns,
+		MaxIdleConns:    cfg.DB.MaxIdleConns,
+		ConnMaxIdleTime: cfg.DB.ConnMaxIdleTime,
+	})
+	if err != nil {
+		fatal("db", err)
 	}
 	defer pg.Close()
 
-	rep := repo.New(pg)
-	srv := api.New(rep)
+	if err := metrics.RegisterDBStats(pg); err != nil {
+		fatal("metrics", err)
+	}
+
+	rep := repo.New(pg,
+		repo.WithRetry(repo.RetryPolicy{
+			MaxAttempts: cfg.Transfer.RetryAttempts,
+			BaseDelay:   cfg.Transfer.RetryBaseDelay,
+			MaxDelay:    cfg.Transfer.RetryMaxDelay,
+		}),
+		repo.WithConcurrency(cfg.Transfer.Concurrency),
+		repo.WithBulkThreshold(cfg.Transfer.BulkMinRows))
+	hub := live.NewHub(rep)
+	srv := api.New(rep,
+		api.WithUploadLimit(cfg.Limits.MaxUploadBytes),
+		api.WithChunkRows(cfg.Transfer.ChunkRows),
+		api.WithCertSubjects(cfg.TLS.ClientCompanies),
+		api.WithLiveEvents(hub),
+		api.WithGraphQL(
+			graphqlapi.WithMaxDepth(cfg.Limits.GraphQLMaxDepth),
+			graphqlapi.WithMaxComplexity(cfg.Limits.GraphQLMaxComplexity)))
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// holds one pooled connection for as long as the server runs; ends
+	// every event stream at shutdown so they do not hold it up
+	go hub.Run(ctx)
+
+	if cfg.Webhook.PollInterval > 0 {
+		dispatcher := webhook.New(rep, webhook.Policy{
+			MaxAttempts: cfg.Webhook.MaxAttempts,
+			BaseDelay:   cfg.Webhook.RetryBaseDelay,
+			MaxDelay:    cfg.Webhook.RetryMaxDelay,
+		}, cfg.Webhook.PollInterval, cfg.Webhook.Timeout)
+		go dispatcher.Run(ctx)
+	}
+
+	server := newHTTPServer(srv, cfg.HTTP)
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		fatal("listen", err)
+	}
+	if cfg.TLS.Enabled() {
+		reloader, err := certs.NewReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.ClientCAFile, cfg.TLS.ClientAuth)
+		if err != nil {
+			fatal("tls", err)
+		}
+		go reloader.Watch(ctx, cfg.TLS.ReloadInterval)
+		server.TLSConfig = reloader.TLSConfig()
+	}
+
+	var grpcDone chan error
+	if cfg.GRPC.Addr != "" {
+		opts := []grpcapi.Option{
+			grpcapi.WithCertSubjects(cfg.TLS.ClientCompanies),
+			grpcapi.WithMaxBatchRows(cfg.GRPC.MaxBatchRows),
+		}
+		if server.TLSConfig != nil {
+			opts = append(opts, grpcapi.WithTLS(server.TLSConfig))
+		}
+		gln, err := net.Listen("tcp", cfg.GRPC.Addr)
+		if err != nil {
+			fatal("listen grpc", err)
+		}
+		slog.Info("🚀  listening for gRPC", "addr", gln.Addr().String(), "tls", cfg.TLS.Enabled())
+		grpcDone = make(chan error, 1)
+		go func() {
+			err := serveGRPC(ctx, grpcapi.New(rep, opts...), gln, cfg.HTTP.ShutdownTimeout)
+			if err != nil {
+				stop() // take the HTTP server down with it
+			}
+			grpcDone <- err
+		}()
+	}
+
+	slog.Info("🚀  listening", "addr", ln.Addr().String(), "tls", cfg.TLS.Enabled())
+	if err := serve(ctx, server, ln, srv.Drain, cfg.HTTP.ShutdownTimeout); err != nil {
+		fatal("server error", err)
+	}
+	if grpcDone != nil {
+		if err := <-grpcDone; err != nil {
+			fatal("grpc server error", err)
+		}
+	}
+	slog.Info("server stopped")
+}
+
+// serve runs server on ln, over TLS when server.TLSConfig is set, until ctx
+// is cancelled, then calls drain (failing readiness), stops accepting
+// connections and waits up to timeout for in-flight requests. Requests still
+// running at the deadline are aborted.
+func serve(ctx context.Context, server *http.Server, ln net.Listener, drain func(), timeout time.Duration) error {
+	errCh := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			errCh <- server.ServeTLS(ln, "", "")
+			return
+		}
+		errCh <- server.Serve(ln)
+	}()
 
-	server := newHTTPServer(srv)
-	log.Println("🚀  listening on http://localhost:8080")
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("server error: %v", err)
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down", "timeout", timeout)
+	drain()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("in-flight requests did not finish in time", "err", err)
+		_ = server.Close()
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
 	}
+	return nil
 }
 
-func newHTTPServer(handler http.Handler) *http.Server {
+// serveGRPC is serve for the gRPC server: it runs gs on ln until ctx is
+// cancelled, then fails its health checks, refuses new calls and waits up
+// to timeout for running ones, cancelling those still running at the
+// deadline.
+func serveGRPC(ctx context.Context, gs *grpcapi.Server, ln net.Listener, timeout time.Duration) error {
+	errCh := make(chan error, 1)
+	go func() { errCh <- gs.Serve(ln) }()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	gs.Drain()
+	stopped := make(chan struct{})
+	go func() {
+		gs.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		slog.Error("in-flight gRPC calls did not finish in time")
+		gs.Stop()
+		<-stopped
+		<-errCh
+		return context.DeadlineExceeded
+	}
+	// Serve refuses to start on a server already stopped
+	if err := <-errCh; !errors.Is(err, grpc.ErrServerStopped) {
+		return err
+	}
+	return nil
+}
+
+func newHTTPServer(handler http.Handler, cfg config.HTTP) *http.Server {
 	return &http.Server{
-		Addr:         ":8080",
+		Addr:         cfg.Addr,
 		Handler:      handler,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
 	}
 }
+
+// fatal logs err and exits; deferred calls do not run.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
+}
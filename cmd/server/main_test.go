@@ -1,16 +1,24 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"net"
 	"net/http"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/token-cjg/minibank/internal/config"
+	"github.com/token-cjg/minibank/internal/grpcapi"
+	"github.com/token-cjg/minibank/internal/repo"
 )
 
 func TestNewHTTPServer(t *testing.T) {
 	// Create a dummy handler.
 	dummyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
 
-	s := newHTTPServer(dummyHandler)
+	s := newHTTPServer(dummyHandler, config.Default().HTTP)
 
 	if s.Addr != ":8080" {
 		t.Errorf("expected Addr ':8080', got %q", s.Addr)
@@ -28,3 +36,98 @@ func TestNewHTTPServer(t *testing.T) {
 		t.Errorf("expected IdleTimeout 60s, got %v", s.IdleTimeout)
 	}
 }
+
+func TestServe_DrainsInFlightRequests(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	})
+	server := newHTTPServer(slow, config.Default().HTTP)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var drained atomic.Bool
+	done := make(chan error, 1)
+	go func() { done <- serve(ctx, server, ln, func() { drained.Store(true) }, 5*time.Second) }()
+
+	respCh := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			t.Errorf("in-flight request failed: %v", err)
+		}
+		respCh <- resp
+	}()
+
+	<-started
+	cancel() // SIGTERM arrives mid-request
+	time.Sleep(50 * time.Millisecond)
+	if !drained.Load() {
+		t.Fatal("drain was not called")
+	}
+	if _, err := http.Get("http://" + ln.Addr().String()); err == nil {
+		t.Fatal("new connections should be refused while draining")
+	}
+
+	close(release)
+	if resp := <-respCh; resp == nil || resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("in-flight request was not completed: %v", resp)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+}
+
+func TestServe_DeadlineExceeded(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	started := make(chan struct{})
+	stuck := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, newHTTPServer(stuck, config.Default().HTTP), ln, func() {}, 50*time.Millisecond)
+	}()
+	go http.Get("http://" + ln.Addr().String())
+
+	<-started
+	cancel()
+	if err := <-done; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want deadline exceeded, got %v", err)
+	}
+}
+
+func TestServeGRPC_StopsWhenCancelled(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- serveGRPC(ctx, grpcapi.New(repo.New(nil)), ln, 5*time.Second) }()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("serveGRPC: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serveGRPC did not return after cancel")
+	}
+	if _, err := net.DialTimeout("tcp", ln.Addr().String(), time.Second); err == nil {
+		t.Fatal("listener still accepting after shutdown")
+	}
+}
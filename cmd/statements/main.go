@@ -0,0 +1,39 @@
+// cmd/statements/main.go
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/token-cjg/minibank/internal/export"
+	"github.com/token-cjg/minibank/internal/logging"
+)
+
+func main() {
+	company := flag.Int64("company", 0, "company whose accounts to report (required)")
+	account := flag.Int64("account", 0, "report only this account id")
+	date := flag.String("date", "",
+		"UTC day to report, YYYY-MM-DD (default yesterday, or today for camt.052), or month YYYY-MM for pdf (default last month)")
+	format := flag.String("format", export.FormatCamt053,
+		"camt.053, camt.052 or pdf for a file per account, mt940 or bai2 for one file for the company")
+	dir := flag.String("out", ".", "directory to write the files to")
+	flag.Parse()
+
+	if err := logging.Setup(); err != nil {
+		fatal("logging", err)
+	}
+
+	j := export.Job{Company: *company, Account: *account, Format: *format, Dir: *dir, Now: time.Now().UTC()}
+	if err := export.Exec(context.Background(), j, *date); err != nil {
+		fatal("export", err)
+	}
+}
+
+// fatal logs err and exits; deferred calls do not run.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
+}
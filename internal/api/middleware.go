@@ -0,0 +1,202 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/token-cjg/minibank/internal/auth"
+	"github.com/token-cjg/minibank/internal/handler"
+	"github.com/token-cjg/minibank/internal/logging"
+	"github.com/token-cjg/minibank/internal/metrics"
+	"github.com/token-cjg/minibank/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// unmatchedRoute labels requests no route matched, keeping metric
+// cardinality bounded whatever paths clients probe.
+const unmatchedRoute = "unmatched"
+
+// statusWriter records the status code written by the wrapped handler.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach Flush and deadlines underneath.
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) code() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// routeTemplate returns the mux path template that matched r, such as
+// /companies/{companyId:[0-9]+}, so metrics are not labelled per ID.
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return unmatchedRoute
+}
+
+// instrument records request counts and latency per route template.
+func instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		route := routeTemplate(r)
+		metrics.HTTPDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+		metrics.HTTPRequests.WithLabelValues(route, r.Method, strconv.Itoa(sw.code())).Inc()
+	})
+}
+
+// traced starts a server span per request, continuing any trace the caller
+// propagated in the traceparent header. Handlers and the repo hang their own
+// spans off the request context.
+func traced(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		route := routeTemplate(r)
+		ctx, span := tracing.Tracer().Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+				attribute.Int64("http.request.body.size", r.ContentLength),
+				attribute.String("http.request_id", logging.RequestID(r.Context())),
+			))
+		defer span.End()
+
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(sw.code()))
+		if sw.code() >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sw.code()))
+		}
+	})
+}
+
+// withRequestID propagates the caller's X-Request-ID or assigns a new one,
+// stores it in the request context for loggers and echoes it on the response.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(logging.RequestIDHeader)
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set(logging.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// logFields collects what middleware further in learns about a request,
+// such as the authenticated company, for accessLog to log. It travels in
+// the request context, as the requests those middleware pass on are copies.
+type logFields struct {
+	company       int64
+	authenticated bool
+}
+
+type logFieldsKey struct{}
+
+// setLogCompany records the authenticated company for the access log.
+func setLogCompany(ctx context.Context, company int64) {
+	if f, ok := ctx.Value(logFieldsKey{}).(*logFields); ok {
+		f.company, f.authenticated = company, true
+	}
+}
+
+// accessLog writes one log line per request once the response is complete.
+// company is the authenticated company or else the one in the path.
+func accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		fields := &logFields{}
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), logFieldsKey{}, fields)))
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("route", routeTemplate(r)),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", sw.code()),
+			slog.Int64("bytes", sw.bytes),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("remote", r.RemoteAddr),
+		}
+		if fields.authenticated {
+			attrs = append(attrs, slog.String("company", strconv.FormatInt(fields.company, 10)))
+		} else if company := mux.Vars(r)["companyId"]; company != "" {
+			attrs = append(attrs, slog.String("company", company))
+		}
+		level := slog.LevelInfo
+		if sw.code() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+// certAuth authenticates the company behind a verified client certificate.
+// Requests without a certificate pass through unauthenticated; a
+// certificate whose subject is not mapped to a company is refused.
+func certAuth(subjects auth.CertSubjects) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cert := auth.ClientCert(r)
+			if cert == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			company, ok := subjects.Lookup(cert)
+			if !ok {
+				handler.WriteProblem(w, r, handler.NewProblem(http.StatusForbidden, handler.CodeForbidden,
+					"client certificate "+cert.Subject.String()+" is not mapped to a company"))
+				return
+			}
+			trace.SpanFromContext(r.Context()).SetAttributes(attribute.Int64("auth.company", company))
+			setLogCompany(r.Context(), company)
+			next.ServeHTTP(w, r.WithContext(auth.WithCompany(r.Context(), company)))
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+// muxVarPattern strips the regexp from a mux variable, {id:[0-9]+} -> {id}.
+var muxVarPattern = regexp.MustCompile(`\{([^:}]+):[^}]+\}`)
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cannot create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(OpenAPISpec(), &spec); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Fatalf("want an OpenAPI 3 document, got %q", spec.OpenAPI)
+	}
+
+	srv := New(repo.New(db))
+	routes := 0
+	err = srv.router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil // subrouter or matcher-only route
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		path := muxVarPattern.ReplaceAllString(tpl, "{$1}")
+		for _, m := range methods {
+			routes++
+			if _, ok := spec.Paths[path][strings.ToLower(m)]; !ok {
+				t.Errorf("route %s %s is missing from openapi.json", m, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk: %v", err)
+	}
+	if routes == 0 {
+		t.Fatal("no routes found")
+	}
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	db, _, _ := sqlmock.New()
+	defer db.Close()
+	srv := New(repo.New(db))
+
+	for path, ct := range map[string]string{"/openapi.json": "application/json", "/docs": "text/html"} {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), ct) {
+			t.Errorf("%s: status %d, content type %q", path, rec.Code, rec.Header().Get("Content-Type"))
+		}
+	}
+}
+
+// TestDocsAssets checks that the docs page loads Swagger UI from the server
+// itself, and that the server has it.
+func TestDocsAssets(t *testing.T) {
+	if strings.Contains(string(docsPage), "://") {
+		t.Errorf("docs page loads from another site:\n%s", docsPage)
+	}
+	db, _, _ := sqlmock.New()
+	defer db.Close()
+	srv := New(repo.New(db))
+
+	for path, ct := range map[string]string{
+		"/docs/swagger-ui.css":       "text/css",
+		"/docs/swagger-ui-bundle.js": "text/javascript",
+	} {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), ct) || rec.Body.Len() == 0 {
+			t.Errorf("%s: status %d, content type %q, %d bytes", path, rec.Code, rec.Header().Get("Content-Type"), rec.Body.Len())
+		}
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs/index.html", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("/docs/index.html: status %d, want 404", rec.Code)
+	}
+}
@@ -8,37 +8,157 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/token-cjg/minibank/internal/auth"
+	"github.com/token-cjg/minibank/internal/graphqlapi"
 	"github.com/token-cjg/minibank/internal/handler"
+	"github.com/token-cjg/minibank/internal/live"
+	"github.com/token-cjg/minibank/internal/metrics"
 	"github.com/token-cjg/minibank/internal/repo"
+	"github.com/token-cjg/minibank/migrations"
 )
 
 type Server struct {
-	router *mux.Router
+	router       *mux.Router
+	health       *handler.Health
+	transfer     *handler.Transfer
+	certSubjects auth.CertSubjects
+	events       *handler.Events
+	graphqlOpts  []graphqlapi.Option
 }
 
-func New(rep *repo.Repo) *Server {
+// Option customises the server built by New.
+type Option func(*Server)
+
+// WithUploadLimit overrides the transfer upload cap; see handler.Transfer.
+func WithUploadLimit(maxUploadBytes int64) Option {
+	return func(s *Server) {
+		s.transfer.MaxUploadBytes = maxUploadBytes
+	}
+}
+
+// WithChunkRows overrides how many CSV rows a transfer upload runs at a
+// time; see handler.Transfer.
+func WithChunkRows(n int) Option {
+	return func(s *Server) {
+		s.transfer.ChunkRows = n
+	}
+}
+
+// WithCertSubjects maps verified TLS client certificates to companies, so
+// mTLS clients are authenticated on the transfer endpoints.
+func WithCertSubjects(subjects auth.CertSubjects) Option {
+	return func(s *Server) { s.certSubjects = subjects }
+}
+
+// WithLiveEvents serves the event stream endpoints from hub, which the
+// caller runs. Without it they answer 503.
+func WithLiveEvents(hub *live.Hub) Option {
+	return func(s *Server) { s.events.Hub = hub }
+}
+
+// WithGraphQL customises the GraphQL endpoint, such as its query limits.
+func WithGraphQL(opts ...graphqlapi.Option) Option {
+	return func(s *Server) { s.graphqlOpts = opts }
+}
+
+func New(rep *repo.Repo, opts ...Option) *Server {
 	s := &Server{router: mux.NewRouter().StrictSlash(true)}
+	s.router.NotFoundHandler = wrap(http.HandlerFunc(handler.NotFound))
+	s.router.MethodNotAllowedHandler = wrap(http.HandlerFunc(handler.MethodNotAllowed))
+	s.router.Use(middleware...)
 
 	account := handler.NewAccount(rep)
 	company := handler.NewCompany(rep)
 	transfer := handler.NewTransfer(rep)
+	profile := handler.NewImportProfile(rep)
+	statement := handler.NewStatement(rep)
+	webhook := handler.NewWebhook(rep)
+	s.transfer = transfer
+	s.events = handler.NewEvents(rep, nil)
+	s.health = handler.NewHealth(rep, migrations.Versions())
+	for _, opt := range opts {
+		opt(s)
+	}
 
 	s.router.HandleFunc("/companies", company.Create).Methods(http.MethodPost)
 	s.router.HandleFunc("/companies", company.List).Methods(http.MethodGet)
-	s.router.HandleFunc("/companies/{id:[0-9]+}", company.GetByID).Methods(http.MethodGet)
+	s.router.HandleFunc("/companies/{companyId:[0-9]+}", company.GetByID).Methods(http.MethodGet)
 
-	s.router.HandleFunc("/companies/{id:[0-9]+}/accounts",
+	s.router.HandleFunc("/companies/{companyId:[0-9]+}/events",
+		s.events.Company).Methods(http.MethodGet)
+
+	s.router.HandleFunc("/companies/{companyId:[0-9]+}/accounts",
 		account.Create).Methods(http.MethodPost)
-	s.router.HandleFunc("/companies/{id:[0-9]+}/accounts",
+	s.router.HandleFunc("/companies/{companyId:[0-9]+}/accounts",
 		account.ListByCompany).Methods(http.MethodGet)
-	s.router.HandleFunc("/companies/{id:[0-9]+}/accounts/{id:[0-9]+}",
+	s.router.HandleFunc("/companies/{companyId:[0-9]+}/accounts/{accountId:[0-9]+}",
 		account.GetByID).Methods(http.MethodGet)
+	s.router.HandleFunc("/companies/{companyId:[0-9]+}/accounts/{accountId:[0-9]+}/statement",
+		statement.Period).Methods(http.MethodGet)
+	s.router.HandleFunc("/companies/{companyId:[0-9]+}/accounts/{accountId:[0-9]+}/balance",
+		statement.Balance).Methods(http.MethodGet)
+	s.router.HandleFunc("/companies/{companyId:[0-9]+}/accounts/{accountId:[0-9]+}/camt.053",
+		statement.Camt053).Methods(http.MethodGet)
+	s.router.HandleFunc("/companies/{companyId:[0-9]+}/accounts/{accountId:[0-9]+}/camt.052",
+		statement.Camt052).Methods(http.MethodGet)
+	s.router.HandleFunc("/companies/{companyId:[0-9]+}/accounts/{accountId:[0-9]+}/events",
+		s.events.Account).Methods(http.MethodGet)
+	s.router.HandleFunc("/accounts/by-number/{accountNumber:[0-9]+}",
+		account.GetByNumber).Methods(http.MethodGet)
+
+	s.router.HandleFunc("/companies/{companyId:[0-9]+}/import-profiles",
+		profile.List).Methods(http.MethodGet)
+	s.router.HandleFunc("/companies/{companyId:[0-9]+}/import-profiles/{profileName:[A-Za-z0-9._-]+}",
+		profile.Get).Methods(http.MethodGet)
+	s.router.HandleFunc("/companies/{companyId:[0-9]+}/import-profiles/{profileName:[A-Za-z0-9._-]+}",
+		profile.Put).Methods(http.MethodPut)
+	s.router.HandleFunc("/companies/{companyId:[0-9]+}/import-profiles/{profileName:[A-Za-z0-9._-]+}",
+		profile.Delete).Methods(http.MethodDelete)
+
+	s.router.HandleFunc("/companies/{companyId:[0-9]+}/webhooks",
+		webhook.Create).Methods(http.MethodPost)
+	s.router.HandleFunc("/companies/{companyId:[0-9]+}/webhooks",
+		webhook.List).Methods(http.MethodGet)
+	s.router.HandleFunc("/companies/{companyId:[0-9]+}/webhooks/{webhookId:[0-9]+}",
+		webhook.Get).Methods(http.MethodGet)
+	s.router.HandleFunc("/companies/{companyId:[0-9]+}/webhooks/{webhookId:[0-9]+}",
+		webhook.Delete).Methods(http.MethodDelete)
+	s.router.HandleFunc("/companies/{companyId:[0-9]+}/webhooks/{webhookId:[0-9]+}/deliveries",
+		webhook.Deliveries).Methods(http.MethodGet)
+	s.router.HandleFunc("/companies/{companyId:[0-9]+}/webhooks/{webhookId:[0-9]+}/deliveries/{deliveryId:[0-9]+}/redeliver",
+		webhook.Redeliver).Methods(http.MethodPost)
+
+	s.router.Handle("/transfer", certAuth(s.certSubjects)(http.HandlerFunc(transfer.Batch))).
+		Methods(http.MethodPost)
+
+	s.router.Handle("/graphql", graphqlapi.New(rep, s.graphqlOpts...)).
+		Methods(http.MethodGet, http.MethodPost)
 
-	s.router.HandleFunc("/transfer", transfer.Batch).Methods(http.MethodPost)
+	s.router.HandleFunc("/healthz", s.health.Live).Methods(http.MethodGet)
+	s.router.HandleFunc("/readyz", s.health.Ready).Methods(http.MethodGet)
+
+	s.router.HandleFunc("/openapi.json", serveOpenAPI).Methods(http.MethodGet)
+	s.router.HandleFunc("/docs", serveDocs).Methods(http.MethodGet)
+	s.router.HandleFunc("/docs/{asset:"+docsAssets+"}", serveDocsAsset).Methods(http.MethodGet)
+	s.router.Handle("/metrics", metrics.Handler()).Methods(http.MethodGet)
 
 	return s
 }
 
+// middleware runs, outermost first, around every matched route.
+var middleware = []mux.MiddlewareFunc{withRequestID, instrument, traced, accessLog}
+
+// wrap applies middleware to handlers mux calls without a route match.
+func wrap(h http.Handler) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// Drain fails the readiness probe ahead of a graceful shutdown.
+func (s *Server) Drain() { s.health.Drain() }
+
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.router.ServeHTTP(w, r)
 }
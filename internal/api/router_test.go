@@ -1,15 +1,28 @@
 package api_test
 
 import (
+	"bufio"
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/token-cjg/minibank/internal/api"
+	"github.com/token-cjg/minibank/internal/auth"
+	"github.com/token-cjg/minibank/internal/logging"
 	"github.com/token-cjg/minibank/internal/repo"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func newTestServer(t *testing.T) (*api.Server, sqlmock.Sqlmock) {
@@ -111,3 +124,207 @@ func TestCreateAccount(t *testing.T) {
 		t.Fatalf("db expectations: %v", err)
 	}
 }
+
+func TestGetAccount_RoutesBothIDs(t *testing.T) {
+	srv, mock := newTestServer(t)
+
+	// company 3 does not own account 10
+	mock.ExpectQuery(`FROM account WHERE company_id=\$1 AND account_id=\$2`).
+		WithArgs(int64(3), int64(10)).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"account_id", "company_id", "account_number", "account_balance"}))
+
+	rec := perform(t, srv, http.MethodGet, "/companies/3/accounts/10", nil)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status %d, want 404", rec.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
+
+func TestUnknownRoute_Problem(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	rec := perform(t, srv, http.MethodGet, "/nope", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status %d, want 404", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Fatalf("content type %q", ct)
+	}
+
+	rec = perform(t, srv, http.MethodDelete, "/companies", nil)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("status %d, want 405", rec.Code)
+	}
+}
+
+func TestMetrics_RouteTemplateLabels(t *testing.T) {
+	srv, mock := newTestServer(t)
+
+	mock.ExpectQuery(`SELECT company_id, company_name FROM company WHERE company_id=\$1`).
+		WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"company_id", "company_name"}).AddRow(7, "Acme Corp"))
+	perform(t, srv, http.MethodGet, "/companies/7", nil)
+
+	rec := perform(t, srv, http.MethodGet, "/metrics", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	want := `minibank_http_requests_total{code="200",method="GET",route="/companies/{companyId:[0-9]+}"}`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Fatalf("metrics output lacks %s", want)
+	}
+}
+
+func TestTracing_ServerSpanPerRequest(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	defer otel.SetTracerProvider(prev)
+
+	srv, mock := newTestServer(t)
+	mock.ExpectQuery(`SELECT company_id, company_name FROM company`).
+		WillReturnRows(sqlmock.NewRows([]string{"company_id", "company_name"}))
+	perform(t, srv, http.MethodGet, "/companies", nil)
+
+	spans := rec.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	if spans[0].Name() != "GET /companies" || spans[0].SpanKind() != trace.SpanKindServer {
+		t.Fatalf("unexpected span %q kind %v", spans[0].Name(), spans[0].SpanKind())
+	}
+}
+
+func TestRequestID_PropagatedAndLogged(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(logging.New(&buf, slog.LevelInfo))
+	defer slog.SetDefault(prev)
+
+	srv, mock := newTestServer(t)
+	mock.ExpectQuery(`SELECT account_id, company_id, account_number, account_balance FROM account WHERE company_id=\$1`).
+		WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"account_id", "company_id", "account_number", "account_balance"}))
+
+	req := httptest.NewRequest(http.MethodGet, "/companies/4/accounts", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("X-Request-ID"); got != "abc-123" {
+		t.Fatalf("request id not echoed, got %q", got)
+	}
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("access log is not one JSON line: %q", buf.String())
+	}
+	if line["request_id"] != "abc-123" || line["company"] != "4" ||
+		line["route"] != "/companies/{companyId:[0-9]+}/accounts" || line["status"] != float64(200) {
+		t.Fatalf("unexpected access log %v", line)
+	}
+
+	// a missing or unusable ID is replaced with a generated one
+	req = httptest.NewRequest(http.MethodGet, "/nope", nil)
+	req.Header.Set("X-Request-ID", "has spaces")
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if got := rec.Header().Get("X-Request-ID"); len(got) != 32 {
+		t.Fatalf("want generated 32 char id, got %q", got)
+	}
+}
+
+func TestAccessLog_AuthenticatedCompany(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(logging.New(&buf, slog.LevelInfo))
+	defer slog.SetDefault(prev)
+
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cannot create sqlmock: %v", err)
+	}
+	srv := api.New(repo.New(db), api.WithCertSubjects(auth.CertSubjects{"CN=acme-treasury": 9}))
+
+	req := httptest.NewRequest(http.MethodPost, "/transfer", strings.NewReader(""))
+	req.Header.Set("Content-Type", "text/csv")
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+		{Subject: pkix.Name{CommonName: "acme-treasury"}},
+	}}}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("access log is not one JSON line: %q", buf.String())
+	}
+	if line["company"] != "9" {
+		t.Fatalf("access log %v, want company 9", line)
+	}
+}
+
+// The first result must arrive while the upload is still open, proving the
+// server reads and answers the stream in lockstep rather than buffering.
+func TestTransferStreamsWhileUploading(t *testing.T) {
+	srv, mock := newTestServer(t)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	for _, acc := range []struct{ src, dst, srcID, dstID int64 }{{100, 200, 1, 2}, {300, 400, 3, 4}} {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FOR UPDATE`).WithArgs(acc.src, acc.dst).
+			WillReturnRows(sqlmock.NewRows([]string{"account_number", "account_id", "account_balance"}).
+				AddRow(acc.src, acc.srcID, 100.0).AddRow(acc.dst, acc.dstID, 0.0))
+		mock.ExpectExec(`account_balance - \$1`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`account_balance \+ \$1`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO transaction`).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+	}
+
+	upload, uploadW := io.Pipe()
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/transfer", upload)
+	req.Header.Set("Content-Type", "text/csv")
+	req.Header.Set("Accept", "application/x-ndjson")
+
+	respc := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Error(err)
+			close(respc)
+			return
+		}
+		respc <- resp
+	}()
+
+	_, _ = io.WriteString(uploadW, "100,200,10\n")
+	resp, ok := <-respc
+	if !ok {
+		return
+	}
+	defer resp.Body.Close()
+	lines := bufio.NewScanner(resp.Body)
+	if !lines.Scan() || !strings.Contains(lines.Text(), `"row":1`) {
+		t.Fatalf("first line %q, err %v", lines.Text(), lines.Err())
+	}
+
+	_, _ = io.WriteString(uploadW, "300,400,20\n")
+	_ = uploadW.Close()
+	var rest []string
+	for lines.Scan() {
+		rest = append(rest, lines.Text())
+	}
+	if len(rest) != 2 || !strings.Contains(rest[0], `"row":2`) || !strings.Contains(rest[1], `"complete":true`) {
+		t.Fatalf("remaining lines %q", rest)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("db expectations: %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+// Package auth identifies the company a request acts for. Today the only
+// method is a verified TLS client certificate whose subject is mapped to a
+// company; requests without one are unauthenticated and behave as before.
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+)
+
+type ctxKey struct{}
+
+// WithCompany returns a copy of ctx carrying the authenticated company.
+func WithCompany(ctx context.Context, companyID int64) context.Context {
+	return context.WithValue(ctx, ctxKey{}, companyID)
+}
+
+// Company returns the authenticated company, if any.
+func Company(ctx context.Context) (int64, bool) {
+	id, ok := ctx.Value(ctxKey{}).(int64)
+	return id, ok
+}
+
+// CertSubjects maps client certificate subjects to company IDs. A key is
+// either the full subject DN as printed by pkix.Name.String, such as
+// "CN=acme-treasury,O=Acme Corp", or just "CN=<common name>".
+type CertSubjects map[string]int64
+
+// Lookup returns the company for cert, preferring a full-DN match.
+func (m CertSubjects) Lookup(cert *x509.Certificate) (int64, bool) {
+	if id, ok := m[cert.Subject.String()]; ok {
+		return id, true
+	}
+	id, ok := m["CN="+cert.Subject.CommonName]
+	return id, ok
+}
+
+// ClientCert returns the verified leaf certificate of r, or nil when the
+// connection is not TLS or the client sent no certificate. Only verified
+// chains are considered, so an unverified certificate never authenticates.
+func ClientCert(r *http.Request) *x509.Certificate {
+	return PeerCert(r.TLS)
+}
+
+// PeerCert is ClientCert for a connection's TLS state, which is nil when
+// the connection is not TLS.
+func PeerCert(state *tls.ConnectionState) *x509.Certificate {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
@@ -0,0 +1,170 @@
+// Package bai2 writes BAI2 cash management balance reports, the previous-day
+// format older treasury systems ingest. Records are comma separated, end
+// with "/" unless their last field is free text, and are continued in 88
+// records past 80 characters. Amounts are in cents with no decimal point.
+package bai2
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/token-cjg/minibank/internal/model"
+)
+
+// Type codes used in account and transaction detail records.
+const (
+	TypeOpeningLedger    = "010"
+	TypeClosingLedger    = "015"
+	TypeTotalCredits     = "100"
+	TypeTotalDebits      = "400"
+	TypeIncomingTransfer = "195"
+	TypeOutgoingTransfer = "495"
+)
+
+const (
+	version      = "2"
+	maxRecordLen = 80
+	groupStatus  = "1" // update
+	asOfModifier = "2" // final previous day
+	fundsUnknown = "Z"
+	dateLayout   = "060102"
+	timeLayout   = "1504"
+)
+
+// Header identifies a file and its two parties.
+type Header struct {
+	Sender   string // identifies minibank
+	Receiver string // identifies the client
+	Created  time.Time
+	FileID   int       // distinguishes files sent on the same day
+	AsOf     time.Time // the day reported
+}
+
+// Encode writes the statements of day h.AsOf as a file with a single group,
+// one account section per statement. Each section has the opening and
+// closing ledger balances, the total credits and debits, and one detail
+// record per settled transfer carrying minibank's transaction id as bank
+// reference and the transfer's reference as customer reference.
+func Encode(h Header, sts []model.Statement) []byte {
+	f := &file{}
+	created := h.Created.UTC()
+	f.record(false, "01", field(h.Sender), field(h.Receiver), created.Format(dateLayout),
+		created.Format(timeLayout), strconv.Itoa(h.FileID), "", "", version)
+
+	groupStart, groupTotal := f.records, int64(0)
+	f.record(false, "02", field(h.Receiver), field(h.Sender), groupStatus, h.AsOf.UTC().Format(dateLayout),
+		"", model.Currency, asOfModifier)
+	for _, st := range sts {
+		groupTotal += f.account(st)
+	}
+	f.record(false, "98", strconv.FormatInt(groupTotal, 10), strconv.Itoa(len(sts)),
+		strconv.Itoa(f.records-groupStart+1))
+
+	f.record(false, "99", strconv.FormatInt(groupTotal, 10), "1", strconv.Itoa(f.records+1))
+	return f.buf.Bytes()
+}
+
+// file is a BAI2 file being written.
+type file struct {
+	buf     bytes.Buffer
+	records int
+}
+
+// record writes a record of fields, ending it with "/" unless its last
+// field is text. Past maxRecordLen it continues in 88 records, breaking
+// between fields, or inside the text.
+func (f *file) record(text bool, fields ...string) {
+	last := len(fields) - 1
+	if !text {
+		fields[last] += "/"
+	}
+	line := fields[0]
+	for i := 1; i <= last; i++ {
+		fl := fields[i]
+		if len(line)+1+len(fl) <= maxRecordLen {
+			line += "," + fl
+			continue
+		}
+		if text && i == last {
+			for len(line)+1+len(fl) > maxRecordLen {
+				n := maxRecordLen - len(line) - 1
+				f.write(line + "," + fl[:n])
+				line, fl = "88", fl[n:]
+			}
+			line += "," + fl
+			continue
+		}
+		f.write(line)
+		line = "88," + fl
+	}
+	f.write(line)
+}
+
+func (f *file) write(line string) {
+	f.buf.WriteString(line)
+	f.buf.WriteByte('\n')
+	f.records++
+}
+
+// account writes the section of one statement and returns its control
+// total, the sum of every amount in it.
+func (f *file) account(st model.Statement) int64 {
+	start := f.records
+	opening, closing := model.Cents(st.Opening), model.Cents(st.Closing)
+	var credits, debits int64
+	var nCredits, nDebits int
+	for _, e := range st.Entries {
+		if c := model.Cents(e.Amount); c < 0 {
+			debits -= c
+			nDebits++
+		} else {
+			credits += c
+			nCredits++
+		}
+	}
+	total := opening + closing + credits + debits
+	f.record(false, "03", st.Account.Number, model.Currency,
+		TypeOpeningLedger, cents(opening), "", "",
+		TypeClosingLedger, cents(closing), "", "",
+		TypeTotalCredits, cents(credits), strconv.Itoa(nCredits), "",
+		TypeTotalDebits, cents(debits), strconv.Itoa(nDebits), "")
+
+	for _, e := range st.Entries {
+		c := model.Cents(e.Amount)
+		code := TypeIncomingTransfer
+		if c < 0 {
+			code, c = TypeOutgoingTransfer, -c
+		}
+		total += c
+		ref := ""
+		if e.Reference != nil {
+			ref = field(*e.Reference)
+		}
+		text := "ACCT " + e.Counterparty
+		if e.Memo != nil {
+			text += " " + ascii(*e.Memo)
+		}
+		f.record(true, "16", code, cents(c), fundsUnknown, strconv.FormatInt(e.TxID, 10), ref, text)
+	}
+	f.record(false, "49", strconv.FormatInt(total, 10), strconv.Itoa(f.records-start+1))
+	return total
+}
+
+// field makes s safe in a delimited field, which may hold neither "," nor "/".
+func field(s string) string {
+	return strings.TrimSpace(strings.NewReplacer(",", " ", "/", " ").Replace(ascii(s)))
+}
+
+// ascii replaces what is not printable ASCII with spaces.
+func ascii(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r > '~' {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+func cents(c int64) string { return strconv.FormatInt(c, 10) }
@@ -0,0 +1,61 @@
+package bai2_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/token-cjg/minibank/internal/bai2"
+	"github.com/token-cjg/minibank/internal/model"
+	"github.com/token-cjg/minibank/internal/testutil/golden"
+)
+
+func ptr(s string) *string { return &s }
+
+var (
+	day    = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	header = bai2.Header{Sender: "MINIBANK", Receiver: "1", Created: day.Add(25 * time.Hour), FileID: 61, AsOf: day}
+)
+
+// statements are a day on two accounts of one company: a debit with a
+// reference and a memo long enough to need continuing, a credit with
+// nothing, and an account with no activity.
+func statements() []model.Statement {
+	return []model.Statement{{
+		Account: model.Account{ID: 1, Company: 1, Number: "1000000000000000"},
+		From:    day, To: day.AddDate(0, 0, 1),
+		Opening: 1000, Closing: 925.5,
+		Entries: []model.StatementEntry{{
+			TxID:         7,
+			BookedAt:     day.Add(9 * time.Hour),
+			Amount:       -100,
+			Counterparty: "1000000000000001",
+			Reference:    ptr("INV/2024,1001"),
+			Memo:         ptr("Rent for März, as agreed in the lease signed last year, paid on time as always"),
+		}, {
+			TxID:         9,
+			BookedAt:     day.Add(14 * time.Hour),
+			Amount:       25.5,
+			Counterparty: "1000000000000002",
+		}},
+	}, {
+		Account: model.Account{ID: 2, Company: 1, Number: "1000000000000003"},
+		From:    day, To: day.AddDate(0, 0, 1),
+		Opening: 50, Closing: 50,
+	}}
+}
+
+func TestEncode(t *testing.T) {
+	out := bai2.Encode(header, statements())
+	golden.Assert(t, "statements.bai", out)
+
+	for i, line := range strings.Split(strings.TrimSuffix(string(out), "\n"), "\n") {
+		if len(line) > 80 {
+			t.Errorf("record %d is %d characters: %s", i+1, len(line), line)
+		}
+	}
+}
+
+func TestEncode_NoAccounts(t *testing.T) {
+	golden.Assert(t, "empty.bai", bai2.Encode(header, nil))
+}
@@ -0,0 +1,151 @@
+// Package certs serves TLS key material that is reloaded from disk when the
+// files change, so certificates can be rotated without restarting the
+// server, and optionally verifies client certificates against a CA bundle.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// ClientAuth modes accepted by NewReloader.
+const (
+	ClientAuthNone    = "none"    // do not ask for client certificates
+	ClientAuthRequest = "request" // verify a certificate if the client sends one
+	ClientAuthRequire = "require" // reject handshakes without a valid certificate
+)
+
+// Reloader holds the current server certificate and client CA pool.
+type Reloader struct {
+	certFile, keyFile, caFile string
+	clientAuth                tls.ClientAuthType
+
+	cert    atomic.Pointer[tls.Certificate]
+	pool    atomic.Pointer[x509.CertPool]
+	modTime atomic.Int64 // newest mtime of the files last loaded, in ns
+}
+
+// NewReloader loads the key pair and, if caFile is set, the client CA bundle.
+func NewReloader(certFile, keyFile, caFile, clientAuth string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, caFile: caFile}
+	switch clientAuth {
+	case ClientAuthNone, "":
+		r.clientAuth = tls.NoClientCert
+	case ClientAuthRequest:
+		r.clientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		r.clientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown client auth mode %q (want none, request or require)", clientAuth)
+	}
+	if r.clientAuth != tls.NoClientCert && caFile == "" {
+		return nil, errors.New("client certificate verification needs a CA bundle")
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Reloader) load() error {
+	mod, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load key pair: %w", err)
+	}
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("read client CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("client CA bundle %s holds no PEM certificates", r.caFile)
+		}
+		r.pool.Store(pool)
+	}
+	r.cert.Store(&cert)
+	r.modTime.Store(mod)
+	return nil
+}
+
+func (r *Reloader) latestModTime() (int64, error) {
+	var latest int64
+	for _, f := range []string{r.certFile, r.keyFile, r.caFile} {
+		if f == "" {
+			continue
+		}
+		fi, err := os.Stat(f)
+		if err != nil {
+			return 0, err
+		}
+		if m := fi.ModTime().UnixNano(); m > latest {
+			latest = m
+		}
+	}
+	return latest, nil
+}
+
+// Reload re-reads the files if any changed since the last load. On error
+// the previous material stays in use.
+func (r *Reloader) Reload() (bool, error) {
+	mod, err := r.latestModTime()
+	if err != nil {
+		return false, err
+	}
+	if mod == r.modTime.Load() {
+		return false, nil
+	}
+	if err := r.load(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Watch polls the files every interval until ctx is done.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			switch changed, err := r.Reload(); {
+			case err != nil:
+				slog.Error("tls reload failed, keeping previous certificates", "err", err)
+			case changed:
+				slog.Info("tls certificates reloaded", "cert_file", r.certFile, "client_ca_file", r.caFile)
+			}
+		}
+	}
+}
+
+// TLSConfig returns a server config that always hands out the current
+// certificate and verifies clients against the current CA pool.
+func (r *Reloader) TLSConfig() *tls.Config {
+	base := &tls.Config{MinVersion: tls.VersionTLS12}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cfg := &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{*r.cert.Load()},
+			ClientAuth:   r.clientAuth,
+			NextProtos:   []string{"h2", "http/1.1"},
+		}
+		if pool := r.pool.Load(); pool != nil {
+			cfg.ClientCAs = pool
+		}
+		return cfg, nil
+	}
+	return base
+}
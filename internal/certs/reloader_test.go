@@ -0,0 +1,172 @@
+package certs_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/token-cjg/minibank/internal/certs"
+)
+
+type keyPair struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// issue creates a certificate for cn signed by parent, or self-signed.
+func issue(t *testing.T, cn string, parent *keyPair, isCA bool) *keyPair {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn, Organization: []string{"Acme Corp"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           nil,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	signer, signerKey := tpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &keyPair{cert: cert, key: key, der: der}
+}
+
+func (kp *keyPair) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	keyDER, _ := x509.MarshalECPrivateKey(kp.key)
+	must(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: kp.der}), 0o600))
+	must(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func (kp *keyPair) tlsCert() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{kp.der}, PrivateKey: kp.key}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReload_PicksUpChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	first := issue(t, "first", nil, false)
+	certFile, keyFile := first.write(t, dir, "server")
+
+	r, err := certs.NewReloader(certFile, keyFile, "", certs.ClientAuthNone)
+	must(t, err)
+	if changed, err := r.Reload(); changed || err != nil {
+		t.Fatalf("unchanged files reloaded: %v %v", changed, err)
+	}
+
+	second := issue(t, "second", nil, false)
+	second.write(t, dir, "server")
+	future := time.Now().Add(time.Minute)
+	must(t, os.Chtimes(certFile, future, future))
+
+	if changed, err := r.Reload(); !changed || err != nil {
+		t.Fatalf("changed files not reloaded: %v %v", changed, err)
+	}
+	cfg, _ := r.TLSConfig().GetConfigForClient(nil)
+	if got, _ := x509.ParseCertificate(cfg.Certificates[0].Certificate[0]); got.Subject.CommonName != "second" {
+		t.Fatalf("serving %q after reload", got.Subject.CommonName)
+	}
+}
+
+func TestReload_BadFilesKeepPrevious(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := issue(t, "good", nil, false).write(t, dir, "server")
+	r, err := certs.NewReloader(certFile, keyFile, "", certs.ClientAuthNone)
+	must(t, err)
+
+	must(t, os.WriteFile(certFile, []byte("garbage"), 0o600))
+	future := time.Now().Add(time.Minute)
+	must(t, os.Chtimes(certFile, future, future))
+	if _, err := r.Reload(); err == nil {
+		t.Fatal("expected reload error")
+	}
+	cfg, _ := r.TLSConfig().GetConfigForClient(nil)
+	if got, _ := x509.ParseCertificate(cfg.Certificates[0].Certificate[0]); got.Subject.CommonName != "good" {
+		t.Fatalf("previous certificate dropped, serving %q", got.Subject.CommonName)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := issue(t, "minibank-ca", nil, true)
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := issue(t, "localhost", ca, false).write(t, dir, "server")
+	client := issue(t, "acme-treasury", ca, false)
+
+	r, err := certs.NewReloader(certFile, keyFile, caFile, certs.ClientAuthRequire)
+	must(t, err)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = io.WriteString(w, req.TLS.VerifiedChains[0][0].Subject.CommonName)
+	}))
+	srv.TLS = r.TLSConfig()
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(certs ...tls.Certificate) (string, error) {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs: roots, Certificates: certs, ServerName: "localhost",
+		}}}
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return string(b), nil
+	}
+
+	if got, err := get(client.tlsCert()); err != nil || got != "acme-treasury" {
+		t.Fatalf("with client cert: %q, %v", got, err)
+	}
+	if _, err := get(); err == nil {
+		t.Fatal("handshake without a client certificate should fail in require mode")
+	}
+	if _, err := get(issue(t, "stranger", nil, false).tlsCert()); err == nil {
+		t.Fatal("certificate from an unknown CA should be rejected")
+	}
+}
+
+func TestNewReloader_RequiresCAForClientAuth(t *testing.T) {
+	certFile, keyFile := issue(t, "x", nil, false).write(t, t.TempDir(), "server")
+	if _, err := certs.NewReloader(certFile, keyFile, "", certs.ClientAuthRequire); err == nil {
+		t.Fatal("expected error without CA bundle")
+	}
+}
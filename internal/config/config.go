@@ -0,0 +1,451 @@
+// Package config loads the server configuration. Each setting has a built-in
+// default and can be overridden, in increasing order of precedence, by a
+// YAML or TOML file (-config), an environment variable and a command line
+// flag. Load validates the result so the server fails fast at startup.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/token-cjg/minibank/internal/logging"
+	"github.com/token-cjg/minibank/internal/tracing"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the complete server configuration.
+type Config struct {
+	HTTP     HTTP     `yaml:"http" toml:"http"`
+	GRPC     GRPC     `yaml:"grpc" toml:"grpc"`
+	TLS      TLS      `yaml:"tls" toml:"tls"`
+	DB       DB       `yaml:"db" toml:"db"`
+	Limits   Limits   `yaml:"limits" toml:"limits"`
+	Transfer Transfer `yaml:"transfer" toml:"transfer"`
+	Webhook  Webhook  `yaml:"webhook" toml:"webhook"`
+	Log      Log      `yaml:"log" toml:"log"`
+	Tracing  Tracing  `yaml:"tracing" toml:"tracing"`
+
+	// PrintConfig asks the server to print the effective configuration and exit.
+	PrintConfig bool `yaml:"-" toml:"-"`
+}
+
+type HTTP struct {
+	Addr            string        `yaml:"addr" toml:"addr"`
+	ReadTimeout     time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+// GRPC serves the gRPC API on its own port, with the same TLS settings as
+// HTTP; an empty Addr turns it off. BatchTransfer holds a batch in memory
+// until it has all of it, so MaxBatchRows caps the rows a call may stream;
+// 0 means no cap.
+type GRPC struct {
+	Addr         string `yaml:"addr" toml:"addr"`
+	MaxBatchRows int    `yaml:"max_batch_rows" toml:"max_batch_rows"`
+}
+
+// TLS enables HTTPS when both CertFile and KeyFile are set. The files are
+// re-read every ReloadInterval if they change. With ClientCAFile set,
+// client certificates are verified (ClientAuth "request" or "require") and
+// ClientCompanies maps their subjects to the company they act for.
+type TLS struct {
+	CertFile        string           `yaml:"cert_file" toml:"cert_file"`
+	KeyFile         string           `yaml:"key_file" toml:"key_file"`
+	ReloadInterval  time.Duration    `yaml:"reload_interval" toml:"reload_interval"`
+	ClientCAFile    string           `yaml:"client_ca_file" toml:"client_ca_file"`
+	ClientAuth      string           `yaml:"client_auth" toml:"client_auth"`
+	ClientCompanies map[string]int64 `yaml:"client_companies" toml:"client_companies"`
+}
+
+// Enabled reports whether the server should serve HTTPS.
+func (t TLS) Enabled() bool { return t.CertFile != "" }
+
+type DB struct {
+	URL             string        `yaml:"url" toml:"url"`
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time"`
+}
+
+type Limits struct {
+	// MaxUploadBytes caps the size of a transfer upload; 0 means no cap.
+	MaxUploadBytes int64 `yaml:"max_upload_bytes" toml:"max_upload_bytes"`
+	// GraphQLMaxDepth and GraphQLMaxComplexity refuse GraphQL queries that
+	// nest fields deeper or are estimated to resolve more fields, counting
+	// each page of a list as full; 0 means no limit.
+	GraphQLMaxDepth      int `yaml:"graphql_max_depth" toml:"graphql_max_depth"`
+	GraphQLMaxComplexity int `yaml:"graphql_max_complexity" toml:"graphql_max_complexity"`
+}
+
+// Transfer tunes how transfers run against the database. A transaction
+// aborted by a serialization failure or deadlock is retried up to
+// RetryAttempts times in total, backing off from RetryBaseDelay to at most
+// RetryMaxDelay with random jitter. Concurrency is how many independent
+// batch rows may run at once. The default, 1, runs batches row by row and
+// stops at the first failing row; above 1, rows after a failing one may
+// already have been applied, so parallel runs are opt-in. Batches of at
+// least BulkMinRows rows use the set-based bulk engine instead, which is
+// all or nothing; 0 disables it. A CSV upload is run as batches of
+// ChunkRows rows, so its memory stays bounded; 0 runs it as one batch.
+// BulkMinRows must not exceed ChunkRows, or uploads never use the bulk
+// engine.
+type Transfer struct {
+	Concurrency    int           `yaml:"concurrency" toml:"concurrency"`
+	BulkMinRows    int           `yaml:"bulk_min_rows" toml:"bulk_min_rows"`
+	ChunkRows      int           `yaml:"chunk_rows" toml:"chunk_rows"`
+	RetryAttempts  int           `yaml:"retry_attempts" toml:"retry_attempts"`
+	RetryBaseDelay time.Duration `yaml:"retry_base_delay" toml:"retry_base_delay"`
+	RetryMaxDelay  time.Duration `yaml:"retry_max_delay" toml:"retry_max_delay"`
+}
+
+// Webhook tunes webhook delivery. The outbox is polled every PollInterval;
+// 0 stops this server delivering, for deployments that leave it to others.
+// A receiver gets Timeout to answer, and a delivery is attempted up to
+// MaxAttempts times, waiting from RetryBaseDelay, doubling, up to
+// RetryMaxDelay between attempts.
+type Webhook struct {
+	PollInterval   time.Duration `yaml:"poll_interval" toml:"poll_interval"`
+	Timeout        time.Duration `yaml:"timeout" toml:"timeout"`
+	MaxAttempts    int           `yaml:"max_attempts" toml:"max_attempts"`
+	RetryBaseDelay time.Duration `yaml:"retry_base_delay" toml:"retry_base_delay"`
+	RetryMaxDelay  time.Duration `yaml:"retry_max_delay" toml:"retry_max_delay"`
+}
+
+type Log struct {
+	Level string `yaml:"level" toml:"level"`
+}
+
+type Tracing struct {
+	Exporter string `yaml:"exporter" toml:"exporter"`
+}
+
+// Default returns the settings the server used before it was configurable.
+func Default() Config {
+	return Config{
+		HTTP: HTTP{
+			Addr:            ":8080",
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    10 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		GRPC: GRPC{
+			Addr:         ":9090",
+			MaxBatchRows: 1_000_000,
+		},
+		DB: DB{
+			MaxOpenConns:    15,
+			MaxIdleConns:    5,
+			ConnMaxIdleTime: 10 * time.Minute,
+		},
+		TLS: TLS{
+			ReloadInterval: 10 * time.Second,
+			ClientAuth:     "none",
+		},
+		Limits: Limits{
+			MaxUploadBytes:       100 << 20,
+			GraphQLMaxDepth:      15,
+			GraphQLMaxComplexity: 50_000,
+		},
+		Transfer: Transfer{
+			Concurrency:    1,
+			ChunkRows:      10_000,
+			RetryAttempts:  5,
+			RetryBaseDelay: 10 * time.Millisecond,
+			RetryMaxDelay:  500 * time.Millisecond,
+		},
+		Webhook: Webhook{
+			PollInterval:   time.Second,
+			Timeout:        10 * time.Second,
+			MaxAttempts:    12,
+			RetryBaseDelay: time.Minute,
+			RetryMaxDelay:  6 * time.Hour,
+		},
+		Log:     Log{Level: "info"},
+		Tracing: Tracing{Exporter: tracing.ExporterNone},
+	}
+}
+
+// setting binds one Config field to its flag and environment variable.
+type setting struct {
+	flag, env, usage string
+	ptr              any // *string, *int, *int64 or *time.Duration
+	secret           bool
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{"http.addr", "MINIBANK_HTTP_ADDR", "listen address", &c.HTTP.Addr, false},
+		{"http.read-timeout", "MINIBANK_HTTP_READ_TIMEOUT", "maximum time to read a request", &c.HTTP.ReadTimeout, false},
+		{"http.write-timeout", "MINIBANK_HTTP_WRITE_TIMEOUT", "maximum time to write a response", &c.HTTP.WriteTimeout, false},
+		{"http.idle-timeout", "MINIBANK_HTTP_IDLE_TIMEOUT", "keep-alive idle timeout", &c.HTTP.IdleTimeout, false},
+		{"http.shutdown-timeout", "MINIBANK_HTTP_SHUTDOWN_TIMEOUT", "time in-flight requests get to finish on SIGTERM", &c.HTTP.ShutdownTimeout, false},
+		{"grpc.addr", "MINIBANK_GRPC_ADDR", "gRPC listen address, empty for none", &c.GRPC.Addr, false},
+		{"grpc.max-batch-rows", "MINIBANK_GRPC_MAX_BATCH_ROWS", "maximum rows in a gRPC BatchTransfer, 0 for none", &c.GRPC.MaxBatchRows, false},
+		{"tls.cert-file", "MINIBANK_TLS_CERT_FILE", "PEM certificate chain; enables HTTPS", &c.TLS.CertFile, false},
+		{"tls.key-file", "MINIBANK_TLS_KEY_FILE", "PEM private key for tls.cert-file", &c.TLS.KeyFile, false},
+		{"tls.reload-interval", "MINIBANK_TLS_RELOAD_INTERVAL", "how often to check the TLS files for changes", &c.TLS.ReloadInterval, false},
+		{"tls.client-ca-file", "MINIBANK_TLS_CLIENT_CA_FILE", "PEM bundle of CAs that sign client certificates", &c.TLS.ClientCAFile, false},
+		{"tls.client-auth", "MINIBANK_TLS_CLIENT_AUTH", "client certificates: none, request or require", &c.TLS.ClientAuth, false},
+		{"db.url", "DATABASE_URL", "Postgres connection URL", &c.DB.URL, true},
+		{"db.max-open-conns", "MINIBANK_DB_MAX_OPEN_CONNS", "maximum open connections", &c.DB.MaxOpenConns, false},
+		{"db.max-idle-conns", "MINIBANK_DB_MAX_IDLE_CONNS", "maximum idle connections", &c.DB.MaxIdleConns, false},
+		{"db.conn-max-idle-time", "MINIBANK_DB_CONN_MAX_IDLE_TIME", "close connections idle for longer", &c.DB.ConnMaxIdleTime, false},
+		{"limits.max-upload-bytes", "MINIBANK_LIMITS_MAX_UPLOAD_BYTES", "maximum transfer upload size, 0 for none", &c.Limits.MaxUploadBytes, false},
+		{"limits.graphql-max-depth", "MINIBANK_LIMITS_GRAPHQL_MAX_DEPTH", "deepest field nesting in a GraphQL query, 0 for none", &c.Limits.GraphQLMaxDepth, false},
+		{"limits.graphql-max-complexity", "MINIBANK_LIMITS_GRAPHQL_MAX_COMPLEXITY", "highest estimated GraphQL query cost, 0 for none", &c.Limits.GraphQLMaxComplexity, false},
+		{"transfer.concurrency", "MINIBANK_TRANSFER_CONCURRENCY", "batch rows on disjoint accounts run at once", &c.Transfer.Concurrency, false},
+		{"transfer.bulk-min-rows", "MINIBANK_TRANSFER_BULK_MIN_ROWS", "batches this large use the bulk engine, 0 for never", &c.Transfer.BulkMinRows, false},
+		{"transfer.chunk-rows", "MINIBANK_TRANSFER_CHUNK_ROWS", "CSV upload rows run as one batch, 0 for the whole file", &c.Transfer.ChunkRows, false},
+		{"transfer.retry-attempts", "MINIBANK_TRANSFER_RETRY_ATTEMPTS", "attempts per transfer on serialization failure or deadlock", &c.Transfer.RetryAttempts, false},
+		{"transfer.retry-base-delay", "MINIBANK_TRANSFER_RETRY_BASE_DELAY", "backoff before the first retry", &c.Transfer.RetryBaseDelay, false},
+		{"transfer.retry-max-delay", "MINIBANK_TRANSFER_RETRY_MAX_DELAY", "longest backoff between retries", &c.Transfer.RetryMaxDelay, false},
+		{"webhook.poll-interval", "MINIBANK_WEBHOOK_POLL_INTERVAL", "how often to deliver webhook events, 0 for never", &c.Webhook.PollInterval, false},
+		{"webhook.timeout", "MINIBANK_WEBHOOK_TIMEOUT", "time a webhook receiver gets to answer", &c.Webhook.Timeout, false},
+		{"webhook.max-attempts", "MINIBANK_WEBHOOK_MAX_ATTEMPTS", "attempts per webhook delivery before it fails", &c.Webhook.MaxAttempts, false},
+		{"webhook.retry-base-delay", "MINIBANK_WEBHOOK_RETRY_BASE_DELAY", "wait after a failed webhook delivery", &c.Webhook.RetryBaseDelay, false},
+		{"webhook.retry-max-delay", "MINIBANK_WEBHOOK_RETRY_MAX_DELAY", "longest wait between webhook delivery attempts", &c.Webhook.RetryMaxDelay, false},
+		{"log.level", "LOG_LEVEL", "debug, info, warn or error", &c.Log.Level, false},
+		{"tracing.exporter", "OTEL_TRACES_EXPORTER", "none, otlp or stdout", &c.Tracing.Exporter, false},
+	}
+}
+
+func (s setting) set(v string) error {
+	var err error
+	switch p := s.ptr.(type) {
+	case *string:
+		*p = v
+	case *int:
+		*p, err = strconv.Atoi(v)
+	case *int64:
+		*p, err = strconv.ParseInt(v, 10, 64)
+	case *time.Duration:
+		*p, err = time.ParseDuration(v)
+	default:
+		panic(fmt.Sprintf("config: unsupported type %T", s.ptr))
+	}
+	return err
+}
+
+// Load builds the configuration from defaults, the file named by -config,
+// environment variables (read through getenv) and the flags in args.
+// It returns flag.ErrHelp if args ask for usage.
+func Load(args []string, getenv func(string) string, stderr io.Writer) (Config, error) {
+	cfg := Default()
+	settings := cfg.settings()
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	file := fs.String("config", getenv("MINIBANK_CONFIG"), "YAML (.yaml, .yml) or TOML (.toml) config file")
+	printConfig := fs.Bool("print-config", false, "print the effective configuration (secrets redacted) and exit")
+	flagVals := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		flagVals[s.flag] = fs.String(s.flag, "", fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	if *file != "" {
+		if err := loadFile(*file, &cfg); err != nil {
+			return cfg, err
+		}
+	}
+	for _, s := range settings {
+		if v := getenv(s.env); v != "" {
+			if err := s.set(v); err != nil {
+				return cfg, fmt.Errorf("env %s: %w", s.env, err)
+			}
+		}
+	}
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name && flagErr == nil {
+				if err := s.set(*flagVals[s.flag]); err != nil {
+					flagErr = fmt.Errorf("flag -%s: %w", s.flag, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return cfg, flagErr
+	}
+	cfg.PrintConfig = *printConfig
+	return cfg, cfg.Validate()
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(strings.NewReader(string(data)))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("config file %s: unknown key %s", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("config file %s: unsupported extension (want .yaml, .yml or .toml)", path)
+	}
+	return nil
+}
+
+// Validate reports every setting that cannot work.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.HTTP.Addr != "", "http.addr must be set")
+	check(c.HTTP.ReadTimeout > 0, "http.read_timeout must be positive, got %s", c.HTTP.ReadTimeout)
+	check(c.HTTP.WriteTimeout > 0, "http.write_timeout must be positive, got %s", c.HTTP.WriteTimeout)
+	check(c.HTTP.IdleTimeout > 0, "http.idle_timeout must be positive, got %s", c.HTTP.IdleTimeout)
+	check(c.HTTP.ShutdownTimeout > 0, "http.shutdown_timeout must be positive, got %s", c.HTTP.ShutdownTimeout)
+
+	check(c.GRPC.Addr == "" || c.GRPC.Addr != c.HTTP.Addr, "grpc.addr must differ from http.addr")
+	check(c.GRPC.MaxBatchRows >= 0, "grpc.max_batch_rows must not be negative")
+
+	check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "tls.cert_file and tls.key_file must be set together")
+	checkFile := func(name, path string) {
+		if path != "" {
+			_, err := os.Stat(path)
+			check(err == nil, "%s: %v", name, err)
+		}
+	}
+	checkFile("tls.cert_file", c.TLS.CertFile)
+	checkFile("tls.key_file", c.TLS.KeyFile)
+	checkFile("tls.client_ca_file", c.TLS.ClientCAFile)
+	check(c.TLS.ReloadInterval > 0, "tls.reload_interval must be positive, got %s", c.TLS.ReloadInterval)
+	switch c.TLS.ClientAuth {
+	case "none":
+		check(c.TLS.ClientCAFile == "" && len(c.TLS.ClientCompanies) == 0,
+			"tls.client_ca_file and tls.client_companies need tls.client_auth request or require")
+	case "request", "require":
+		check(c.TLS.Enabled(), "tls.client_auth needs tls.cert_file and tls.key_file")
+		check(c.TLS.ClientCAFile != "", "tls.client_auth %s needs tls.client_ca_file", c.TLS.ClientAuth)
+	default:
+		check(false, "tls.client_auth must be none, request or require, got %q", c.TLS.ClientAuth)
+	}
+
+	check(c.DB.URL != "", "db.url (DATABASE_URL) must be set")
+	if c.DB.URL != "" {
+		_, err := url.Parse(c.DB.URL)
+		check(err == nil, "db.url is not a valid URL")
+	}
+	check(c.DB.MaxOpenConns > 0, "db.max_open_conns must be positive, got %d", c.DB.MaxOpenConns)
+	check(c.DB.MaxIdleConns >= 0 && c.DB.MaxIdleConns <= c.DB.MaxOpenConns,
+		"db.max_idle_conns must be between 0 and db.max_open_conns, got %d", c.DB.MaxIdleConns)
+	check(c.DB.ConnMaxIdleTime >= 0, "db.conn_max_idle_time must not be negative")
+
+	check(c.Limits.MaxUploadBytes >= 0, "limits.max_upload_bytes must not be negative")
+	check(c.Limits.GraphQLMaxDepth >= 0, "limits.graphql_max_depth must not be negative")
+	check(c.Limits.GraphQLMaxComplexity >= 0, "limits.graphql_max_complexity must not be negative")
+
+	check(c.Transfer.Concurrency >= 1 && c.Transfer.Concurrency <= c.DB.MaxOpenConns,
+		"transfer.concurrency must be between 1 and db.max_open_conns, got %d", c.Transfer.Concurrency)
+	check(c.Transfer.BulkMinRows >= 0, "transfer.bulk_min_rows must not be negative")
+	check(c.Transfer.ChunkRows >= 0, "transfer.chunk_rows must not be negative")
+	// a CSV upload never reaches the bulk engine in chunks smaller than it
+	check(c.Transfer.BulkMinRows <= c.Transfer.ChunkRows || c.Transfer.ChunkRows <= 0,
+		"transfer.bulk_min_rows must not be more than transfer.chunk_rows, got %d > %d",
+		c.Transfer.BulkMinRows, c.Transfer.ChunkRows)
+	check(c.Transfer.RetryAttempts >= 1, "transfer.retry_attempts must be at least 1, got %d", c.Transfer.RetryAttempts)
+	check(c.Transfer.RetryBaseDelay >= 0, "transfer.retry_base_delay must not be negative")
+	check(c.Transfer.RetryMaxDelay >= c.Transfer.RetryBaseDelay,
+		"transfer.retry_max_delay must be at least transfer.retry_base_delay")
+
+	check(c.Webhook.PollInterval >= 0, "webhook.poll_interval must not be negative")
+	check(c.Webhook.Timeout > 0, "webhook.timeout must be positive, got %s", c.Webhook.Timeout)
+	check(c.Webhook.MaxAttempts >= 1, "webhook.max_attempts must be at least 1, got %d", c.Webhook.MaxAttempts)
+	check(c.Webhook.RetryBaseDelay > 0, "webhook.retry_base_delay must be positive, got %s", c.Webhook.RetryBaseDelay)
+	check(c.Webhook.RetryMaxDelay >= c.Webhook.RetryBaseDelay,
+		"webhook.retry_max_delay must be at least webhook.retry_base_delay")
+
+	_, err := logging.ParseLevel(c.Log.Level)
+	check(err == nil, "log.level: %v", err)
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout:
+	default:
+		check(false, "tracing.exporter must be none, otlp or stdout, got %q", c.Tracing.Exporter)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy safe to print: secrets such as the database
+// password are masked.
+func (c Config) Redacted() Config {
+	out := c
+	for _, s := range out.settings() {
+		if p, ok := s.ptr.(*string); ok && s.secret && *p != "" {
+			*p = redactURL(*p)
+		}
+	}
+	return out
+}
+
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" {
+		return "REDACTED"
+	}
+	return u.Redacted()
+}
+
+// YAML renders the redacted configuration, for -print-config.
+func (c Config) YAML() string {
+	b, _ := yaml.Marshal(c.Redacted())
+	return string(b)
+}
+
+// LogValue logs the redacted configuration as nested groups.
+func (c Config) LogValue() slog.Value {
+	r := c.Redacted()
+	return slog.GroupValue(
+		slog.Group("http", "addr", r.HTTP.Addr, "read_timeout", r.HTTP.ReadTimeout,
+			"write_timeout", r.HTTP.WriteTimeout, "idle_timeout", r.HTTP.IdleTimeout,
+			"shutdown_timeout", r.HTTP.ShutdownTimeout),
+		slog.Group("grpc", "addr", r.GRPC.Addr, "max_batch_rows", r.GRPC.MaxBatchRows),
+		slog.Group("tls", "cert_file", r.TLS.CertFile, "key_file", r.TLS.KeyFile,
+			"reload_interval", r.TLS.ReloadInterval, "client_ca_file", r.TLS.ClientCAFile,
+			"client_auth", r.TLS.ClientAuth, "client_companies", len(r.TLS.ClientCompanies)),
+		slog.Group("db", "url", r.DB.URL, "max_open_conns", r.DB.MaxOpenConns,
+			"max_idle_conns", r.DB.MaxIdleConns, "conn_max_idle_time", r.DB.ConnMaxIdleTime),
+		slog.Group("limits", "max_upload_bytes", r.Limits.MaxUploadBytes,
+			"graphql_max_depth", r.Limits.GraphQLMaxDepth, "graphql_max_complexity", r.Limits.GraphQLMaxComplexity),
+		slog.Group("transfer", "concurrency", r.Transfer.Concurrency,
+			"bulk_min_rows", r.Transfer.BulkMinRows, "chunk_rows", r.Transfer.ChunkRows, "retry_attempts", r.Transfer.RetryAttempts,
+			"retry_base_delay", r.Transfer.RetryBaseDelay, "retry_max_delay", r.Transfer.RetryMaxDelay),
+		slog.Group("webhook", "poll_interval", r.Webhook.PollInterval, "timeout", r.Webhook.Timeout,
+			"max_attempts", r.Webhook.MaxAttempts, "retry_base_delay", r.Webhook.RetryBaseDelay,
+			"retry_max_delay", r.Webhook.RetryMaxDelay),
+		slog.Group("log", "level", r.Log.Level),
+		slog.Group("tracing", "exporter", r.Tracing.Exporter),
+	)
+}
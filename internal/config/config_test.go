@@ -0,0 +1,154 @@
+package config_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/token-cjg/minibank/internal/config"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(k string) string { return vars[k] }
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+		t.Fatalf("write %s: %v", p, err)
+	}
+	return p
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, err := config.Load(nil, env(map[string]string{"DATABASE_URL": "postgres://localhost/bank"}), io.Discard)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	want := config.Default()
+	want.DB.URL = "postgres://localhost/bank"
+	if !reflect.DeepEqual(cfg, want) {
+		t.Fatalf("got %+v, want %+v", cfg, want)
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	file := writeFile(t, "minibank.yaml", `
+http:
+  addr: ":9000"
+  read_timeout: 20s
+db:
+  url: postgres://file/bank
+  max_open_conns: 30
+  max_idle_conns: 10
+`)
+	cfg, err := config.Load(
+		[]string{"-config", file, "-db.max-open-conns", "40"},
+		env(map[string]string{"MINIBANK_HTTP_ADDR": ":9100", "MINIBANK_DB_MAX_OPEN_CONNS": "35"}),
+		io.Discard)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.HTTP.ReadTimeout != 20*time.Second { // file over default
+		t.Errorf("read timeout %s", cfg.HTTP.ReadTimeout)
+	}
+	if cfg.HTTP.Addr != ":9100" { // env over file
+		t.Errorf("addr %q", cfg.HTTP.Addr)
+	}
+	if cfg.DB.MaxOpenConns != 40 { // flag over env
+		t.Errorf("max open conns %d", cfg.DB.MaxOpenConns)
+	}
+	if cfg.DB.MaxIdleConns != 10 || cfg.HTTP.WriteTimeout != 10*time.Second {
+		t.Errorf("unset values should fall through: %+v", cfg)
+	}
+}
+
+func TestLoad_TOML(t *testing.T) {
+	file := writeFile(t, "minibank.toml", `
+[db]
+url = "postgres://toml/bank"
+
+[limits]
+max_upload_bytes = 1048576
+`)
+	cfg, err := config.Load([]string{"-config", file}, env(nil), io.Discard)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.DB.URL != "postgres://toml/bank" || cfg.Limits.MaxUploadBytes != 1<<20 {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+}
+
+func TestLoad_UnknownFileKey(t *testing.T) {
+	file := writeFile(t, "minibank.yaml", "db:\n  urll: postgres://typo\n")
+	if _, err := config.Load([]string{"-config", file}, env(nil), io.Discard); err == nil {
+		t.Fatal("expected error for unknown key")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := config.Default()
+	cfg.DB.URL = "postgres://localhost/bank"
+	cfg.DB.MaxIdleConns = 50
+	cfg.HTTP.ReadTimeout = 0
+	cfg.TLS.CertFile = "cert.pem"
+	cfg.Log.Level = "loud"
+	cfg.Transfer.RetryAttempts = 0
+	cfg.Transfer.ChunkRows = -1
+	cfg.Webhook.MaxAttempts = 0
+	cfg.GRPC.Addr = cfg.HTTP.Addr
+	cfg.Limits.GraphQLMaxComplexity = -1
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, want := range []string{"max_idle_conns", "read_timeout", "tls.cert_file and tls.key_file", "log.level", "transfer.retry_attempts", "transfer.chunk_rows",
+		"webhook.max_attempts", "grpc.addr", "limits.graphql_max_complexity"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
+
+func TestValidate_BulkMinRowsAboveChunkRows(t *testing.T) {
+	cfg := config.Default()
+	cfg.DB.URL = "postgres://localhost/bank"
+	cfg.Transfer.BulkMinRows = cfg.Transfer.ChunkRows
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("bulk_min_rows equal to chunk_rows: %v", err)
+	}
+	cfg.Transfer.BulkMinRows++
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "transfer.bulk_min_rows") {
+		t.Fatalf("error %v does not mention transfer.bulk_min_rows", err)
+	}
+	cfg.Transfer.ChunkRows = 0
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unchunked uploads: %v", err)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := config.Default()
+	cfg.DB.URL = "postgres://bank:s3cret@db:5432/bank?sslmode=disable"
+
+	out := cfg.YAML()
+	if strings.Contains(out, "s3cret") {
+		t.Fatalf("password leaked:\n%s", out)
+	}
+	if !strings.Contains(out, "postgres://bank:xxxxx@db:5432/bank") {
+		t.Fatalf("url not redacted as expected:\n%s", out)
+	}
+	if !strings.Contains(out, "read_timeout: 10s") {
+		t.Fatalf("durations should print readably:\n%s", out)
+	}
+	if cfg.DB.URL != "postgres://bank:s3cret@db:5432/bank?sslmode=disable" {
+		t.Fatal("Redacted must not modify the original")
+	}
+}
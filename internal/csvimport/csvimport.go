@@ -0,0 +1,240 @@
+// Package csvimport reads transfer files in the CSV dialect described by a
+// company's import profile: delimiter, header row, which columns hold the
+// source, target and amount and, optionally, the reference, memo and value
+// date, the number format and the text encoding.
+package csvimport
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/token-cjg/minibank/internal/model"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// Header modes.
+const (
+	HeaderAuto    = "auto"    // a first row whose source column is not a number is a header
+	HeaderPresent = "present" // the first row is always a header
+	HeaderAbsent  = "absent"  // every row is data
+)
+
+// encodings maps the supported profile encodings to their decoders.
+var encodings = map[string]encoding.Encoding{
+	"utf-8":        unicode.UTF8,
+	"utf-16le":     unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	"utf-16be":     unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	"iso-8859-1":   charmap.ISO8859_1,
+	"windows-1252": charmap.Windows1252,
+}
+
+// Encodings lists the encoding names a profile may use.
+func Encodings() []string {
+	return []string{"utf-8", "utf-16le", "utf-16be", "iso-8859-1", "windows-1252"}
+}
+
+// DecimalSeparators and ThousandsSeparators list the allowed number formats.
+var (
+	DecimalSeparators   = []string{".", ","}
+	ThousandsSeparators = []string{"", ",", ".", " ", "'"}
+)
+
+// DefaultProfile fills in the settings a saved profile leaves empty.
+func DefaultProfile() model.ImportProfile {
+	return model.ImportProfile{
+		Delimiter:        ",",
+		Header:           HeaderAuto,
+		SourceColumn:     "1",
+		TargetColumn:     "2",
+		AmountColumn:     "3",
+		DecimalSeparator: ".",
+		Encoding:         "utf-8",
+	}
+}
+
+// Position returns the 0-based column index for a column reference that is a
+// 1-based position such as "2", or false if ref is a header name.
+func Position(ref string) (int, bool) {
+	n, err := strconv.Atoi(ref)
+	if err != nil || n < 1 {
+		return 0, false
+	}
+	return n - 1, true
+}
+
+// Row is one data row of a transfer file.
+type Row struct {
+	Num    int // 1-based data row, not counting the header
+	Line   int // line in the file where the row starts
+	Source string
+	Target string
+	Amount string // normalised to a plain decimal with "." as separator
+
+	// The optional details, empty unless the profile maps their columns
+	// and the row fills them in.
+	Reference string
+	Memo      string
+	ValueDate string
+}
+
+// required is how many of a Reader's columns every row must have: source,
+// target and amount. The rest are the optional details.
+const required = 3
+
+// Reader reads Rows.
+type Reader struct {
+	csv     *csv.Reader
+	profile *model.ImportProfile
+	// source, target, amount, reference, memo and value date; -1 until the
+	// header is read, and for ever for a detail the profile does not map
+	cols    [6]int
+	started bool
+	rows    int
+}
+
+// NewReader reads r in the dialect of p. A nil profile is the original
+// format: exactly three comma-separated columns and no header.
+func NewReader(r io.Reader, p *model.ImportProfile) (*Reader, error) {
+	if p == nil {
+		cr := csv.NewReader(transform.NewReader(r, unicode.BOMOverride(transform.Nop)))
+		cr.FieldsPerRecord = 3
+		return &Reader{csv: cr, cols: [6]int{0, 1, 2, -1, -1, -1}}, nil
+	}
+
+	enc, ok := encodings[p.Encoding]
+	if !ok {
+		return nil, fmt.Errorf("unsupported encoding %q", p.Encoding)
+	}
+	// a byte order mark, if present, overrides the profile's encoding
+	r = transform.NewReader(r, unicode.BOMOverride(enc.NewDecoder()))
+
+	cr := csv.NewReader(r)
+	cr.Comma, _ = utf8.DecodeRuneInString(p.Delimiter)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	rd := &Reader{csv: cr, profile: p, cols: [6]int{-1, -1, -1, -1, -1, -1}}
+	for i, ref := range rd.refs() {
+		if n, ok := Position(ref); ok {
+			rd.cols[i] = n
+		}
+	}
+	return rd, nil
+}
+
+func (r *Reader) refs() [6]string {
+	return [6]string{r.profile.SourceColumn, r.profile.TargetColumn, r.profile.AmountColumn,
+		r.profile.ReferenceColumn, r.profile.MemoColumn, r.profile.ValueDateColumn}
+}
+
+// Read returns the next data row, or io.EOF. Errors are *csv.ParseError
+// or *RowError and name the line.
+func (r *Reader) Read() (Row, error) {
+	rec, err := r.csv.Read()
+	if err != nil {
+		return Row{}, err
+	}
+	line, _ := r.csv.FieldPos(0)
+
+	if !r.started {
+		r.started = true
+		if r.profile != nil && r.isHeader(rec) {
+			if err := r.mapHeader(rec, line); err != nil {
+				return Row{}, err
+			}
+			return r.Read()
+		}
+		if r.profile != nil {
+			for i, ref := range r.refs() {
+				if r.cols[i] < 0 && ref != "" {
+					return Row{}, &RowError{Line: line, Msg: fmt.Sprintf("column %q needs a header row", ref)}
+				}
+			}
+		}
+	}
+
+	r.rows++
+	row := Row{Num: r.rows, Line: line}
+	fields := [6]*string{&row.Source, &row.Target, &row.Amount, &row.Reference, &row.Memo, &row.ValueDate}
+	for i, c := range r.cols {
+		switch {
+		case c < 0:
+			// a detail the profile does not map
+		case c < len(rec):
+			*fields[i] = strings.TrimSpace(rec[c])
+		case i < required:
+			return row, &RowError{Line: line, Msg: fmt.Sprintf("has %d fields, column %d is missing", len(rec), c+1)}
+		default:
+			// a row may stop short of its details, as spreadsheets drop
+			// trailing empty cells
+		}
+	}
+	if r.profile != nil {
+		row.Amount = r.normaliseAmount(row.Amount)
+	}
+	return row, nil
+}
+
+func (r *Reader) isHeader(rec []string) bool {
+	switch r.profile.Header {
+	case HeaderPresent:
+		return true
+	case HeaderAbsent:
+		return false
+	}
+	if r.cols[0] < 0 {
+		return true // columns named, so there must be a header
+	}
+	if r.cols[0] >= len(rec) {
+		return false
+	}
+	_, err := strconv.ParseInt(strings.TrimSpace(rec[r.cols[0]]), 10, 64)
+	return err != nil
+}
+
+func (r *Reader) mapHeader(rec []string, line int) error {
+	for i, ref := range r.refs() {
+		if _, ok := Position(ref); ok || ref == "" {
+			continue
+		}
+		r.cols[i] = -1
+		for j, name := range rec {
+			if strings.EqualFold(strings.TrimSpace(name), ref) {
+				r.cols[i] = j
+				break
+			}
+		}
+		if r.cols[i] < 0 {
+			return &RowError{Line: line, Msg: fmt.Sprintf("header has no column %q", ref)}
+		}
+	}
+	return nil
+}
+
+// normaliseAmount turns "1.234,50" into "1234.50" for a profile with "."
+// thousands and "," decimals. Anything unexpected is left for amount
+// validation to reject.
+func (r *Reader) normaliseAmount(s string) string {
+	if t := r.profile.ThousandsSeparator; t != "" {
+		s = strings.ReplaceAll(s, t, "")
+	}
+	if d := r.profile.DecimalSeparator; d != "." {
+		s = strings.Replace(s, d, ".", 1)
+	}
+	return s
+}
+
+// RowError is a row that does not fit the profile.
+type RowError struct {
+	Line int
+	Msg  string
+}
+
+func (e *RowError) Error() string { return fmt.Sprintf("line %d: %s", e.Line, e.Msg) }
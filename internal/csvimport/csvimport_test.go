@@ -0,0 +1,177 @@
+package csvimport_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/token-cjg/minibank/internal/csvimport"
+	"github.com/token-cjg/minibank/internal/model"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func readAll(t *testing.T, in io.Reader, p *model.ImportProfile) ([]csvimport.Row, error) {
+	t.Helper()
+	rd, err := csvimport.NewReader(in, p)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	var rows []csvimport.Row
+	for {
+		row, err := rd.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return rows, err
+		}
+		rows = append(rows, row)
+	}
+}
+
+func profile(edit func(*model.ImportProfile)) *model.ImportProfile {
+	p := csvimport.DefaultProfile()
+	edit(&p)
+	return &p
+}
+
+func TestRead_NoProfile(t *testing.T) {
+	rows, err := readAll(t, strings.NewReader("\ufeff1,2,10.50\n3,4,1\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []csvimport.Row{
+		{Num: 1, Line: 1, Source: "1", Target: "2", Amount: "10.50"},
+		{Num: 2, Line: 2, Source: "3", Target: "4", Amount: "1"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("rows %+v, want %+v", rows, want)
+	}
+}
+
+func TestRead_NoProfileWrongFieldCount(t *testing.T) {
+	_, err := readAll(t, strings.NewReader("1,2,3,4\n"), nil)
+	var perr *csv.ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("err %v, want *csv.ParseError", err)
+	}
+}
+
+func TestRead_NamedColumnsEuropeanNumbers(t *testing.T) {
+	p := profile(func(p *model.ImportProfile) {
+		p.Delimiter = ";"
+		p.SourceColumn, p.TargetColumn, p.AmountColumn = "From", "to", "Amount"
+		p.DecimalSeparator, p.ThousandsSeparator = ",", "."
+	})
+	in := "Date;Amount;To;From;Memo\n2024-01-02;1.234,50;2;1;rent\n2024-01-03; 7,5 ;4;3;\n"
+	rows, err := readAll(t, strings.NewReader(in), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []csvimport.Row{
+		{Num: 1, Line: 2, Source: "1", Target: "2", Amount: "1234.50"},
+		{Num: 2, Line: 3, Source: "3", Target: "4", Amount: "7.5"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("rows %+v, want %+v", rows, want)
+	}
+}
+
+func TestRead_Details(t *testing.T) {
+	p := profile(func(p *model.ImportProfile) {
+		p.ReferenceColumn, p.MemoColumn, p.ValueDateColumn = "Ref", "5", "Value date"
+	})
+	in := "source,target,amount,value date,text,ref\n1,2,10,2024-03-01,March rent,INV-1\n3,4,5,2024-03-02\n"
+	rows, err := readAll(t, strings.NewReader(in), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []csvimport.Row{
+		{Num: 1, Line: 2, Source: "1", Target: "2", Amount: "10",
+			Reference: "INV-1", Memo: "March rent", ValueDate: "2024-03-01"},
+		// the short row leaves its trailing details empty
+		{Num: 2, Line: 3, Source: "3", Target: "4", Amount: "5", ValueDate: "2024-03-02"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("rows %+v, want %+v", rows, want)
+	}
+}
+
+func TestRead_HeaderDetection(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		in     string
+		rows   int
+	}{
+		{csvimport.HeaderAuto, "source,target,amount\n1,2,3\n", 1},
+		{csvimport.HeaderAuto, "1,2,3\n4,5,6\n", 2},
+		{csvimport.HeaderPresent, "1,2,3\n4,5,6\n", 1},
+		{csvimport.HeaderAbsent, "1,2,3\n4,5,6\n", 2},
+	} {
+		p := profile(func(p *model.ImportProfile) { p.Header = tc.header })
+		rows, err := readAll(t, strings.NewReader(tc.in), p)
+		if err != nil {
+			t.Fatalf("%s %q: %v", tc.header, tc.in, err)
+		}
+		if len(rows) != tc.rows {
+			t.Errorf("%s %q: %d rows, want %d", tc.header, tc.in, len(rows), tc.rows)
+		}
+	}
+}
+
+func TestRead_MissingHeaderColumn(t *testing.T) {
+	p := profile(func(p *model.ImportProfile) { p.AmountColumn = "Amount" })
+	_, err := readAll(t, strings.NewReader("source,target,value\n1,2,3\n"), p)
+	var rerr *csvimport.RowError
+	if !errors.As(err, &rerr) || rerr.Line != 1 {
+		t.Fatalf("err %v, want RowError on line 1", err)
+	}
+}
+
+func TestRead_ShortRow(t *testing.T) {
+	_, err := readAll(t, strings.NewReader("1,2,3\n4,5\n"), profile(func(*model.ImportProfile) {}))
+	var rerr *csvimport.RowError
+	if !errors.As(err, &rerr) || rerr.Line != 2 {
+		t.Fatalf("err %v, want RowError on line 2", err)
+	}
+}
+
+func TestRead_Encodings(t *testing.T) {
+	const text = "Quelle;Ziel;Betrag€\n1;2;5,00\n"
+	want := []csvimport.Row{{Num: 1, Line: 2, Source: "1", Target: "2", Amount: "5.00"}}
+	p := profile(func(p *model.ImportProfile) {
+		p.Delimiter, p.DecimalSeparator = ";", ","
+		p.SourceColumn, p.TargetColumn, p.AmountColumn = "quelle", "ziel", "betrag€"
+	})
+
+	win, _ := charmap.Windows1252.NewEncoder().String(text)
+	utf16, _ := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().String(text)
+	for _, tc := range []struct {
+		name, encoding, data string
+	}{
+		{"windows-1252", "windows-1252", win},
+		{"utf-8 with BOM", "utf-8", "\ufeff" + text},
+		{"utf-16 BOM overrides profile", "utf-8", utf16},
+	} {
+		p.Encoding = tc.encoding
+		rows, err := readAll(t, bytes.NewBufferString(tc.data), p)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(rows, want) {
+			t.Errorf("%s: rows %+v, want %+v", tc.name, rows, want)
+		}
+	}
+}
+
+func TestNewReader_UnknownEncoding(t *testing.T) {
+	p := profile(func(p *model.ImportProfile) { p.Encoding = "ebcdic" })
+	if _, err := csvimport.NewReader(strings.NewReader(""), p); err == nil {
+		t.Fatal("want error")
+	}
+}
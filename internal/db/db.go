@@ -1,6 +1,7 @@
 // Package db provides a database connection for the application.
 // It uses the pgx driver for PostgreSQL and sets up connection pooling.
 // The connection pool settings are configured to optimize performance.
+// Statements are traced with OpenTelemetry.
 package db
 
 import (
@@ -9,22 +10,47 @@ import (
 	"os"
 	"time"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/jackc/pgx/v5/stdlib"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
+// Pool holds the connection pool settings applied by Open.
+type Pool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxIdleTime time.Duration
+}
+
+// DefaultPool is used by New.
+var DefaultPool = Pool{MaxOpenConns: 15, MaxIdleConns: 5, ConnMaxIdleTime: 10 * time.Minute}
+
+// New connects to DATABASE_URL with DefaultPool.
 func New() (*sql.DB, error) {
 	dsn := os.Getenv("DATABASE_URL")
 	if dsn == "" {
 		return nil, fmt.Errorf("DATABASE_URL not set")
 	}
-	db, err := sql.Open("pgx", dsn)
+	return Open(dsn, DefaultPool)
+}
+
+// Open connects to dsn, applies the pool settings and pings the database.
+func Open(dsn string, pool Pool) (*sql.DB, error) {
+	// otelsql emits a span per statement, begin and commit under whatever
+	// span is in the query context; without a tracer provider it is a no-op.
+	db, err := otelsql.Open("pgx", dsn,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+			OmitRows:             true,
+		}))
 	if err != nil {
 		return nil, err
 	}
-	// Set connection pool settings
-	db.SetMaxOpenConns(15)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxIdleTime(10 * time.Minute)
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
 
 	return db, db.Ping()
 }
@@ -0,0 +1,232 @@
+// Package export writes statement files: camt.053, camt.052 or PDF
+// statements per account, or MT940 or BAI2 files per company, for the
+// commands that schedule them.
+package export
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/token-cjg/minibank/internal/bai2"
+	"github.com/token-cjg/minibank/internal/iso20022"
+	"github.com/token-cjg/minibank/internal/model"
+	"github.com/token-cjg/minibank/internal/mt940"
+	"github.com/token-cjg/minibank/internal/pdf"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+// Statement file formats.
+const (
+	FormatCamt053 = "camt.053"
+	FormatCamt052 = "camt.052"
+	FormatMT940   = "mt940"
+	FormatBAI2    = "bai2"
+	FormatPDF     = "pdf"
+)
+
+// bankID identifies minibank as the sender of BAI2 files.
+const bankID = "MINIBANK"
+
+// Job is one run of the exporter: the statements of a company's accounts
+// for a UTC day, or a month for PDF, written to Dir.
+type Job struct {
+	Company int64
+	Account int64     // 0 for every account of the company
+	Day     time.Time // the first day of the month for PDF; set by SetDay
+	Format  string
+	Dir     string
+	Now     time.Time
+}
+
+// Exec sets j's day from date, as SetDay does, writes its files from the
+// database at DATABASE_URL and logs how many it wrote.
+func Exec(ctx context.Context, j Job, date string) error {
+	if err := j.SetDay(date); err != nil {
+		return err
+	}
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		return errors.New("DATABASE_URL env var not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return fmt.Errorf("open db: %w", err)
+	}
+	defer db.Close()
+
+	files, err := j.Run(ctx, repo.New(db))
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "✅  statement export completed", "format", j.Format, "files", len(files))
+	return nil
+}
+
+// SetDay validates the job and sets the day it reports from date, which
+// may be empty for the default. Only camt.052 reports a day in progress.
+// PDF statements cover a month that has ended, given as YYYY-MM.
+func (j *Job) SetDay(date string) error {
+	if j.Company <= 0 {
+		return errors.New("-company is required")
+	}
+	switch j.Format {
+	case FormatCamt053, FormatCamt052, FormatMT940, FormatBAI2:
+	case FormatPDF:
+		return j.setMonth(date)
+	default:
+		return fmt.Errorf("-format must be camt.053, camt.052, mt940, bai2 or pdf, not %q", j.Format)
+	}
+	today := j.Now.Truncate(24 * time.Hour)
+	switch {
+	case date != "":
+		d, err := time.Parse(time.DateOnly, date)
+		if err != nil {
+			return fmt.Errorf("-date: %w", err)
+		}
+		j.Day = d
+	case j.Format == FormatCamt052:
+		j.Day = today
+	default:
+		j.Day = today.AddDate(0, 0, -1)
+	}
+	if j.Day.After(today) {
+		return errors.New("-date is in the future")
+	}
+	if j.Format != FormatCamt052 && !j.Day.Before(today) {
+		return fmt.Errorf("%s covers a day that has ended; camt.052 reports today", j.Format)
+	}
+	return nil
+}
+
+func (j *Job) setMonth(date string) error {
+	month := time.Date(j.Now.Year(), j.Now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if date == "" {
+		j.Day = month.AddDate(0, -1, 0)
+		return nil
+	}
+	d, err := time.Parse("2006-01", date)
+	if err != nil {
+		return fmt.Errorf("-date: %w", err)
+	}
+	if !d.Before(month) {
+		return errors.New("pdf covers a month that has ended")
+	}
+	j.Day = d
+	return nil
+}
+
+// end is the end of the period the job reports: the end of its day, or of
+// its month for PDF.
+func (j Job) end() time.Time {
+	if j.Format == FormatPDF {
+		return j.Day.AddDate(0, 1, 0)
+	}
+	return j.Day.AddDate(0, 0, 1)
+}
+
+// Run writes the statements and returns the paths of the files written.
+// camt files hold one account each and are named after the account number,
+// the day and the message, and PDF files after the account number and the
+// month; MT940 and BAI2 files hold every account and
+// are named after the company and the day.
+func (j Job) Run(ctx context.Context, rep *repo.Repo) ([]string, error) {
+	sts, err := j.statements(ctx, rep)
+	if err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%d-%s", j.Company, j.Day.Format("20060102"))
+	switch j.Format {
+	case FormatMT940:
+		return j.write(nil, name+".mt940", mt940.Encode(sts))
+	case FormatBAI2:
+		h := bai2.Header{
+			Sender:   bankID,
+			Receiver: strconv.FormatInt(j.Company, 10),
+			Created:  j.Now,
+			FileID:   mt940.Number(j.Day),
+			AsOf:     j.Day,
+		}
+		return j.write(nil, name+".bai", bai2.Encode(h, sts))
+	}
+
+	render := iso20022.Camt053
+	switch j.Format {
+	case FormatCamt052:
+		render = iso20022.Camt052
+	case FormatPDF:
+		render = renderPDF
+	}
+	var files []string
+	for _, st := range sts {
+		out, err := render(st, j.Now)
+		if err != nil {
+			return files, fmt.Errorf("account %d: %w", st.Account.ID, err)
+		}
+		name := fmt.Sprintf("%s-%s.%s.xml", st.Account.Number, j.Day.Format("20060102"), j.Format)
+		if j.Format == FormatPDF {
+			name = fmt.Sprintf("%s-%s.pdf", st.Account.Number, j.Day.Format("200601"))
+		}
+		files, err = j.write(files, name, out)
+		if err != nil {
+			return files, err
+		}
+	}
+	return files, nil
+}
+
+func renderPDF(st model.Statement, created time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	err := pdf.Statement(&buf, st, created)
+	return buf.Bytes(), err
+}
+
+// statements loads the period's statement of each account the job covers.
+func (j Job) statements(ctx context.Context, rep *repo.Repo) ([]model.Statement, error) {
+	var accounts []model.Account
+	if j.Account != 0 {
+		a, err := rep.GetCompanyAccount(ctx, j.Company, j.Account)
+		if err != nil {
+			return nil, fmt.Errorf("account %d: %w", j.Account, err)
+		}
+		accounts = []model.Account{a}
+	} else {
+		var err error
+		if accounts, err = rep.ListAccountsByCompany(ctx, j.Company); err != nil {
+			return nil, fmt.Errorf("list accounts: %w", err)
+		}
+	}
+
+	from, to := j.Day, j.end()
+	if to.After(j.Now) {
+		to = j.Now
+	}
+	sts := make([]model.Statement, 0, len(accounts))
+	for _, a := range accounts {
+		st, err := rep.Statement(ctx, j.Company, a.ID, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("account %d: %w", a.ID, err)
+		}
+		sts = append(sts, st)
+	}
+	return sts, nil
+}
+
+// write writes data to the file name in the job's directory and appends
+// its path to files.
+func (j Job) write(files []string, name string, data []byte) ([]string, error) {
+	path := filepath.Join(j.Dir, name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return files, err
+	}
+	slog.Info("wrote statement file", "path", path)
+	return append(files, path), nil
+}
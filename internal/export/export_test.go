@@ -0,0 +1,163 @@
+package export_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/token-cjg/minibank/internal/export"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+var now = time.Date(2024, 3, 2, 1, 0, 0, 0, time.UTC)
+
+func TestSetDay(t *testing.T) {
+	for _, tc := range []struct {
+		format, date, want, err string
+	}{
+		{format: export.FormatCamt053, want: "2024-03-01"},
+		{format: export.FormatCamt052, want: "2024-03-02"},
+		{format: export.FormatMT940, want: "2024-03-01"},
+		{format: export.FormatCamt053, date: "2024-02-15", want: "2024-02-15"},
+		{format: export.FormatCamt053, date: "2024-03-02", err: "has ended"},
+		{format: export.FormatBAI2, date: "2024-03-02", err: "has ended"},
+		{format: export.FormatCamt052, date: "2024-03-03", err: "future"},
+		{format: "camt.054", err: "-format"},
+		{format: export.FormatCamt053, date: "1/3/2024", err: "-date"},
+		{format: export.FormatPDF, want: "2024-02-01"},
+		{format: export.FormatPDF, date: "2023-12", want: "2023-12-01"},
+		{format: export.FormatPDF, date: "2024-03", err: "has ended"},
+		{format: export.FormatPDF, date: "2024-02-01", err: "-date"},
+	} {
+		j := export.Job{Company: 1, Format: tc.format, Now: now}
+		err := j.SetDay(tc.date)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%+v: want error containing %q, got %v", tc, tc.err, err)
+			}
+			continue
+		}
+		if err != nil || j.Day.Format(time.DateOnly) != tc.want {
+			t.Errorf("%+v: day %v, err %v", tc, j.Day, err)
+		}
+	}
+
+	if err := (&export.Job{Format: export.FormatCamt053, Now: now}).SetDay(""); err == nil {
+		t.Error("want an error without -company")
+	}
+}
+
+// expectStatements expects the accounts of company 1 to be listed and the
+// statement of each loaded, with no activity from 2024-03-01 to end.
+func expectStatements(t *testing.T, end time.Time) *sql.DB {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+		db.Close()
+	})
+
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT account_id, company_id, account_number, account_balance FROM account WHERE company_id=\$1`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"account_id", "company_id", "account_number", "account_balance"}).
+			AddRow(10, 1, "1000000000000000", 900.0).
+			AddRow(11, 1, "1000000000000001", 100.0))
+	for _, acct := range []struct {
+		id     int64
+		number string
+	}{{10, "1000000000000000"}, {11, "1000000000000001"}} {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT a.account_id`).
+			WithArgs(int64(1), acct.id, day, end).
+			WillReturnRows(sqlmock.NewRows([]string{"account_id", "company_id", "account_number",
+				"account_balance", "company_name", "opening", "closing"}).
+				AddRow(acct.id, 1, acct.number, 0.0, "Acme", 0.0, 0.0))
+		mock.ExpectQuery(`SELECT e.tx_id`).
+			WillReturnRows(sqlmock.NewRows([]string{"tx_id", "created_at", "amount", "account_number",
+				"reference", "memo", "value_date"}))
+		mock.ExpectCommit()
+	}
+	return db
+}
+
+// TestRun_Camt checks that every account of the company gets its own
+// statement file.
+func TestRun_Camt(t *testing.T) {
+	db := expectStatements(t, time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC))
+	dir := t.TempDir()
+	j := export.Job{Company: 1, Day: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), Format: export.FormatCamt053, Dir: dir, Now: now}
+	files, err := j.Run(context.Background(), repo.New(db))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := []string{
+		filepath.Join(dir, "1000000000000000-20240301.camt.053.xml"),
+		filepath.Join(dir, "1000000000000001-20240301.camt.053.xml"),
+	}
+	if strings.Join(files, ",") != strings.Join(want, ",") {
+		t.Fatalf("files %v, want %v", files, want)
+	}
+	data, err := os.ReadFile(files[1])
+	if err != nil || !strings.Contains(string(data), "<Id>1000000000000001-20240301</Id>") {
+		t.Errorf("statement %s: %v", data, err)
+	}
+}
+
+// TestRun_DailyFiles checks that MT940 and BAI2 put every account of the
+// company in one file.
+func TestRun_DailyFiles(t *testing.T) {
+	for format, want := range map[string]struct{ name, first, second string }{
+		export.FormatMT940: {"1-20240301.mt940", ":25:1000000000000000", ":25:1000000000000001"},
+		export.FormatBAI2:  {"1-20240301.bai", "03,1000000000000000,AUD", "03,1000000000000001,AUD"},
+	} {
+		db := expectStatements(t, time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC))
+		dir := t.TempDir()
+		j := export.Job{Company: 1, Day: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), Format: format, Dir: dir, Now: now}
+		files, err := j.Run(context.Background(), repo.New(db))
+		if err != nil {
+			t.Fatalf("%s: Run: %v", format, err)
+		}
+		if len(files) != 1 || files[0] != filepath.Join(dir, want.name) {
+			t.Fatalf("%s: files %v, want %s", format, files, want.name)
+		}
+		data, _ := os.ReadFile(files[0])
+		if !strings.Contains(string(data), want.first) || !strings.Contains(string(data), want.second) {
+			t.Errorf("%s: file lacks an account:\n%s", format, data)
+		}
+	}
+}
+
+// TestRun_PDF checks that every account of the company gets a PDF of its
+// month.
+func TestRun_PDF(t *testing.T) {
+	db := expectStatements(t, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC))
+	dir := t.TempDir()
+	j := export.Job{Company: 1, Day: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), Format: export.FormatPDF, Dir: dir,
+		Now: time.Date(2024, 4, 1, 2, 0, 0, 0, time.UTC)}
+	files, err := j.Run(context.Background(), repo.New(db))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := []string{
+		filepath.Join(dir, "1000000000000000-202403.pdf"),
+		filepath.Join(dir, "1000000000000001-202403.pdf"),
+	}
+	if strings.Join(files, ",") != strings.Join(want, ",") {
+		t.Fatalf("files %v, want %v", files, want)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil || !strings.HasPrefix(string(data), "%PDF-") {
+		t.Errorf("statement is not a PDF: %v", err)
+	}
+}
@@ -0,0 +1,478 @@
+package graphqlapi
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// connections are the fields returning a page of nodes. Their names are
+// unique in the schema, so the cost walk needs no type information.
+var connections = map[string]bool{"companies": true, "accounts": true, "transactions": true}
+
+// maxCost caps the arithmetic in cost; it is far above any sane limit.
+const maxCost = math.MaxInt32
+
+// complexity estimates what running the operation named op (the only one
+// if op is empty) in query would cost: one for each field it may resolve,
+// the fields under a connection counting once for each node the
+// connection may return, that is its first argument or the default page
+// size. query must have passed validation; variables are the request's.
+func complexity(query, op string, variables map[string]any) (int, error) {
+	d, err := parseDocument(query)
+	if err != nil {
+		return 0, err
+	}
+	var chosen *operation
+	for i := range d.operations {
+		if o := &d.operations[i]; o.name == op || op == "" {
+			chosen = o
+			break
+		}
+	}
+	if chosen == nil {
+		return 0, fmt.Errorf("no operation %q", op)
+	}
+	w := walker{doc: d, op: chosen, vars: variables, fragments: map[string]int{}}
+	return w.cost(chosen.selections), nil
+}
+
+type document struct {
+	operations []operation
+	fragments  map[string][]selection
+}
+
+type operation struct {
+	name       string
+	defaults   map[string]int // Int variables' default values
+	selections []selection
+}
+
+// selection is a field, with its first argument if any, or a fragment
+// spread; inline fragments are flattened into their parent.
+type selection struct {
+	field      string
+	first      *int   // a literal first
+	firstVar   string // a first given by a variable
+	spread     string
+	selections []selection
+}
+
+type walker struct {
+	doc       *document
+	op        *operation
+	vars      map[string]any
+	fragments map[string]int // fragment costs, -1 while being walked
+}
+
+func (w *walker) cost(sels []selection) int {
+	total := 0
+	for _, s := range sels {
+		if s.spread != "" {
+			total = add(total, w.fragment(s.spread))
+			continue
+		}
+		children := w.cost(s.selections)
+		if connections[s.field] {
+			children = mul(children, w.pageSize(s))
+		}
+		total = add(total, add(1, children))
+	}
+	return total
+}
+
+// fragment costs a named fragment once however often it is spread.
+// Validation rejects unknown and cyclic fragments, which cost nothing here.
+func (w *walker) fragment(name string) int {
+	if c, ok := w.fragments[name]; ok {
+		return max(c, 0)
+	}
+	w.fragments[name] = -1
+	c := w.cost(w.doc.fragments[name])
+	w.fragments[name] = c
+	return c
+}
+
+// pageSize is what the connection's resolver makes of its first argument.
+func (w *walker) pageSize(s selection) int {
+	n := DefaultPageSize
+	switch {
+	case s.first != nil:
+		n = *s.first
+	case s.firstVar != "":
+		switch v := w.vars[s.firstVar].(type) {
+		case float64:
+			n = int(min(max(v, 0), MaxPageSize))
+		case int:
+			n = v
+		case int32:
+			n = int(v)
+		case nil:
+			if d, ok := w.op.defaults[s.firstVar]; ok {
+				n = d
+			}
+		}
+	}
+	return min(max(n, 0), MaxPageSize)
+}
+
+func add(a, b int) int { return min(a+b, maxCost) }
+
+func mul(a, b int) int {
+	if b != 0 && a > maxCost/b {
+		return maxCost
+	}
+	return a * b
+}
+
+// parseDocument parses the parts of a GraphQL executable document that
+// bear on its cost, skipping directives, types and other arguments.
+func parseDocument(src string) (*document, error) {
+	p := &parser{lex: lexer{src: src}}
+	p.next()
+	d := &document{fragments: map[string][]selection{}}
+	for p.tok.kind != tokEOF {
+		switch {
+		case p.is(tokPunct, "{"):
+			d.operations = append(d.operations, operation{selections: p.selectionSet()})
+		case p.is(tokName, "query"), p.is(tokName, "mutation"), p.is(tokName, "subscription"):
+			p.next()
+			op := operation{defaults: map[string]int{}}
+			if p.tok.kind == tokName {
+				op.name = p.name()
+			}
+			if p.is(tokPunct, "(") {
+				p.variableDefinitions(op.defaults)
+			}
+			p.directives()
+			op.selections = p.selectionSet()
+			d.operations = append(d.operations, op)
+		case p.is(tokName, "fragment"):
+			p.next()
+			name := p.name()
+			p.expect(tokName, "on")
+			p.name()
+			p.directives()
+			d.fragments[name] = p.selectionSet()
+		default:
+			p.fail()
+		}
+		if p.err != nil {
+			return nil, p.err
+		}
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return d, nil
+}
+
+type parser struct {
+	lex lexer
+	tok token
+	err error
+}
+
+func (p *parser) next() {
+	if p.err != nil {
+		p.tok = token{kind: tokEOF}
+		return
+	}
+	p.tok, p.err = p.lex.next()
+}
+
+func (p *parser) is(kind tokenKind, text string) bool {
+	return p.tok.kind == kind && p.tok.text == text
+}
+
+func (p *parser) fail() {
+	if p.err == nil {
+		p.err = fmt.Errorf("unexpected %q at offset %d", p.tok.text, p.tok.pos)
+	}
+	p.tok = token{kind: tokEOF}
+}
+
+func (p *parser) expect(kind tokenKind, text string) {
+	if !p.is(kind, text) {
+		p.fail()
+		return
+	}
+	p.next()
+}
+
+func (p *parser) name() string {
+	if p.tok.kind != tokName {
+		p.fail()
+		return ""
+	}
+	name := p.tok.text
+	p.next()
+	return name
+}
+
+// variableDefinitions records the default values of Int variables.
+func (p *parser) variableDefinitions(defaults map[string]int) {
+	p.expect(tokPunct, "(")
+	for p.err == nil && !p.is(tokPunct, ")") {
+		p.expect(tokPunct, "$")
+		name := p.name()
+		p.expect(tokPunct, ":")
+		p.typeRef()
+		if p.is(tokPunct, "=") {
+			p.next()
+			if n, ok := p.value(); ok {
+				defaults[name] = n
+			}
+		}
+		p.directives()
+	}
+	p.expect(tokPunct, ")")
+}
+
+func (p *parser) typeRef() {
+	if p.is(tokPunct, "[") {
+		p.next()
+		p.typeRef()
+		p.expect(tokPunct, "]")
+	} else {
+		p.name()
+	}
+	if p.is(tokPunct, "!") {
+		p.next()
+	}
+}
+
+func (p *parser) directives() {
+	for p.err == nil && p.is(tokPunct, "@") {
+		p.next()
+		p.name()
+		if p.is(tokPunct, "(") {
+			p.arguments(nil)
+		}
+	}
+}
+
+// arguments parses an argument list, recording first in s if s is not nil.
+func (p *parser) arguments(s *selection) {
+	p.expect(tokPunct, "(")
+	for p.err == nil && !p.is(tokPunct, ")") {
+		name := p.name()
+		p.expect(tokPunct, ":")
+		if s != nil && name == "first" && p.is(tokPunct, "$") {
+			p.next()
+			s.firstVar = p.name()
+			continue
+		}
+		if n, ok := p.value(); ok && s != nil && name == "first" {
+			s.first = &n
+		}
+	}
+	p.expect(tokPunct, ")")
+}
+
+// value parses a value, returning it if it is an Int literal.
+func (p *parser) value() (int, bool) {
+	switch {
+	case p.is(tokPunct, "$"):
+		p.next()
+		p.name()
+	case p.is(tokPunct, "["):
+		p.next()
+		for p.err == nil && !p.is(tokPunct, "]") {
+			p.value()
+		}
+		p.expect(tokPunct, "]")
+	case p.is(tokPunct, "{"):
+		p.next()
+		for p.err == nil && !p.is(tokPunct, "}") {
+			p.name()
+			p.expect(tokPunct, ":")
+			p.value()
+		}
+		p.expect(tokPunct, "}")
+	case p.tok.kind == tokInt:
+		n, err := strconv.Atoi(p.tok.text)
+		if err != nil {
+			n = maxCost // out of range; validation rejects it as an Int
+		}
+		p.next()
+		return n, true
+	case p.tok.kind == tokFloat, p.tok.kind == tokString, p.tok.kind == tokName:
+		p.next()
+	default:
+		p.fail()
+	}
+	return 0, false
+}
+
+func (p *parser) selectionSet() []selection {
+	p.expect(tokPunct, "{")
+	var sels []selection
+	for p.err == nil && !p.is(tokPunct, "}") {
+		if p.is(tokPunct, "...") {
+			p.next()
+			switch {
+			case p.is(tokName, "on"):
+				p.next()
+				p.name()
+				p.directives()
+				sels = append(sels, p.selectionSet()...)
+			case p.is(tokPunct, "@"), p.is(tokPunct, "{"):
+				p.directives()
+				sels = append(sels, p.selectionSet()...)
+			default:
+				sels = append(sels, selection{spread: p.name()})
+				p.directives()
+			}
+			continue
+		}
+		s := selection{field: p.name()}
+		if p.is(tokPunct, ":") { // the name was an alias
+			p.next()
+			s.field = p.name()
+		}
+		if p.is(tokPunct, "(") {
+			p.arguments(&s)
+		}
+		p.directives()
+		if p.is(tokPunct, "{") {
+			s.selections = p.selectionSet()
+		}
+		sels = append(sels, s)
+	}
+	p.expect(tokPunct, "}")
+	return sels
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokPunct
+	tokName
+	tokInt
+	tokFloat
+	tokString
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+func (l *lexer) next() (token, error) {
+	l.skipIgnored()
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+	c := l.src[l.pos]
+	switch {
+	case strings.HasPrefix(l.src[l.pos:], "..."):
+		l.pos += 3
+		return token{kind: tokPunct, text: "...", pos: start}, nil
+	case strings.IndexByte("!$&():=@[]{|}", c) >= 0:
+		l.pos++
+		return token{kind: tokPunct, text: string(c), pos: start}, nil
+	case c == '_' || isLetter(c):
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || isLetter(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.pos++
+		}
+		return token{kind: tokName, text: l.src[start:l.pos], pos: start}, nil
+	case c == '-' || isDigit(c):
+		return l.number()
+	case c == '"':
+		return l.string()
+	}
+	return token{}, fmt.Errorf("unexpected character %q at offset %d", c, start)
+}
+
+// skipIgnored skips white space, commas, comments and byte order marks.
+func (l *lexer) skipIgnored() {
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			l.pos++
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' && l.src[l.pos] != '\r' {
+				l.pos++
+			}
+		case strings.HasPrefix(l.src[l.pos:], "\uFEFF"):
+			l.pos += len("\uFEFF")
+		default:
+			return
+		}
+	}
+}
+
+func (l *lexer) number() (token, error) {
+	start, kind := l.pos, tokInt
+	if l.src[l.pos] == '-' {
+		l.pos++
+	}
+	digits := func() {
+		for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+			l.pos++
+		}
+	}
+	digits()
+	if l.pos < len(l.src) && l.src[l.pos] == '.' {
+		kind = tokFloat
+		l.pos++
+		digits()
+	}
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		kind = tokFloat
+		l.pos++
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.pos++
+		}
+		digits()
+	}
+	return token{kind: kind, text: l.src[start:l.pos], pos: start}, nil
+}
+
+// string skips a string or block string; its value does not matter.
+func (l *lexer) string() (token, error) {
+	start := l.pos
+	if strings.HasPrefix(l.src[l.pos:], `"""`) {
+		l.pos += 3
+		for l.pos < len(l.src) {
+			switch {
+			case strings.HasPrefix(l.src[l.pos:], `\"""`):
+				l.pos += 4
+			case strings.HasPrefix(l.src[l.pos:], `"""`):
+				l.pos += 3
+				return token{kind: tokString, pos: start}, nil
+			default:
+				l.pos++
+			}
+		}
+		return token{}, fmt.Errorf("unterminated string at offset %d", start)
+	}
+	l.pos++
+	for l.pos < len(l.src) {
+		switch l.src[l.pos] {
+		case '\\':
+			l.pos += 2
+		case '"':
+			l.pos++
+			return token{kind: tokString, pos: start}, nil
+		case '\n', '\r':
+			return token{}, fmt.Errorf("unterminated string at offset %d", start)
+		default:
+			l.pos++
+		}
+	}
+	return token{}, fmt.Errorf("unterminated string at offset %d", start)
+}
+
+func isLetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+func isDigit(c byte) bool  { return c >= '0' && c <= '9' }
@@ -0,0 +1,66 @@
+package graphqlapi_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/token-cjg/minibank/internal/graphqlapi"
+)
+
+func TestComplexity(t *testing.T) {
+	for _, tc := range []struct {
+		name, query, op string
+		vars            map[string]any
+		want            int
+	}{
+		{"scalar fields", `{ company(id: 1) { id name } }`, "", nil, 3},
+		{"default page size", `{ companies { nodes { id } } }`, "", nil, 1 + 20*2},
+		{"page size capped", `{ companies(first: 5000) { nodes { id } } }`, "", nil, 1 + 100*2},
+		{"nested connections", `{ companies(first: 2) { nodes { accounts(first: 3) { nodes { id } } } } }`,
+			"", nil, 1 + 2*(1+1+3*2)},
+		{"aliases", `{ a: companies(first: 2) { n: nodes { id } } b: companies(first: 1) { pageInfo { hasNextPage } } }`,
+			"", nil, (1 + 2*2) + (1 + 1*2)},
+		{"variable", `query Q($n: Int) { companies(first: $n) { nodes { id } } }`, "", map[string]any{"n": float64(4)}, 1 + 4*2},
+		{"variable default", `query Q($n: Int = 7) { companies(first: $n) { nodes { id } } }`, "", nil, 1 + 7*2},
+		{"fragments", `
+			query { companies(first: 3) { nodes { ...C ... on Company { name } } } }
+			fragment C on Company { id accounts(first: 2) { nodes { id } } }`,
+			"", nil, 1 + 3*(1+1+1+2*2+1)},
+		{"named operation", `query A { companies { nodes { id } } } query B { company(id: "1") { id } }`, "B", nil, 2},
+		{"ignored tokens", "# comment\n{ company(id: \"1\\\" } {\") , @include(if: true) { name } }", "", nil, 2},
+		{"block string", `{ company(id: """a "quoted" }"""), { name } }`, "", nil, 2},
+		{"introspection", `{ __schema { types { name fields { name } } } }`, "", nil, 5},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := graphqlapi.Complexity(tc.query, tc.op, tc.vars)
+			if err != nil || got != tc.want {
+				t.Errorf("Complexity = %d, %v; want %d", got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestComplexity_FragmentsCountedOnce(t *testing.T) {
+	// each fragment spreads the one before twice: expanded, the query has
+	// 2^40 fields, far past the cap
+	var b strings.Builder
+	b.WriteString("{ company(id: 1) { ...F0 } }\nfragment F0 on Company { name }\n")
+	for i := 1; i <= 40; i++ {
+		fmt.Fprintf(&b, "fragment F%d on Company { ...F%d ...F%d }\n", i, i-1, i-1)
+	}
+	b.WriteString("query Big { company(id: 1) { ...F40 } }")
+
+	got, err := graphqlapi.Complexity(b.String(), "Big", nil)
+	if err != nil || got != 1<<31-1 {
+		t.Errorf("Complexity = %d, %v; want the cap", got, err)
+	}
+}
+
+func TestComplexity_Malformed(t *testing.T) {
+	for _, q := range []string{`{ companies { nodes { id }`, `{ company(id: "1) { id } }`, `query ( { }`} {
+		if _, err := graphqlapi.Complexity(q, "", nil); err == nil {
+			t.Errorf("Complexity(%q) succeeded", q)
+		}
+	}
+}
@@ -0,0 +1,4 @@
+package graphqlapi
+
+// Complexity exposes the cost estimate to the external tests.
+var Complexity = complexity
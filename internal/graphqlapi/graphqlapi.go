@@ -0,0 +1,161 @@
+// Package graphqlapi serves a read-only GraphQL API over companies, their
+// accounts and the accounts' transactions, so a client can fetch what one
+// screen needs in a single request. Nested lists are paged connections and
+// are loaded a level at a time: the accounts of every company in a page
+// come from one query, as do the transactions of all those accounts.
+//
+// Queries are refused before they run if they nest deeper than the depth
+// limit or if their estimated cost, roughly the number of fields they may
+// resolve, exceeds the complexity limit.
+package graphqlapi
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/graph-gophers/graphql-go/trace/otel"
+	"github.com/token-cjg/minibank/internal/handler"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+//go:embed schema.graphql
+var schema string
+
+// Query limits unless the server configuration overrides them.
+const (
+	DefaultMaxDepth      = 15
+	DefaultMaxComplexity = 50_000
+)
+
+// maxBodyBytes caps a POSTed request; queries are small.
+const maxBodyBytes = 1 << 20
+
+// Handler serves GraphQL requests: POSTed as JSON, or as GET query
+// parameters.
+type Handler struct {
+	schema        *graphql.Schema
+	maxComplexity int
+}
+
+type options struct {
+	maxDepth      int
+	maxComplexity int
+}
+
+// Option customises the handler built by New.
+type Option func(*options)
+
+// WithMaxDepth overrides how deeply a query may nest fields; 0 means no
+// limit. Introspection queries nest about a dozen deep.
+func WithMaxDepth(n int) Option {
+	return func(o *options) { o.maxDepth = n }
+}
+
+// WithMaxComplexity overrides the highest estimated cost a query may have;
+// 0 means no limit.
+func WithMaxComplexity(n int) Option {
+	return func(o *options) { o.maxComplexity = n }
+}
+
+func New(rep *repo.Repo, opts ...Option) *Handler {
+	o := options{maxDepth: DefaultMaxDepth, maxComplexity: DefaultMaxComplexity}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	s := graphql.MustParseSchema(schema, &resolver{repo: rep},
+		graphql.UseStringDescriptions(),
+		graphql.UseFieldResolvers(),
+		graphql.MaxDepth(o.maxDepth),
+		graphql.Tracer(otel.DefaultTracer()))
+	return &Handler{schema: s, maxComplexity: o.maxComplexity}
+}
+
+type request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req request
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				handler.WriteProblem(w, r, handler.NewProblem(http.StatusBadRequest, handler.CodeBadRequest,
+					"variables must be a JSON object"))
+				return
+			}
+		}
+	} else {
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+		if err := dec.Decode(&req); err != nil {
+			handler.WriteProblem(w, r, handler.NewProblem(http.StatusBadRequest, handler.CodeBadRequest,
+				"body must be a JSON object with a query"))
+			return
+		}
+	}
+	if req.Query == "" {
+		handler.WriteProblem(w, r, handler.NewProblem(http.StatusBadRequest, handler.CodeBadRequest,
+			"query is required"))
+		return
+	}
+
+	resp := &graphql.Response{Errors: h.check(r.Context(), req)}
+	if len(resp.Errors) == 0 {
+		resp = h.schema.Exec(r.Context(), req.Query, req.OperationName, req.Variables)
+		mask(r.Context(), resp.Errors)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// check validates the query, including its depth, and holds its estimated
+// cost to the complexity limit.
+func (h *Handler) check(ctx context.Context, req request) []*gqlerrors.QueryError {
+	if errs := h.schema.ValidateWithVariables(req.Query, req.Variables); len(errs) > 0 {
+		return errs
+	}
+	if h.maxComplexity <= 0 {
+		return nil
+	}
+	cost, err := complexity(req.Query, req.OperationName, req.Variables)
+	if err != nil {
+		// graphql-go accepted what the estimate cannot read: refuse it
+		// rather than run it unchecked
+		slog.ErrorContext(ctx, "graphql complexity", "err", err)
+		return []*gqlerrors.QueryError{{
+			Message:    "cannot estimate the query's complexity",
+			Extensions: map[string]any{"code": handler.CodeInternal},
+		}}
+	}
+	if cost > h.maxComplexity {
+		return []*gqlerrors.QueryError{{
+			Message:    fmt.Sprintf("query complexity %d exceeds the limit of %d", cost, h.maxComplexity),
+			Extensions: map[string]any{"code": handler.CodeBadRequest, "complexity": cost, "maxComplexity": h.maxComplexity},
+		}}
+	}
+	return nil
+}
+
+// mask logs resolver errors other than input errors and replaces their
+// messages, so database text does not reach the client.
+func mask(ctx context.Context, errs []*gqlerrors.QueryError) {
+	for _, e := range errs {
+		var input inputError
+		if e.ResolverError == nil || errors.As(e.ResolverError, &input) {
+			continue
+		}
+		slog.ErrorContext(ctx, "graphql resolver", "path", e.Path, "err", e.ResolverError)
+		e.Message = "internal server error"
+		e.Extensions = map[string]any{"code": handler.CodeInternal}
+	}
+}
@@ -0,0 +1,194 @@
+package graphqlapi_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/token-cjg/minibank/internal/graphqlapi"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+var (
+	companyCols     = []string{"company_id", "company_name"}
+	accountCols     = []string{"account_id", "company_id", "account_number", "account_balance"}
+	transactionCols = []string{"id", "tx_id", "source_account_id", "target_account_id", "transfer_amount", "error",
+		"created_at", "reference", "memo", "value_date"}
+)
+
+type response struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+// post runs query against a handler backed by sqlmock.
+func post(t *testing.T, h http.Handler, query string, variables map[string]any) response {
+	t.Helper()
+	body, _ := json.Marshal(map[string]any{"query": query, "variables": variables})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var resp response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	return resp
+}
+
+func newHandler(t *testing.T, opts ...graphqlapi.Option) (http.Handler, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return graphqlapi.New(repo.New(db), opts...), mock
+}
+
+func TestCompanies_OneQueryPerLevel(t *testing.T) {
+	h, mock := newHandler(t)
+
+	created := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`FROM company WHERE company_id > \$1 ORDER BY company_id LIMIT \$2`).
+		WithArgs(int64(0), 3).
+		WillReturnRows(sqlmock.NewRows(companyCols).AddRow(1, "Acme").AddRow(2, "Globex").AddRow(3, "Initech"))
+	mock.ExpectQuery(`FROM \(VALUES \(\$3::BIGINT\), \(\$4::BIGINT\)\) AS c\(id\)`).
+		WithArgs(int64(0), 2, int64(1), int64(2)).
+		WillReturnRows(sqlmock.NewRows(accountCols).
+			AddRow(10, 1, "1000000000000000", 100.5).
+			AddRow(11, 1, "1000000000000001", 0.0).
+			AddRow(20, 2, "1000000000000002", 7.0))
+	mock.ExpectQuery(`FROM \(VALUES \(\$3::BIGINT\), \(\$4::BIGINT\)\) AS a\(id\)`).
+		WithArgs(int64(math.MaxInt64), 21, int64(10), int64(20)).
+		WillReturnRows(sqlmock.NewRows(transactionCols).
+			AddRow(10, 41, 10, 20, 7.0, nil, created, "INV-1", nil, nil).
+			AddRow(20, 41, 10, 20, 7.0, nil, created, "INV-1", nil, nil))
+
+	resp := post(t, h, `{
+		companies(first: 2) {
+			nodes {
+				name
+				accounts(first: 1) {
+					nodes { number balance transactions { nodes { id amount reference createdAt } } }
+					pageInfo { hasNextPage endCursor }
+				}
+			}
+			pageInfo { hasNextPage endCursor }
+		}
+	}`, nil)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("errors %+v", resp.Errors)
+	}
+	want := `{"companies":{"nodes":[` +
+		`{"name":"Acme","accounts":{"nodes":[{"number":"1000000000000000","balance":"100.50","transactions":{"nodes":[{"id":"41","amount":"7.00","reference":"INV-1","createdAt":"2024-04-01T12:00:00Z"}]}}],"pageInfo":{"hasNextPage":true,"endCursor":"10"}}},` +
+		`{"name":"Globex","accounts":{"nodes":[{"number":"1000000000000002","balance":"7.00","transactions":{"nodes":[{"id":"41","amount":"7.00","reference":"INV-1","createdAt":"2024-04-01T12:00:00Z"}]}}],"pageInfo":{"hasNextPage":false,"endCursor":"20"}}}` +
+		`],"pageInfo":{"hasNextPage":true,"endCursor":"2"}}}`
+	if string(resp.Data) != want {
+		t.Errorf("data\n%s\nwant\n%s", resp.Data, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("db expectations: %v", err)
+	}
+}
+
+func TestCompany_NotFound(t *testing.T) {
+	h, mock := newHandler(t)
+
+	mock.ExpectQuery(`FROM company WHERE company_id=\$1`).
+		WithArgs(int64(9)).
+		WillReturnRows(sqlmock.NewRows(companyCols))
+
+	resp := post(t, h, `query($id: ID!) { company(id: $id) { name } }`, map[string]any{"id": "9"})
+	if len(resp.Errors) > 0 || string(resp.Data) != `{"company":null}` {
+		t.Fatalf("response %s %+v", resp.Data, resp.Errors)
+	}
+}
+
+func TestCompany_AccountsAfterCursor(t *testing.T) {
+	h, mock := newHandler(t)
+
+	mock.ExpectQuery(`FROM company WHERE company_id=\$1`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(companyCols).AddRow(1, "Acme"))
+	mock.ExpectQuery(`AS c\(id\)`).
+		WithArgs(int64(10), 21, int64(1)).
+		WillReturnRows(sqlmock.NewRows(accountCols).AddRow(11, 1, "1000000000000001", 0.0))
+
+	resp := post(t, h, `{ company(id: 1) { accounts(after: "10") { nodes { id } pageInfo { hasNextPage } } } }`, nil)
+	if len(resp.Errors) > 0 || string(resp.Data) != `{"company":{"accounts":{"nodes":[{"id":"11"}],"pageInfo":{"hasNextPage":false}}}}` {
+		t.Fatalf("response %s %+v", resp.Data, resp.Errors)
+	}
+}
+
+func TestCompanies_Errors(t *testing.T) {
+	h, mock := newHandler(t)
+
+	resp := post(t, h, `{ companies(after: "yesterday") { nodes { name } } }`, nil)
+	if len(resp.Errors) != 1 || resp.Errors[0].Message != "bad after cursor" || resp.Errors[0].Extensions["code"] != "bad_request" {
+		t.Errorf("bad cursor errors %+v", resp.Errors)
+	}
+
+	mock.ExpectQuery(`FROM company`).WillReturnError(errors.New("relation company does not exist"))
+	resp = post(t, h, `{ companies { nodes { name } } }`, nil)
+	if len(resp.Errors) != 1 || resp.Errors[0].Message != "internal server error" || resp.Errors[0].Extensions["code"] != "internal_error" {
+		t.Errorf("database errors %+v", resp.Errors)
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	h, _ := newHandler(t, graphqlapi.WithMaxDepth(4))
+
+	resp := post(t, h, `{ companies { nodes { accounts { nodes { number } } } } }`, nil)
+	if len(resp.Errors) == 0 || !strings.Contains(resp.Errors[0].Message, "exceeds max depth 4") {
+		t.Errorf("errors %+v", resp.Errors)
+	}
+}
+
+func TestMaxComplexity(t *testing.T) {
+	h, _ := newHandler(t, graphqlapi.WithMaxComplexity(1000))
+
+	// 1 + 100 * (1 + 1 + 100 * (1 + 1)) = 20201: companies, nodes, accounts, nodes, id
+	resp := post(t, h, `query($n: Int) { companies(first: $n) { nodes { accounts(first: 100) { nodes { id } } } } }`,
+		map[string]any{"n": 100})
+	if len(resp.Errors) != 1 || resp.Errors[0].Message != "query complexity 20201 exceeds the limit of 1000" {
+		t.Errorf("errors %+v", resp.Errors)
+	}
+}
+
+func TestGet(t *testing.T) {
+	h, mock := newHandler(t)
+
+	mock.ExpectQuery(`FROM company WHERE company_id=\$1`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(companyCols).AddRow(1, "Acme"))
+
+	q := url.Values{"query": {`query($id: ID!) { company(id: $id) { name } }`}, "variables": {`{"id":"1"}`}}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/graphql?"+q.Encode(), nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `{"data":{"company":{"name":"Acme"}}}`) {
+		t.Fatalf("%d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestMalformedRequest(t *testing.T) {
+	h, _ := newHandler(t)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query": 42}`)))
+	if rec.Code != http.StatusBadRequest || rec.Header().Get("Content-Type") != "application/problem+json" {
+		t.Fatalf("%d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,278 @@
+package graphqlapi
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/token-cjg/minibank/internal/handler"
+	"github.com/token-cjg/minibank/internal/model"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+// Page sizes for every connection's first argument.
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// inputError is a resolver error caused by the query's arguments, shown to
+// the client as it is. Other resolver errors are logged and masked.
+type inputError string
+
+func (e inputError) Error() string { return string(e) }
+
+func (e inputError) Extensions() map[string]any {
+	return map[string]any{"code": handler.CodeBadRequest}
+}
+
+// pageArgs are a connection's arguments.
+type pageArgs struct {
+	First *int32
+	After *string
+}
+
+// page is a connection's arguments checked: first defaulted and capped,
+// after parsed. It keys a batch's loads, as every parent in a list asks
+// with the same arguments unless the query aliases the field.
+type page struct {
+	first int
+	after int64
+}
+
+func (a pageArgs) page() (page, error) {
+	p := page{first: DefaultPageSize}
+	if a.First != nil {
+		p.first = min(int(*a.First), MaxPageSize)
+	}
+	if p.first < 0 {
+		return p, inputError("first must not be negative")
+	}
+	if a.After != nil {
+		n, err := strconv.ParseInt(*a.After, 10, 64)
+		if err != nil || n <= 0 {
+			return p, inputError("bad after cursor")
+		}
+		p.after = n
+	}
+	return p, nil
+}
+
+// batch loads the children of a list of parents, such as the accounts of
+// a page of companies, a page for every parent at once: the first parent
+// whose children are resolved loads them for its siblings too, who wait
+// for and share the result. Each level of a query thus costs one query
+// however many parents it has.
+type batch[T any] struct {
+	parents []int64
+	fetch   func(ctx context.Context, parents []int64, p page) (map[int64][]T, error)
+
+	mu    sync.Mutex
+	loads map[page]*load[T]
+}
+
+type load[T any] struct {
+	once     sync.Once
+	children map[int64][]T
+	err      error
+}
+
+func newBatch[T any](parents []int64, fetch func(context.Context, []int64, page) (map[int64][]T, error)) *batch[T] {
+	return &batch[T]{parents: parents, fetch: fetch, loads: map[page]*load[T]{}}
+}
+
+// get returns parent's children for p, up to p.first+1 of them so the
+// caller can tell whether there is a next page.
+func (b *batch[T]) get(ctx context.Context, parent int64, p page) ([]T, error) {
+	b.mu.Lock()
+	l, ok := b.loads[p]
+	if !ok {
+		l = &load[T]{}
+		b.loads[p] = l
+	}
+	b.mu.Unlock()
+
+	l.once.Do(func() { l.children, l.err = b.fetch(ctx, b.parents, p) })
+	return l.children[parent], l.err
+}
+
+type connection[T any] struct {
+	Nodes    []T
+	PageInfo pageInfo
+}
+
+type pageInfo struct {
+	HasNextPage bool
+	EndCursor   *string
+}
+
+// split cuts nodes fetched one past p.first down to the page, reporting
+// whether there was one more.
+func split[T any](nodes []T, p page) ([]T, bool) {
+	if len(nodes) > p.first {
+		return nodes[:p.first], true
+	}
+	return nodes, false
+}
+
+// connect makes a page of nodes, with cursor giving each node's cursor.
+func connect[T any](nodes []T, more bool, cursor func(T) int64) *connection[T] {
+	c := &connection[T]{Nodes: nodes, PageInfo: pageInfo{HasNextPage: more}}
+	if n := len(nodes); n > 0 {
+		end := strconv.FormatInt(cursor(nodes[n-1]), 10)
+		c.PageInfo.EndCursor = &end
+	}
+	return c
+}
+
+// resolver is the Query type.
+type resolver struct {
+	repo *repo.Repo
+}
+
+func (r *resolver) Company(ctx context.Context, args struct{ ID graphql.ID }) (*companyResolver, error) {
+	companyID, err := strconv.ParseInt(string(args.ID), 10, 64)
+	if err != nil {
+		return nil, inputError("bad company id")
+	}
+	c, err := r.repo.GetCompanyByID(ctx, companyID)
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.companies([]model.Company{c})[0], nil
+}
+
+func (r *resolver) Companies(ctx context.Context, args pageArgs) (*connection[*companyResolver], error) {
+	p, err := args.page()
+	if err != nil {
+		return nil, err
+	}
+	cs, err := r.repo.ListCompaniesAfter(ctx, p.after, p.first+1)
+	if err != nil {
+		return nil, err
+	}
+	cs, more := split(cs, p)
+	return connect(r.companies(cs), more, func(c *companyResolver) int64 { return c.c.ID }), nil
+}
+
+// companies wraps cs, which share a batch for their accounts.
+func (r *resolver) companies(cs []model.Company) []*companyResolver {
+	ids := make([]int64, len(cs))
+	for i, c := range cs {
+		ids[i] = c.ID
+	}
+	accounts := newBatch(ids, r.fetchAccounts)
+	out := make([]*companyResolver, len(cs))
+	for i, c := range cs {
+		out[i] = &companyResolver{c: c, accounts: accounts}
+	}
+	return out
+}
+
+// fetchAccounts loads a page of accounts for each company. The accounts
+// loaded together share a batch for their transactions in turn.
+func (r *resolver) fetchAccounts(ctx context.Context, companies []int64, p page) (map[int64][]*accountResolver, error) {
+	byCompany, err := r.repo.ListAccountsByCompanies(ctx, companies, p.after, p.first+1)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for _, c := range companies {
+		accs, _ := split(byCompany[c], p)
+		for _, a := range accs {
+			ids = append(ids, a.ID)
+		}
+	}
+	transactions := newBatch(ids, r.fetchTransactions)
+	out := make(map[int64][]*accountResolver, len(byCompany))
+	for c, accs := range byCompany {
+		for _, a := range accs {
+			out[c] = append(out[c], &accountResolver{a: a, transactions: transactions})
+		}
+	}
+	return out, nil
+}
+
+func (r *resolver) fetchTransactions(ctx context.Context, accounts []int64, p page) (map[int64][]*transactionResolver, error) {
+	byAccount, err := r.repo.ListTransactionsByAccounts(ctx, accounts, p.after, p.first+1)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[int64][]*transactionResolver, len(byAccount))
+	for a, txs := range byAccount {
+		for _, t := range txs {
+			out[a] = append(out[a], &transactionResolver{t: t, Error: t.Error})
+		}
+	}
+	return out, nil
+}
+
+type companyResolver struct {
+	c        model.Company
+	accounts *batch[*accountResolver]
+}
+
+func (r *companyResolver) ID() graphql.ID { return id(r.c.ID) }
+func (r *companyResolver) Name() string   { return r.c.Name }
+
+func (r *companyResolver) Accounts(ctx context.Context, args pageArgs) (*connection[*accountResolver], error) {
+	p, err := args.page()
+	if err != nil {
+		return nil, err
+	}
+	accs, err := r.accounts.get(ctx, r.c.ID, p)
+	if err != nil {
+		return nil, err
+	}
+	accs, more := split(accs, p)
+	return connect(accs, more, func(a *accountResolver) int64 { return a.a.ID }), nil
+}
+
+type accountResolver struct {
+	a            model.Account
+	transactions *batch[*transactionResolver]
+}
+
+func (r *accountResolver) ID() graphql.ID        { return id(r.a.ID) }
+func (r *accountResolver) CompanyID() graphql.ID { return id(r.a.Company) }
+func (r *accountResolver) Number() string        { return r.a.Number }
+func (r *accountResolver) Balance() string       { return money(r.a.Balance) }
+
+func (r *accountResolver) Transactions(ctx context.Context, args pageArgs) (*connection[*transactionResolver], error) {
+	p, err := args.page()
+	if err != nil {
+		return nil, err
+	}
+	txs, err := r.transactions.get(ctx, r.a.ID, p)
+	if err != nil {
+		return nil, err
+	}
+	txs, more := split(txs, p)
+	return connect(txs, more, func(t *transactionResolver) int64 { return t.t.ID }), nil
+}
+
+type transactionResolver struct {
+	t model.Transaction
+	// Error resolves the error field; as a method it would make the
+	// resolver an error.
+	Error *string
+}
+
+func (r *transactionResolver) ID() graphql.ID              { return id(r.t.ID) }
+func (r *transactionResolver) SourceAccountID() graphql.ID { return id(r.t.Source) }
+func (r *transactionResolver) TargetAccountID() graphql.ID { return id(r.t.Target) }
+func (r *transactionResolver) Amount() string              { return money(r.t.Amount) }
+func (r *transactionResolver) Reference() *string          { return r.t.Reference }
+func (r *transactionResolver) Memo() *string               { return r.t.Memo }
+func (r *transactionResolver) ValueDate() *string          { return r.t.ValueDate }
+func (r *transactionResolver) CreatedAt() graphql.Time     { return graphql.Time{Time: r.t.CreatedAt} }
+
+func id(n int64) graphql.ID { return graphql.ID(strconv.FormatInt(n, 10)) }
+
+// money renders an amount as the API's decimal string.
+func money(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
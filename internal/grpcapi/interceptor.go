@@ -0,0 +1,222 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/x509"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/token-cjg/minibank/internal/auth"
+	"github.com/token-cjg/minibank/internal/logging"
+	"github.com/token-cjg/minibank/internal/metrics"
+	"github.com/token-cjg/minibank/internal/tracing"
+	minibankv1 "github.com/token-cjg/minibank/proto/minibank/v1"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDKey is logging.RequestIDHeader as a metadata key.
+var requestIDKey = strings.ToLower(logging.RequestIDHeader)
+
+// call continues an RPC with ctx, which an interceptor may have extended.
+type call func(ctx context.Context) error
+
+// interceptor wraps every RPC, unary or streaming, as the HTTP middleware
+// wraps every request. method is the full method name, such as
+// /minibank.v1.Minibank/Transfer.
+type interceptor func(ctx context.Context, method string, next call) error
+
+// unary and stream run chain, outermost first, around unary and streaming
+// RPCs.
+func unary(chain ...interceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, h grpc.UnaryHandler) (any, error) {
+		var resp any
+		err := run(chain, ctx, info.FullMethod, func(ctx context.Context) error {
+			var err error
+			resp, err = h(ctx, req)
+			return err
+		})
+		return resp, err
+	}
+}
+
+func stream(chain ...interceptor) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, h grpc.StreamHandler) error {
+		return run(chain, ss.Context(), info.FullMethod, func(ctx context.Context) error {
+			return h(srv, &contextStream{ServerStream: ss, ctx: ctx})
+		})
+	}
+}
+
+func run(chain []interceptor, ctx context.Context, method string, last call) error {
+	c := last
+	for i := len(chain) - 1; i >= 0; i-- {
+		ic, next := chain[i], c
+		c = func(ctx context.Context) error { return ic(ctx, method, next) }
+	}
+	return c(ctx)
+}
+
+// contextStream hands a streaming handler the context the interceptors
+// built.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context { return s.ctx }
+
+// serverError reports whether code is the server's fault, like a 5xx.
+func serverError(code codes.Code) bool {
+	switch code {
+	case codes.Unknown, codes.Internal, codes.DataLoss, codes.Unimplemented,
+		codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// withRequestID propagates the caller's x-request-id or assigns a new one,
+// stores it in the context for loggers and echoes it in the response header.
+func withRequestID(ctx context.Context, _ string, next call) error {
+	var id string
+	if v := metadata.ValueFromIncomingContext(ctx, requestIDKey); len(v) > 0 {
+		id = v[0]
+	}
+	if !logging.ValidRequestID(id) {
+		id = logging.NewRequestID()
+	}
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, id))
+	return next(logging.WithRequestID(ctx, id))
+}
+
+// instrument records call counts and latency per method.
+func instrument(ctx context.Context, method string, next call) error {
+	start := time.Now()
+	err := next(ctx)
+	metrics.GRPCDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	metrics.GRPCRequests.WithLabelValues(method, status.Code(err).String()).Inc()
+	return err
+}
+
+// traced starts a server span per call, continuing any trace the caller
+// propagated in its metadata.
+func traced(ctx context.Context, method string, next call) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+	name := strings.TrimPrefix(method, "/")
+	service, rpc, _ := strings.Cut(name, "/")
+	ctx, span := tracing.Tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.RPCSystemGRPC,
+			semconv.RPCService(service),
+			semconv.RPCMethod(rpc),
+			attribute.String("rpc.request_id", logging.RequestID(ctx)),
+		))
+	defer span.End()
+
+	err := next(ctx)
+
+	code := status.Code(err)
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(code)))
+	if serverError(code) {
+		span.SetStatus(otelcodes.Error, code.String())
+	}
+	return err
+}
+
+// metadataCarrier lets the propagator read trace headers from metadata.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if v := metadata.MD(c).Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) { metadata.MD(c).Set(key, value) }
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// accessLog writes one log line per call once it has ended.
+func accessLog(ctx context.Context, method string, next call) error {
+	start := time.Now()
+	err := next(ctx)
+
+	code := status.Code(err)
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.String("code", code.String()),
+		slog.Duration("latency", time.Since(start)),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		attrs = append(attrs, slog.String("remote", p.Addr.String()))
+	}
+	level := slog.LevelInfo
+	if serverError(code) {
+		level = slog.LevelError
+	}
+	slog.LogAttrs(ctx, level, "rpc", attrs...)
+	return err
+}
+
+// transferMethods are the RPCs certAuth authenticates, as it authenticates
+// only POST /transfer over HTTP.
+var transferMethods = map[string]bool{
+	minibankv1.Minibank_CreateTransfer_FullMethodName: true,
+	minibankv1.Minibank_BatchTransfer_FullMethodName:  true,
+	minibankv1.Minibank_Transfer_FullMethodName:       true,
+}
+
+// certAuth authenticates the company behind a verified client certificate.
+// Calls without a certificate pass through unauthenticated; a certificate
+// whose subject is not mapped to a company is refused.
+func certAuth(subjects auth.CertSubjects) interceptor {
+	return func(ctx context.Context, method string, next call) error {
+		if !transferMethods[method] {
+			return next(ctx)
+		}
+		cert := peerCert(ctx)
+		if cert == nil {
+			return next(ctx)
+		}
+		company, ok := subjects.Lookup(cert)
+		if !ok {
+			return status.Errorf(codes.PermissionDenied,
+				"client certificate %s is not mapped to a company", cert.Subject)
+		}
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Int64("auth.company", company))
+		return next(auth.WithCompany(ctx, company))
+	}
+}
+
+// peerCert is auth.ClientCert for the connection a call came in on.
+func peerCert(ctx context.Context) *x509.Certificate {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil
+	}
+	return auth.PeerCert(&info.State)
+}
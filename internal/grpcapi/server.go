@@ -0,0 +1,276 @@
+// Package grpcapi serves the minibank.v1 gRPC API next to the REST API. It
+// is backed by the same repo layer and validates requests as the HTTP
+// handlers do, so both APIs accept and refuse the same things.
+package grpcapi
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/token-cjg/minibank/internal/auth"
+	"github.com/token-cjg/minibank/internal/handler"
+	"github.com/token-cjg/minibank/internal/model"
+	"github.com/token-cjg/minibank/internal/repo"
+	minibankv1 "github.com/token-cjg/minibank/proto/minibank/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Transaction page sizes for ListTransactions.
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// DefaultMaxBatchRows is the BatchTransfer row cap unless the server
+// configuration overrides it.
+const DefaultMaxBatchRows = 1_000_000
+
+// Server is the gRPC server: the Minibank service plus the standard health
+// and reflection services.
+type Server struct {
+	grpc   *grpc.Server
+	health *health.Server
+}
+
+// service implements minibankv1.MinibankServer.
+type service struct {
+	minibankv1.UnimplementedMinibankServer
+	repo *repo.Repo
+	// maxBatchRows caps a BatchTransfer call; 0 means no cap.
+	maxBatchRows int
+}
+
+type options struct {
+	tls          *tls.Config
+	certSubjects auth.CertSubjects
+	maxBatchRows int
+}
+
+// Option customises the server built by New.
+type Option func(*options)
+
+// WithTLS serves over TLS with cfg, verifying client certificates as cfg
+// says.
+func WithTLS(cfg *tls.Config) Option {
+	return func(o *options) { o.tls = cfg }
+}
+
+// WithCertSubjects maps verified TLS client certificates to companies, so
+// mTLS clients are authenticated on the transfer RPCs.
+func WithCertSubjects(subjects auth.CertSubjects) Option {
+	return func(o *options) { o.certSubjects = subjects }
+}
+
+// WithMaxBatchRows overrides the BatchTransfer row cap; 0 means no cap.
+func WithMaxBatchRows(n int) Option {
+	return func(o *options) { o.maxBatchRows = n }
+}
+
+func New(rep *repo.Repo, opts ...Option) *Server {
+	o := options{maxBatchRows: DefaultMaxBatchRows}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	chain := []interceptor{withRequestID, instrument, traced, accessLog, certAuth(o.certSubjects)}
+	serverOpts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(unary(chain...)),
+		grpc.StreamInterceptor(stream(chain...)),
+	}
+	if o.tls != nil {
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(o.tls)))
+	}
+
+	s := &Server{grpc: grpc.NewServer(serverOpts...), health: health.NewServer()}
+	minibankv1.RegisterMinibankServer(s.grpc, &service{repo: rep, maxBatchRows: o.maxBatchRows})
+	healthpb.RegisterHealthServer(s.grpc, s.health)
+	reflection.Register(s.grpc)
+	return s
+}
+
+// Serve accepts connections on ln until Stop or GracefulStop.
+func (s *Server) Serve(ln net.Listener) error { return s.grpc.Serve(ln) }
+
+// Drain reports the server as not serving to health checks ahead of a
+// graceful shutdown.
+func (s *Server) Drain() { s.health.Shutdown() }
+
+// GracefulStop stops accepting calls and waits for running ones to finish.
+func (s *Server) GracefulStop() { s.grpc.GracefulStop() }
+
+// Stop closes every connection, cancelling running calls.
+func (s *Server) Stop() { s.grpc.Stop() }
+
+func (s *service) CreateCompany(ctx context.Context, req *minibankv1.CreateCompanyRequest) (*minibankv1.Company, error) {
+	if verrs := handler.ValidateCompanyName(req.GetCompanyName()); verrs != nil {
+		return nil, invalid("request validation failed", verrs)
+	}
+	c, err := s.repo.CreateCompany(ctx, req.GetCompanyName())
+	if err != nil {
+		return nil, statusFor(ctx, err)
+	}
+	return companyMsg(c), nil
+}
+
+func (s *service) GetCompany(ctx context.Context, req *minibankv1.GetCompanyRequest) (*minibankv1.Company, error) {
+	c, err := s.repo.GetCompanyByID(ctx, req.GetCompanyId())
+	if err != nil {
+		return nil, statusFor(ctx, err)
+	}
+	return companyMsg(c), nil
+}
+
+func (s *service) ListCompanies(ctx context.Context, _ *minibankv1.ListCompaniesRequest) (*minibankv1.ListCompaniesResponse, error) {
+	cs, err := s.repo.ListCompanies(ctx)
+	if err != nil {
+		return nil, statusFor(ctx, err)
+	}
+	out := &minibankv1.ListCompaniesResponse{Companies: make([]*minibankv1.Company, len(cs))}
+	for i, c := range cs {
+		out.Companies[i] = companyMsg(c)
+	}
+	return out, nil
+}
+
+func (s *service) CreateAccount(ctx context.Context, req *minibankv1.CreateAccountRequest) (*minibankv1.Account, error) {
+	raw := req.GetInitialBalance()
+	if raw == "" {
+		raw = "0"
+	}
+	balance, verrs := handler.ValidateBalance(raw)
+	if verrs != nil {
+		return nil, invalid("request validation failed", verrs)
+	}
+	a, err := s.repo.CreateAccount(ctx, req.GetCompanyId(), balance)
+	if err != nil {
+		return nil, statusFor(ctx, err)
+	}
+	return accountMsg(a), nil
+}
+
+func (s *service) GetAccount(ctx context.Context, req *minibankv1.GetAccountRequest) (*minibankv1.Account, error) {
+	a, err := s.repo.GetCompanyAccount(ctx, req.GetCompanyId(), req.GetAccountId())
+	if err != nil {
+		return nil, statusFor(ctx, err)
+	}
+	return accountMsg(a), nil
+}
+
+func (s *service) GetAccountByNumber(ctx context.Context, req *minibankv1.GetAccountByNumberRequest) (*minibankv1.Account, error) {
+	number, err := strconv.ParseInt(req.GetAccountNumber(), 10, 64)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "bad account number")
+	}
+	a, err := s.repo.GetAccountByNumber(ctx, number)
+	if err != nil {
+		return nil, statusFor(ctx, err)
+	}
+	return accountMsg(a), nil
+}
+
+func (s *service) ListAccounts(ctx context.Context, req *minibankv1.ListAccountsRequest) (*minibankv1.ListAccountsResponse, error) {
+	accs, err := s.repo.ListAccountsByCompany(ctx, req.GetCompanyId())
+	if err != nil {
+		return nil, statusFor(ctx, err)
+	}
+	out := &minibankv1.ListAccountsResponse{Accounts: make([]*minibankv1.Account, len(accs))}
+	for i, a := range accs {
+		out.Accounts[i] = accountMsg(a)
+	}
+	return out, nil
+}
+
+// ListTransactions pages by tx_id: the page token is the last tx_id of the
+// previous page, and a page as long as asked for has a next one, which may
+// turn out empty.
+func (s *service) ListTransactions(ctx context.Context, req *minibankv1.ListTransactionsRequest) (*minibankv1.ListTransactionsResponse, error) {
+	size := int(req.GetPageSize())
+	switch {
+	case size < 0:
+		return nil, status.Error(codes.InvalidArgument, "page_size must not be negative")
+	case size == 0:
+		size = DefaultPageSize
+	case size > MaxPageSize:
+		size = MaxPageSize
+	}
+	var before int64
+	if tok := req.GetPageToken(); tok != "" {
+		n, err := strconv.ParseInt(tok, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "bad page_token")
+		}
+		before = n
+	}
+	if _, err := s.repo.GetCompanyAccount(ctx, req.GetCompanyId(), req.GetAccountId()); err != nil {
+		return nil, statusFor(ctx, err)
+	}
+	txs, err := s.repo.ListTransactions(ctx, req.GetAccountId(), before, size)
+	if err != nil {
+		return nil, statusFor(ctx, err)
+	}
+	out := &minibankv1.ListTransactionsResponse{Transactions: make([]*minibankv1.Transaction, len(txs))}
+	for i, t := range txs {
+		out.Transactions[i] = transactionMsg(t)
+	}
+	if len(txs) == size {
+		out.NextPageToken = strconv.FormatInt(txs[len(txs)-1].ID, 10)
+	}
+	return out, nil
+}
+
+func (s *service) GetBalance(ctx context.Context, req *minibankv1.GetBalanceRequest) (*minibankv1.Balance, error) {
+	at := time.Now()
+	if req.GetAt() != nil {
+		if err := req.GetAt().CheckValid(); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "bad at: "+err.Error())
+		}
+		at = req.GetAt().AsTime()
+	}
+	b, err := s.repo.BalanceAt(ctx, req.GetCompanyId(), req.GetAccountId(), at)
+	if err != nil {
+		return nil, statusFor(ctx, err)
+	}
+	return &minibankv1.Balance{AccountId: b.Account, At: timestamppb.New(b.At), Balance: money(b.Balance)}, nil
+}
+
+func companyMsg(c model.Company) *minibankv1.Company {
+	return &minibankv1.Company{CompanyId: c.ID, CompanyName: c.Name}
+}
+
+func accountMsg(a model.Account) *minibankv1.Account {
+	return &minibankv1.Account{AccountId: a.ID, CompanyId: a.Company, AccountNumber: a.Number, Balance: money(a.Balance)}
+}
+
+func transactionMsg(t model.Transaction) *minibankv1.Transaction {
+	return &minibankv1.Transaction{
+		TxId:            t.ID,
+		SourceAccountId: t.Source,
+		TargetAccountId: t.Target,
+		Amount:          money(t.Amount),
+		Error:           deref(t.Error),
+		Reference:       deref(t.Reference),
+		Memo:            deref(t.Memo),
+		ValueDate:       deref(t.ValueDate),
+		CreatedAt:       timestamppb.New(t.CreatedAt),
+	}
+}
+
+// money renders an amount as the API's decimal string.
+func money(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,153 @@
+package grpcapi_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/token-cjg/minibank/internal/grpcapi"
+	"github.com/token-cjg/minibank/internal/handler"
+	"github.com/token-cjg/minibank/internal/repo"
+	minibankv1 "github.com/token-cjg/minibank/proto/minibank/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dial serves a gRPC server backed by sqlmock over an in-memory listener
+// and returns a client for it. creds are the client's; nil dials without TLS.
+func dial(t *testing.T, creds credentials.TransportCredentials, opts ...grpcapi.Option) (minibankv1.MinibankClient, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	ln := bufconn.Listen(1 << 20)
+	srv := grpcapi.New(repo.New(db), opts...)
+	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
+
+	if creds == nil {
+		creds = insecure.NewCredentials()
+	}
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(creds))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return minibankv1.NewMinibankClient(conn), mock
+}
+
+func TestCreateCompany(t *testing.T) {
+	client, mock := dial(t, nil)
+
+	mock.ExpectQuery(`INSERT INTO company \(company_name\) VALUES \(\$1\)`).
+		WithArgs("Acme").
+		WillReturnRows(sqlmock.NewRows([]string{"company_id", "company_name"}).AddRow(1, "Acme"))
+
+	var header metadata.MD
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-request-id", "req-42")
+	c, err := client.CreateCompany(ctx, &minibankv1.CreateCompanyRequest{CompanyName: "Acme"}, grpc.Header(&header))
+	if err != nil {
+		t.Fatalf("CreateCompany: %v", err)
+	}
+	if c.GetCompanyId() != 1 || c.GetCompanyName() != "Acme" {
+		t.Errorf("company %v", c)
+	}
+	if got := header.Get("x-request-id"); len(got) != 1 || got[0] != "req-42" {
+		t.Errorf("x-request-id header %q, want req-42", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("db expectations: %v", err)
+	}
+}
+
+func TestCreateCompany_Validation(t *testing.T) {
+	client, _ := dial(t, nil)
+
+	_, err := client.CreateCompany(context.Background(), &minibankv1.CreateCompanyRequest{CompanyName: "  "})
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("code %v, want InvalidArgument: %v", st.Code(), err)
+	}
+	if len(st.Details()) != 1 {
+		t.Fatalf("details %v", st.Details())
+	}
+	br, ok := st.Details()[0].(*errdetails.BadRequest)
+	if !ok || len(br.GetFieldViolations()) != 1 {
+		t.Fatalf("detail %v", st.Details()[0])
+	}
+	if v := br.GetFieldViolations()[0]; v.GetField() != "company_name" || v.GetReason() != handler.FieldRequired {
+		t.Errorf("violation %v", v)
+	}
+}
+
+func TestGetAccount_NotFound(t *testing.T) {
+	client, mock := dial(t, nil)
+
+	mock.ExpectQuery(`FROM account WHERE company_id=\$1 AND account_id=\$2`).
+		WithArgs(int64(1), int64(9)).
+		WillReturnRows(sqlmock.NewRows([]string{"account_id", "company_id", "account_number", "account_balance"}))
+
+	_, err := client.GetAccount(context.Background(), &minibankv1.GetAccountRequest{CompanyId: 1, AccountId: 9})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("err = %v, want NotFound", err)
+	}
+}
+
+func TestListTransactions_Pages(t *testing.T) {
+	client, mock := dial(t, nil)
+
+	created := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	cols := []string{"tx_id", "source_account_id", "target_account_id", "transfer_amount", "error",
+		"created_at", "reference", "memo", "value_date"}
+	mock.ExpectQuery(`FROM account WHERE company_id=\$1 AND account_id=\$2`).
+		WithArgs(int64(1), int64(10)).
+		WillReturnRows(sqlmock.NewRows([]string{"account_id", "company_id", "account_number", "account_balance"}).
+			AddRow(10, 1, "1000000000000000", 100.0))
+	mock.ExpectQuery(`FROM transaction\s+WHERE tx_id < \$2`).
+		WithArgs(int64(10), int64(42), 2).
+		WillReturnRows(sqlmock.NewRows(cols).
+			AddRow(41, 10, 11, 100.5, nil, created, "INV-1", nil, nil).
+			AddRow(40, 12, 10, 7.0, nil, created, nil, nil, nil))
+
+	page, err := client.ListTransactions(context.Background(), &minibankv1.ListTransactionsRequest{
+		CompanyId: 1, AccountId: 10, PageSize: 2, PageToken: "42",
+	})
+	if err != nil {
+		t.Fatalf("ListTransactions: %v", err)
+	}
+	txs := page.GetTransactions()
+	if len(txs) != 2 || txs[0].GetTxId() != 41 || txs[0].GetAmount() != "100.50" || txs[0].GetReference() != "INV-1" ||
+		!txs[1].GetCreatedAt().AsTime().Equal(created) {
+		t.Fatalf("transactions %v", txs)
+	}
+	if page.GetNextPageToken() != "40" {
+		t.Errorf("next page token %q, want 40", page.GetNextPageToken())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("db expectations: %v", err)
+	}
+}
+
+func TestListTransactions_BadPageToken(t *testing.T) {
+	client, _ := dial(t, nil)
+
+	_, err := client.ListTransactions(context.Background(), &minibankv1.ListTransactionsRequest{
+		CompanyId: 1, AccountId: 10, PageToken: "yesterday",
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("err = %v, want InvalidArgument", err)
+	}
+}
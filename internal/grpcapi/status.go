@@ -0,0 +1,69 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/token-cjg/minibank/internal/handler"
+	"github.com/token-cjg/minibank/internal/repo"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// statusFor maps repo errors onto gRPC status codes, as the HTTP handlers
+// map them onto statuses. Anything unrecognised is logged and reported as
+// Internal without echoing database text to the client. Errors that already
+// carry a status, such as those from a stream, pass through.
+func statusFor(ctx context.Context, err error) error {
+	if st, ok := status.FromError(err); ok {
+		return st.Err()
+	}
+	var verrs handler.ValidationErrors
+	switch {
+	case errors.As(err, &verrs):
+		return invalid("request validation failed", verrs)
+	case errors.Is(err, repo.ErrNotFound):
+		return status.Error(codes.NotFound, "resource not found")
+	case errors.Is(err, repo.ErrDuplicate):
+		return status.Error(codes.AlreadyExists, "resource already exists")
+	case errors.Is(err, repo.ErrConflict):
+		return status.Error(codes.Aborted, "conflicted with concurrent transfers; retry the request")
+	case errors.Is(err, repo.ErrInvalid):
+		return status.Error(codes.InvalidArgument, "value rejected by a database constraint")
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	default:
+		slog.ErrorContext(ctx, "internal error", "err", err)
+		return status.Error(codes.Internal, "internal server error")
+	}
+}
+
+// invalid is an InvalidArgument status with a google.rpc.BadRequest detail
+// listing every rejected field, with the same codes as the HTTP problem's
+// "errors".
+func invalid(msg string, verrs handler.ValidationErrors) error {
+	br := &errdetails.BadRequest{}
+	for _, fe := range verrs {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       fe.Field,
+			Reason:      fe.Code,
+			Description: fe.Message,
+		})
+	}
+	st := status.New(codes.InvalidArgument, msg)
+	if detailed, err := st.WithDetails(br); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// atRow prefixes the message of the status err with the 1-based row of a
+// transfer stream it concerns, keeping its code and details.
+func atRow(row int, err error) error {
+	p := status.Convert(err).Proto()
+	p.Message = fmt.Sprintf("row %d: %s", row, p.Message)
+	return status.FromProto(p).Err()
+}
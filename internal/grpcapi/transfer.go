@@ -0,0 +1,209 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/token-cjg/minibank/internal/auth"
+	"github.com/token-cjg/minibank/internal/handler"
+	"github.com/token-cjg/minibank/internal/repo"
+	minibankv1 "github.com/token-cjg/minibank/proto/minibank/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errRowRejected stops a stream at a row the service refused to run.
+var errRowRejected = errors.New("row rejected")
+
+var outcomes = map[repo.Outcome]minibankv1.Outcome{
+	repo.Settled:                minibankv1.Outcome_OUTCOME_SETTLED,
+	repo.DeclinedInsufficient:   minibankv1.Outcome_OUTCOME_DECLINED_INSUFFICIENT,
+	repo.DeclinedUnknownAccount: minibankv1.Outcome_OUTCOME_DECLINED_UNKNOWN_ACCOUNT,
+}
+
+// CreateTransfer runs one transfer through the same pipeline as a streamed
+// batch of one, like a single JSON transfer to POST /transfer.
+func (s *service) CreateTransfer(ctx context.Context, req *minibankv1.TransferRequest) (*minibankv1.TransferResult, error) {
+	t, err := validateTransfer(req)
+	if err != nil {
+		return nil, err
+	}
+	if company, ok := auth.Company(ctx); ok {
+		if err := s.checkSource(ctx, company, t.Source, map[int64]bool{}); err != nil {
+			return nil, err
+		}
+	}
+	var out *minibankv1.TransferResult
+	done := false
+	err = s.repo.TransferStream(ctx,
+		func() (repo.TransferInput, error) {
+			if done {
+				return repo.TransferInput{}, io.EOF
+			}
+			done = true
+			return t, nil
+		},
+		func(res repo.RowResult) error {
+			out = resultMsg(res)
+			return nil
+		})
+	if err != nil {
+		return nil, statusFor(ctx, err)
+	}
+	return out, nil
+}
+
+// BatchTransfer collects the client's rows, validating each as it arrives,
+// and runs them with repo.BatchTransfer as POST /transfer runs a CSV file.
+func (s *service) BatchTransfer(stream minibankv1.Minibank_BatchTransferServer) error {
+	ctx := stream.Context()
+	var txns []repo.TransferInput
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if s.maxBatchRows > 0 && len(txns) == s.maxBatchRows {
+			return status.Errorf(codes.ResourceExhausted, "a batch may have at most %d rows", s.maxBatchRows)
+		}
+		t, err := validateTransfer(req)
+		if err != nil {
+			return atRow(len(txns)+1, err)
+		}
+		txns = append(txns, t)
+	}
+
+	if company, ok := auth.Company(ctx); ok && len(txns) > 0 {
+		if err := s.checkOwnership(ctx, company, txns); err != nil {
+			return err
+		}
+	}
+	if berr := s.repo.BatchTransfer(ctx, txns); berr != nil {
+		err := statusFor(ctx, berr.Err)
+		if berr.Row >= 0 {
+			err = atRow(berr.Row+1, err)
+		}
+		return err
+	}
+	return stream.SendAndClose(&minibankv1.BatchTransferResponse{Rows: int32(len(txns))})
+}
+
+// Transfer runs rows as they arrive with repo.TransferStream and sends each
+// result as it completes, like an NDJSON upload to POST /transfer. The row
+// that stops the stream has no result of its own: the call's status names
+// it instead.
+func (s *service) Transfer(stream minibankv1.Minibank_TransferServer) error {
+	ctx := stream.Context()
+	company, authenticated := auth.Company(ctx)
+	owned := make(map[int64]bool)
+	var rejected error
+
+	num := 0
+	next := func() (repo.TransferInput, error) {
+		req, err := stream.Recv()
+		if err != nil {
+			return repo.TransferInput{}, err // io.EOF ends the input
+		}
+		num++
+		t, err := validateTransfer(req)
+		if err == nil && authenticated {
+			err = s.checkSource(ctx, company, t.Source, owned)
+		}
+		if err != nil {
+			rejected = atRow(num, err)
+			return t, errRowRejected
+		}
+		return t, nil
+	}
+	emit := func(res repo.RowResult) error {
+		if res.Err != nil {
+			return nil
+		}
+		return stream.Send(resultMsg(res))
+	}
+
+	err := s.repo.TransferStream(ctx, next, emit)
+	var serr *repo.StreamError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, errRowRejected):
+		return rejected
+	case errors.As(err, &serr):
+		return atRow(serr.Row, statusFor(ctx, serr.Err))
+	default:
+		return statusFor(ctx, err)
+	}
+}
+
+// validateTransfer checks req as a JSON transfer is checked.
+func validateTransfer(req *minibankv1.TransferRequest) (repo.TransferInput, error) {
+	t, verrs := handler.ValidateTransfer(req.GetSource(), req.GetTarget(), req.GetAmount(),
+		req.GetReference(), req.GetMemo(), req.GetValueDate())
+	if verrs != nil {
+		return t, invalid("invalid transfer", verrs)
+	}
+	return t, nil
+}
+
+// checkSource refuses a transfer debiting an account of a company other
+// than the authenticated one, remembering accounts already found to be
+// owned.
+func (s *service) checkSource(ctx context.Context, company, src int64, owned map[int64]bool) error {
+	if owned[src] {
+		return nil
+	}
+	foreign, err := s.repo.AccountsOutsideCompany(ctx, company, []int64{src})
+	if err != nil {
+		return statusFor(ctx, err)
+	}
+	if len(foreign) > 0 {
+		return status.Errorf(codes.PermissionDenied,
+			"source account %d does not belong to the authenticated company", src)
+	}
+	owned[src] = true
+	return nil
+}
+
+// checkOwnership is checkSource for a whole batch at once, naming the first
+// offending row.
+func (s *service) checkOwnership(ctx context.Context, company int64, txns []repo.TransferInput) error {
+	seen := make(map[int64]bool)
+	var sources []int64
+	for _, t := range txns {
+		if !seen[t.Source] {
+			seen[t.Source] = true
+			sources = append(sources, t.Source)
+		}
+	}
+	foreign, err := s.repo.AccountsOutsideCompany(ctx, company, sources)
+	if err != nil {
+		return statusFor(ctx, err)
+	}
+	bad := make(map[int64]bool, len(foreign))
+	for _, n := range foreign {
+		bad[n] = true
+	}
+	for i, t := range txns {
+		if bad[t.Source] {
+			return atRow(i+1, status.Errorf(codes.PermissionDenied,
+				"source account %d does not belong to the authenticated company", t.Source))
+		}
+	}
+	return nil
+}
+
+func resultMsg(res repo.RowResult) *minibankv1.TransferResult {
+	return &minibankv1.TransferResult{
+		Row:       int32(res.Row),
+		Source:    res.Input.Source,
+		Target:    res.Input.Target,
+		Amount:    money(res.Input.Amount),
+		Reference: res.Input.Reference,
+		Outcome:   outcomes[res.Outcome],
+	}
+}
@@ -0,0 +1,207 @@
+package grpcapi_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/token-cjg/minibank/internal/auth"
+	"github.com/token-cjg/minibank/internal/grpcapi"
+	minibankv1 "github.com/token-cjg/minibank/proto/minibank/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+const srcNum, dstNum = int64(1000000000000000), int64(1000000000000001)
+
+// expectDeclined expects one transfer of 50 from srcNum to dstNum that is
+// declined for want of balance.
+func expectDeclined(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT account_number, account_id, account_balance`).
+		WithArgs(srcNum, dstNum).
+		WillReturnRows(sqlmock.NewRows([]string{"account_number", "account_id", "account_balance"}).
+			AddRow(srcNum, 1, 10.0).
+			AddRow(dstNum, 2, 0.0))
+	msg := "tx declined, insufficient balance"
+	mock.ExpectExec(`INSERT INTO transaction`).
+		WithArgs(int64(1), int64(2), 50.0, &msg, nil, nil, nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+}
+
+func TestTransfer_ResultPerRowThenFailingRow(t *testing.T) {
+	client, mock := dial(t, nil)
+	expectDeclined(mock)
+
+	stream, err := client.Transfer(context.Background())
+	if err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	_ = stream.Send(&minibankv1.TransferRequest{Source: srcNum, Target: dstNum, Amount: "50"})
+	_ = stream.Send(&minibankv1.TransferRequest{Source: srcNum, Target: dstNum, Amount: "1.234"})
+	_ = stream.CloseSend()
+
+	res, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("first result: %v", err)
+	}
+	if res.GetRow() != 1 || res.GetOutcome() != minibankv1.Outcome_OUTCOME_DECLINED_INSUFFICIENT || res.GetAmount() != "50.00" {
+		t.Errorf("result %v", res)
+	}
+	_, err = stream.Recv()
+	if st := status.Convert(err); st.Code() != codes.InvalidArgument || !strings.HasPrefix(st.Message(), "row 2: ") {
+		t.Fatalf("err = %v, want InvalidArgument for row 2", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("db expectations: %v", err)
+	}
+}
+
+func TestBatchTransfer_InvalidRow(t *testing.T) {
+	client, _ := dial(t, nil)
+
+	stream, err := client.BatchTransfer(context.Background())
+	if err != nil {
+		t.Fatalf("BatchTransfer: %v", err)
+	}
+	_ = stream.Send(&minibankv1.TransferRequest{Source: srcNum, Target: dstNum, Amount: "50"})
+	_ = stream.Send(&minibankv1.TransferRequest{Source: srcNum, Amount: "50"})
+	_, err = stream.CloseAndRecv()
+	if st := status.Convert(err); st.Code() != codes.InvalidArgument || !strings.HasPrefix(st.Message(), "row 2: ") {
+		t.Fatalf("err = %v, want InvalidArgument for row 2", err)
+	}
+}
+
+func TestBatchTransfer_TooManyRows(t *testing.T) {
+	client, _ := dial(t, nil, grpcapi.WithMaxBatchRows(1))
+
+	stream, err := client.BatchTransfer(context.Background())
+	if err != nil {
+		t.Fatalf("BatchTransfer: %v", err)
+	}
+	for range 2 {
+		_ = stream.Send(&minibankv1.TransferRequest{Source: srcNum, Target: dstNum, Amount: "50"})
+	}
+	if _, err := stream.CloseAndRecv(); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("err = %v, want ResourceExhausted", err)
+	}
+}
+
+func TestBatchTransfer(t *testing.T) {
+	client, mock := dial(t, nil)
+	expectDeclined(mock)
+	mock.ExpectExec(`INSERT INTO webhook_event \(company_id, event_type, payload\)`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	stream, err := client.BatchTransfer(context.Background())
+	if err != nil {
+		t.Fatalf("BatchTransfer: %v", err)
+	}
+	_ = stream.Send(&minibankv1.TransferRequest{Source: srcNum, Target: dstNum, Amount: "50"})
+	resp, err := stream.CloseAndRecv()
+	if err != nil || resp.GetRows() != 1 {
+		t.Fatalf("BatchTransfer = %v, %v; want 1 row", resp, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("db expectations: %v", err)
+	}
+}
+
+type keyPair struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// issue creates a certificate for cn signed by parent, or self-signed.
+func issue(t *testing.T, cn string, parent *keyPair) *keyPair {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	signer, signerKey := tpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &keyPair{cert: cert, key: key}
+}
+
+func (kp *keyPair) tlsCert() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{kp.cert.Raw}, PrivateKey: kp.key}
+}
+
+// dialMTLS dials a server that requires client certificates, presenting
+// one for cn, with acme-treasury mapped to company 1.
+func dialMTLS(t *testing.T, cn string) (minibankv1.MinibankClient, sqlmock.Sqlmock) {
+	t.Helper()
+	ca := issue(t, "minibank-ca", nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	server := &tls.Config{
+		Certificates: []tls.Certificate{issue(t, "localhost", ca).tlsCert()},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	client := credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{issue(t, cn, ca).tlsCert()},
+		RootCAs:      pool,
+		ServerName:   "localhost",
+	})
+	return dial(t, client, grpcapi.WithTLS(server),
+		grpcapi.WithCertSubjects(auth.CertSubjects{"CN=acme-treasury": 1}))
+}
+
+func TestCreateTransfer_ForeignSource(t *testing.T) {
+	client, mock := dialMTLS(t, "acme-treasury")
+
+	mock.ExpectQuery(`SELECT account_number FROM account WHERE company_id <> \$1 AND account_number IN \(\$2\)`).
+		WithArgs(int64(1), srcNum).
+		WillReturnRows(sqlmock.NewRows([]string{"account_number"}).AddRow(srcNum))
+
+	_, err := client.CreateTransfer(context.Background(),
+		&minibankv1.TransferRequest{Source: srcNum, Target: dstNum, Amount: "50"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("err = %v, want PermissionDenied", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("db expectations: %v", err)
+	}
+}
+
+func TestCreateTransfer_UnmappedCertificate(t *testing.T) {
+	client, _ := dialMTLS(t, "stranger")
+
+	_, err := client.CreateTransfer(context.Background(),
+		&minibankv1.TransferRequest{Source: srcNum, Target: dstNum, Amount: "50"})
+	if st := status.Convert(err); st.Code() != codes.PermissionDenied || !strings.Contains(st.Message(), "CN=stranger") {
+		t.Fatalf("err = %v, want PermissionDenied naming the certificate", err)
+	}
+}
@@ -18,26 +18,31 @@ func NewAccount(r *repo.Repo) *Account { return &Account{Repo: r} }
 /*
 Create is a handler for creating a new account.
 
-	POST /companies/{id}/accounts
+	POST /companies/{companyId}/accounts
 	Content-Type: application/json
 	Body: {"initial_balance": 1000.0}
 */
 func (h *Account) Create(w http.ResponseWriter, r *http.Request) {
-	companyID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	companyID, err := strconv.ParseInt(mux.Vars(r)["companyId"], 10, 64)
 	if err != nil {
-		http.Error(w, "bad company id", http.StatusBadRequest)
+		badRequest(w, r, "bad company id")
 		return
 	}
 	var req struct {
-		Balance float64 `json:"initial_balance"`
+		Balance json.RawMessage `json:"initial_balance"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeDecodeError(w, r, err)
 		return
 	}
-	acct, err := h.Repo.CreateAccount(r.Context(), companyID, req.Balance)
+	balance, verrs := ValidateBalance(string(req.Balance))
+	if verrs != nil {
+		writeValidation(w, r, verrs)
+		return
+	}
+	acct, err := h.Repo.CreateAccount(r.Context(), companyID, balance)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	json.NewEncoder(w).Encode(acct)
@@ -45,13 +50,13 @@ func (h *Account) Create(w http.ResponseWriter, r *http.Request) {
 
 /*
 	 ListByCompany is a handler for listing all accounts for a company.
-		GET /companies/{id}/accounts
+		GET /companies/{companyId}/accounts
 */
 func (h *Account) ListByCompany(w http.ResponseWriter, r *http.Request) {
-	companyID, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	companyID, _ := strconv.ParseInt(mux.Vars(r)["companyId"], 10, 64)
 	accs, err := h.Repo.ListAccountsByCompany(r.Context(), companyID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	if accs == nil {
@@ -61,15 +66,38 @@ func (h *Account) ListByCompany(w http.ResponseWriter, r *http.Request) {
 }
 
 /*
-GetByID is a handler for getting an account by its ID.
+GetByID is a handler for getting an account of a company by its ID.
+It responds 404 if the account does not exist or belongs to another company.
 
-	GET /companies/{id}/accounts/{id}
+	GET /companies/{companyId}/accounts/{accountId}
 */
 func (h *Account) GetByID(w http.ResponseWriter, r *http.Request) {
-	accountID, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
-	acc, err := h.Repo.GetAccountByID(r.Context(), accountID)
+	vars := mux.Vars(r)
+	companyID, _ := strconv.ParseInt(vars["companyId"], 10, 64)
+	accountID, _ := strconv.ParseInt(vars["accountId"], 10, 64)
+	acc, err := h.Repo.GetCompanyAccount(r.Context(), companyID, accountID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(acc)
+}
+
+/*
+GetByNumber is a handler for looking an account up by its account number,
+the identifier used in transfer files.
+
+	GET /accounts/by-number/{accountNumber}
+*/
+func (h *Account) GetByNumber(w http.ResponseWriter, r *http.Request) {
+	number, err := strconv.ParseInt(mux.Vars(r)["accountNumber"], 10, 64)
+	if err != nil {
+		badRequest(w, r, "bad account number")
+		return
+	}
+	acc, err := h.Repo.GetAccountByNumber(r.Context(), number)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	json.NewEncoder(w).Encode(acc)
@@ -43,7 +43,7 @@ func TestAccountCreate_OK(t *testing.T) {
 
 	body, _ := json.Marshal(map[string]any{"initial_balance": 750.0})
 	rec := perform(h.Create, http.MethodPost, "/companies/1/accounts",
-		map[string]string{"id": "1"}, body)
+		map[string]string{"companyId": "1"}, body)
 
 	if rec.Code != http.StatusOK {
 		t.Fatalf("status %d, want 200", rec.Code)
@@ -56,7 +56,7 @@ func TestAccountCreate_OK(t *testing.T) {
 func TestAccountCreate_BadJSON(t *testing.T) {
 	h, _ := newDeps(t)
 	rec := perform(h.Create, http.MethodPost, "/companies/1/accounts",
-		map[string]string{"id": "1"}, []byte(`{bad json}`))
+		map[string]string{"companyId": "1"}, []byte(`{bad json}`))
 
 	if rec.Code != http.StatusBadRequest {
 		t.Fatalf("want 400, got %d", rec.Code)
@@ -73,7 +73,7 @@ func TestAccountList_Empty(t *testing.T) {
 		})) // empty
 
 	rec := perform(h.ListByCompany, http.MethodGet, "/companies/2/accounts",
-		map[string]string{"id": "2"}, nil)
+		map[string]string{"companyId": "2"}, nil)
 
 	if rec.Code != http.StatusOK {
 		t.Fatalf("status %d", rec.Code)
@@ -86,15 +86,57 @@ func TestAccountList_Empty(t *testing.T) {
 func TestAccountGetByID_OK(t *testing.T) {
 	h, mock := newDeps(t)
 
-	mock.ExpectQuery(`SELECT account_id, company_id, account_number, account_balance FROM account WHERE account_id=\$1`).
-		WithArgs(int64(10)).
+	mock.ExpectQuery(`SELECT account_id, company_id, account_number, account_balance FROM account WHERE company_id=\$1 AND account_id=\$2`).
+		WithArgs(int64(1), int64(10)).
 		WillReturnRows(sqlmock.NewRows([]string{
 			"account_id", "company_id", "account_number", "account_balance",
 		}).AddRow(10, 1, int64(1000000000000010), 500.0))
 
 	rec := perform(h.GetByID, http.MethodGet,
 		"/companies/1/accounts/10",
-		map[string]string{"id": "10"}, nil)
+		map[string]string{"companyId": "1", "accountId": "10"}, nil)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
+
+func TestAccountGetByID_OtherCompany(t *testing.T) {
+	h, mock := newDeps(t)
+
+	mock.ExpectQuery(`SELECT account_id, company_id, account_number, account_balance FROM account WHERE company_id=\$1 AND account_id=\$2`).
+		WithArgs(int64(2), int64(10)).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"account_id", "company_id", "account_number", "account_balance",
+		})) // account 10 belongs to company 1
+
+	rec := perform(h.GetByID, http.MethodGet,
+		"/companies/2/accounts/10",
+		map[string]string{"companyId": "2", "accountId": "10"}, nil)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("want 404, got %d", rec.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
+
+func TestAccountGetByNumber_OK(t *testing.T) {
+	h, mock := newDeps(t)
+
+	mock.ExpectQuery(`SELECT account_id, company_id, account_number, account_balance FROM account WHERE account_number=\$1`).
+		WithArgs(int64(1000000000000010)).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"account_id", "company_id", "account_number", "account_balance",
+		}).AddRow(10, 1, int64(1000000000000010), 500.0))
+
+	rec := perform(h.GetByNumber, http.MethodGet,
+		"/accounts/by-number/1000000000000010",
+		map[string]string{"accountNumber": "1000000000000010"}, nil)
 
 	if rec.Code != http.StatusOK {
 		t.Fatalf("status %d", rec.Code)
@@ -1,7 +1,6 @@
 package handler
 
 import (
-	"encoding/json"
 	"net/http"
 	"strconv"
 
@@ -24,14 +23,18 @@ func (h *Company) Create(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Name string `json:"company_name"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+	if verrs := ValidateCompanyName(req.Name); verrs != nil {
+		writeValidation(w, r, verrs)
 		return
 	}
 
 	c, err := h.Repo.CreateCompany(r.Context(), req.Name)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	writeJSON(w, http.StatusCreated, c)
@@ -44,7 +47,7 @@ func (h *Company) Create(w http.ResponseWriter, r *http.Request) {
 func (h *Company) List(w http.ResponseWriter, r *http.Request) {
 	cs, err := h.Repo.ListCompanies(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	if cs == nil {
@@ -55,13 +58,13 @@ func (h *Company) List(w http.ResponseWriter, r *http.Request) {
 
 /*
 	 GetByID is a handler for getting a company by ID.
-			GET /companies/{id}
+			GET /companies/{companyId}
 */
 func (h *Company) GetByID(w http.ResponseWriter, r *http.Request) {
-	companyID, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	companyID, _ := strconv.ParseInt(mux.Vars(r)["companyId"], 10, 64)
 	c, err := h.Repo.GetCompanyByID(r.Context(), companyID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	writeJSON(w, http.StatusOK, c)
@@ -3,11 +3,14 @@ package handler_test
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/token-cjg/minibank/internal/handler"
 	"github.com/token-cjg/minibank/internal/repo"
 )
@@ -75,7 +78,7 @@ func TestCompanyGetByID_OK(t *testing.T) {
 			AddRow(2, "Backme Corp"))
 
 	rec := perform(h.GetByID, http.MethodGet, "/companies/2",
-		map[string]string{"id": "2"}, nil)
+		map[string]string{"companyId": "2"}, nil)
 	if rec.Code != http.StatusOK {
 		t.Fatalf("status %d != 200", rec.Code)
 	}
@@ -83,3 +86,63 @@ func TestCompanyGetByID_OK(t *testing.T) {
 		t.Fatalf("db expectations: %v", err)
 	}
 }
+
+func TestCompanyCreate_DuplicateName(t *testing.T) {
+	h, mock := depsCompany(t)
+
+	mock.ExpectQuery(`INSERT INTO company`).
+		WithArgs("Acme Corp").
+		WillReturnError(&pgconn.PgError{Code: "23505", Message: "duplicate key value"})
+
+	body, _ := json.Marshal(map[string]string{"company_name": "Acme Corp"})
+	rec := call(h.Create, http.MethodPost, "/companies", body)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status %d != 409", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != handler.ProblemContentType {
+		t.Fatalf("content type %q", ct)
+	}
+	var p handler.Problem
+	_ = json.Unmarshal(rec.Body.Bytes(), &p)
+	if p.Code != handler.CodeConflict || p.Status != http.StatusConflict {
+		t.Fatalf("unexpected problem %+v", p)
+	}
+	if strings.Contains(rec.Body.String(), "duplicate key") {
+		t.Fatalf("database text leaked: %s", rec.Body.String())
+	}
+}
+
+func TestCompanyGetByID_NotFound(t *testing.T) {
+	h, mock := depsCompany(t)
+
+	mock.ExpectQuery(`SELECT company_id, company_name FROM company WHERE company_id=\$1`).
+		WithArgs(int64(9)).
+		WillReturnRows(sqlmock.NewRows([]string{"company_id", "company_name"}))
+
+	rec := perform(h.GetByID, http.MethodGet, "/companies/9",
+		map[string]string{"companyId": "9"}, nil)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status %d != 404", rec.Code)
+	}
+	var p handler.Problem
+	_ = json.Unmarshal(rec.Body.Bytes(), &p)
+	if p.Code != handler.CodeNotFound || p.Instance != "/companies/9" {
+		t.Fatalf("unexpected problem %+v", p)
+	}
+}
+
+func TestCompanyList_InternalErrorHidden(t *testing.T) {
+	h, mock := depsCompany(t)
+
+	mock.ExpectQuery(`SELECT company_id, company_name FROM company`).
+		WillReturnError(errors.New("connection reset by peer"))
+
+	rec := call(h.List, http.MethodGet, "/companies", nil)
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d != 500", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "connection reset") {
+		t.Fatalf("database text leaked: %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/token-cjg/minibank/internal/live"
+	"github.com/token-cjg/minibank/internal/model"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+// EventStreamContentType is the media type of Server-Sent Events.
+const EventStreamContentType = "text/event-stream"
+
+// eventBacklogPage is how many missed events are read at a time when a
+// stream resumes.
+const eventBacklogPage = 500
+
+// Events streams transactions to clients as Server-Sent Events while they
+// commit.
+type Events struct {
+	Repo *repo.Repo
+	// Hub is nil when the server does not listen for transactions; every
+	// stream is then refused with 503.
+	Hub *live.Hub
+	// Heartbeat is how often an idle stream gets a comment, so proxies do
+	// not time it out.
+	Heartbeat time.Duration
+}
+
+func NewEvents(r *repo.Repo, hub *live.Hub) *Events {
+	return &Events{Repo: r, Hub: hub, Heartbeat: 15 * time.Second}
+}
+
+/*
+Company streams a company's transactions as they commit: settled transfers
+into or out of any of its accounts and declined debits of them.
+
+	GET /companies/{companyId}/events
+	Accept: text/event-stream
+
+Each transaction is one event, with the tx_id as its id and the transfer as
+JSON:
+
+	id: 42
+	event: transfer.settled
+	data: {"tx_id":42,"type":"transfer.settled","source_company_id":1,...}
+
+A client that reconnects with Last-Event-ID first gets every transaction
+after that tx_id that it missed, then the live stream. The server may end a
+stream at any time, for instance when the client falls behind; browsers'
+EventSource reconnects and resumes by itself. tx_ids are taken before
+transfers commit, so events can arrive slightly out of tx_id order, and a
+transfer still committing as the client disconnects is not replayed if its
+tx_id is below the last one the client saw.
+*/
+func (h *Events) Company(w http.ResponseWriter, r *http.Request) {
+	companyID, _ := strconv.ParseInt(mux.Vars(r)["companyId"], 10, 64)
+	if _, err := h.Repo.GetCompanyByID(r.Context(), companyID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	h.serve(w, r, live.Filter{Company: companyID})
+}
+
+/*
+Account streams one account's transactions as they commit, as Company does
+for a whole company.
+
+	GET /companies/{companyId}/accounts/{accountId}/events
+	Accept: text/event-stream
+*/
+func (h *Events) Account(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	companyID, _ := strconv.ParseInt(vars["companyId"], 10, 64)
+	accountID, _ := strconv.ParseInt(vars["accountId"], 10, 64)
+	if _, err := h.Repo.GetCompanyAccount(r.Context(), companyID, accountID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	h.serve(w, r, live.Filter{Company: companyID, Account: accountID})
+}
+
+func (h *Events) serve(w http.ResponseWriter, r *http.Request, f live.Filter) {
+	if h.Hub == nil {
+		WriteProblem(w, r, NewProblem(http.StatusServiceUnavailable, CodeUnavailable,
+			"live events are not enabled on this server"))
+		return
+	}
+	var lastID int64
+	lastRaw := r.Header.Get("Last-Event-ID")
+	if lastRaw != "" {
+		n, err := strconv.ParseInt(lastRaw, 10, 64)
+		if err != nil || n < 0 {
+			badRequest(w, r, "Last-Event-ID must be a tx_id")
+			return
+		}
+		lastID = n
+	}
+
+	// subscribe before reading the backlog, so nothing that commits in
+	// between is missed
+	sub := h.Hub.Subscribe(f)
+	defer sub.Close()
+
+	ctx := r.Context()
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", EventStreamContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	write := func(format string, args ...any) error {
+		_ = rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	send := func(ev model.TransactionEvent) error {
+		data, _ := json.Marshal(ev)
+		return write("id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	sent := make(map[int64]bool)
+	for lastRaw != "" {
+		evs, err := h.Repo.TransactionEventsSince(ctx, f.Company, f.Account, lastID, eventBacklogPage)
+		if err != nil {
+			slog.ErrorContext(ctx, "read missed transactions", "after", lastID, "err", err)
+			return
+		}
+		for _, ev := range evs {
+			if err := send(ev); err != nil {
+				return
+			}
+			sent[ev.ID] = true
+			lastID = ev.ID
+		}
+		if len(evs) < eventBacklogPage {
+			break
+		}
+	}
+
+	heartbeat := time.NewTicker(h.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if sent[ev.ID] {
+				continue
+			}
+			if err := send(ev); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := write(": keepalive\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
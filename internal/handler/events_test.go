@@ -0,0 +1,138 @@
+package handler_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/token-cjg/minibank/internal/handler"
+	"github.com/token-cjg/minibank/internal/live"
+	"github.com/token-cjg/minibank/internal/model"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+func depsEvents(t *testing.T) (*handler.Events, *live.Hub, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	rep := repo.New(db)
+	hub := live.NewHub(rep)
+	return handler.NewEvents(rep, hub), hub, mock
+}
+
+// readEvent reads one event off an SSE stream and returns its lines.
+func readEvent(t *testing.T, r *bufio.Reader) []string {
+	t.Helper()
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read stream: %v (so far %q)", err, lines)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestEventsCompany_ResumesThenStreams(t *testing.T) {
+	h, hub, mock := depsEvents(t)
+
+	mock.ExpectQuery(`SELECT company_id, company_name FROM company WHERE company_id=\$1`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"company_id", "company_name"}).AddRow(1, "Acme"))
+	mock.ExpectQuery(`FROM transaction tx\s+JOIN account s .* WHERE tx.tx_id > \$3`).
+		WithArgs(int64(1), int64(0), int64(40), 500).
+		WillReturnRows(sqlmock.NewRows([]string{"event"}).
+			AddRow([]byte(`{"tx_id":41,"type":"transfer.settled","source_company_id":1,"target_company_id":2,` +
+				`"transfer_amount":10.5,"created_at":"2024-04-01T12:00:00.5+00:00"}`)).
+			AddRow([]byte(`{"tx_id":42,"type":"transfer.declined","source_company_id":1,"target_company_id":2,` +
+				`"transfer_amount":99,"error":"tx declined, insufficient balance","created_at":"2024-04-01T12:00:01+00:00"}`)))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.Company(w, mux.SetURLVars(r, map[string]string{"companyId": "1"}))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	req.Header.Set("Last-Event-ID", "40")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != handler.EventStreamContentType {
+		t.Fatalf("status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	body := bufio.NewReader(resp.Body)
+
+	first := readEvent(t, body)
+	if len(first) != 3 || first[0] != "id: 41" || first[1] != "event: transfer.settled" ||
+		!strings.Contains(first[2], `"created_at":"2024-04-01T12:00:00.5Z"`) {
+		t.Fatalf("first event %q", first)
+	}
+	if second := readEvent(t, body); second[0] != "id: 42" || second[1] != "event: transfer.declined" {
+		t.Fatalf("second event %q", second)
+	}
+
+	// 42 was replayed already; 43 is new, and 44 is another company's
+	hub.Publish(model.TransactionEvent{ID: 42, Type: model.EventTransferDeclined, SourceCompany: 1})
+	hub.Publish(model.TransactionEvent{ID: 44, Type: model.EventTransferSettled, SourceCompany: 3, TargetCompany: 3})
+	hub.Publish(model.TransactionEvent{ID: 43, Type: model.EventTransferSettled, SourceCompany: 2, TargetCompany: 1})
+	if third := readEvent(t, body); third[0] != "id: 43" {
+		t.Fatalf("third event %q", third)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
+
+func TestEventsAccount_UnknownAccount(t *testing.T) {
+	h, _, mock := depsEvents(t)
+
+	mock.ExpectQuery(`FROM account WHERE company_id=\$1 AND account_id=\$2`).
+		WithArgs(int64(1), int64(9)).
+		WillReturnRows(sqlmock.NewRows([]string{"account_id", "company_id", "account_number", "account_balance"}))
+
+	rec := perform(h.Account, http.MethodGet, "/companies/1/accounts/9/events",
+		map[string]string{"companyId": "1", "accountId": "9"}, nil)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status %d, want 404: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestEventsCompany_BadLastEventID(t *testing.T) {
+	h, _, mock := depsEvents(t)
+
+	mock.ExpectQuery(`SELECT company_id, company_name FROM company WHERE company_id=\$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"company_id", "company_name"}).AddRow(1, "Acme"))
+
+	req := httptest.NewRequest(http.MethodGet, "/companies/1/events", nil)
+	req.Header.Set("Last-Event-ID", "yesterday")
+	rec := httptest.NewRecorder()
+	h.Company(rec, mux.SetURLVars(req, map[string]string{"companyId": "1"}))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestEventsCompany_NoHub(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	h := handler.NewEvents(repo.New(db), nil)
+
+	mock.ExpectQuery(`FROM company WHERE company_id=\$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"company_id", "company_name"}).AddRow(1, "Acme"))
+
+	rec := perform(h.Company, http.MethodGet, "/companies/1/events", map[string]string{"companyId": "1"}, nil)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want 503: %s", rec.Code, rec.Body)
+	}
+}
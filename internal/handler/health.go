@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+// readyTimeout bounds the database checks behind /readyz so a hung database
+// makes the probe fail rather than hang.
+const readyTimeout = 2 * time.Second
+
+// Health serves the orchestrator's liveness and readiness probes.
+type Health struct {
+	Repo       *repo.Repo
+	Migrations []string // versions the binary expects to be applied
+
+	draining atomic.Bool
+}
+
+func NewHealth(r *repo.Repo, migrations []string) *Health {
+	return &Health{Repo: r, Migrations: migrations}
+}
+
+// Drain makes Ready fail from now on, so the load balancer stops sending
+// traffic while in-flight requests finish.
+func (h *Health) Drain() { h.draining.Store(true) }
+
+type healthStatus struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+/*
+Live is the liveness probe. It only reports that the process is serving.
+
+	GET /healthz
+*/
+func (h *Health) Live(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, healthStatus{Status: "ok"})
+}
+
+/*
+Ready is the readiness probe: the database answers a ping, every migration
+the binary embeds has been applied, and the server is not shutting down.
+
+	GET /readyz
+	Returns 200 when ready, 503 with the failing checks otherwise.
+*/
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	checks := map[string]string{"database": "ok", "migrations": "ok"}
+	ok := true
+	if h.draining.Load() {
+		checks["server"] = "shutting down"
+		ok = false
+	}
+
+	if err := h.Repo.Ping(ctx); err != nil {
+		checks["database"] = "unreachable"
+		checks["migrations"] = "unknown"
+		ok = false
+	} else if applied, err := h.Repo.AppliedMigrations(ctx); err != nil {
+		checks["migrations"] = "unknown"
+		ok = false
+	} else if missing := missingVersions(h.Migrations, applied); len(missing) > 0 {
+		checks["migrations"] = "pending: " + missing[0]
+		ok = false
+	}
+
+	if !ok {
+		writeJSON(w, http.StatusServiceUnavailable, healthStatus{Status: "unavailable", Checks: checks})
+		return
+	}
+	writeJSON(w, http.StatusOK, healthStatus{Status: "ok", Checks: checks})
+}
+
+func missingVersions(want, have []string) []string {
+	applied := make(map[string]bool, len(have))
+	for _, v := range have {
+		applied[v] = true
+	}
+	var missing []string
+	for _, v := range want {
+		if !applied[v] {
+			missing = append(missing, v)
+		}
+	}
+	return missing
+}
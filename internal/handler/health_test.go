@@ -0,0 +1,81 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/token-cjg/minibank/internal/handler"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+func depsHealth(t *testing.T) (*handler.Health, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, _ := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	return handler.NewHealth(repo.New(db), []string{"000_init.sql", "001_next.sql"}), mock
+}
+
+func readyChecks(t *testing.T, h *handler.Health) (int, map[string]string) {
+	t.Helper()
+	rec := call(h.Ready, http.MethodGet, "/readyz", nil)
+	var body struct {
+		Checks map[string]string `json:"checks"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &body)
+	return rec.Code, body.Checks
+}
+
+func TestHealthLive(t *testing.T) {
+	h, _ := depsHealth(t)
+	if rec := call(h.Live, http.MethodGet, "/healthz", nil); rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+}
+
+func TestHealthReady_OK(t *testing.T) {
+	h, mock := depsHealth(t)
+	mock.ExpectPing()
+	mock.ExpectQuery(`SELECT version FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("000_init.sql").AddRow("001_next.sql"))
+
+	if code, checks := readyChecks(t, h); code != http.StatusOK {
+		t.Fatalf("status %d, checks %v", code, checks)
+	}
+}
+
+func TestHealthReady_PendingMigration(t *testing.T) {
+	h, mock := depsHealth(t)
+	mock.ExpectPing()
+	mock.ExpectQuery(`SELECT version FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("000_init.sql"))
+
+	code, checks := readyChecks(t, h)
+	if code != http.StatusServiceUnavailable || checks["migrations"] != "pending: 001_next.sql" {
+		t.Fatalf("status %d, checks %v", code, checks)
+	}
+}
+
+func TestHealthReady_DatabaseDown(t *testing.T) {
+	h, mock := depsHealth(t)
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+	code, checks := readyChecks(t, h)
+	if code != http.StatusServiceUnavailable || checks["database"] != "unreachable" {
+		t.Fatalf("status %d, checks %v", code, checks)
+	}
+}
+
+func TestHealthReady_Draining(t *testing.T) {
+	h, mock := depsHealth(t)
+	mock.ExpectPing()
+	mock.ExpectQuery(`SELECT version FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("000_init.sql").AddRow("001_next.sql"))
+	h.Drain()
+
+	code, checks := readyChecks(t, h)
+	if code != http.StatusServiceUnavailable || checks["server"] != "shutting down" {
+		t.Fatalf("status %d, checks %v", code, checks)
+	}
+}
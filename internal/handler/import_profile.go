@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"github.com/token-cjg/minibank/internal/csvimport"
+	"github.com/token-cjg/minibank/internal/model"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+// MaxColumnNameLen bounds a column reference in an import profile.
+const MaxColumnNameLen = 100
+
+type ImportProfile struct{ Repo *repo.Repo }
+
+func NewImportProfile(r *repo.Repo) *ImportProfile { return &ImportProfile{Repo: r} }
+
+// importProfileRequest is the body of Put. Omitted or null settings take
+// their csvimport.DefaultProfile value.
+type importProfileRequest struct {
+	Delimiter          *string `json:"delimiter"`
+	Header             *string `json:"header"`
+	SourceColumn       *string `json:"source_column"`
+	TargetColumn       *string `json:"target_column"`
+	AmountColumn       *string `json:"amount_column"`
+	ReferenceColumn    *string `json:"reference_column"`
+	MemoColumn         *string `json:"memo_column"`
+	ValueDateColumn    *string `json:"value_date_column"`
+	DecimalSeparator   *string `json:"decimal_separator"`
+	ThousandsSeparator *string `json:"thousands_separator"`
+	Encoding           *string `json:"encoding"`
+}
+
+/*
+Put creates or replaces a company's named import profile.
+
+	PUT /companies/{companyId}/import-profiles/{profileName}
+	Content-Type: application/json
+	Body: {"delimiter": ";", "header": "present", "source_column": "From",
+	       "target_column": "To", "amount_column": "Amount",
+	       "reference_column": "Ref", "memo_column": "Text", "value_date_column": "Valuta",
+	       "decimal_separator": ",", "thousands_separator": ".", "encoding": "windows-1252"}
+	Returns 200 with the saved profile.
+*/
+func (h *ImportProfile) Put(w http.ResponseWriter, r *http.Request) {
+	var req importProfileRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+	p := csvimport.DefaultProfile()
+	p.Company, _ = strconv.ParseInt(mux.Vars(r)["companyId"], 10, 64)
+	p.Name = mux.Vars(r)["profileName"]
+	set := func(dst *string, src *string) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+	set(&p.Delimiter, req.Delimiter)
+	set(&p.Header, req.Header)
+	set(&p.SourceColumn, req.SourceColumn)
+	set(&p.TargetColumn, req.TargetColumn)
+	set(&p.AmountColumn, req.AmountColumn)
+	set(&p.ReferenceColumn, req.ReferenceColumn)
+	set(&p.MemoColumn, req.MemoColumn)
+	set(&p.ValueDateColumn, req.ValueDateColumn)
+	set(&p.DecimalSeparator, req.DecimalSeparator)
+	set(&p.ThousandsSeparator, req.ThousandsSeparator)
+	set(&p.Encoding, req.Encoding)
+
+	if verrs := checkImportProfile(p); verrs != nil {
+		writeValidation(w, r, verrs)
+		return
+	}
+	saved, err := h.Repo.PutImportProfile(r.Context(), p)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, saved)
+}
+
+/*
+List returns a company's import profiles by name.
+
+	GET /companies/{companyId}/import-profiles
+*/
+func (h *ImportProfile) List(w http.ResponseWriter, r *http.Request) {
+	companyID, _ := strconv.ParseInt(mux.Vars(r)["companyId"], 10, 64)
+	ps, err := h.Repo.ListImportProfiles(r.Context(), companyID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ps)
+}
+
+/*
+Get returns one import profile.
+
+	GET /companies/{companyId}/import-profiles/{profileName}
+*/
+func (h *ImportProfile) Get(w http.ResponseWriter, r *http.Request) {
+	companyID, _ := strconv.ParseInt(mux.Vars(r)["companyId"], 10, 64)
+	p, err := h.Repo.GetImportProfile(r.Context(), companyID, mux.Vars(r)["profileName"])
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+/*
+Delete removes an import profile.
+
+	DELETE /companies/{companyId}/import-profiles/{profileName}
+	Returns 204, or 404 if there is no such profile.
+*/
+func (h *ImportProfile) Delete(w http.ResponseWriter, r *http.Request) {
+	companyID, _ := strconv.ParseInt(mux.Vars(r)["companyId"], 10, 64)
+	if err := h.Repo.DeleteImportProfile(r.Context(), companyID, mux.Vars(r)["profileName"]); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkImportProfile validates every setting of p.
+func checkImportProfile(p model.ImportProfile) ValidationErrors {
+	var v ValidationErrors
+	if d, size := utf8.DecodeRuneInString(p.Delimiter); size == 0 || size != len(p.Delimiter) ||
+		d == '"' || d == '\r' || d == '\n' || d == utf8.RuneError {
+		v.add("delimiter", FieldInvalid, "must be a single character other than a quote or line break")
+	} else if p.Delimiter == p.DecimalSeparator || p.Delimiter == p.ThousandsSeparator {
+		v.add("delimiter", FieldInvalid, "must differ from the number separators")
+	}
+
+	if !slices.Contains([]string{csvimport.HeaderAuto, csvimport.HeaderPresent, csvimport.HeaderAbsent}, p.Header) {
+		v.add("header", FieldInvalid, "must be auto, present or absent")
+	}
+	type column struct{ field, ref string }
+	cols := []column{
+		{"source_column", p.SourceColumn}, {"target_column", p.TargetColumn}, {"amount_column", p.AmountColumn},
+		// the details are optional: empty leaves them out
+		{"reference_column", p.ReferenceColumn}, {"memo_column", p.MemoColumn}, {"value_date_column", p.ValueDateColumn},
+	}
+	for i, col := range cols {
+		field, ref := col.field, col.ref
+		if i >= 3 && ref == "" {
+			continue
+		}
+		v.checkName(field, ref, MaxColumnNameLen)
+		if _, isPos := csvimport.Position(ref); !isPos && ref != "" && p.Header == csvimport.HeaderAbsent {
+			v.add(field, FieldInvalid, "must be a 1-based column number when there is no header")
+		}
+		if i >= 3 && slices.ContainsFunc(cols[:i], func(c column) bool { return c.ref == ref }) {
+			v.add(field, FieldInvalid, "must be a column of its own")
+		}
+	}
+	if p.SourceColumn == p.TargetColumn || p.SourceColumn == p.AmountColumn || p.TargetColumn == p.AmountColumn {
+		v.add("amount_column", FieldInvalid, "source, target and amount must be different columns")
+	}
+
+	if !slices.Contains(csvimport.DecimalSeparators, p.DecimalSeparator) {
+		v.add("decimal_separator", FieldInvalid, "must be . or ,")
+	}
+	if !slices.Contains(csvimport.ThousandsSeparators, p.ThousandsSeparator) {
+		v.add("thousands_separator", FieldInvalid, `must be empty or one of , . ' and space`)
+	} else if p.ThousandsSeparator == p.DecimalSeparator {
+		v.add("thousands_separator", FieldInvalid, "must differ from decimal_separator")
+	}
+	if !slices.Contains(csvimport.Encodings(), p.Encoding) {
+		v.add("encoding", FieldInvalid, "must be one of %v", csvimport.Encodings())
+	}
+	return v
+}
@@ -0,0 +1,222 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/token-cjg/minibank/internal/auth"
+	"github.com/token-cjg/minibank/internal/handler"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+var importProfileCols = []string{
+	"profile_id", "company_id", "profile_name", "delimiter", "header",
+	"source_column", "target_column", "amount_column",
+	"reference_column", "memo_column", "value_date_column",
+	"decimal_separator", "thousands_separator", "encoding",
+}
+
+func depsImportProfile(t *testing.T) (*handler.ImportProfile, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	return handler.NewImportProfile(repo.New(db)), mock
+}
+
+func TestImportProfilePut_DefaultsFilledIn(t *testing.T) {
+	h, mock := depsImportProfile(t)
+
+	mock.ExpectQuery(`INSERT INTO import_profile .* ON CONFLICT \(company_id, profile_name\) DO UPDATE`).
+		WithArgs(int64(1), "bank-de", ";", "auto", "Von", "2", "3", "", "", "", ",", "", "utf-8").
+		WillReturnRows(sqlmock.NewRows(importProfileCols).
+			AddRow(5, 1, "bank-de", ";", "auto", "Von", "2", "3", "", "", "", ",", "", "utf-8"))
+
+	body := []byte(`{"delimiter": ";", "source_column": "Von", "decimal_separator": ","}`)
+	rec := perform(h.Put, http.MethodPut, "/companies/1/import-profiles/bank-de",
+		map[string]string{"companyId": "1", "profileName": "bank-de"}, body)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var got map[string]any
+	_ = json.Unmarshal(rec.Body.Bytes(), &got)
+	if got["profile_id"] != 5.0 || got["source_column"] != "Von" {
+		t.Fatalf("body %v", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
+
+func TestImportProfilePut_Details(t *testing.T) {
+	h, mock := depsImportProfile(t)
+
+	mock.ExpectQuery(`INSERT INTO import_profile`).
+		WithArgs(int64(1), "erp", ",", "auto", "1", "2", "3", "Ref", "Text", "Valuta", ".", "", "utf-8").
+		WillReturnRows(sqlmock.NewRows(importProfileCols).
+			AddRow(6, 1, "erp", ",", "auto", "1", "2", "3", "Ref", "Text", "Valuta", ".", "", "utf-8"))
+
+	body := []byte(`{"reference_column": "Ref", "memo_column": "Text", "value_date_column": "Valuta"}`)
+	rec := perform(h.Put, http.MethodPut, "/companies/1/import-profiles/erp",
+		map[string]string{"companyId": "1", "profileName": "erp"}, body)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var got map[string]any
+	_ = json.Unmarshal(rec.Body.Bytes(), &got)
+	if got["reference_column"] != "Ref" || got["memo_column"] != "Text" || got["value_date_column"] != "Valuta" {
+		t.Fatalf("body %v", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
+
+func TestImportProfilePut_Validation(t *testing.T) {
+	h, _ := depsImportProfile(t)
+
+	body := []byte(`{"delimiter": ",", "header": "absent", "source_column": "From",
+		"target_column": "From", "decimal_separator": ",", "thousands_separator": "x", "encoding": "ebcdic"}`)
+	rec := perform(h.Put, http.MethodPut, "/companies/1/import-profiles/bad",
+		map[string]string{"companyId": "1", "profileName": "bad"}, body)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status %d, want 422: %s", rec.Code, rec.Body)
+	}
+	fields := map[string]bool{}
+	for _, e := range decodeProblem(t, rec.Body.Bytes()).Errors {
+		fields[e.Field] = true
+	}
+	for _, f := range []string{"delimiter", "source_column", "amount_column", "thousands_separator", "encoding"} {
+		if !fields[f] {
+			t.Errorf("no error for %s in %v", f, fields)
+		}
+	}
+}
+
+func TestImportProfileDelete_NotFound(t *testing.T) {
+	h, mock := depsImportProfile(t)
+
+	mock.ExpectExec(`DELETE FROM import_profile WHERE company_id=\$1 AND profile_name=\$2`).
+		WithArgs(int64(1), "gone").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	rec := perform(h.Delete, http.MethodDelete, "/companies/1/import-profiles/gone",
+		map[string]string{"companyId": "1", "profileName": "gone"}, nil)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status %d, want 404", rec.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
+
+func TestTransferBatch_WithProfile(t *testing.T) {
+	h, mock := depsTransfer(t)
+	const (
+		srcNum int64 = 1000000000000000
+		dstNum int64 = 1000000000000001
+	)
+
+	mock.ExpectQuery(`SELECT .* FROM import_profile WHERE company_id=\$1 AND profile_name=\$2`).
+		WithArgs(int64(7), "bank-de").
+		WillReturnRows(sqlmock.NewRows(importProfileCols).
+			AddRow(5, 7, "bank-de", ";", "auto", "Von", "Nach", "Betrag", "", "", "", ",", ".", "windows-1252"))
+	mock.ExpectQuery(`SELECT account_number FROM account WHERE company_id <> \$1 AND account_number IN`).
+		WithArgs(int64(7), srcNum).
+		WillReturnRows(sqlmock.NewRows([]string{"account_number"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT account_number, account_id, account_balance.*FOR UPDATE`).
+		WithArgs(srcNum, dstNum).
+		WillReturnRows(sqlmock.NewRows([]string{"account_number", "account_id", "account_balance"}).
+			AddRow(srcNum, 1, 5000.0).
+			AddRow(dstNum, 2, 0.0))
+	mock.ExpectExec(`UPDATE account SET account_balance = account_balance -`).
+		WithArgs(1234.5, int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE account SET account_balance = account_balance \+`).
+		WithArgs(1234.5, int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO transaction`).
+		WithArgs(int64(1), int64(2), 1234.5, nil, nil, nil, nil).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	body := "Datum;Betrag;Nach;Von\n2024-01-02;1.234,50;1000000000000001;1000000000000000\n"
+	req := httptest.NewRequest(http.MethodPost, "/transfer?profile=bank-de", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	req = req.WithContext(auth.WithCompany(req.Context(), 7))
+	rec := httptest.NewRecorder()
+	h.Batch(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status %d != 204: %s", rec.Code, rec.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
+
+func TestTransferBatch_ProfileSelection(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		url     string
+		company int64 // authenticated company, 0 for none
+		status  int
+	}{
+		{"needs a company", "/transfer?profile=p", 0, http.StatusBadRequest},
+		{"other company", "/transfer?profile=p&company_id=8", 7, http.StatusForbidden},
+		{"unknown profile", "/transfer?profile=p&company_id=8", 0, http.StatusNotFound},
+	} {
+		h, mock := depsTransfer(t)
+		mock.ExpectQuery(`FROM import_profile`).WillReturnRows(sqlmock.NewRows(importProfileCols))
+
+		req := httptest.NewRequest(http.MethodPost, tc.url, strings.NewReader("1,2,3\n"))
+		req.Header.Set("Content-Type", "text/csv")
+		if tc.company != 0 {
+			req = req.WithContext(auth.WithCompany(req.Context(), tc.company))
+		}
+		rec := httptest.NewRecorder()
+		h.Batch(rec, req)
+		if rec.Code != tc.status {
+			t.Errorf("%s: status %d, want %d: %s", tc.name, rec.Code, tc.status, rec.Body)
+		}
+	}
+}
+
+func TestTransferBatch_ProfileDetails(t *testing.T) {
+	h, mock := depsTransfer(t)
+	valueDate := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT .* FROM import_profile WHERE company_id=\$1 AND profile_name=\$2`).
+		WithArgs(int64(7), "erp").
+		WillReturnRows(sqlmock.NewRows(importProfileCols).
+			AddRow(6, 7, "erp", ",", "auto", "1", "2", "3", "Ref", "Text", "Valuta", ".", "", "utf-8"))
+	mock.ExpectQuery(`SELECT account_number FROM account WHERE company_id <> \$1`).
+		WithArgs(int64(7), int64(1000000000000000)).
+		WillReturnRows(sqlmock.NewRows([]string{"account_number"}))
+	expectLock(mock, 500.0)
+	mock.ExpectExec(`UPDATE account`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE account`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO transaction`).
+		WithArgs(int64(1), int64(2), 100.5, nil, "INV-1", "March rent", valueDate).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	body := "From,To,Amount,Valuta,Text,Ref\n" +
+		"1000000000000000,1000000000000001,100.50,2024-03-01,March rent,INV-1\n"
+	req := httptest.NewRequest(http.MethodPost, "/transfer?profile=erp", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	req = req.WithContext(auth.WithCompany(req.Context(), 7))
+	rec := httptest.NewRecorder()
+	h.Batch(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status %d != 204: %s", rec.Code, rec.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+// ProblemContentType is the media type of every error response (RFC 7807).
+const ProblemContentType = "application/problem+json"
+
+// Machine-readable problem codes. Clients should branch on these rather than
+// on the human readable title or detail.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeNotFound         = "not_found"
+	CodeForbidden        = "forbidden"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeUnsupportedMedia = "unsupported_media_type"
+	CodeValidation       = "validation_failed"
+	CodeInternal         = "internal_error"
+	CodeUnavailable      = "unavailable"
+)
+
+// Problem is an RFC 7807 problem details object extended with a stable code.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Code     string `json:"code"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Row      int    `json:"row,omitempty"` // 1-based CSV row for transfer batch failures
+
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// NewProblem builds a Problem for status. The type is about:blank, so the
+// title is the standard status text as RFC 7807 recommends.
+func NewProblem(status int, code, detail string) Problem {
+	return Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+// WriteProblem sends p as application/problem+json, filling in the request
+// path as the instance.
+func WriteProblem(w http.ResponseWriter, r *http.Request, p Problem) {
+	if p.Instance == "" && r != nil {
+		p.Instance = r.URL.Path
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// writeError maps repo errors onto HTTP statuses. Anything unrecognised is
+// logged and reported as a 500 without echoing database text to the client.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	p := problemFor(err)
+	if p.Status == http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), "internal error", "err", err)
+	}
+	WriteProblem(w, r, p)
+}
+
+func problemFor(err error) Problem {
+	switch {
+	case errors.Is(err, repo.ErrNotFound):
+		return NewProblem(http.StatusNotFound, CodeNotFound, "resource not found")
+	case errors.Is(err, repo.ErrDuplicate):
+		return NewProblem(http.StatusConflict, CodeConflict, "resource already exists")
+	case errors.Is(err, repo.ErrConflict):
+		return NewProblem(http.StatusConflict, CodeConflict, "conflicted with concurrent transfers; retry the request")
+	case errors.Is(err, repo.ErrInvalid):
+		return NewProblem(http.StatusUnprocessableEntity, CodeValidation, "value rejected by a database constraint")
+	default:
+		return NewProblem(http.StatusInternalServerError, CodeInternal, "internal server error")
+	}
+}
+
+// badRequest is shorthand for the common 400 response.
+func badRequest(w http.ResponseWriter, r *http.Request, detail string) {
+	WriteProblem(w, r, NewProblem(http.StatusBadRequest, CodeBadRequest, detail))
+}
+
+// NotFound and MethodNotAllowed let the router answer unmatched requests in
+// the same format as the handlers.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	WriteProblem(w, r, NewProblem(http.StatusNotFound, CodeNotFound, "no route matches "+r.URL.Path))
+}
+
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	WriteProblem(w, r, NewProblem(http.StatusMethodNotAllowed, CodeMethodNotAllowed,
+		r.Method+" is not supported on "+r.URL.Path))
+}
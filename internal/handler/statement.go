@@ -0,0 +1,279 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/token-cjg/minibank/internal/iso20022"
+	"github.com/token-cjg/minibank/internal/model"
+	"github.com/token-cjg/minibank/internal/pdf"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+// Statement serves an account's settled activity and past balances, as JSON
+// CSV or PDF and in the formats banks report them in. Days are UTC days.
+type Statement struct{ Repo *repo.Repo }
+
+func NewStatement(r *repo.Repo) *Statement { return &Statement{Repo: r} }
+
+/*
+Camt053 is a handler for an account's ISO 20022 camt.053 end-of-day
+statement: its opening and closing booked balances and one entry per
+settled transfer of the day. Declined transfers are left out.
+
+	GET /companies/{companyId}/accounts/{accountId}/camt.053?date=2024-03-01
+
+date defaults to yesterday and must be a day that has ended.
+*/
+func (h *Statement) Camt053(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC()
+	day, ok := statementDay(w, r, now.AddDate(0, 0, -1))
+	if !ok {
+		return
+	}
+	if day.AddDate(0, 0, 1).After(now) {
+		badRequest(w, r, "camt.053 covers a day that has ended; use camt.052 for today")
+		return
+	}
+	st, ok := h.statement(w, r, day, day.AddDate(0, 0, 1))
+	if !ok {
+		return
+	}
+	out, err := iso20022.Camt053(st, now)
+	writeXML(w, r, out, err)
+}
+
+/*
+Camt052 is a handler for an account's ISO 20022 camt.052 intraday report:
+its opening booked balance, its interim booked balance now and one entry per
+transfer settled since the start of the day. For a past day it covers the
+whole day.
+
+	GET /companies/{companyId}/accounts/{accountId}/camt.052?date=2024-03-01
+
+date defaults to today.
+*/
+func (h *Statement) Camt052(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC()
+	day, ok := statementDay(w, r, now)
+	if !ok {
+		return
+	}
+	if day.After(now) {
+		badRequest(w, r, "date is in the future")
+		return
+	}
+	to := day.AddDate(0, 0, 1)
+	if to.After(now) {
+		to = now
+	}
+	st, ok := h.statement(w, r, day, to)
+	if !ok {
+		return
+	}
+	out, err := iso20022.Camt052(st, now)
+	writeXML(w, r, out, err)
+}
+
+// CSVContentType is the media type of CSV statements.
+const CSVContentType = "text/csv"
+
+/*
+Period is a handler for an account's statement over a period: its opening
+balance, each settled transfer with the balance after it, and its closing
+balance, worked out from the transfer history. Declined transfers are left
+out.
+
+	GET /companies/{companyId}/accounts/{accountId}/statement?from=2024-03-01&to=2024-03-31
+	Accept: application/json (default), text/csv or application/pdf,
+	or ?format=csv or ?format=pdf
+
+from and to are RFC 3339 times or dates. A date as from means the start of
+that UTC day and as to the end of it, so the example covers all of March.
+to defaults to now; a period must not end before it starts.
+*/
+func (h *Statement) Period(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	now := time.Now().UTC()
+	if q.Get("from") == "" {
+		badRequest(w, r, "from is required")
+		return
+	}
+	from, err := parseInstant(q.Get("from"), false)
+	if err != nil {
+		badRequest(w, r, "from "+err.Error())
+		return
+	}
+	to := now
+	if q.Get("to") != "" {
+		if to, err = parseInstant(q.Get("to"), true); err != nil {
+			badRequest(w, r, "to "+err.Error())
+			return
+		}
+	}
+	if to.Before(from) {
+		badRequest(w, r, "to is before from")
+		return
+	}
+	if to.After(now) {
+		to = now
+	}
+	if from.After(to) {
+		from = to
+	}
+
+	st, ok := h.statement(w, r, from, to)
+	if !ok {
+		return
+	}
+	switch {
+	case q.Get("format") == "csv" || accepts(r, CSVContentType):
+		writeStatementCSV(w, st)
+		return
+	case q.Get("format") == "pdf" || accepts(r, pdf.ContentType):
+		writeStatementPDF(w, r, st, now)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+/*
+Balance is a handler for an account's balance at a point in time, worked out
+from the transfers settled since.
+
+	GET /companies/{companyId}/accounts/{accountId}/balance?at=2024-03-01T12:00:00Z
+
+at is an RFC 3339 time or a date, meaning the start of that UTC day, and
+defaults to now.
+*/
+func (h *Statement) Balance(w http.ResponseWriter, r *http.Request) {
+	at := time.Now().UTC()
+	if raw := r.URL.Query().Get("at"); raw != "" {
+		var err error
+		if at, err = parseInstant(raw, false); err != nil {
+			badRequest(w, r, "at "+err.Error())
+			return
+		}
+	}
+	vars := mux.Vars(r)
+	companyID, _ := strconv.ParseInt(vars["companyId"], 10, 64)
+	accountID, _ := strconv.ParseInt(vars["accountId"], 10, 64)
+	b, err := h.Repo.BalanceAt(r.Context(), companyID, accountID, at)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, b)
+}
+
+// parseInstant reads an RFC 3339 time, or a date as the start of that UTC
+// day, or the end of it if end is set.
+func parseInstant(raw string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t.UTC(), nil
+	}
+	d, err := time.Parse(time.DateOnly, raw)
+	if err != nil {
+		return d, errors.New("must be a date such as 2024-03-01 or a time such as 2024-03-01T12:00:00Z")
+	}
+	if end {
+		d = d.AddDate(0, 0, 1)
+	}
+	return d, nil
+}
+
+// writeStatementCSV writes st as CSV: an opening row, a debit or credit row
+// per transfer and a closing row, each with the balance after it.
+func writeStatementCSV(w http.ResponseWriter, st model.Statement) {
+	w.Header().Set("Content-Type", CSVContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s-%s.csv"`,
+		st.Account.Number, st.From.Format("20060102"), st.To.Format("20060102")))
+	w.WriteHeader(http.StatusOK)
+
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"type", "booked_at", "tx_id", "counterparty_account_number",
+		"reference", "memo", "value_date", "amount", "balance"})
+	_ = cw.Write([]string{"opening", st.From.Format(time.RFC3339), "", "", "", "", "", "",
+		money(st.Opening)})
+	for _, e := range st.Entries {
+		kind := "credit"
+		if e.Amount < 0 {
+			kind = "debit"
+		}
+		_ = cw.Write([]string{kind, e.BookedAt.UTC().Format(time.RFC3339), strconv.FormatInt(e.TxID, 10),
+			e.Counterparty, deref(e.Reference), deref(e.Memo), deref(e.ValueDate),
+			money(e.Amount), money(e.Balance)})
+	}
+	_ = cw.Write([]string{"closing", st.To.Format(time.RFC3339), "", "", "", "", "", "",
+		money(st.Closing)})
+	cw.Flush()
+}
+
+func money(amount float64) string { return strconv.FormatFloat(amount, 'f', 2, 64) }
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// statement loads the statement of the account in the path over [from, to).
+// It writes the problem and returns false if it cannot.
+func (h *Statement) statement(w http.ResponseWriter, r *http.Request, from, to time.Time) (model.Statement, bool) {
+	vars := mux.Vars(r)
+	companyID, _ := strconv.ParseInt(vars["companyId"], 10, 64)
+	accountID, _ := strconv.ParseInt(vars["accountId"], 10, 64)
+	st, err := h.Repo.Statement(r.Context(), companyID, accountID, from, to)
+	if err != nil {
+		writeError(w, r, err)
+		return st, false
+	}
+	return st, true
+}
+
+// statementDay is the start of the UTC day named by the "date" query
+// parameter, or of the day of def if there is none.
+func statementDay(w http.ResponseWriter, r *http.Request, def time.Time) (time.Time, bool) {
+	raw := r.URL.Query().Get("date")
+	if raw == "" {
+		return def.Truncate(24 * time.Hour), true
+	}
+	day, err := time.Parse(time.DateOnly, raw)
+	if err != nil {
+		badRequest(w, r, "date must be a date such as 2024-03-01")
+		return day, false
+	}
+	return day, true
+}
+
+// writeStatementPDF renders st as a PDF. It is rendered in full before
+// anything is written so that a failure can still be reported as a problem.
+func writeStatementPDF(w http.ResponseWriter, r *http.Request, st model.Statement, now time.Time) {
+	var buf bytes.Buffer
+	if err := pdf.Statement(&buf, st, now); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", pdf.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s-%s.pdf"`,
+		st.Account.Number, st.From.Format("20060102"), st.To.Format("20060102")))
+	w.WriteHeader(http.StatusOK)
+	_, _ = buf.WriteTo(w)
+}
+
+func writeXML(w http.ResponseWriter, r *http.Request, body []byte, err error) {
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", XMLContentType)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
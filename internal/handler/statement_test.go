@@ -0,0 +1,219 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/token-cjg/minibank/internal/handler"
+	"github.com/token-cjg/minibank/internal/pdf"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+func depsStatement(t *testing.T) (*handler.Statement, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	return handler.NewStatement(repo.New(db)), mock
+}
+
+var accountVars = map[string]string{"companyId": "1", "accountId": "10"}
+
+// expectStatement expects the statement of account 10 of company 1 over
+// [from, to), with one settled debit.
+func expectStatement(mock sqlmock.Sqlmock, from, to time.Time) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT a.account_id`).
+		WithArgs(int64(1), int64(10), from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"account_id", "company_id", "account_number",
+			"account_balance", "company_name", "opening", "closing"}).
+			AddRow(10, 1, "1000000000000000", 900.0, "Acme", 1000.0, 900.0))
+	mock.ExpectQuery(`SELECT e.tx_id`).
+		WithArgs(int64(10), from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"tx_id", "created_at", "amount", "account_number",
+			"reference", "memo", "value_date"}).
+			AddRow(7, from.Add(time.Hour), -100.0, "1000000000000001", "INV-1", nil, nil))
+	mock.ExpectCommit()
+}
+
+func TestStatementCamt053_OK(t *testing.T) {
+	h, mock := depsStatement(t)
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	expectStatement(mock, day, day.AddDate(0, 0, 1))
+
+	rec := perform(h.Camt053, http.MethodGet, "/companies/1/accounts/10/camt.053?date=2024-03-01",
+		accountVars, nil)
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != handler.XMLContentType {
+		t.Fatalf("status %d, content type %q: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"camt.053.001.02", "<Cd>OPBD</Cd>", "<Cd>CLBD</Cd>",
+		"<EndToEndId>INV-1</EndToEndId>", "<Id>1000000000000001</Id>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("statement lacks %s:\n%s", want, body)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
+
+func TestStatementCamt053_DayNotOver(t *testing.T) {
+	h, _ := depsStatement(t)
+	today := time.Now().UTC().Format(time.DateOnly)
+
+	rec := perform(h.Camt053, http.MethodGet, "/companies/1/accounts/10/camt.053?date="+today,
+		accountVars, nil)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", rec.Code)
+	}
+}
+
+func TestStatementCamt052_PastDay(t *testing.T) {
+	h, mock := depsStatement(t)
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	expectStatement(mock, day, day.AddDate(0, 0, 1))
+
+	rec := perform(h.Camt052, http.MethodGet, "/companies/1/accounts/10/camt.052?date=2024-03-01",
+		accountVars, nil)
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<Cd>ITBD</Cd>") {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
+
+func TestStatementCamt053_OtherCompany(t *testing.T) {
+	h, mock := depsStatement(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT a.account_id`).WillReturnRows(sqlmock.NewRows([]string{"account_id"}))
+	mock.ExpectRollback()
+
+	rec := perform(h.Camt053, http.MethodGet, "/companies/1/accounts/10/camt.053",
+		accountVars, nil)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status %d, want 404", rec.Code)
+	}
+}
+
+func TestStatementCamt053_BadDate(t *testing.T) {
+	h, _ := depsStatement(t)
+	rec := perform(h.Camt053, http.MethodGet, "/companies/1/accounts/10/camt.053?date=01/03/2024",
+		accountVars, nil)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", rec.Code)
+	}
+}
+
+func TestStatementPeriod_JSON(t *testing.T) {
+	h, mock := depsStatement(t)
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	expectStatement(mock, from, from.AddDate(0, 1, 0))
+
+	rec := perform(h.Period, http.MethodGet, "/companies/1/accounts/10/statement?from=2024-03-01&to=2024-03-31",
+		accountVars, nil)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var st struct {
+		Opening float64 `json:"opening_balance"`
+		Closing float64 `json:"closing_balance"`
+		Entries []struct {
+			Amount  float64 `json:"amount"`
+			Balance float64 `json:"balance"`
+		} `json:"entries"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Opening != 1000 || st.Closing != 900 || len(st.Entries) != 1 ||
+		st.Entries[0].Amount != -100 || st.Entries[0].Balance != 900 {
+		t.Errorf("statement %+v", st)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
+
+func TestStatementPeriod_CSV(t *testing.T) {
+	h, mock := depsStatement(t)
+	from := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+	expectStatement(mock, from, to)
+
+	req := httptest.NewRequest(http.MethodGet,
+		"/companies/1/accounts/10/statement?from=2024-03-01T09:00:00Z&to=2024-03-01", nil)
+	req.Header.Set("Accept", "text/csv")
+	rec := httptest.NewRecorder()
+	h.Period(rec, mux.SetURLVars(req, accountVars))
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != handler.CSVContentType {
+		t.Fatalf("status %d, content type %q: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+	}
+	want := "type,booked_at,tx_id,counterparty_account_number,reference,memo,value_date,amount,balance\n" +
+		"opening,2024-03-01T09:00:00Z,,,,,,,1000.00\n" +
+		"debit,2024-03-01T10:00:00Z,7,1000000000000001,INV-1,,,-100.00,900.00\n" +
+		"closing,2024-03-02T00:00:00Z,,,,,,,900.00\n"
+	if rec.Body.String() != want {
+		t.Errorf("CSV:\n%s\nwant:\n%s", rec.Body, want)
+	}
+}
+
+func TestStatementPeriod_BadPeriod(t *testing.T) {
+	h, _ := depsStatement(t)
+	for _, query := range []string{"", "?from=yesterday", "?from=2024-03-02&to=2024-02-28"} {
+		rec := perform(h.Period, http.MethodGet, "/companies/1/accounts/10/statement"+query,
+			accountVars, nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: status %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+func TestStatementBalance(t *testing.T) {
+	h, mock := depsStatement(t)
+	at := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT a.account_balance`).
+		WithArgs(int64(1), int64(10), at).
+		WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(412.5))
+
+	rec := perform(h.Balance, http.MethodGet, "/companies/1/accounts/10/balance?at=2024-03-01",
+		accountVars, nil)
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"balance":412.5`) {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
+
+func TestStatementPeriod_PDF(t *testing.T) {
+	h, mock := depsStatement(t)
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	expectStatement(mock, from, from.AddDate(0, 1, 0))
+
+	rec := perform(h.Period, http.MethodGet,
+		"/companies/1/accounts/10/statement?from=2024-03-01&to=2024-03-31&format=pdf", accountVars, nil)
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != pdf.ContentType {
+		t.Fatalf("status %d, content type %q: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+	}
+	if !strings.HasPrefix(rec.Body.String(), "%PDF-") {
+		t.Errorf("body is not a PDF: %.40q", rec.Body)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, "1000000000000000-20240301-20240401.pdf") {
+		t.Errorf("Content-Disposition %q", cd)
+	}
+}
@@ -1,23 +1,50 @@
 package handler
 
 import (
-	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/token-cjg/minibank/internal/auth"
+	"github.com/token-cjg/minibank/internal/csvimport"
+	"github.com/token-cjg/minibank/internal/model"
 	"github.com/token-cjg/minibank/internal/repo"
+	"github.com/token-cjg/minibank/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-type Transfer struct{ Repo *repo.Repo }
+type Transfer struct {
+	Repo *repo.Repo
+	// MaxUploadBytes caps the request body; 0 means no cap.
+	MaxUploadBytes int64
+	// ChunkRows is how many rows of a CSV upload are read and run as one
+	// batch before the next are read; 0 runs the whole upload as one.
+	ChunkRows int
+}
+
+// DefaultMaxUploadBytes is the upload cap unless the server configuration
+// overrides it.
+const DefaultMaxUploadBytes = 100 << 20
+
+// DefaultChunkRows is the CSV chunk size unless the server configuration
+// overrides it.
+const DefaultChunkRows = 10_000
 
-func NewTransfer(r *repo.Repo) *Transfer { return &Transfer{Repo: r} }
+func NewTransfer(r *repo.Repo) *Transfer {
+	return &Transfer{Repo: r, MaxUploadBytes: DefaultMaxUploadBytes, ChunkRows: DefaultChunkRows}
+}
 
 const FileUploadField = "file"
 
+// NDJSONContentType is the media type of streamed transfer results.
+const NDJSONContentType = "application/x-ndjson"
+
 /* Batch is a handler for transferring money between accounts.
  * 	POST /transfer
  * 	Content-Type: multipart/form-data
@@ -25,88 +52,360 @@ const FileUploadField = "file"
  * 	OR
  * 	Content-Type: text/csv
  * 	Body: <csv data>
+ * 	OR
+ * 	Content-Type: application/json or application/x-ndjson (see batchJSON)
+ * 	Body: a transfer, an array of transfers, or one transfer per line
+ * 	OR
+ * 	Content-Type: application/xml (see batchPain001)
+ * 	Body: an ISO 20022 pain.001 credit transfer initiation
  * 	CSV format: <source_account_id>,<target_account_id>,<amount>
  * 	Example:
  * 		1,2,100.50
  * 		3,4,200.00
  * 		5,6,300.75
  * 	Returns:
- * 		201 Created
- * 		400 Bad Request if the CSV is malformed or the request is not multipart/form-data
+ * 		204 No Content
+ * 		200 OK with one application/x-ndjson line per row when the client
+ * 		    sends Accept: application/x-ndjson or an NDJSON body (see stream)
+ * 		200 OK with the results of a JSON body, or a pain.002 report for a pain.001 body
+ * 		400 Bad Request if the CSV is malformed
+ * 		403 Forbidden if the client certificate's company does not own a source account
+ * 		422 Unprocessable Entity if an amount is not positive with at most two decimals
+ * 		415 Unsupported Media Type if the request is not CSV, JSON, NDJSON or XML
  * 		500 Internal Server Error if the server encounters an error
+ * 		Errors are application/problem+json; batch failures carry the 1-based "row".
  * 	Notes:
  * 		- The CSV file can be uploaded as a file part in a multipart/form-data request.
  * 		- The CSV file can also be sent as a text/csv request body.
  * 		- The CSV file must contain three columns: source_account_id, target_account_id, and amount.
  * 		- The source_account_id and target_account_id must be valid account IDs.
- * 		- The amount must be a valid float64 value.
+ * 		- The amount must be a positive decimal with at most two decimal places.
  * 		- The transfer will be processed in a batch, and the response will indicate the status of the transfer.
  * 		- The transfer will be processed in the order they appear in the CSV file.
+ * 		- Every row is parsed and authorized before any runs, so a malformed or
+ * 		  forbidden row rejects the whole upload. Rows beyond the first
+ * 		  ChunkRows wait in a temporary file, so an upload of any size is
+ * 		  read in bounded memory.
+ * 		- The rows then run ChunkRows at a time. A row that fails stops the
+ * 		  upload there; earlier chunks have been applied, and the problem
+ * 		  says which rows.
  */
 func (h *Transfer) Batch(w http.ResponseWriter, r *http.Request) {
-	ct := r.Header.Get("Content-Type")
-
-	var csvReader *csv.Reader
+	if h.MaxUploadBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, h.MaxUploadBytes)
+	}
+	defer r.Body.Close()
 
-	switch {
-	case strings.HasPrefix(ct, "multipart/form-data"):
-		// Parse up to 10 MB of file parts into memory before spilling to disk
-		if err := r.ParseMultipartForm(10 << 20); err != nil {
-			http.Error(w, "bad multipart form: "+err.Error(), http.StatusBadRequest)
+	switch mt := mediaType(r); mt {
+	case JSONContentType, NDJSONContentType, XMLContentType, "text/xml":
+		if r.URL.Query().Has("profile") {
+			badRequest(w, r, "profile applies only to CSV uploads")
 			return
 		}
-		file, _, err := r.FormFile(FileUploadField)
-		if err != nil {
-			http.Error(w, "missing file: "+err.Error(), http.StatusBadRequest)
-			return
+		switch mt {
+		case JSONContentType:
+			h.batchJSON(w, r)
+		case NDJSONContentType:
+			dec := json.NewDecoder(r.Body)
+			dec.DisallowUnknownFields()
+			h.stream(w, r, jsonRows(dec))
+		default:
+			h.batchPain001(w, r)
 		}
-		defer file.Close()
-		csvReader = csv.NewReader(file)
+		return
+	}
 
-	case ct == "text/csv" || ct == "text/plain":
-		csvReader = csv.NewReader(r.Body)
-		defer r.Body.Close()
+	profile, ok := h.importProfile(w, r)
+	if !ok {
+		return
+	}
+	body, ok := csvBody(w, r)
+	if !ok {
+		return
+	}
+	rows, err := csvimport.NewReader(body, profile)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-	default:
-		http.Error(w, "expect multipart/form-data or text/csv", http.StatusUnsupportedMediaType)
+	if acceptsNDJSON(r) {
+		h.stream(w, r, csvRows(rows))
 		return
 	}
 
-	csvReader.FieldsPerRecord = 3
-	defer r.Body.Close()
+	rc := http.NewResponseController(w)
+	// a large upload may take longer to read than the server's read timeout
+	_ = rc.SetReadDeadline(time.Time{})
+	spool, ok := h.readUpload(w, r, csvRows(rows))
+	if !ok {
+		return
+	}
+	defer spool.close()
 
-	var txns []repo.TransferInput
-	line := 1
-	for {
-		rec, err := csvReader.Read()
+	// nor need running it fit in the write timeout; the answer gets its own
+	_ = rc.SetWriteDeadline(time.Time{})
+	for num := 1; ; {
+		txns, err := spool.next()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			msg := fmt.Sprintf("bad CSV on line %d: %v", line, err)
-			http.Error(w, msg, http.StatusBadRequest)
+			_ = rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			writeError(w, r, err)
 			return
 		}
-		src, e1 := strconv.ParseInt(rec[0], 10, 64)
-		dst, e2 := strconv.ParseInt(rec[1], 10, 64)
-		amt, e3 := strconv.ParseFloat(rec[2], 64)
-		if err := firstErr(e1, e2, e3); err != nil {
-			msg := fmt.Sprintf("parse error on line %d: %v", line, err)
-			http.Error(w, msg, http.StatusBadRequest)
+		if berr := h.Repo.BatchTransfer(r.Context(), txns); berr != nil {
+			_ = rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			p := batchProblem(berr, num)
+			if num > 1 {
+				p.Detail += fmt.Sprintf(" (rows 1 to %d had been applied)", num-1)
+			}
+			WriteProblem(w, r, p)
 			return
 		}
-		txns = append(txns, repo.TransferInput{Source: src, Target: dst, Amount: amt})
-		line++
+		num += len(txns)
 	}
 
-	if berr := h.Repo.BatchTransfer(r.Context(), txns); berr != nil {
-		status := http.StatusInternalServerError
-		resp := map[string]any{"error": berr.Err.Error(), "row": berr.Row + 1}
-		writeJSON(w, status, resp)
-		return
+	_ = rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readUpload reads and checks every row of a CSV upload, ChunkRows at a
+// time: that it parses and, for an authenticated company, that the company
+// owns its source account. It writes the problem and returns false if a row
+// is rejected; nothing has run then.
+func (h *Transfer) readUpload(w http.ResponseWriter, r *http.Request, next rowSource) (*uploadSpool, bool) {
+	company, authenticated := auth.Company(r.Context())
+	spool := &uploadSpool{chunk: h.ChunkRows}
+	for num := 1; ; {
+		txns, last, ok := h.readChunk(w, r, next, num)
+		if ok && authenticated && len(txns) > 0 {
+			ok = h.checkOwnership(w, r, company, txns, num)
+		}
+		if !ok {
+			spool.close()
+			return nil, false
+		}
+		for _, t := range txns {
+			if err := spool.add(t); err != nil {
+				spool.close()
+				writeError(w, r, err)
+				return nil, false
+			}
+		}
+		if last {
+			return spool, true
+		}
+		num += len(txns)
 	}
+}
 
-	w.WriteHeader(http.StatusNoContent)
+// batchProblem is the problem for a failed batch whose first row is row
+// num. A failure no row is to blame for, such as the bulk engine's, has no
+// row.
+func batchProblem(berr *repo.BatchError, num int) Problem {
+	p := problemFor(berr.Err)
+	if berr.Row >= 0 {
+		p.Row = num + berr.Row
+	}
+	return p
+}
+
+// readChunk reads up to ChunkRows rows from next, the first of them row
+// num, and reports whether the upload ended with them. It writes the
+// problem and returns false if a row is rejected.
+func (h *Transfer) readChunk(w http.ResponseWriter, r *http.Request, next rowSource, num int) (txns []repo.TransferInput, last, ok bool) {
+	_, parse := tracing.Tracer().Start(r.Context(), "csv.parse")
+	defer parse.End()
+
+	for h.ChunkRows <= 0 || len(txns) < h.ChunkRows {
+		t, p, err := next(num + len(txns))
+		if err == io.EOF {
+			last = true
+			break
+		}
+		if p != nil {
+			WriteProblem(w, r, *p)
+			return nil, false, false
+		}
+		txns = append(txns, t)
+	}
+	parse.SetAttributes(attribute.Int("batch.rows", len(txns)))
+	return txns, last, true
+}
+
+// csvBody returns the CSV in the request: the "file" part of a multipart
+// form, read straight from the part so nothing is buffered or spilled to
+// disk, or the body itself. It writes the problem and returns false if
+// there is none.
+func csvBody(w http.ResponseWriter, r *http.Request) (io.Reader, bool) {
+	ct := r.Header.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(ct, "multipart/form-data"):
+		mr, err := r.MultipartReader()
+		if err != nil {
+			badRequest(w, r, "bad multipart form: "+err.Error())
+			return nil, false
+		}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				badRequest(w, r, "missing file: no "+strconv.Quote(FileUploadField)+" part")
+				return nil, false
+			}
+			if err != nil {
+				badRequest(w, r, "bad multipart form: "+err.Error())
+				return nil, false
+			}
+			if part.FormName() == FileUploadField {
+				return part, true
+			}
+		}
+
+	case ct == "text/csv" || ct == "text/plain":
+		return r.Body, true
+
+	default:
+		WriteProblem(w, r, NewProblem(http.StatusUnsupportedMediaType, CodeUnsupportedMedia,
+			"expect multipart/form-data, text/csv, application/json, application/x-ndjson or application/xml"))
+		return nil, false
+	}
+}
+
+// rowSource reads row num, counting from 1, of an upload. It returns io.EOF
+// after the last row, or the problem that rejects the row.
+type rowSource func(num int) (repo.TransferInput, *Problem, error)
+
+// csvRows reads the rows of a CSV upload.
+func csvRows(rows *csvimport.Reader) rowSource {
+	return func(num int) (repo.TransferInput, *Problem, error) {
+		row, err := rows.Read()
+		if err == io.EOF {
+			return repo.TransferInput{}, nil, io.EOF
+		}
+		t, p := parseRow(row, err, num)
+		return t, p, nil
+	}
+}
+
+// mediaType is the request's Content-Type without parameters.
+func mediaType(r *http.Request) string {
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mt
+}
+
+// parseRow turns data row num, read with error readErr, into a transfer,
+// or into the problem that rejects it. Problems carry num as their row and
+// name the file line, which differs when the file has a header.
+func parseRow(row csvimport.Row, readErr error, num int) (repo.TransferInput, *Problem) {
+	if readErr != nil {
+		p := NewProblem(http.StatusBadRequest, CodeBadRequest, "bad CSV: "+readErr.Error())
+		p.Row = num
+		return repo.TransferInput{}, &p
+	}
+	src, e1 := strconv.ParseInt(row.Source, 10, 64)
+	dst, e2 := strconv.ParseInt(row.Target, 10, 64)
+	if err := firstErr(e1, e2); err != nil {
+		p := NewProblem(http.StatusBadRequest, CodeBadRequest,
+			fmt.Sprintf("parse error on line %d: %v", row.Line, err))
+		p.Row = num
+		return repo.TransferInput{}, &p
+	}
+	var verrs ValidationErrors
+	amt := verrs.checkAmount("amount", row.Amount, true)
+	valueDate := verrs.checkDetails(row.Reference, row.Memo, row.ValueDate)
+	if verrs != nil {
+		p := NewProblem(http.StatusUnprocessableEntity, CodeValidation,
+			fmt.Sprintf("invalid %s on line %d", verrs[0].Field, row.Line))
+		p.Row, p.Errors = num, verrs
+		return repo.TransferInput{}, &p
+	}
+	return repo.TransferInput{
+		Source:    src,
+		Target:    dst,
+		Amount:    amt,
+		Reference: row.Reference,
+		Memo:      row.Memo,
+		ValueDate: valueDate,
+	}, nil
+}
+
+// importProfile loads the profile named by the "profile" query parameter.
+// Profiles belong to a company: the authenticated one, or the one named by
+// "company_id". It returns nil, true when no profile was asked for, and
+// writes the problem and returns false when the profile cannot be used.
+func (h *Transfer) importProfile(w http.ResponseWriter, r *http.Request) (*model.ImportProfile, bool) {
+	q := r.URL.Query()
+	name := q.Get("profile")
+	if name == "" {
+		return nil, true
+	}
+	company, authenticated := auth.Company(r.Context())
+	if raw := q.Get("company_id"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			badRequest(w, r, "company_id must be an integer")
+			return nil, false
+		}
+		if authenticated && id != company {
+			WriteProblem(w, r, NewProblem(http.StatusForbidden, CodeForbidden,
+				"company_id is not the authenticated company"))
+			return nil, false
+		}
+		company, authenticated = id, true
+	}
+	if !authenticated {
+		badRequest(w, r, "profile needs company_id")
+		return nil, false
+	}
+	p, err := h.Repo.GetImportProfile(r.Context(), company, name)
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			WriteProblem(w, r, NewProblem(http.StatusNotFound, CodeNotFound,
+				fmt.Sprintf("company %d has no import profile %q", company, name)))
+			return nil, false
+		}
+		writeError(w, r, err)
+		return nil, false
+	}
+	return &p, true
+}
+
+// checkOwnership rejects the batch, whose first row is row num, with 403 if
+// an authenticated company tries to debit an account owned by another
+// company. It reports whether the batch may proceed.
+func (h *Transfer) checkOwnership(w http.ResponseWriter, r *http.Request, company int64, txns []repo.TransferInput, num int) bool {
+	seen := make(map[int64]bool)
+	var sources []int64
+	for _, t := range txns {
+		if !seen[t.Source] {
+			seen[t.Source] = true
+			sources = append(sources, t.Source)
+		}
+	}
+	foreign, err := h.Repo.AccountsOutsideCompany(r.Context(), company, sources)
+	if err != nil {
+		writeError(w, r, err)
+		return false
+	}
+	if len(foreign) == 0 {
+		return true
+	}
+	bad := make(map[int64]bool, len(foreign))
+	for _, n := range foreign {
+		bad[n] = true
+	}
+	for i, t := range txns {
+		if bad[t.Source] {
+			p := NewProblem(http.StatusForbidden, CodeForbidden,
+				fmt.Sprintf("source account %d does not belong to the authenticated company", t.Source))
+			p.Row = num + i
+			WriteProblem(w, r, p)
+			return false
+		}
+	}
+	return true
 }
 
 func firstErr(errs ...error) error {
@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/token-cjg/minibank/internal/auth"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+// JSONContentType is the media type of a single transfer or an array of them.
+const JSONContentType = "application/json"
+
+// Limits on the optional details of a JSON transfer. They match the ISO
+// 20022 end-to-end id and unstructured remittance information.
+const (
+	MaxReferenceLen = 35
+	MaxMemoLen      = 140
+)
+
+// ValueDateLayout is the format of value_date.
+const ValueDateLayout = time.DateOnly
+
+// transferRequest is one transfer in a JSON or NDJSON upload.
+type transferRequest struct {
+	Source    int64           `json:"source"`
+	Target    int64           `json:"target"`
+	Amount    json.RawMessage `json:"amount"`
+	Reference string          `json:"reference"`
+	Memo      string          `json:"memo"`
+	ValueDate string          `json:"value_date"`
+}
+
+// input validates req and turns it into a transfer.
+func (req transferRequest) input() (repo.TransferInput, ValidationErrors) {
+	var v ValidationErrors
+	if req.Source == 0 {
+		v.add("source", FieldRequired, "is required")
+	}
+	if req.Target == 0 {
+		v.add("target", FieldRequired, "is required")
+	}
+	amt := v.checkAmount("amount", string(req.Amount), true)
+	valueDate := v.checkDetails(req.Reference, req.Memo, req.ValueDate)
+	if v != nil {
+		return repo.TransferInput{}, v
+	}
+	return repo.TransferInput{
+		Source:    req.Source,
+		Target:    req.Target,
+		Amount:    amt,
+		Reference: req.Reference,
+		Memo:      req.Memo,
+		ValueDate: valueDate,
+	}, nil
+}
+
+// checkDetails validates a transfer's optional details, any of which may be
+// empty, and returns the parsed value date.
+func (v *ValidationErrors) checkDetails(reference, memo, valueDate string) time.Time {
+	if reference != "" {
+		v.checkName("reference", reference, MaxReferenceLen)
+	}
+	if memo != "" {
+		v.checkName("memo", memo, MaxMemoLen)
+	}
+	if valueDate == "" {
+		return time.Time{}
+	}
+	d, err := time.Parse(ValueDateLayout, valueDate)
+	if err != nil {
+		v.add("value_date", FieldInvalid, "must be a date such as 2024-01-31")
+	}
+	return d
+}
+
+// ValidateTransfer checks one transfer as a JSON upload to POST /transfer
+// does and turns it into a repo transfer. amount is the decimal as the
+// client wrote it; the optional details may be empty.
+func ValidateTransfer(source, target int64, amount, reference, memo, valueDate string) (repo.TransferInput, ValidationErrors) {
+	return transferRequest{
+		Source:    source,
+		Target:    target,
+		Amount:    json.RawMessage(amount),
+		Reference: reference,
+		Memo:      memo,
+		ValueDate: valueDate,
+	}.input()
+}
+
+// jsonRows reads transfers one JSON value at a time from dec, which is
+// either inside an array or at the top level of an NDJSON stream.
+func jsonRows(dec *json.Decoder) rowSource {
+	return func(num int) (repo.TransferInput, *Problem, error) {
+		if !dec.More() {
+			return repo.TransferInput{}, nil, io.EOF
+		}
+		var req transferRequest
+		if err := dec.Decode(&req); err != nil {
+			p := transferDecodeProblem(fieldDecodeError(err))
+			p.Row = num
+			return repo.TransferInput{}, &p, nil
+		}
+		t, verrs := req.input()
+		if verrs != nil {
+			p := NewProblem(http.StatusUnprocessableEntity, CodeValidation,
+				fmt.Sprintf("invalid transfer in row %d", num))
+			p.Row, p.Errors = num, verrs
+			return t, &p, nil
+		}
+		return t, nil, nil
+	}
+}
+
+// transferDecodeProblem is the problem for a transfer that could not be
+// decoded, with the status writeDecodeError would use.
+func transferDecodeProblem(err error) Problem {
+	var v ValidationErrors
+	if errors.As(err, &v) {
+		p := NewProblem(http.StatusUnprocessableEntity, CodeValidation, "invalid transfer")
+		p.Errors = v
+		return p
+	}
+	var tooBig *http.MaxBytesError
+	if errors.As(err, &tooBig) {
+		return NewProblem(http.StatusRequestEntityTooLarge, CodeBadRequest,
+			fmt.Sprintf("request body exceeds %d bytes", tooBig.Limit))
+	}
+	return NewProblem(http.StatusBadRequest, CodeBadRequest, "malformed JSON: "+err.Error())
+}
+
+// transferResults is the response to a JSON array of transfers.
+type transferResults struct {
+	Results []rowResult   `json:"results"`
+	Summary streamSummary `json:"summary"`
+}
+
+/*
+batchJSON is Batch for Content-Type: application/json. The body is one
+transfer or an array of them:
+
+	{"source": 1000000000000000, "target": 1000000000000001, "amount": 100.50,
+	 "reference": "INV-42", "memo": "March rent", "value_date": "2024-03-01"}
+
+Every transfer is validated, and the sources checked against the
+authenticated company, before any runs. The transfers then run as one batch,
+like a CSV upload, so large arrays get the parallel or bulk engine. A single
+transfer is answered with its result, an array with {"results": [...],
+"summary": {...}}. A transfer that fails is answered with its problem
+instead; those before it were applied unless the bulk engine ran the batch,
+which applies all or nothing.
+*/
+func (h *Transfer) batchJSON(w http.ResponseWriter, r *http.Request) {
+	br := bufio.NewReader(r.Body)
+	first, err := firstByte(br)
+	if err != nil {
+		WriteProblem(w, r, transferDecodeProblem(emptyBody(err)))
+		return
+	}
+	dec := json.NewDecoder(br)
+	dec.DisallowUnknownFields()
+	single := first != '['
+	if !single {
+		_, _ = dec.Token() // the opening bracket
+	}
+
+	next := jsonRows(dec)
+	var txns []repo.TransferInput
+	for num := 1; ; num++ {
+		t, p, err := next(num)
+		if err == io.EOF {
+			break
+		}
+		if p != nil {
+			WriteProblem(w, r, *p)
+			return
+		}
+		txns = append(txns, t)
+		if single {
+			break
+		}
+	}
+	if single && len(txns) == 0 {
+		badRequest(w, r, "request body must contain a single transfer or an array of them")
+		return
+	}
+	if !single {
+		if tok, err := dec.Token(); err != nil || tok != json.Delim(']') {
+			badRequest(w, r, "malformed JSON: the array of transfers is not closed")
+			return
+		}
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		badRequest(w, r, "request body must contain a single transfer or an array of them")
+		return
+	}
+
+	if company, ok := auth.Company(r.Context()); ok && len(txns) > 0 {
+		if !h.checkOwnership(w, r, company, txns, 1) {
+			return
+		}
+	}
+
+	outcomes, berr := h.Repo.BatchTransferOutcomes(r.Context(), txns)
+	if berr != nil {
+		WriteProblem(w, r, batchProblem(berr, 1))
+		return
+	}
+	out := transferResults{Results: make([]rowResult, len(txns))}
+	for i, t := range txns {
+		out.Results[i] = out.Summary.add(repo.RowResult{Row: i + 1, Input: t, Outcome: outcomes[i]})
+	}
+	out.Summary.Complete = true
+
+	if single {
+		writeJSON(w, http.StatusOK, out.Results[0])
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// firstByte returns the first non-space byte of br without consuming it.
+func firstByte(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b, br.UnreadByte()
+	}
+}
+
+func emptyBody(err error) error {
+	if errors.Is(err, io.EOF) {
+		return errors.New("request body is empty")
+	}
+	return err
+}
@@ -0,0 +1,153 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/token-cjg/minibank/internal/handler"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+func postBody(h *handler.Transfer, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/transfer", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	h.Batch(rec, req)
+	return rec
+}
+
+// expectLock expects the locking query of one transfer between accounts 1
+// and 2, numbered 1000000000000000 and 1000000000000001.
+func expectLock(mock sqlmock.Sqlmock, srcBal float64) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FOR UPDATE`).
+		WithArgs(int64(1000000000000000), int64(1000000000000001)).
+		WillReturnRows(sqlmock.NewRows([]string{"account_number", "account_id", "account_balance"}).
+			AddRow(int64(1000000000000000), 1, srcBal).
+			AddRow(int64(1000000000000001), 2, 0.0))
+}
+
+func TestTransferBatch_JSONSingle(t *testing.T) {
+	h, mock := depsTransfer(t)
+
+	expectLock(mock, 500.0)
+	mock.ExpectExec(`UPDATE account`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE account`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO transaction`).
+		WithArgs(int64(1), int64(2), 100.5, nil, "INV-42", "March rent", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	rec := postBody(h, "application/json; charset=utf-8", `{"source": 1000000000000000, "target": 1000000000000001,
+		"amount": 100.50, "reference": "INV-42", "memo": "March rent", "value_date": "2024-03-01"}`)
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("status %d, content type %q: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+	}
+	var got map[string]any
+	_ = json.Unmarshal(rec.Body.Bytes(), &got)
+	if got["row"] != 1.0 || got["outcome"] != string(repo.Settled) || got["reference"] != "INV-42" {
+		t.Errorf("body %v", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
+
+func TestTransferBatch_JSONArray(t *testing.T) {
+	h, mock := depsTransfer(t)
+
+	expectLock(mock, 5.0)
+	mock.ExpectExec(`INSERT INTO transaction`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	rec := postBody(h, handler.JSONContentType,
+		`[{"source": 1000000000000000, "target": 1000000000000001, "amount": 10}]`)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var got struct {
+		Results []map[string]any
+		Summary map[string]any
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &got)
+	if len(got.Results) != 1 || got.Results[0]["outcome"] != string(repo.DeclinedInsufficient) {
+		t.Errorf("results %v", got.Results)
+	}
+	want := map[string]any{"rows": 1.0, "settled": 0.0, "declined": 1.0, "failed": 0.0, "complete": true}
+	if !reflect.DeepEqual(got.Summary, want) {
+		t.Errorf("summary %v, want %v", got.Summary, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
+
+func TestTransferBatch_JSONRejectedBeforeRunning(t *testing.T) {
+	for _, tc := range []struct {
+		name, body string
+		status     int
+		row        int
+	}{
+		{"empty", ``, http.StatusBadRequest, 0},
+		{"empty array of one", `[]`, http.StatusOK, 0},
+		{"unknown field", `{"source": 1, "target": 2, "amount": 1, "fee": 1}`, http.StatusUnprocessableEntity, 1},
+		{"bad second row", `[{"source": 1, "target": 2, "amount": 1},
+			{"source": 1, "target": 2, "amount": 1.001, "value_date": "01/03/2024"}]`, http.StatusUnprocessableEntity, 2},
+		{"reference too long", `{"source": 1, "target": 2, "amount": 1, "reference": "` + strings.Repeat("x", 36) + `"}`,
+			http.StatusUnprocessableEntity, 1},
+		{"unclosed array", `[{"source": 1, "target": 2, "amount": 1}`, http.StatusBadRequest, 2},
+		{"trailing data", `{"source": 1, "target": 2, "amount": 1} {}`, http.StatusBadRequest, 0},
+	} {
+		h, mock := depsTransfer(t)
+		rec := postBody(h, handler.JSONContentType, tc.body)
+		if rec.Code != tc.status {
+			t.Errorf("%s: status %d, want %d: %s", tc.name, rec.Code, tc.status, rec.Body)
+			continue
+		}
+		if tc.status != http.StatusOK {
+			if p := decodeProblem(t, rec.Body.Bytes()); p.Row != tc.row {
+				t.Errorf("%s: problem row %d, want %d", tc.name, p.Row, tc.row)
+			}
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+	}
+}
+
+func TestTransferBatch_NDJSONBody(t *testing.T) {
+	h, mock := depsTransfer(t)
+
+	expectLock(mock, 5.0)
+	mock.ExpectExec(`INSERT INTO transaction`).
+		WithArgs(int64(1), int64(2), 10.0, sqlmock.AnyArg(), "r-1", nil, nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	body := `{"source": 1000000000000000, "target": 1000000000000001, "amount": 10, "reference": "r-1"}` + "\n" +
+		`{"source": 1000000000000000, "target": 1000000000000001, "amount": -1}` + "\n"
+	req := httptest.NewRequest(http.MethodPost, "/transfer", strings.NewReader(body))
+	req.Header.Set("Content-Type", handler.NDJSONContentType)
+
+	lines := postNDJSON(t, h, req)
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want result, problem and summary: %v", len(lines), lines)
+	}
+	if lines[0]["reference"] != "r-1" || lines[0]["outcome"] != string(repo.DeclinedInsufficient) {
+		t.Errorf("line 1 = %v", lines[0])
+	}
+	if p, _ := lines[1]["problem"].(map[string]any); lines[1]["row"] != 2.0 || p["code"] != handler.CodeValidation {
+		t.Errorf("line 2 = %v", lines[1])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
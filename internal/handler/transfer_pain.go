@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/token-cjg/minibank/internal/auth"
+	"github.com/token-cjg/minibank/internal/iso20022"
+	"github.com/token-cjg/minibank/internal/model"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+// XMLContentType is the media type of pain.001 uploads and pain.002 reports.
+const XMLContentType = "application/xml"
+
+// maxMsgIDLen bounds an ISO 20022 message id.
+const maxMsgIDLen = 35
+
+/*
+batchPain001 is Batch for Content-Type: application/xml or text/xml. The body
+is an ISO 20022 pain.001.001.03 or pain.001.001.09 credit transfer
+initiation. Each PmtInf's debtor account and each transaction's creditor
+account must be a minibank account number, given as Othr/Id or as the last
+16 characters of an IBAN, and every InstdAmt must be in AUD. EndToEndId
+becomes the transfer's reference, unstructured remittance information its
+memo and ReqdExctnDt its value date.
+
+Transactions that cannot be run are rejected without running, the rest run
+in document order as one batch, like a CSV upload, and the answer is a
+pain.002 status report listing every transaction as ACSC or RJCT with a
+reason code. A message whose NbOfTxs or CtrlSum is wrong is rejected as a
+whole and nothing runs. As with the other formats, a transfer that fails is
+answered with its problem instead.
+*/
+func (h *Transfer) batchPain001(w http.ResponseWriter, r *http.Request) {
+	in, err := iso20022.ParsePain001(r.Body)
+	if err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			WriteProblem(w, r, NewProblem(http.StatusRequestEntityTooLarge, CodeBadRequest,
+				fmt.Sprintf("request body exceeds %d bytes", tooBig.Limit)))
+			return
+		}
+		badRequest(w, r, err.Error())
+		return
+	}
+
+	if in.CheckTotals() {
+		if !h.runPain001(w, r, in) {
+			return
+		}
+	}
+
+	report, err := in.Report(statusReportID(in.MsgID), time.Now())
+	writeXML(w, r, report, err)
+}
+
+// runPain001 rejects the transactions of in that cannot run and runs the
+// rest, setting every transaction's status. It writes the problem and
+// returns false if a transfer failed.
+func (h *Transfer) runPain001(w http.ResponseWriter, r *http.Request, in *iso20022.Initiation) bool {
+	var (
+		run   []*iso20022.CreditTransfer
+		txns  []repo.TransferInput
+		debts = make(map[int64]bool)
+	)
+	for _, p := range in.Payments {
+		src, srcOK := p.DebtorAccount.Number()
+		for _, ct := range p.Transfers {
+			t, st := painTransfer(p, ct, src, srcOK)
+			if st != nil {
+				ct.Status = *st
+				continue
+			}
+			run = append(run, ct)
+			txns = append(txns, t)
+			debts[src] = true
+		}
+	}
+
+	if company, ok := auth.Company(r.Context()); ok && len(debts) > 0 {
+		sources := make([]int64, 0, len(debts))
+		for n := range debts {
+			sources = append(sources, n)
+		}
+		foreign, err := h.Repo.AccountsOutsideCompany(r.Context(), company, sources)
+		if err != nil {
+			writeError(w, r, err)
+			return false
+		}
+		bad := make(map[int64]bool, len(foreign))
+		for _, n := range foreign {
+			bad[n] = true
+		}
+		var keptRun []*iso20022.CreditTransfer
+		var keptTxns []repo.TransferInput
+		for i, t := range txns {
+			if bad[t.Source] {
+				run[i].Status = iso20022.Rejected(iso20022.ReasonForbidden,
+					"debtor account does not belong to the authenticated company")
+				continue
+			}
+			keptRun = append(keptRun, run[i])
+			keptTxns = append(keptTxns, t)
+		}
+		run, txns = keptRun, keptTxns
+	}
+
+	outcomes, berr := h.Repo.BatchTransferOutcomes(r.Context(), txns)
+	if berr != nil {
+		p := problemFor(berr.Err)
+		if berr.Row >= 0 {
+			p.Detail = fmt.Sprintf("transaction %s: %s", run[berr.Row].EndToEndID, p.Detail)
+		}
+		WriteProblem(w, r, p)
+		return false
+	}
+	for i, out := range outcomes {
+		run[i].Status = painStatus(out)
+	}
+	return true
+}
+
+// painTransfer turns credit transfer ct of payment p, debiting account src
+// if srcOK, into a transfer, or into the status rejecting it.
+func painTransfer(p *iso20022.Payment, ct *iso20022.CreditTransfer, src int64, srcOK bool) (repo.TransferInput, *iso20022.Status) {
+	reject := func(reason, info string) (repo.TransferInput, *iso20022.Status) {
+		st := iso20022.Rejected(reason, info)
+		return repo.TransferInput{}, &st
+	}
+	if p.Method != "TRF" {
+		return reject(iso20022.ReasonNarrative, "only credit transfers, PmtMtd TRF, are supported")
+	}
+	if !srcOK {
+		return reject(iso20022.ReasonAccount,
+			fmt.Sprintf("debtor account %q is not a minibank account number", p.DebtorAccount))
+	}
+	dst, ok := ct.CreditorAccount.Number()
+	if !ok {
+		return reject(iso20022.ReasonAccount,
+			fmt.Sprintf("creditor account %q is not a minibank account number", ct.CreditorAccount))
+	}
+	var v ValidationErrors
+	amt := v.checkAmount("amount", ct.Amount, true)
+	if v != nil {
+		return reject(iso20022.ReasonAmount, "InstdAmt "+v[0].Message)
+	}
+	if ct.Currency != model.Currency {
+		return reject(iso20022.ReasonCurrency,
+			fmt.Sprintf("InstdAmt must be in %s, not %q", model.Currency, ct.Currency))
+	}
+	if utf8.RuneCountInString(ct.EndToEndID) > MaxReferenceLen {
+		return reject(iso20022.ReasonNarrative,
+			fmt.Sprintf("EndToEndId must be at most %d characters", MaxReferenceLen))
+	}
+	memo := ct.Remittance
+	if utf8.RuneCountInString(memo) > MaxMemoLen {
+		memo = string([]rune(memo)[:MaxMemoLen])
+	}
+	return repo.TransferInput{
+		Source:    src,
+		Target:    dst,
+		Amount:    amt,
+		Reference: ct.EndToEndID,
+		Memo:      memo,
+		ValueDate: p.ExecutionDate,
+	}, nil
+}
+
+// painStatus reports a transfer outcome in pain.002 terms.
+func painStatus(out repo.Outcome) iso20022.Status {
+	switch out {
+	case repo.Settled:
+		return iso20022.Status{Code: iso20022.StatusAccepted}
+	case repo.DeclinedInsufficient:
+		return iso20022.Rejected(iso20022.ReasonInsufficient, "insufficient balance")
+	default:
+		return iso20022.Rejected(iso20022.ReasonAccount, "debtor or creditor account not found")
+	}
+}
+
+// statusReportID derives the pain.002 message id from the pain.001 one.
+func statusReportID(msgID string) string {
+	id := "STS-" + msgID
+	if len(id) > maxMsgIDLen {
+		id = id[:maxMsgIDLen]
+	}
+	return id
+}
@@ -0,0 +1,168 @@
+package handler_test
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/token-cjg/minibank/internal/handler"
+)
+
+const pain001 = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.001.001.03">
+  <CstmrCdtTrfInitn>
+    <GrpHdr><MsgId>ERP-1</MsgId><CreDtTm>2024-03-01T09:30:00</CreDtTm><NbOfTxs>3</NbOfTxs></GrpHdr>
+    <PmtInf>
+      <PmtInfId>PAY-1</PmtInfId>
+      <PmtMtd>TRF</PmtMtd>
+      <ReqdExctnDt>2024-03-01</ReqdExctnDt>
+      <DbtrAcct><Id><Othr><Id>1000000000000000</Id></Othr></Id></DbtrAcct>
+      <CdtTrfTxInf>
+        <PmtId><EndToEndId>INV-1</EndToEndId></PmtId>
+        <Amt><InstdAmt Ccy="AUD">100.50</InstdAmt></Amt>
+        <CdtrAcct><Id><IBAN>AU001000000000000001</IBAN></Id></CdtrAcct>
+        <RmtInf><Ustrd>Invoice 1</Ustrd></RmtInf>
+      </CdtTrfTxInf>
+      <CdtTrfTxInf>
+        <PmtId><EndToEndId>INV-2</EndToEndId></PmtId>
+        <Amt><InstdAmt Ccy="AUD">0.001</InstdAmt></Amt>
+        <CdtrAcct><Id><Othr><Id>1000000000000001</Id></Othr></Id></CdtrAcct>
+      </CdtTrfTxInf>
+      <CdtTrfTxInf>
+        <PmtId><EndToEndId>INV-3</EndToEndId></PmtId>
+        <Amt><InstdAmt Ccy="AUD">9000</InstdAmt></Amt>
+        <CdtrAcct><Id><Othr><Id>1000000000000001</Id></Othr></Id></CdtrAcct>
+      </CdtTrfTxInf>
+    </PmtInf>
+  </CstmrCdtTrfInitn>
+</Document>`
+
+type pain002 struct {
+	XMLName xml.Name
+	GrpSts  string `xml:"CstmrPmtStsRpt>OrgnlGrpInfAndSts>GrpSts"`
+	Txs     []struct {
+		EndToEndID string `xml:"OrgnlEndToEndId"`
+		Status     string `xml:"TxSts"`
+		Reason     string `xml:"StsRsnInf>Rsn>Cd"`
+	} `xml:"CstmrPmtStsRpt>OrgnlPmtInfAndSts>TxInfAndSts"`
+}
+
+func TestTransferBatch_Pain001(t *testing.T) {
+	h, mock := depsTransfer(t)
+	valueDate := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	// INV-1 settles
+	expectLock(mock, 500.0)
+	mock.ExpectExec(`UPDATE account`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE account`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO transaction`).
+		WithArgs(int64(1), int64(2), 100.5, nil, "INV-1", "Invoice 1", valueDate).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	// INV-2 has a bad amount and never runs; INV-3 is declined
+	expectLock(mock, 399.5)
+	mock.ExpectExec(`INSERT INTO transaction`).
+		WithArgs(int64(1), int64(2), 9000.0, sqlmock.AnyArg(), "INV-3", nil, valueDate).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+
+	rec := postBody(h, "application/xml", pain001)
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != handler.XMLContentType {
+		t.Fatalf("status %d, content type %q: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+	}
+	var rpt pain002
+	if err := xml.Unmarshal(rec.Body.Bytes(), &rpt); err != nil {
+		t.Fatal(err)
+	}
+	if rpt.XMLName.Space != "urn:iso:std:iso:20022:tech:xsd:pain.002.001.03" || rpt.GrpSts != "PART" {
+		t.Errorf("report %s with group status %q", rpt.XMLName.Space, rpt.GrpSts)
+	}
+	want := []struct{ id, status, reason string }{
+		{"INV-1", "ACSC", ""}, {"INV-2", "RJCT", "AM12"}, {"INV-3", "RJCT", "AM04"},
+	}
+	if len(rpt.Txs) != len(want) {
+		t.Fatalf("report lists %d transactions: %s", len(rpt.Txs), rec.Body)
+	}
+	for i, w := range want {
+		if got := rpt.Txs[i]; got.EndToEndID != w.id || got.Status != w.status || got.Reason != w.reason {
+			t.Errorf("transaction %d = %+v, want %+v", i+1, got, w)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
+
+func TestTransferBatch_Pain001Malformed(t *testing.T) {
+	h, _ := depsTransfer(t)
+	rec := postBody(h, "text/xml", `<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02"/>`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d != 400: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestTransferBatch_Pain001Currency(t *testing.T) {
+	h, mock := depsTransfer(t)
+	body := strings.Replace(pain001, `<InstdAmt Ccy="AUD">9000</InstdAmt>`, `<InstdAmt Ccy="USD">9000</InstdAmt>`, 1)
+
+	// INV-1 settles; INV-2's amount and INV-3's currency reject them unrun
+	expectLock(mock, 500.0)
+	mock.ExpectExec(`UPDATE account`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE account`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO transaction`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	rec := postBody(h, "application/xml", body)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var rpt pain002
+	if err := xml.Unmarshal(rec.Body.Bytes(), &rpt); err != nil {
+		t.Fatal(err)
+	}
+	if len(rpt.Txs) != 3 {
+		t.Fatalf("report lists %d transactions: %s", len(rpt.Txs), rec.Body)
+	}
+	if got := rpt.Txs[2]; got.EndToEndID != "INV-3" || got.Status != "RJCT" || got.Reason != "AM03" {
+		t.Errorf("INV-3 = %+v, want RJCT AM03", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
+
+func TestTransferBatch_Pain001AmountSyntax(t *testing.T) {
+	h, mock := depsTransfer(t)
+	body := strings.Replace(pain001, `<InstdAmt Ccy="AUD">9000</InstdAmt>`, `<InstdAmt Ccy="AUD">0x10</InstdAmt>`, 1)
+
+	// INV-1 settles; INV-2 and INV-3 are rejected for their amounts unrun
+	expectLock(mock, 500.0)
+	mock.ExpectExec(`UPDATE account`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE account`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO transaction`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	rec := postBody(h, "application/xml", body)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var rpt pain002
+	if err := xml.Unmarshal(rec.Body.Bytes(), &rpt); err != nil {
+		t.Fatal(err)
+	}
+	if len(rpt.Txs) != 3 {
+		t.Fatalf("report lists %d transactions: %s", len(rpt.Txs), rec.Body)
+	}
+	if got := rpt.Txs[2]; got.EndToEndID != "INV-3" || got.Status != "RJCT" || got.Reason != "AM12" {
+		t.Errorf("INV-3 = %+v, want RJCT AM12", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/gob"
+	"io"
+	"os"
+
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+// uploadSpool holds the checked rows of a CSV upload until all of them have
+// been read: the first chunk in memory and the rest in a temporary file, so
+// an upload of any size is checked in full before any of it runs.
+type uploadSpool struct {
+	chunk int // rows per chunk; 0 keeps the whole upload in memory
+	head  []repo.TransferInput
+
+	file *os.File
+	w    *bufio.Writer
+	enc  *gob.Encoder
+	dec  *gob.Decoder
+}
+
+func (s *uploadSpool) add(t repo.TransferInput) error {
+	if s.file == nil && (s.chunk <= 0 || len(s.head) < s.chunk) {
+		s.head = append(s.head, t)
+		return nil
+	}
+	if s.file == nil {
+		f, err := os.CreateTemp("", "minibank-upload-*")
+		if err != nil {
+			return err
+		}
+		s.file, s.w = f, bufio.NewWriter(f)
+		s.enc = gob.NewEncoder(s.w)
+	}
+	return s.enc.Encode(&t)
+}
+
+// next returns the next chunk of rows, or io.EOF after the last.
+func (s *uploadSpool) next() ([]repo.TransferInput, error) {
+	if s.head != nil {
+		txns := s.head
+		s.head = nil
+		return txns, nil
+	}
+	if s.file == nil {
+		return nil, io.EOF
+	}
+	if s.dec == nil {
+		if err := s.w.Flush(); err != nil {
+			return nil, err
+		}
+		if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		s.dec = gob.NewDecoder(bufio.NewReader(s.file))
+	}
+	txns := make([]repo.TransferInput, 0, s.chunk)
+	for len(txns) < s.chunk {
+		var t repo.TransferInput
+		err := s.dec.Decode(&t)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		txns = append(txns, t)
+	}
+	if len(txns) == 0 {
+		return nil, io.EOF
+	}
+	return txns, nil
+}
+
+// close removes the temporary file, if there is one.
+func (s *uploadSpool) close() {
+	if s.file != nil {
+		s.file.Close()
+		os.Remove(s.file.Name())
+	}
+}
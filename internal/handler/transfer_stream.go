@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/token-cjg/minibank/internal/auth"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+// streamWriteTimeout bounds each write of a streamed response, so a client
+// that stops reading is dropped instead of stalling the batch.
+const streamWriteTimeout = 30 * time.Second
+
+// errRowRejected stops a stream at a row the handler refused to run.
+var errRowRejected = errors.New("row rejected")
+
+// rowResult is one line of a streamed transfer response.
+type rowResult struct {
+	Row       int      `json:"row"`
+	Source    int64    `json:"source,omitempty"`
+	Target    int64    `json:"target,omitempty"`
+	Amount    float64  `json:"amount,omitempty"`
+	Reference string   `json:"reference,omitempty"`
+	Outcome   string   `json:"outcome,omitempty"`
+	Problem   *Problem `json:"problem,omitempty"`
+}
+
+// streamSummary is the last line of a streamed transfer response.
+type streamSummary struct {
+	Rows     int  `json:"rows"`
+	Settled  int  `json:"settled"`
+	Declined int  `json:"declined"`
+	Failed   int  `json:"failed"`
+	Complete bool `json:"complete"`
+}
+
+// add counts res and returns its line of the response.
+func (s *streamSummary) add(res repo.RowResult) rowResult {
+	out := rowResult{
+		Row:       res.Row,
+		Source:    res.Input.Source,
+		Target:    res.Input.Target,
+		Amount:    res.Input.Amount,
+		Reference: res.Input.Reference,
+		Outcome:   string(res.Outcome),
+	}
+	s.Rows++
+	switch {
+	case res.Err != nil:
+		p := problemFor(res.Err)
+		p.Row = res.Row
+		out.Problem = &p
+		s.Failed++
+	case res.Outcome == repo.Settled:
+		s.Settled++
+	default:
+		s.Declined++
+	}
+	return out
+}
+
+// acceptsNDJSON reports whether the client asked for streamed results.
+func acceptsNDJSON(r *http.Request) bool { return accepts(r, NDJSONContentType) }
+
+// accepts reports whether the Accept header names media type mt.
+func accepts(r *http.Request, mt string) bool {
+	for _, v := range strings.Split(r.Header.Get("Accept"), ",") {
+		if got, _, err := mime.ParseMediaType(strings.TrimSpace(v)); err == nil && got == mt {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+stream is Batch for clients that send Accept: application/x-ndjson with a
+CSV upload, or that upload NDJSON themselves. Rows are transferred as they
+are read from the upload, and results are written back as they complete,
+in row order, one JSON object per line:
+
+	{"row":1,"source":1000000000000000,"target":1000000000000001,"amount":100.5,"outcome":"settled"}
+
+Neither the upload nor the results are held in memory, so a file of any
+size runs in constant space. A row that cannot be parsed, debits another
+company's account or fails has a "problem" and ends the stream; the rows
+before it have been applied. The last line is always a summary:
+
+	{"summary":{"rows":3,"settled":2,"declined":1,"failed":0,"complete":true}}
+*/
+func (h *Transfer) stream(w http.ResponseWriter, r *http.Request, rows rowSource) {
+	ctx := r.Context()
+	rc := http.NewResponseController(w)
+	// keep reading the upload after the first results are written, for as
+	// long as the upload takes
+	_ = rc.EnableFullDuplex()
+	_ = rc.SetReadDeadline(time.Time{})
+
+	company, authenticated := auth.Company(ctx)
+	owned := make(map[int64]bool)
+	var rejected *rowResult
+
+	num := 0
+	next := func() (repo.TransferInput, error) {
+		t, p, err := rows(num + 1)
+		if err == io.EOF {
+			return repo.TransferInput{}, io.EOF
+		}
+		num++
+		if p == nil && authenticated {
+			p = h.checkSource(ctx, company, t.Source, owned)
+		}
+		if p != nil {
+			p.Row = num
+			rejected = &rowResult{Row: num, Problem: p}
+			return t, errRowRejected
+		}
+		return t, nil
+	}
+
+	w.Header().Set("Content-Type", NDJSONContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	write := func(v any) error {
+		_ = rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	var sum streamSummary
+	emit := func(res repo.RowResult) error {
+		return write(sum.add(res))
+	}
+
+	err := h.Repo.TransferStream(ctx, next, emit)
+	var serr *repo.StreamError
+	switch {
+	case err == nil:
+		sum.Complete = true
+	case errors.Is(err, errRowRejected):
+		if write(rejected) != nil {
+			return
+		}
+	case errors.As(err, &serr):
+	default:
+		// the client went away or stopped reading
+		slog.WarnContext(ctx, "transfer stream aborted", "rows", sum.Rows, "err", err)
+		return
+	}
+	_ = write(map[string]streamSummary{"summary": sum})
+}
+
+// checkSource is the streaming counterpart of checkOwnership: it checks one
+// source account, remembering accounts already found to be owned.
+func (h *Transfer) checkSource(ctx context.Context, company, src int64, owned map[int64]bool) *Problem {
+	if owned[src] {
+		return nil
+	}
+	foreign, err := h.Repo.AccountsOutsideCompany(ctx, company, []int64{src})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error", "err", err)
+		p := problemFor(err)
+		return &p
+	}
+	if len(foreign) > 0 {
+		p := NewProblem(http.StatusForbidden, CodeForbidden,
+			fmt.Sprintf("source account %d does not belong to the authenticated company", src))
+		return &p
+	}
+	owned[src] = true
+	return nil
+}
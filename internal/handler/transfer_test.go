@@ -2,11 +2,18 @@ package handler_test
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/token-cjg/minibank/internal/auth"
 	"github.com/token-cjg/minibank/internal/handler"
 	"github.com/token-cjg/minibank/internal/repo"
 )
@@ -17,6 +24,14 @@ func depsTransfer(t *testing.T) (*handler.Transfer, sqlmock.Sqlmock) {
 	return handler.NewTransfer(repo.New(db)), mock
 }
 
+func postCSV(h *handler.Transfer, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/transfer", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	rec := httptest.NewRecorder()
+	h.Batch(rec, req)
+	return rec
+}
+
 func TestTransferBatch_OK_OneRow(t *testing.T) {
 	h, mock := depsTransfer(t)
 
@@ -30,16 +45,12 @@ func TestTransferBatch_OK_OneRow(t *testing.T) {
 
 	mock.ExpectBegin()
 
-	// lock + balance
-	mock.ExpectQuery(`SELECT account_id, account_balance.*FOR UPDATE`).
-		WithArgs(srcNum).
-		WillReturnRows(sqlmock.NewRows([]string{"account_id", "account_balance"}).
-			AddRow(srcID, 800.0))
-
-	// target id
-	mock.ExpectQuery(`SELECT account_id FROM account WHERE account_number\s*=\s*\$1`).
-		WithArgs(dstNum).
-		WillReturnRows(sqlmock.NewRows([]string{"account_id"}).AddRow(dstID))
+	// lock both accounts, lowest account number first
+	mock.ExpectQuery(`SELECT account_number, account_id, account_balance.*ORDER BY account_number\s+FOR UPDATE`).
+		WithArgs(srcNum, dstNum).
+		WillReturnRows(sqlmock.NewRows([]string{"account_number", "account_id", "account_balance"}).
+			AddRow(srcNum, srcID, 800.0).
+			AddRow(dstNum, dstID, 0.0))
 
 	// debit / credit
 	mock.ExpectExec(`UPDATE account SET account_balance = account_balance -`).
@@ -49,24 +60,207 @@ func TestTransferBatch_OK_OneRow(t *testing.T) {
 
 	// insert transaction
 	mock.ExpectExec(`INSERT INTO transaction`).
-		WithArgs(srcID, dstID, 100.0, nil).
+		WithArgs(srcID, dstID, 100.0, nil, nil, nil, nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	mock.ExpectCommit()
 	// --------------------------------------------------------------------------
 
-	csvBody := []byte("1000000000000000,1000000000000001,100.00\n")
-	req := httptest.NewRequest(http.MethodPost, "/transfer", bytes.NewReader(csvBody))
+	rec := postCSV(h, "1000000000000000,1000000000000001,100.00\n")
+
+	println(rec.Body.String())
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status %d != 204", rec.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
+
+func TestTransferBatch_ForeignSourceAccount(t *testing.T) {
+	h, mock := depsTransfer(t)
+
+	mock.ExpectQuery(`SELECT account_number FROM account WHERE company_id <> \$1 AND account_number IN`).
+		WithArgs(int64(7), int64(1000000000000000), int64(1000000000000002)).
+		WillReturnRows(sqlmock.NewRows([]string{"account_number"}).AddRow(int64(1000000000000002)))
+
+	body := "1000000000000000,1000000000000001,10.00\n" +
+		"1000000000000002,1000000000000001,10.00\n"
+	req := httptest.NewRequest(http.MethodPost, "/transfer", strings.NewReader(body))
 	req.Header.Set("Content-Type", "text/csv")
+	req = req.WithContext(auth.WithCompany(req.Context(), 7))
 	rec := httptest.NewRecorder()
 	h.Batch(rec, req)
 
-	println(rec.Body.String())
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status %d != 403: %s", rec.Code, rec.Body)
+	}
+	if p := decodeProblem(t, rec.Body.Bytes()); p.Code != handler.CodeForbidden || p.Row != 2 {
+		t.Fatalf("problem %+v", p)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
+
+func TestTransferBatch_Chunked(t *testing.T) {
+	h, mock := depsTransfer(t)
+	h.ChunkRows = 2
+
+	// every chunk is checked before any row runs
+	mock.ExpectQuery(`SELECT account_number FROM account WHERE company_id <> \$1`).
+		WithArgs(int64(7), int64(1000000000000000)).
+		WillReturnRows(sqlmock.NewRows([]string{"account_number"}))
+	mock.ExpectQuery(`SELECT account_number FROM account WHERE company_id <> \$1`).
+		WithArgs(int64(7), int64(1000000000000002)).
+		WillReturnRows(sqlmock.NewRows([]string{"account_number"}).AddRow(int64(1000000000000002)))
+
+	body := "1000000000000000,1000000000000001,10.00\n" +
+		"1000000000000000,1000000000000001,20.00\n" +
+		"1000000000000002,1000000000000001,30.00\n"
+	req := httptest.NewRequest(http.MethodPost, "/transfer", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	req = req.WithContext(auth.WithCompany(req.Context(), 7))
+	rec := httptest.NewRecorder()
+	h.Batch(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status %d != 403: %s", rec.Code, rec.Body)
+	}
+	if p := decodeProblem(t, rec.Body.Bytes()); p.Row != 3 {
+		t.Fatalf("problem %+v, want row 3", p)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("no transfer should run: %v", err)
+	}
+}
+
+// TestTransferBatch_ChunkedRuns checks that rows spooled beyond the first
+// chunk all run, in order.
+func TestTransferBatch_ChunkedRuns(t *testing.T) {
+	h, mock := depsTransfer(t)
+	h.ChunkRows = 2
+
+	for range 5 {
+		expectLock(mock, 0)
+		mock.ExpectExec(`INSERT INTO transaction`).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+	}
+
+	rec := postCSV(h, strings.Repeat("1000000000000000,1000000000000001,10.00\n", 5))
 
 	if rec.Code != http.StatusNoContent {
-		t.Fatalf("status %d != 204", rec.Code)
+		t.Fatalf("status %d != 204: %s", rec.Code, rec.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
+
+// TestTransferBatch_ChunkedFailure checks that a failure in a later chunk
+// says which rows had already been applied.
+func TestTransferBatch_ChunkedFailure(t *testing.T) {
+	h, mock := depsTransfer(t)
+	h.ChunkRows = 2
+
+	for range 2 {
+		expectLock(mock, 0)
+		mock.ExpectExec(`INSERT INTO transaction`).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+	}
+	mock.ExpectBegin().WillReturnError(errors.New("connection reset by peer"))
+
+	rec := postCSV(h, strings.Repeat("1000000000000000,1000000000000001,10.00\n", 3))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d != 500: %s", rec.Code, rec.Body)
+	}
+	p := decodeProblem(t, rec.Body.Bytes())
+	if p.Row != 3 || !strings.Contains(p.Detail, "rows 1 to 2 had been applied") {
+		t.Fatalf("problem %+v, want row 3 after rows 1 to 2", p)
 	}
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Fatalf("db expectations: %v", err)
 	}
 }
+
+// postNDJSON posts body as text/csv asking for streamed results and returns
+// the decoded lines.
+func postNDJSON(t *testing.T, h *handler.Transfer, req *http.Request) []map[string]any {
+	t.Helper()
+	req.Header.Set("Accept", handler.NDJSONContentType)
+	rec := httptest.NewRecorder()
+	h.Batch(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != handler.NDJSONContentType {
+		t.Fatalf("status %d, content type %q: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+	}
+	var lines []map[string]any
+	dec := json.NewDecoder(rec.Body)
+	for dec.More() {
+		var l map[string]any
+		if err := dec.Decode(&l); err != nil {
+			t.Fatalf("line %d: %v", len(lines)+1, err)
+		}
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+func TestTransferBatch_StreamsNDJSON(t *testing.T) {
+	h, mock := depsTransfer(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FOR UPDATE`).
+		WithArgs(int64(1000000000000000), int64(1000000000000001)).
+		WillReturnRows(sqlmock.NewRows([]string{"account_number", "account_id", "account_balance"}).
+			AddRow(int64(1000000000000000), 1, 5.0).
+			AddRow(int64(1000000000000001), 2, 0.0))
+	mock.ExpectExec(`INSERT INTO transaction`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	// the CSV arrives as the file part of a multipart upload
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	_ = mw.WriteField("note", "ignored")
+	fw, _ := mw.CreateFormFile(handler.FileUploadField, "batch.csv")
+	_, _ = io.WriteString(fw, "1000000000000000,1000000000000001,10.00\n1000000000000000,x,1\n")
+	_ = mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/transfer", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	lines := postNDJSON(t, h, req)
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want result, problem and summary: %v", len(lines), lines)
+	}
+	if lines[0]["row"] != 1.0 || lines[0]["outcome"] != string(repo.DeclinedInsufficient) {
+		t.Errorf("line 1 = %v", lines[0])
+	}
+	if p, _ := lines[1]["problem"].(map[string]any); lines[1]["row"] != 2.0 || p["code"] != handler.CodeBadRequest {
+		t.Errorf("line 2 = %v", lines[1])
+	}
+	want := map[string]any{"rows": 1.0, "settled": 0.0, "declined": 1.0, "failed": 0.0, "complete": false}
+	if got := lines[2]["summary"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("summary = %v, want %v", got, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
+
+func TestTransferBatch_MultipartWithoutFile(t *testing.T) {
+	h, _ := depsTransfer(t)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	_ = mw.WriteField("note", "no file here")
+	_ = mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/transfer", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	h.Batch(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d != 400: %s", rec.Code, rec.Body)
+	}
+}
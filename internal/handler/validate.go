@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Limits enforced on request bodies before they reach the repo.
+const (
+	MaxJSONBodyBytes  = 1 << 20
+	MaxCompanyNameLen = 200
+	// Amounts reach the database as float64, which keeps 15 significant
+	// digits exactly: 13 integer digits and the cents. NUMERIC(18,2) would
+	// hold 16, but 9999999999999999.99 comes out as 1e16.
+	maxAmountDigits = 13
+)
+
+// decimalPattern is the only amount syntax accepted: digits, optionally
+// signed and with a fraction.
+var decimalPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// Field error codes reported in Problem.Errors.
+const (
+	FieldRequired     = "required"
+	FieldTooLong      = "too_long"
+	FieldInvalid      = "invalid"
+	FieldNegative     = "negative"
+	FieldNotPositive  = "not_positive"
+	FieldPrecision    = "too_many_decimals"
+	FieldOutOfRange   = "out_of_range"
+	FieldUnknown      = "unknown_field"
+	FieldWrongType    = "wrong_type"
+	FieldControlChars = "control_characters"
+)
+
+// FieldError describes why a single request field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors collects field errors; a nil value means the request is valid.
+type ValidationErrors []FieldError
+
+func (v *ValidationErrors) add(field, code, format string, args ...any) {
+	*v = append(*v, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, len(v))
+	for i, fe := range v {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// writeValidation sends a 422 listing every rejected field.
+func writeValidation(w http.ResponseWriter, r *http.Request, errs ValidationErrors) {
+	p := NewProblem(http.StatusUnprocessableEntity, CodeValidation, "request validation failed")
+	p.Errors = errs
+	WriteProblem(w, r, p)
+}
+
+// decodeJSON strictly decodes a single JSON object from the request body.
+// Unknown fields and wrongly typed values come back as ValidationErrors so
+// they can be reported per field; anything else is a malformed body.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxJSONBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errors.New("request body is empty")
+		}
+		return fieldDecodeError(err)
+	}
+	if dec.More() {
+		return errors.New("request body must contain a single JSON object")
+	}
+	return nil
+}
+
+// fieldDecodeError turns a strict decoder's complaint about one field into
+// ValidationErrors; other errors are returned as they are.
+func fieldDecodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr):
+		var v ValidationErrors
+		v.add(typeErr.Field, FieldWrongType, "must be a JSON %s", typeErr.Type.Kind())
+		return v
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		var v ValidationErrors
+		name := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		v.add(name, FieldUnknown, "is not a recognised field")
+		return v
+	}
+	return err
+}
+
+// writeDecodeError reports a decodeJSON failure with the matching status.
+func writeDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	var v ValidationErrors
+	if errors.As(err, &v) {
+		writeValidation(w, r, v)
+		return
+	}
+	var tooBig *http.MaxBytesError
+	if errors.As(err, &tooBig) {
+		WriteProblem(w, r, NewProblem(http.StatusRequestEntityTooLarge, CodeBadRequest,
+			fmt.Sprintf("request body exceeds %d bytes", tooBig.Limit)))
+		return
+	}
+	badRequest(w, r, "malformed JSON body: "+err.Error())
+}
+
+// checkName validates a required, human readable name.
+func (v *ValidationErrors) checkName(field, s string, maxLen int) {
+	switch {
+	case strings.TrimSpace(s) == "":
+		v.add(field, FieldRequired, "must not be empty")
+	case utf8.RuneCountInString(s) > maxLen:
+		v.add(field, FieldTooLong, "must be at most %d characters", maxLen)
+	case strings.IndexFunc(s, unicode.IsControl) >= 0:
+		v.add(field, FieldControlChars, "must not contain control characters")
+	}
+}
+
+// checkAmount validates a decimal money amount exactly as the client wrote
+// it (a JSON number literal or a CSV cell) and returns its value: plain
+// digits with an optional sign and fraction, at most two decimal places, at
+// most maxAmountDigits integer digits, and either non-negative or strictly
+// positive. The value is 0 when the amount is rejected.
+func (v *ValidationErrors) checkAmount(field, raw string, positive bool) float64 {
+	if raw == "" || raw == "null" {
+		v.add(field, FieldRequired, "is required")
+		return 0
+	}
+	// big.Rat and strconv.ParseFloat also take fractions, exponents and
+	// 0x, 0o and 0b prefixes
+	if !decimalPattern.MatchString(raw) {
+		v.add(field, FieldInvalid, "must be a decimal number")
+		return 0
+	}
+	amt, _ := new(big.Rat).SetString(raw)
+	n := len(*v)
+	switch {
+	case positive && amt.Sign() <= 0:
+		v.add(field, FieldNotPositive, "must be greater than zero")
+	case amt.Sign() < 0:
+		v.add(field, FieldNegative, "must not be negative")
+	case !new(big.Rat).Mul(amt, big.NewRat(100, 1)).IsInt():
+		v.add(field, FieldPrecision, "must have at most two decimal places")
+	case len(new(big.Int).Quo(amt.Num(), amt.Denom()).String()) > maxAmountDigits:
+		v.add(field, FieldOutOfRange, "must have at most %d integer digits", maxAmountDigits)
+	}
+	if len(*v) > n {
+		return 0
+	}
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		v.add(field, FieldInvalid, "must be a decimal number")
+		return 0
+	}
+	return f
+}
+
+// ValidateCompanyName checks a new company's name as POST /companies does,
+// for callers that take it some other way.
+func ValidateCompanyName(name string) ValidationErrors {
+	var v ValidationErrors
+	v.checkName("company_name", name, MaxCompanyNameLen)
+	return v
+}
+
+// ValidateBalance checks an initial balance, written as a decimal, as
+// POST /companies/{companyId}/accounts does and returns its value.
+func ValidateBalance(raw string) (float64, ValidationErrors) {
+	var v ValidationErrors
+	balance := v.checkAmount("initial_balance", raw, false)
+	if v != nil {
+		return 0, v
+	}
+	return balance, nil
+}
@@ -0,0 +1,167 @@
+package handler_test
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/token-cjg/minibank/internal/handler"
+)
+
+func decodeProblem(t *testing.T, body []byte) handler.Problem {
+	t.Helper()
+	var p handler.Problem
+	if err := json.Unmarshal(body, &p); err != nil {
+		t.Fatalf("response is not a problem: %v: %s", err, body)
+	}
+	return p
+}
+
+func TestCompanyCreate_Validation(t *testing.T) {
+	cases := []struct {
+		name      string
+		body      string
+		wantField string
+		wantCode  string
+	}{
+		{"empty name", `{"company_name": ""}`, "company_name", handler.FieldRequired},
+		{"blank name", `{"company_name": "   "}`, "company_name", handler.FieldRequired},
+		{"missing name", `{}`, "company_name", handler.FieldRequired},
+		{"control chars", `{"company_name": "Acme\u0000"}`, "company_name", handler.FieldControlChars},
+		{"unknown field", `{"company_name": "Acme", "ceo": "Wile E."}`, "ceo", handler.FieldUnknown},
+		{"wrong type", `{"company_name": 42}`, "company_name", handler.FieldWrongType},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h, mock := depsCompany(t)
+			rec := call(h.Create, http.MethodPost, "/companies", []byte(tc.body))
+
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status %d != 422: %s", rec.Code, rec.Body.String())
+			}
+			p := decodeProblem(t, rec.Body.Bytes())
+			if len(p.Errors) != 1 || p.Errors[0].Field != tc.wantField || p.Errors[0].Code != tc.wantCode {
+				t.Fatalf("unexpected field errors %+v", p.Errors)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("db should not be touched: %v", err)
+			}
+		})
+	}
+}
+
+func TestCompanyCreate_NameTooLong(t *testing.T) {
+	h, _ := depsCompany(t)
+	name := make([]byte, handler.MaxCompanyNameLen+1)
+	for i := range name {
+		name[i] = 'a'
+	}
+	body, _ := json.Marshal(map[string]string{"company_name": string(name)})
+	rec := call(h.Create, http.MethodPost, "/companies", body)
+
+	p := decodeProblem(t, rec.Body.Bytes())
+	if rec.Code != http.StatusUnprocessableEntity || p.Errors[0].Code != handler.FieldTooLong {
+		t.Fatalf("status %d, problem %+v", rec.Code, p)
+	}
+}
+
+func TestAccountCreate_Validation(t *testing.T) {
+	cases := []struct {
+		name     string
+		body     string
+		wantCode string
+	}{
+		{"negative", `{"initial_balance": -1}`, handler.FieldNegative},
+		{"three decimals", `{"initial_balance": 1.005}`, handler.FieldPrecision},
+		{"too large", `{"initial_balance": 10000000000000}`, handler.FieldOutOfRange},
+		{"lost by float64", `{"initial_balance": 9999999999999999.99}`, handler.FieldOutOfRange},
+		{"missing", `{}`, handler.FieldRequired},
+		{"boolean", `{"initial_balance": true}`, handler.FieldInvalid},
+		{"quoted", `{"initial_balance": "10"}`, handler.FieldInvalid},
+		{"exponent", `{"initial_balance": 1e2}`, handler.FieldInvalid},
+		{"null", `{"initial_balance": null}`, handler.FieldRequired},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h, mock := newDeps(t)
+			rec := perform(h.Create, http.MethodPost, "/companies/1/accounts",
+				map[string]string{"companyId": "1"}, []byte(tc.body))
+
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status %d != 422: %s", rec.Code, rec.Body.String())
+			}
+			p := decodeProblem(t, rec.Body.Bytes())
+			if len(p.Errors) != 1 || p.Errors[0].Field != "initial_balance" || p.Errors[0].Code != tc.wantCode {
+				t.Fatalf("unexpected field errors %+v", p.Errors)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("db should not be touched: %v", err)
+			}
+		})
+	}
+}
+
+func TestAccountCreate_MaxBalanceAccepted(t *testing.T) {
+	h, mock := newDeps(t)
+	mock.ExpectQuery(`INSERT INTO account`).
+		WithArgs(int64(1), storedAs("9999999999999.99")).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"account_id", "company_id", "account_number", "account_balance",
+		}).AddRow(10, 1, int64(1000000000000010), 9999999999999.99))
+
+	rec := perform(h.Create, http.MethodPost, "/companies/1/accounts",
+		map[string]string{"companyId": "1"}, []byte(`{"initial_balance": 9999999999999.99}`))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("largest balance rejected: %d %s", rec.Code, rec.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
+
+// storedAs matches a float64 argument whose shortest decimal form, which is
+// what the driver sends for a NUMERIC column, is want.
+type storedAs string
+
+func (want storedAs) Match(v driver.Value) bool {
+	f, ok := v.(float64)
+	return ok && strconv.FormatFloat(f, 'f', -1, 64) == string(want)
+}
+
+// TestTransferBatch_AmountSyntax checks that amounts are plain decimals:
+// strconv and big.Rat also read these, as 16, 100, 1 and 15.
+func TestTransferBatch_AmountSyntax(t *testing.T) {
+	for _, amount := range []string{"0x10", "1e2", "0b1", "0o17"} {
+		h, mock := depsTransfer(t)
+		rec := postCSV(h, "1000000000000000,1000000000000001,"+amount+"\n")
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("%s: status %d != 422", amount, rec.Code)
+		}
+		p := decodeProblem(t, rec.Body.Bytes())
+		if p.Row != 1 || p.Errors[0].Code != handler.FieldInvalid {
+			t.Errorf("%s: unexpected problem %+v", amount, p)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatalf("%s: no transfer should run: %v", amount, err)
+		}
+	}
+}
+
+func TestTransferBatch_InvalidAmount(t *testing.T) {
+	h, mock := depsTransfer(t)
+
+	rec := postCSV(h, "1000000000000000,1000000000000001,10.00\n1000000000000000,1000000000000001,-5\n")
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status %d != 422", rec.Code)
+	}
+	p := decodeProblem(t, rec.Body.Bytes())
+	if p.Row != 2 || p.Errors[0].Code != handler.FieldNotPositive {
+		t.Fatalf("unexpected problem %+v", p)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("no transfer should run: %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/token-cjg/minibank/internal/model"
+	"github.com/token-cjg/minibank/internal/repo"
+	"github.com/token-cjg/minibank/internal/webhook"
+)
+
+// Limits on webhook subscriptions and their delivery log.
+const (
+	MaxWebhookURLLen     = 2048
+	MinWebhookSecretLen  = 16
+	MaxWebhookSecretLen  = 200
+	DefaultDeliveryLimit = 50
+	MaxDeliveryLimit     = 500
+)
+
+// Webhook manages a company's webhook subscriptions and their delivery log.
+// Deliveries themselves are made by webhook.Dispatcher.
+type Webhook struct{ Repo *repo.Repo }
+
+func NewWebhook(r *repo.Repo) *Webhook { return &Webhook{Repo: r} }
+
+// webhookRequest is the body of Create.
+type webhookRequest struct {
+	URL                 string          `json:"url"`
+	Events              []string        `json:"events"`
+	LowBalanceThreshold json.RawMessage `json:"low_balance_threshold"`
+	Secret              string          `json:"secret"`
+}
+
+/*
+Create subscribes a company to webhook events.
+
+	POST /companies/{companyId}/webhooks
+	Content-Type: application/json
+	Body: {"url": "https://example.com/hooks", "events": ["transfer.settled", "account.low_balance"],
+	       "low_balance_threshold": 1000.00}
+	Returns 201 with the subscription, including its signing secret, which
+	is generated unless the body gives one and is not shown again.
+
+low_balance_threshold is required with account.low_balance, which fires when
+a debit takes one of the company's accounts from at least the threshold to
+below it.
+*/
+func (h *Webhook) Create(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+	hook, verrs := req.webhook()
+	if verrs != nil {
+		writeValidation(w, r, verrs)
+		return
+	}
+	hook.Company, _ = strconv.ParseInt(mux.Vars(r)["companyId"], 10, 64)
+	if hook.Secret == "" {
+		hook.Secret = newSecret()
+	}
+
+	saved, err := h.Repo.CreateWebhook(r.Context(), hook)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, saved)
+}
+
+// webhook validates req and turns it into a subscription.
+func (req webhookRequest) webhook() (model.Webhook, ValidationErrors) {
+	var v ValidationErrors
+	if u, err := url.Parse(req.URL); req.URL == "" {
+		v.add("url", FieldRequired, "is required")
+	} else if err != nil || u.Scheme != "https" || u.Host == "" {
+		v.add("url", FieldInvalid, "must be an absolute https URL")
+	} else if !publicHost(u.Hostname()) {
+		v.add("url", FieldInvalid, "must not point at a loopback, private or link-local address")
+	} else if len(req.URL) > MaxWebhookURLLen {
+		v.add("url", FieldTooLong, "must be at most %d characters", MaxWebhookURLLen)
+	}
+
+	if len(req.Events) == 0 {
+		v.add("events", FieldRequired, "must name at least one event")
+	}
+	for i, e := range req.Events {
+		switch {
+		case !slices.Contains(model.EventTypes, e):
+			v.add("events", FieldInvalid, "%q is not an event type", e)
+		case slices.Index(req.Events, e) < i:
+			v.add("events", FieldInvalid, "%q is listed twice", e)
+		}
+	}
+
+	hook := model.Webhook{URL: req.URL, Events: req.Events, Secret: req.Secret}
+	raw := string(req.LowBalanceThreshold)
+	switch {
+	case slices.Contains(req.Events, model.EventLowBalance):
+		if t := v.checkAmount("low_balance_threshold", raw, true); t > 0 {
+			hook.LowBalanceThreshold = &t
+		}
+	case raw != "" && raw != "null":
+		v.add("low_balance_threshold", FieldInvalid, "applies only to account.low_balance")
+	}
+
+	if req.Secret != "" && (len(req.Secret) < MinWebhookSecretLen || len(req.Secret) > MaxWebhookSecretLen) {
+		v.add("secret", FieldInvalid, "must be %d to %d characters", MinWebhookSecretLen, MaxWebhookSecretLen)
+	}
+	return hook, v
+}
+
+// publicHost rejects the hosts a webhook plainly cannot be delivered to.
+// Names are only resolved at delivery, where the dispatcher checks the
+// addresses they resolve to.
+func publicHost(host string) bool {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return webhook.AllowedAddr(addr)
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	return host != "localhost" && !strings.HasSuffix(host, ".localhost")
+}
+
+// newSecret returns a random signing secret.
+func newSecret() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return "whsec_" + hex.EncodeToString(b)
+}
+
+/*
+List returns a company's webhook subscriptions, without their secrets.
+
+	GET /companies/{companyId}/webhooks
+*/
+func (h *Webhook) List(w http.ResponseWriter, r *http.Request) {
+	companyID, _ := strconv.ParseInt(mux.Vars(r)["companyId"], 10, 64)
+	hooks, err := h.Repo.ListWebhooks(r.Context(), companyID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, hooks)
+}
+
+/*
+Get returns one webhook subscription, without its secret.
+
+	GET /companies/{companyId}/webhooks/{webhookId}
+*/
+func (h *Webhook) Get(w http.ResponseWriter, r *http.Request) {
+	companyID, webhookID := webhookVars(r)
+	hook, err := h.Repo.GetWebhook(r.Context(), companyID, webhookID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, hook)
+}
+
+/*
+Delete unsubscribes a webhook and drops its delivery log.
+
+	DELETE /companies/{companyId}/webhooks/{webhookId}
+	Returns 204, or 404 if there is no such webhook.
+*/
+func (h *Webhook) Delete(w http.ResponseWriter, r *http.Request) {
+	companyID, webhookID := webhookVars(r)
+	if err := h.Repo.DeleteWebhook(r.Context(), companyID, webhookID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+Deliveries returns a webhook's delivery log, newest first: each event sent
+to it, whether it was delivered, and the outcome of the latest attempt.
+
+	GET /companies/{companyId}/webhooks/{webhookId}/deliveries?limit=50
+*/
+func (h *Webhook) Deliveries(w http.ResponseWriter, r *http.Request) {
+	limit := DefaultDeliveryLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > MaxDeliveryLimit {
+			badRequest(w, r, "limit must be between 1 and "+strconv.Itoa(MaxDeliveryLimit))
+			return
+		}
+		limit = n
+	}
+	companyID, webhookID := webhookVars(r)
+	if _, err := h.Repo.GetWebhook(r.Context(), companyID, webhookID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	ds, err := h.Repo.ListDeliveries(r.Context(), companyID, webhookID, limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ds)
+}
+
+/*
+Redeliver sends a delivery again as soon as the dispatcher next runs,
+whether it was delivered, failed or is still being retried, with a fresh
+round of attempts.
+
+	POST /companies/{companyId}/webhooks/{webhookId}/deliveries/{deliveryId}/redeliver
+	Returns 202 with the queued delivery.
+*/
+func (h *Webhook) Redeliver(w http.ResponseWriter, r *http.Request) {
+	companyID, webhookID := webhookVars(r)
+	deliveryID, _ := strconv.ParseInt(mux.Vars(r)["deliveryId"], 10, 64)
+	d, err := h.Repo.Redeliver(r.Context(), companyID, webhookID, deliveryID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, d)
+}
+
+func webhookVars(r *http.Request) (companyID, webhookID int64) {
+	vars := mux.Vars(r)
+	companyID, _ = strconv.ParseInt(vars["companyId"], 10, 64)
+	webhookID, _ = strconv.ParseInt(vars["webhookId"], 10, 64)
+	return companyID, webhookID
+}
@@ -0,0 +1,145 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/token-cjg/minibank/internal/handler"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+var webhookCols = []string{"webhook_id", "company_id", "url", "events", "low_balance_threshold", "created_at"}
+
+func depsWebhook(t *testing.T) (*handler.Webhook, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	return handler.NewWebhook(repo.New(db)), mock
+}
+
+func TestWebhookCreate_GeneratesSecret(t *testing.T) {
+	h, mock := depsWebhook(t)
+
+	created := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`INSERT INTO webhook_subscription`).
+		WithArgs(int64(1), "https://example.com/hooks", sqlmock.AnyArg(), "transfer.settled,batch.completed", nil).
+		WillReturnRows(sqlmock.NewRows(webhookCols).
+			AddRow(7, 1, "https://example.com/hooks", "transfer.settled,batch.completed", nil, created))
+
+	body := []byte(`{"url": "https://example.com/hooks", "events": ["transfer.settled", "batch.completed"]}`)
+	rec := perform(h.Create, http.MethodPost, "/companies/1/webhooks", map[string]string{"companyId": "1"}, body)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d, want 201: %s", rec.Code, rec.Body)
+	}
+	var got map[string]any
+	_ = json.Unmarshal(rec.Body.Bytes(), &got)
+	if got["webhook_id"] != 7.0 || !strings.HasPrefix(got["secret"].(string), "whsec_") {
+		t.Fatalf("body %v", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
+
+func TestWebhookCreate_Validation(t *testing.T) {
+	h, _ := depsWebhook(t)
+
+	body := []byte(`{"url": "ftp://example.com", "events": ["transfer.settled", "transfer.settled", "account.opened",
+		"account.low_balance"], "secret": "short"}`)
+	rec := perform(h.Create, http.MethodPost, "/companies/1/webhooks", map[string]string{"companyId": "1"}, body)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status %d, want 422: %s", rec.Code, rec.Body)
+	}
+	var p struct {
+		Errors []struct{ Field, Code string }
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &p)
+	fields := map[string]int{}
+	for _, e := range p.Errors {
+		fields[e.Field]++
+	}
+	if fields["url"] != 1 || fields["events"] != 2 || fields["low_balance_threshold"] != 1 || fields["secret"] != 1 {
+		t.Fatalf("errors %+v", p.Errors)
+	}
+}
+
+func TestWebhookCreate_URL(t *testing.T) {
+	h, _ := depsWebhook(t)
+
+	for _, url := range []string{
+		"http://example.com/hooks", "https://127.0.0.1/hooks", "https://[::1]:8443/hooks",
+		"https://10.0.0.5/hooks", "https://169.254.169.254/latest/meta-data", "https://localhost/hooks",
+	} {
+		body := []byte(`{"url": "` + url + `", "events": ["transfer.settled"]}`)
+		rec := perform(h.Create, http.MethodPost, "/companies/1/webhooks", map[string]string{"companyId": "1"}, body)
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: status %d, want 422", url, rec.Code)
+			continue
+		}
+		if p := decodeProblem(t, rec.Body.Bytes()); len(p.Errors) != 1 || p.Errors[0].Field != "url" {
+			t.Errorf("%s: errors %+v", url, p.Errors)
+		}
+	}
+}
+
+func TestWebhookCreate_ThresholdWithoutEvent(t *testing.T) {
+	h, _ := depsWebhook(t)
+
+	body := []byte(`{"url": "https://example.com/hooks", "events": ["transfer.declined"], "low_balance_threshold": 10}`)
+	rec := perform(h.Create, http.MethodPost, "/companies/1/webhooks", map[string]string{"companyId": "1"}, body)
+
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "low_balance_threshold") {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestWebhookDeliveries_UnknownWebhook(t *testing.T) {
+	h, mock := depsWebhook(t)
+
+	mock.ExpectQuery(`FROM webhook_subscription WHERE company_id=\$1 AND webhook_id=\$2`).
+		WithArgs(int64(1), int64(9)).
+		WillReturnRows(sqlmock.NewRows(webhookCols))
+
+	rec := perform(h.Deliveries, http.MethodGet, "/companies/1/webhooks/9/deliveries",
+		map[string]string{"companyId": "1", "webhookId": "9"}, nil)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status %d, want 404: %s", rec.Code, rec.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
+
+func TestWebhookRedeliver(t *testing.T) {
+	h, mock := depsWebhook(t)
+
+	created := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	next := time.Date(2024, 4, 2, 9, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`WITH redone AS`).
+		WithArgs(int64(1), int64(7), int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"delivery_id", "webhook_id", "event_id", "event_type", "status",
+			"attempts", "next_attempt_at", "last_attempt_at", "response_status", "last_error", "delivered_at",
+			"created_at"}).
+			AddRow(4, 7, 11, "transfer.settled", "pending", 0, next, created, 500, "receiver answered 500", nil, created))
+
+	rec := perform(h.Redeliver, http.MethodPost, "/companies/1/webhooks/7/deliveries/4/redeliver",
+		map[string]string{"companyId": "1", "webhookId": "7", "deliveryId": "4"}, nil)
+
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status %d, want 202: %s", rec.Code, rec.Body)
+	}
+	var got map[string]any
+	_ = json.Unmarshal(rec.Body.Bytes(), &got)
+	if got["status"] != "pending" || got["attempts"] != 0.0 || got["next_attempt_at"] != "2024-04-02T09:00:00Z" {
+		t.Fatalf("body %v", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations: %v", err)
+	}
+}
@@ -0,0 +1,281 @@
+package iso20022
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/token-cjg/minibank/internal/model"
+)
+
+// Cash management versions minibank reports account activity in.
+const (
+	Camt052V02 = "camt.052.001.02" // intraday account report
+	Camt053V02 = "camt.053.001.02" // end-of-day statement
+)
+
+// Balance type codes.
+const (
+	BalanceOpening = "OPBD" // opening booked
+	BalanceClosing = "CLBD" // closing booked
+	BalanceInterim = "ITBD" // interim booked, for intraday reports
+)
+
+// Credit and debit indicators.
+const (
+	Credit = "CRDT"
+	Debit  = "DBIT"
+)
+
+// notProvided stands in for a missing end-to-end id.
+const notProvided = "NOTPROVIDED"
+
+// dateTimeLayout is an ISODateTime, always in UTC.
+const dateTimeLayout = "2006-01-02T15:04:05"
+
+// The XML shapes of a camt.052 report and a camt.053 statement, which
+// differ only in the names of the message and statement elements.
+type (
+	camtDocument struct {
+		XMLName   xml.Name     `xml:"Document"`
+		Xmlns     string       `xml:"xmlns,attr"`
+		Statement *camtMessage `xml:"BkToCstmrStmt,omitempty"`
+		Report    *camtMessage `xml:"BkToCstmrAcctRpt,omitempty"`
+	}
+	camtMessage struct {
+		GrpHdr struct {
+			MsgId   string
+			CreDtTm string
+		}
+		Stmt *camtStatement `xml:",omitempty"`
+		Rpt  *camtStatement `xml:",omitempty"`
+	}
+	camtStatement struct {
+		Id      string
+		CreDtTm string
+		FrToDt  struct {
+			FrDtTm string
+			ToDtTm string
+		}
+		Acct struct {
+			Id   camtAccountID
+			Ccy  string
+			Ownr *struct {
+				Nm string
+			} `xml:",omitempty"`
+		}
+		Bal       []camtBalance
+		TxsSummry camtSummary
+		Ntry      []camtEntry
+	}
+	camtAccountID struct {
+		Othr struct {
+			Id string
+		}
+	}
+	camtAmount struct {
+		Value string `xml:",chardata"`
+		Ccy   string `xml:"Ccy,attr"`
+	}
+	camtDate struct {
+		Dt   string `xml:",omitempty"`
+		DtTm string `xml:",omitempty"`
+	}
+	camtBalance struct {
+		Tp struct {
+			CdOrPrtry struct {
+				Cd string
+			}
+		}
+		Amt       camtAmount
+		CdtDbtInd string
+		Dt        camtDate
+	}
+	camtSummary struct {
+		TtlNtries struct {
+			NbOfNtries    int
+			Sum           string
+			TtlNetNtryAmt string
+			CdtDbtInd     string
+		}
+		TtlCdtNtries camtTotal
+		TtlDbtNtries camtTotal
+	}
+	camtTotal struct {
+		NbOfNtries int
+		Sum        string
+	}
+	camtEntry struct {
+		NtryRef     string
+		Amt         camtAmount
+		CdtDbtInd   string
+		Sts         string
+		BookgDt     camtDate
+		ValDt       camtDate
+		AcctSvcrRef string
+		BkTxCd      camtBankCode
+		NtryDtls    struct {
+			TxDtls struct {
+				Refs struct {
+					AcctSvcrRef string
+					EndToEndId  string
+				}
+				RltdPties struct {
+					DbtrAcct *camtPartyAccount `xml:",omitempty"`
+					CdtrAcct *camtPartyAccount `xml:",omitempty"`
+				}
+				RmtInf *struct {
+					Ustrd string
+				} `xml:",omitempty"`
+			}
+		}
+	}
+	camtPartyAccount struct {
+		Id camtAccountID
+	}
+	camtBankCode struct {
+		Domn struct {
+			Cd   string
+			Fmly struct {
+				Cd        string
+				SubFmlyCd string
+			}
+		}
+	}
+)
+
+// Camt053 renders st, which should cover one day, as a camt.053 end-of-day
+// statement created at created. The statement is identified by the account
+// number and the day.
+func Camt053(st model.Statement, created time.Time) ([]byte, error) {
+	id := st.Account.Number + "-" + st.From.UTC().Format("20060102")
+	s := camtBody(st, id, created)
+	s.Bal = []camtBalance{
+		balance(BalanceOpening, st.Opening, camtDate{Dt: st.From.UTC().Format(time.DateOnly)}),
+		balance(BalanceClosing, st.Closing, camtDate{Dt: st.From.UTC().Format(time.DateOnly)}),
+	}
+	msg := &camtMessage{Stmt: s}
+	msg.GrpHdr.MsgId, msg.GrpHdr.CreDtTm = "STMT-"+id, s.CreDtTm
+	return marshal(camtDocument{Xmlns: namespacePrefix + Camt053V02, Statement: msg})
+}
+
+// Camt052 renders st as a camt.052 intraday report created at created, with
+// the balance at st.To as an interim booked balance. The report is
+// identified by the account number and st.To.
+func Camt052(st model.Statement, created time.Time) ([]byte, error) {
+	id := st.Account.Number + "-" + st.To.UTC().Format("20060102150405")
+	s := camtBody(st, id, created)
+	s.Bal = []camtBalance{
+		balance(BalanceOpening, st.Opening, camtDate{Dt: st.From.UTC().Format(time.DateOnly)}),
+		balance(BalanceInterim, st.Closing, camtDate{DtTm: st.To.UTC().Format(dateTimeLayout)}),
+	}
+	msg := &camtMessage{Rpt: s}
+	msg.GrpHdr.MsgId, msg.GrpHdr.CreDtTm = "RPT-"+id, s.CreDtTm
+	return marshal(camtDocument{Xmlns: namespacePrefix + Camt052V02, Report: msg})
+}
+
+// camtBody fills in everything but the balances, which is common to both
+// messages.
+func camtBody(st model.Statement, id string, created time.Time) *camtStatement {
+	s := &camtStatement{Id: id, CreDtTm: created.UTC().Format(dateTimeLayout)}
+	s.FrToDt.FrDtTm = st.From.UTC().Format(dateTimeLayout)
+	s.FrToDt.ToDtTm = st.To.UTC().Format(dateTimeLayout)
+	s.Acct.Id.Othr.Id = st.Account.Number
+	s.Acct.Ccy = model.Currency
+	if st.CompanyName != "" {
+		s.Acct.Ownr = &struct{ Nm string }{Nm: st.CompanyName}
+	}
+
+	var credits, debits int64 // cents
+	for _, e := range st.Entries {
+		cents := model.Cents(e.Amount)
+		if cents >= 0 {
+			credits += cents
+			s.TxsSummry.TtlCdtNtries.NbOfNtries++
+		} else {
+			debits -= cents
+			s.TxsSummry.TtlDbtNtries.NbOfNtries++
+		}
+		s.Ntry = append(s.Ntry, entry(e))
+	}
+	sum := &s.TxsSummry
+	sum.TtlNtries.NbOfNtries = len(st.Entries)
+	sum.TtlNtries.Sum = formatCents(credits + debits)
+	sum.TtlNtries.TtlNetNtryAmt = formatCents(abs(credits - debits))
+	sum.TtlNtries.CdtDbtInd = indicator(credits - debits)
+	sum.TtlCdtNtries.Sum = formatCents(credits)
+	sum.TtlDbtNtries.Sum = formatCents(debits)
+	return s
+}
+
+func balance(code string, amount float64, at camtDate) camtBalance {
+	cents := model.Cents(amount)
+	b := camtBalance{
+		Amt:       camtAmount{Value: formatCents(abs(cents)), Ccy: model.Currency},
+		CdtDbtInd: indicator(cents),
+		Dt:        at,
+	}
+	b.Tp.CdOrPrtry.Cd = code
+	return b
+}
+
+// entry renders a settled transfer as a booked entry. The counterparty is
+// the creditor of a debit and the debtor of a credit.
+func entry(e model.StatementEntry) camtEntry {
+	cents := model.Cents(e.Amount)
+	ref := strconv.FormatInt(e.TxID, 10)
+	n := camtEntry{
+		NtryRef:     ref,
+		Amt:         camtAmount{Value: formatCents(abs(cents)), Ccy: model.Currency},
+		CdtDbtInd:   indicator(cents),
+		Sts:         "BOOK",
+		BookgDt:     camtDate{DtTm: e.BookedAt.UTC().Format(dateTimeLayout)},
+		ValDt:       camtDate{Dt: e.BookedAt.UTC().Format(time.DateOnly)},
+		AcctSvcrRef: ref,
+	}
+	if e.ValueDate != nil {
+		n.ValDt.Dt = *e.ValueDate
+	}
+	n.BkTxCd.Domn.Cd = "PMNT"
+	n.BkTxCd.Domn.Fmly.SubFmlyCd = "BOOK" // a transfer between minibank accounts
+
+	tx := &n.NtryDtls.TxDtls
+	tx.Refs.AcctSvcrRef = ref
+	tx.Refs.EndToEndId = notProvided
+	if e.Reference != nil {
+		tx.Refs.EndToEndId = *e.Reference
+	}
+	party := &camtPartyAccount{}
+	party.Id.Othr.Id = e.Counterparty
+	if cents < 0 {
+		n.BkTxCd.Domn.Fmly.Cd = "ICDT" // issued credit transfer
+		tx.RltdPties.CdtrAcct = party
+	} else {
+		n.BkTxCd.Domn.Fmly.Cd = "RCDT" // received credit transfer
+		tx.RltdPties.DbtrAcct = party
+	}
+	if e.Memo != nil {
+		tx.RmtInf = &struct{ Ustrd string }{Ustrd: *e.Memo}
+	}
+	return n
+}
+
+// formatCents writes a non-negative amount of cents as a decimal.
+func formatCents(c int64) string {
+	return fmt.Sprintf("%d.%02d", c/100, c%100)
+}
+
+func indicator(cents int64) string {
+	if cents < 0 {
+		return Debit
+	}
+	return Credit
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,68 @@
+package iso20022_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/token-cjg/minibank/internal/iso20022"
+	"github.com/token-cjg/minibank/internal/model"
+	"github.com/token-cjg/minibank/internal/testutil/golden"
+)
+
+func ptr(s string) *string { return &s }
+
+// statement is a day of activity on account 1000000000000000: a debit with
+// a reference, memo and value date, and a credit with none.
+func statement() model.Statement {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	return model.Statement{
+		Account:     model.Account{ID: 1, Company: 1, Number: "1000000000000000", Balance: 900},
+		CompanyName: "Acme Pty Ltd",
+		From:        day,
+		To:          day.AddDate(0, 0, 1),
+		Opening:     1000,
+		Closing:     925.5,
+		Entries: []model.StatementEntry{{
+			TxID:         7,
+			BookedAt:     day.Add(9*time.Hour + 30*time.Minute),
+			Amount:       -100,
+			Counterparty: "1000000000000001",
+			Reference:    ptr("INV-1001"),
+			Memo:         ptr("Invoice 1001 March"),
+			ValueDate:    ptr("2024-02-29"),
+		}, {
+			TxID:         9,
+			BookedAt:     day.Add(14 * time.Hour),
+			Amount:       25.5,
+			Counterparty: "1000000000000002",
+		}},
+	}
+}
+
+func TestCamt053(t *testing.T) {
+	out, err := iso20022.Camt053(statement(), time.Date(2024, 3, 2, 1, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden.Assert(t, "camt053.xml", out)
+}
+
+func TestCamt052(t *testing.T) {
+	st := statement()
+	st.To = st.From.Add(15 * time.Hour)
+	out, err := iso20022.Camt052(st, st.To)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden.Assert(t, "camt052.xml", out)
+}
+
+func TestCamt053_NoEntries(t *testing.T) {
+	st := statement()
+	st.Entries, st.Closing = nil, st.Opening
+	out, err := iso20022.Camt053(st, st.To)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden.Assert(t, "camt053_empty.xml", out)
+}
@@ -0,0 +1,290 @@
+// Package iso20022 reads and writes the ISO 20022 messages minibank
+// exchanges with corporate clients: pain.001 credit transfer initiations
+// in, pain.002 payment status reports out, and camt.052 intraday reports
+// and camt.053 end-of-day statements of account activity.
+package iso20022
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported pain.001 versions and the pain.002 version answering each.
+const (
+	Pain001V03 = "pain.001.001.03"
+	Pain001V09 = "pain.001.001.09"
+
+	Pain002V03 = "pain.002.001.03"
+	Pain002V10 = "pain.002.001.10"
+)
+
+// namespacePrefix starts the XML namespace of every ISO 20022 message.
+const namespacePrefix = "urn:iso:std:iso:20022:tech:xsd:"
+
+// ErrUnsupported is returned by ParsePain001 for a document that is not a
+// supported pain.001 version.
+var ErrUnsupported = errors.New("unsupported message")
+
+// Status codes of a pain.002 report.
+const (
+	StatusAccepted = "ACSC" // accepted, settlement completed
+	StatusRejected = "RJCT"
+	StatusPartial  = "PART" // some transactions accepted, some rejected
+)
+
+// External status reason codes used in rejections.
+const (
+	ReasonAccount      = "AC01" // incorrect account number
+	ReasonForbidden    = "AG01" // transaction forbidden
+	ReasonCurrency     = "AM03" // currency not allowed
+	ReasonInsufficient = "AM04" // insufficient funds
+	ReasonControlSum   = "AM10" // invalid control sum
+	ReasonAmount       = "AM12" // invalid amount
+	ReasonNumberOfTxs  = "AM18" // invalid number of transactions
+	ReasonNarrative    = "NARR" // see the additional information
+)
+
+// accountNumberDigits is the length of a minibank account number.
+const accountNumberDigits = 16
+
+// Initiation is a parsed pain.001 customer credit transfer initiation.
+type Initiation struct {
+	Version  string // Pain001V03 or Pain001V09
+	MsgID    string
+	NbOfTxs  string
+	CtrlSum  string
+	Payments []*Payment
+
+	// Status is the group status; set by Reject, or worked out from the
+	// transaction statuses by Report.
+	Status Status
+}
+
+// Payment is one PmtInf block: a debtor account and the credit transfers
+// paid from it.
+type Payment struct {
+	ID            string
+	Method        string
+	DebtorAccount Account
+	ExecutionDate time.Time // zero if absent
+	Transfers     []*CreditTransfer
+}
+
+// CreditTransfer is one CdtTrfTxInf.
+type CreditTransfer struct {
+	InstrID         string
+	EndToEndID      string
+	Amount          string // as written, e.g. "100.50"
+	Currency        string
+	CreditorAccount Account
+	Remittance      string // unstructured remittance information, joined
+
+	Status Status // set by the caller before Report
+}
+
+// Status is the outcome reported for a transaction or the whole message.
+type Status struct {
+	Code   string // StatusAccepted, StatusRejected or StatusPartial
+	Reason string // external reason code for a rejection
+	Info   string // additional information
+}
+
+// Rejected returns a rejection for reason, described by info.
+func Rejected(reason, info string) Status {
+	return Status{Code: StatusRejected, Reason: reason, Info: info}
+}
+
+// Account identifies an account by IBAN or by another identifier.
+type Account struct {
+	IBAN  string
+	Other string
+}
+
+func (a Account) String() string {
+	if a.IBAN != "" {
+		return a.IBAN
+	}
+	return a.Other
+}
+
+// Number maps a to a minibank account number: an "other" identifier that
+// is the 16-digit account number itself, or an IBAN whose last 16
+// characters are. It reports false for anything else.
+func (a Account) Number() (int64, bool) {
+	id := a.Other
+	if a.IBAN != "" {
+		iban := strings.ReplaceAll(a.IBAN, " ", "")
+		if len(iban) < 4+accountNumberDigits {
+			return 0, false
+		}
+		id = iban[len(iban)-accountNumberDigits:]
+	}
+	if len(id) != accountNumberDigits {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// Transfers lists every credit transfer of in, in document order.
+func (in *Initiation) Transfers() []*CreditTransfer {
+	var out []*CreditTransfer
+	for _, p := range in.Payments {
+		out = append(out, p.Transfers...)
+	}
+	return out
+}
+
+// Reject rejects the whole message; Report then lists no transactions.
+func (in *Initiation) Reject(reason, info string) {
+	in.Status = Rejected(reason, info)
+}
+
+// CheckTotals compares the group header's NbOfTxs and CtrlSum, when given,
+// with the transactions actually present, and rejects the message if they
+// disagree. It reports whether they agree.
+func (in *Initiation) CheckTotals() bool {
+	txs := in.Transfers()
+	if in.NbOfTxs != "" && in.NbOfTxs != strconv.Itoa(len(txs)) {
+		in.Reject(ReasonNumberOfTxs, fmt.Sprintf("NbOfTxs is %s but the message has %d transactions", in.NbOfTxs, len(txs)))
+		return false
+	}
+	if in.CtrlSum == "" {
+		return true
+	}
+	want, ok := new(big.Rat).SetString(in.CtrlSum)
+	sum := new(big.Rat)
+	for _, t := range txs {
+		amt, amtOK := new(big.Rat).SetString(t.Amount)
+		if !amtOK {
+			ok = false
+			break
+		}
+		sum.Add(sum, amt)
+	}
+	if !ok || want.Cmp(sum) != 0 {
+		in.Reject(ReasonControlSum, "CtrlSum is not the sum of the transaction amounts")
+		return false
+	}
+	return true
+}
+
+// The XML shapes shared by both versions. Element names carry no namespace,
+// so they match whichever version's namespace the document declares.
+type (
+	painDocument struct {
+		XMLName xml.Name
+		Initn   *struct {
+			GrpHdr struct {
+				MsgId   string
+				NbOfTxs string
+				CtrlSum string
+			}
+			PmtInf []painPayment
+		} `xml:"CstmrCdtTrfInitn"`
+	}
+	painPayment struct {
+		PmtInfId    string
+		PmtMtd      string
+		ReqdExctnDt struct {
+			Date string `xml:",chardata"` // version 03
+			Dt   string // version 09
+			DtTm string
+		}
+		DbtrAcct    painAccount
+		CdtTrfTxInf []struct {
+			PmtId struct {
+				InstrId    string
+				EndToEndId string
+			}
+			Amt struct {
+				InstdAmt struct {
+					Value string `xml:",chardata"`
+					Ccy   string `xml:"Ccy,attr"`
+				}
+			}
+			CdtrAcct painAccount
+			RmtInf   struct {
+				Ustrd []string
+			}
+		}
+	}
+	painAccount struct {
+		Id struct {
+			IBAN string
+			Othr struct {
+				Id string
+			}
+		}
+	}
+)
+
+func (a painAccount) account() Account {
+	return Account{IBAN: strings.TrimSpace(a.Id.IBAN), Other: strings.TrimSpace(a.Id.Othr.Id)}
+}
+
+// ParsePain001 reads a pain.001.001.03 or pain.001.001.09 document.
+func ParsePain001(r io.Reader) (*Initiation, error) {
+	var doc painDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("malformed XML: %w", err)
+	}
+	version := strings.TrimPrefix(doc.XMLName.Space, namespacePrefix)
+	if doc.XMLName.Local != "Document" || (version != Pain001V03 && version != Pain001V09) || doc.Initn == nil {
+		return nil, fmt.Errorf("%w: want a %s or %s Document, got %s in namespace %q",
+			ErrUnsupported, Pain001V03, Pain001V09, doc.XMLName.Local, doc.XMLName.Space)
+	}
+
+	hdr := doc.Initn.GrpHdr
+	in := &Initiation{
+		Version: version,
+		MsgID:   strings.TrimSpace(hdr.MsgId),
+		NbOfTxs: strings.TrimSpace(hdr.NbOfTxs),
+		CtrlSum: strings.TrimSpace(hdr.CtrlSum),
+	}
+	for _, pi := range doc.Initn.PmtInf {
+		p := &Payment{
+			ID:            strings.TrimSpace(pi.PmtInfId),
+			Method:        strings.TrimSpace(pi.PmtMtd),
+			DebtorAccount: pi.DbtrAcct.account(),
+		}
+		date := firstNonEmpty(pi.ReqdExctnDt.Dt, pi.ReqdExctnDt.DtTm, pi.ReqdExctnDt.Date)
+		if date != "" {
+			d, err := time.Parse(time.DateOnly, date[:min(len(date), len(time.DateOnly))])
+			if err != nil {
+				return nil, fmt.Errorf("payment %s: bad ReqdExctnDt %q", p.ID, date)
+			}
+			p.ExecutionDate = d
+		}
+		for _, tx := range pi.CdtTrfTxInf {
+			p.Transfers = append(p.Transfers, &CreditTransfer{
+				InstrID:         strings.TrimSpace(tx.PmtId.InstrId),
+				EndToEndID:      strings.TrimSpace(tx.PmtId.EndToEndId),
+				Amount:          strings.TrimSpace(tx.Amt.InstdAmt.Value),
+				Currency:        tx.Amt.InstdAmt.Ccy,
+				CreditorAccount: tx.CdtrAcct.account(),
+				Remittance:      strings.Join(tx.RmtInf.Ustrd, " "),
+			})
+		}
+		in.Payments = append(in.Payments, p)
+	}
+	return in, nil
+}
+
+func firstNonEmpty(ss ...string) string {
+	for _, s := range ss {
+		if s = strings.TrimSpace(s); s != "" {
+			return s
+		}
+	}
+	return ""
+}
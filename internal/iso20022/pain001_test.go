@@ -0,0 +1,135 @@
+package iso20022_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/token-cjg/minibank/internal/iso20022"
+	"github.com/token-cjg/minibank/internal/testutil/golden"
+)
+
+func parseFile(t *testing.T, name string) *iso20022.Initiation {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	in, err := iso20022.ParsePain001(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return in
+}
+
+func TestParsePain001_V03(t *testing.T) {
+	in := parseFile(t, "pain001_v03.xml")
+
+	if in.Version != iso20022.Pain001V03 || in.MsgID != "ERP-20240301-01" || len(in.Payments) != 1 {
+		t.Fatalf("initiation %+v", in)
+	}
+	p := in.Payments[0]
+	if n, ok := p.DebtorAccount.Number(); !ok || n != 1000000000000000 {
+		t.Errorf("debtor %v", p.DebtorAccount)
+	}
+	if !p.ExecutionDate.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("execution date %v", p.ExecutionDate)
+	}
+	txs := in.Transfers()
+	if len(txs) != 3 {
+		t.Fatalf("%d transfers", len(txs))
+	}
+	first := txs[0]
+	if first.EndToEndID != "INV-1001" || first.InstrID != "I-1" || first.Amount != "1000.50" ||
+		first.Currency != "AUD" || first.Remittance != "Invoice 1001 March" {
+		t.Errorf("first transfer %+v", first)
+	}
+	if n, ok := first.CreditorAccount.Number(); !ok || n != 1000000000000001 {
+		t.Errorf("creditor %v maps to %d, %v", first.CreditorAccount, n, ok)
+	}
+	if _, ok := txs[2].CreditorAccount.Number(); ok {
+		t.Errorf("creditor %v should not map to an account number", txs[2].CreditorAccount)
+	}
+	if !in.CheckTotals() {
+		t.Errorf("totals rejected: %+v", in.Status)
+	}
+}
+
+func TestParsePain001_V09(t *testing.T) {
+	in := parseFile(t, "pain001_v09.xml")
+
+	if in.Version != iso20022.Pain001V09 || len(in.Transfers()) != 1 {
+		t.Fatalf("initiation %+v", in)
+	}
+	p := in.Payments[0]
+	if n, ok := p.DebtorAccount.Number(); !ok || n != 1000000000000000 {
+		t.Errorf("debtor IBAN %v maps to %d, %v", p.DebtorAccount, n, ok)
+	}
+	if !p.ExecutionDate.Equal(time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("execution date %v", p.ExecutionDate)
+	}
+}
+
+func TestParsePain001_Unsupported(t *testing.T) {
+	for _, doc := range []string{
+		`<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.008.001.02"><CstmrDrctDbtInitn/></Document>`,
+		`<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.001.001.03"></Document>`,
+		`<Invoice/>`,
+	} {
+		if _, err := iso20022.ParsePain001(strings.NewReader(doc)); !errors.Is(err, iso20022.ErrUnsupported) {
+			t.Errorf("%s: err %v, want ErrUnsupported", doc, err)
+		}
+	}
+	if _, err := iso20022.ParsePain001(strings.NewReader(`<Document`)); err == nil {
+		t.Error("malformed XML accepted")
+	}
+}
+
+func TestCheckTotals(t *testing.T) {
+	in := parseFile(t, "pain001_v03.xml")
+	in.CtrlSum = "1350.70"
+	if in.CheckTotals() || in.Status.Reason != iso20022.ReasonControlSum {
+		t.Errorf("bad CtrlSum: status %+v", in.Status)
+	}
+
+	in = parseFile(t, "pain001_v03.xml")
+	in.NbOfTxs = "2"
+	if in.CheckTotals() || in.Status.Reason != iso20022.ReasonNumberOfTxs {
+		t.Errorf("bad NbOfTxs: status %+v", in.Status)
+	}
+}
+
+var reportTime = time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+func TestReport_Partial(t *testing.T) {
+	in := parseFile(t, "pain001_v03.xml")
+	txs := in.Transfers()
+	txs[0].Status = iso20022.Status{Code: iso20022.StatusAccepted}
+	txs[1].Status = iso20022.Rejected(iso20022.ReasonInsufficient, "insufficient balance")
+	txs[2].Status = iso20022.Rejected(iso20022.ReasonAccount, `creditor account "GLOBEX-SAVINGS" is not a minibank account number`)
+
+	out, err := in.Report("STS-ERP-20240301-01", reportTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden.Assert(t, "pain002_v03_partial.xml", out)
+	if in.Status.Code != iso20022.StatusPartial {
+		t.Errorf("group status %q", in.Status.Code)
+	}
+}
+
+func TestReport_GroupRejected(t *testing.T) {
+	in := parseFile(t, "pain001_v09.xml")
+	in.NbOfTxs = "5"
+	in.CheckTotals()
+
+	out, err := in.Report("STS-ERP-20240302-01", reportTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden.Assert(t, "pain002_v10_rejected.xml", out)
+}
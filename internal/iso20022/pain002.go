@@ -0,0 +1,147 @@
+package iso20022
+
+import (
+	"encoding/xml"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// maxInfoLen bounds AddtlInf in a status reason.
+const maxInfoLen = 105
+
+// ReportVersion returns the pain.002 version that answers a pain.001 version.
+func ReportVersion(pain001 string) string {
+	if pain001 == Pain001V03 {
+		return Pain002V03
+	}
+	return Pain002V10
+}
+
+type (
+	reportDocument struct {
+		XMLName xml.Name     `xml:"Document"`
+		Xmlns   string       `xml:"xmlns,attr"`
+		Report  reportStatus `xml:"CstmrPmtStsRpt"`
+	}
+	reportStatus struct {
+		GrpHdr struct {
+			MsgId   string
+			CreDtTm string
+		}
+		OrgnlGrpInfAndSts struct {
+			OrgnlMsgId   string
+			OrgnlMsgNmId string
+			OrgnlNbOfTxs string        `xml:",omitempty"`
+			GrpSts       string        `xml:",omitempty"`
+			StsRsnInf    *reportReason `xml:",omitempty"`
+		}
+		OrgnlPmtInfAndSts []reportPayment `xml:",omitempty"`
+	}
+	reportPayment struct {
+		OrgnlPmtInfId string
+		PmtInfSts     string
+		TxInfAndSts   []reportTx
+	}
+	reportTx struct {
+		OrgnlInstrId    string `xml:",omitempty"`
+		OrgnlEndToEndId string
+		TxSts           string
+		StsRsnInf       *reportReason `xml:",omitempty"`
+	}
+	reportReason struct {
+		Rsn struct {
+			Cd string
+		}
+		AddtlInf string `xml:",omitempty"`
+	}
+)
+
+func reason(s Status) *reportReason {
+	if s.Code != StatusRejected {
+		return nil
+	}
+	r := &reportReason{AddtlInf: truncate(s.Info, maxInfoLen)}
+	r.Rsn.Cd = s.Reason
+	return r
+}
+
+// Report renders the pain.002 status report answering in, with message id
+// msgID created at created. Unless the whole message was rejected, every
+// transaction is listed with its Status, and the payment and group
+// statuses are ACSC, RJCT or PART accordingly.
+func (in *Initiation) Report(msgID string, created time.Time) ([]byte, error) {
+	version := ReportVersion(in.Version)
+	doc := reportDocument{Xmlns: namespacePrefix + version}
+	rpt := &doc.Report
+	rpt.GrpHdr.MsgId = msgID
+	rpt.GrpHdr.CreDtTm = created.UTC().Format(dateTimeLayout)
+	grp := &rpt.OrgnlGrpInfAndSts
+	grp.OrgnlMsgId = in.MsgID
+	grp.OrgnlMsgNmId = in.Version
+	grp.OrgnlNbOfTxs = strconv.Itoa(len(in.Transfers()))
+
+	if in.Status.Code == StatusRejected {
+		grp.GrpSts = StatusRejected
+		grp.StsRsnInf = reason(in.Status)
+		return marshal(doc)
+	}
+
+	var all tally
+	for _, p := range in.Payments {
+		var pay tally
+		rp := reportPayment{OrgnlPmtInfId: p.ID}
+		for _, t := range p.Transfers {
+			pay.add(t.Status.Code)
+			rp.TxInfAndSts = append(rp.TxInfAndSts, reportTx{
+				OrgnlInstrId:    t.InstrID,
+				OrgnlEndToEndId: t.EndToEndID,
+				TxSts:           t.Status.Code,
+				StsRsnInf:       reason(t.Status),
+			})
+		}
+		rp.PmtInfSts = pay.status()
+		all.accepted += pay.accepted
+		all.rejected += pay.rejected
+		rpt.OrgnlPmtInfAndSts = append(rpt.OrgnlPmtInfAndSts, rp)
+	}
+	in.Status = Status{Code: all.status()}
+	grp.GrpSts = in.Status.Code
+	return marshal(doc)
+}
+
+// tally counts transaction statuses to derive a payment or group status.
+type tally struct{ accepted, rejected int }
+
+func (t *tally) add(code string) {
+	if code == StatusAccepted {
+		t.accepted++
+	} else {
+		t.rejected++
+	}
+}
+
+func (t tally) status() string {
+	switch {
+	case t.rejected == 0:
+		return StatusAccepted
+	case t.accepted == 0:
+		return StatusRejected
+	}
+	return StatusPartial
+}
+
+func marshal(doc any) ([]byte, error) {
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(out, '\n')...), nil
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
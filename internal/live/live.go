@@ -0,0 +1,153 @@
+// Package live streams transactions to clients as they commit. Transfers
+// notify a Postgres channel in the transaction that writes them (see
+// repo.TxChannel), so a Hub on every server sees every transfer whichever
+// server made it, and passes each one to the subscriptions it concerns.
+//
+// Subscriptions are best effort: one that falls behind, or that may have
+// missed events while the hub was reconnecting to the database, is closed.
+// Clients resume from the last transaction they saw, which
+// repo.TransactionEventsSince replays.
+package live
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/token-cjg/minibank/internal/metrics"
+	"github.com/token-cjg/minibank/internal/model"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+// Buffer is how many events a subscription holds for a slow reader before
+// it is closed.
+const Buffer = 256
+
+// Filter picks the events of one company, or of one of its accounts: its
+// settled transfers in either direction and its declined debits.
+type Filter struct {
+	Company int64
+	Account int64 // 0 for every account of the company
+}
+
+// Match reports whether ev concerns f.
+func (f Filter) Match(ev model.TransactionEvent) bool {
+	debit := ev.SourceCompany == f.Company && (f.Account == 0 || ev.Source == f.Account)
+	credit := ev.TargetCompany == f.Company && (f.Account == 0 || ev.Target == f.Account)
+	return debit || (credit && ev.Error == nil)
+}
+
+// Subscription receives matching events on C until it is closed, by Close
+// or by the hub, which then closes C.
+type Subscription struct {
+	C      <-chan model.TransactionEvent
+	c      chan model.TransactionEvent
+	filter Filter
+	hub    *Hub
+}
+
+// Close ends the subscription. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.drop(s)
+}
+
+// Hub fans transaction events out to subscriptions.
+type Hub struct {
+	Repo *repo.Repo
+	// RetryDelay is the wait before reconnecting after the listening
+	// connection fails.
+	RetryDelay time.Duration
+
+	mu      sync.Mutex
+	subs    map[*Subscription]bool
+	stopped bool
+}
+
+func NewHub(rep *repo.Repo) *Hub {
+	return &Hub{Repo: rep, RetryDelay: time.Second, subs: make(map[*Subscription]bool)}
+}
+
+// Subscribe starts a subscription to the events f matches. After the hub
+// has stopped the subscription comes back already closed.
+func (h *Hub) Subscribe(f Filter) *Subscription {
+	c := make(chan model.TransactionEvent, Buffer)
+	s := &Subscription{C: c, c: c, filter: f, hub: h}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stopped {
+		close(c)
+		return s
+	}
+	h.subs[s] = true
+	metrics.LiveSubscriptions.Inc()
+	return s
+}
+
+// Publish passes ev to every subscription it matches, closing any that
+// has no room for it.
+func (h *Hub) Publish(ev model.TransactionEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		if !s.filter.Match(ev) {
+			continue
+		}
+		select {
+		case s.c <- ev:
+		default:
+			metrics.LiveSubscriptionsDropped.Inc()
+			h.drop(s)
+		}
+	}
+}
+
+// Run listens for transactions until ctx is done, reconnecting after
+// RetryDelay when the connection fails. Every subscription open while the
+// hub is not listening may miss events, so they are closed both when the
+// connection fails and once it is back. When Run returns the hub is
+// stopped and every subscription closed.
+func (h *Hub) Run(ctx context.Context) {
+	defer func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.stopped = true
+		h.closeAll()
+	}()
+	for {
+		err := h.Repo.Listen(ctx, h.reset, h.Publish)
+		h.reset()
+		if ctx.Err() != nil {
+			return
+		}
+		slog.ErrorContext(ctx, "listen for transactions", "err", err, "retry_in", h.RetryDelay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(h.RetryDelay):
+		}
+	}
+}
+
+func (h *Hub) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closeAll()
+}
+
+func (h *Hub) closeAll() {
+	for s := range h.subs {
+		h.drop(s)
+	}
+}
+
+// drop ends s; h.mu must be held.
+func (h *Hub) drop(s *Subscription) {
+	if h.subs[s] {
+		delete(h.subs, s)
+		close(s.c)
+		metrics.LiveSubscriptions.Dec()
+	}
+}
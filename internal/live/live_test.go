@@ -0,0 +1,96 @@
+package live_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/token-cjg/minibank/internal/live"
+	"github.com/token-cjg/minibank/internal/model"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+func TestFilterMatch(t *testing.T) {
+	declined := "tx declined, insufficient balance"
+	settled := model.TransactionEvent{ID: 1, SourceCompany: 1, Source: 10, TargetCompany: 2, Target: 20}
+	refused := settled
+	refused.Error = &declined
+
+	cases := []struct {
+		name   string
+		filter live.Filter
+		ev     model.TransactionEvent
+		want   bool
+	}{
+		{"debit", live.Filter{Company: 1}, settled, true},
+		{"credit", live.Filter{Company: 2}, settled, true},
+		{"other company", live.Filter{Company: 3}, settled, false},
+		{"declined debit", live.Filter{Company: 1}, refused, true},
+		{"declined credit", live.Filter{Company: 2}, refused, false},
+		{"account debit", live.Filter{Company: 1, Account: 10}, settled, true},
+		{"account credit", live.Filter{Company: 2, Account: 20}, settled, true},
+		{"other account", live.Filter{Company: 1, Account: 11}, settled, false},
+		{"account of other company", live.Filter{Company: 1, Account: 20}, settled, false},
+	}
+	for _, c := range cases {
+		if got := c.filter.Match(c.ev); got != c.want {
+			t.Errorf("%s: Match = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	h := live.NewHub(nil)
+	mine := h.Subscribe(live.Filter{Company: 1})
+	defer mine.Close()
+	other := h.Subscribe(live.Filter{Company: 2})
+	defer other.Close()
+
+	h.Publish(model.TransactionEvent{ID: 7, SourceCompany: 1, TargetCompany: 1})
+	if ev := <-mine.C; ev.ID != 7 {
+		t.Fatalf("got event %d, want 7", ev.ID)
+	}
+	select {
+	case ev := <-other.C:
+		t.Fatalf("other company got event %d", ev.ID)
+	default:
+	}
+}
+
+func TestPublish_DropsSlowSubscription(t *testing.T) {
+	h := live.NewHub(nil)
+	slow := h.Subscribe(live.Filter{Company: 1})
+
+	for i := range live.Buffer + 1 {
+		h.Publish(model.TransactionEvent{ID: int64(i + 1), SourceCompany: 1})
+	}
+	n := 0
+	for range slow.C {
+		n++
+	}
+	if n != live.Buffer {
+		t.Fatalf("read %d events before the subscription closed, want %d", n, live.Buffer)
+	}
+	slow.Close() // already closed by the hub; must not panic
+}
+
+func TestRun_ClosesSubscriptionsWhenStopped(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	h := live.NewHub(repo.New(db))
+	sub := h.Subscribe(live.Filter{Company: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	h.Run(ctx)
+
+	if _, ok := <-sub.C; ok {
+		t.Fatal("subscription still open after Run returned")
+	}
+	if _, ok := <-h.Subscribe(live.Filter{Company: 1}).C; ok {
+		t.Fatal("subscription to a stopped hub is open")
+	}
+}
@@ -0,0 +1,104 @@
+// Package logging sets up structured JSON logging with log/slog and carries
+// the request ID through contexts so that every log line written while
+// serving a request can be correlated with its access log entry.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// RequestIDHeader is read from incoming requests and echoed on responses.
+const RequestIDHeader = "X-Request-ID"
+
+type ctxKey struct{}
+
+// WithRequestID returns a copy of ctx carrying id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// RequestID returns the request ID stored in ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// maxRequestIDLen bounds client supplied request IDs so they cannot bloat logs.
+const maxRequestIDLen = 128
+
+// ValidRequestID reports whether a client supplied request ID may be used
+// as it is: printable ASCII without spaces, and not too long.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e { // printable ASCII, no spaces
+			return false
+		}
+	}
+	return true
+}
+
+// NewRequestID returns a random request ID for requests that came without
+// a valid one.
+func NewRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// ParseLevel accepts debug, info, warn or error (case-insensitive).
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return 0, fmt.Errorf("invalid log level %q (want debug, info, warn or error)", s)
+	}
+	return l, nil
+}
+
+// New returns a JSON logger writing to w at the given level. Records logged
+// with a context get a request_id attribute when the context carries one.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	h := slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})
+	return slog.New(contextHandler{h})
+}
+
+// Setup installs a JSON logger on stderr as the slog and log default, at the
+// level named by LOG_LEVEL (info when unset).
+func Setup() error {
+	level := slog.LevelInfo
+	if s := os.Getenv("LOG_LEVEL"); s != "" {
+		var err error
+		if level, err = ParseLevel(s); err != nil {
+			return err
+		}
+	}
+	slog.SetDefault(New(os.Stderr, level))
+	return nil
+}
+
+// contextHandler adds the request ID found in the record's context.
+type contextHandler struct{ slog.Handler }
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
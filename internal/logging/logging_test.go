@@ -0,0 +1,37 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/token-cjg/minibank/internal/logging"
+)
+
+func TestNew_AddsRequestIDFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	log := logging.New(&buf, slog.LevelInfo).With("component", "test")
+
+	ctx := logging.WithRequestID(context.Background(), "req-123")
+	log.InfoContext(ctx, "hello")
+	log.DebugContext(ctx, "filtered out")
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("want exactly one JSON line, got %q: %v", buf.String(), err)
+	}
+	if line["request_id"] != "req-123" || line["component"] != "test" || line["msg"] != "hello" {
+		t.Fatalf("unexpected log line %v", line)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if l, err := logging.ParseLevel("WARN"); err != nil || l != slog.LevelWarn {
+		t.Fatalf("got %v, %v", l, err)
+	}
+	if _, err := logging.ParseLevel("loud"); err == nil {
+		t.Fatal("expected error for unknown level")
+	}
+}
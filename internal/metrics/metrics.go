@@ -0,0 +1,141 @@
+// Package metrics defines the Prometheus collectors exported by the server.
+// Collectors are package level so any layer can record into them without
+// threading a registry through constructors; they are registered on a
+// dedicated Registry served by Handler.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "minibank"
+
+var (
+	// Registry holds every minibank collector plus the Go runtime and process
+	// collectors.
+	Registry = prometheus.NewRegistry()
+
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by mux route template, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by mux route template and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	GRPCRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "grpc",
+		Name:      "requests_total",
+		Help:      "gRPC calls by full method name and status code.",
+	}, []string{"method", "code"})
+
+	GRPCDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "grpc",
+		Name:      "request_duration_seconds",
+		Help:      "gRPC call latency by full method name; streams count until they end.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	TransfersTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transfers_total",
+		Help:      "Transfers processed by outcome (see repo.Outcome).",
+	}, []string{"outcome"})
+
+	SerializationFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "transfer",
+		Name:      "serialization_failures_total",
+		Help:      "Transfers that hit a Postgres serialization failure or deadlock.",
+	})
+
+	TransferRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "transfer",
+		Name:      "retries_total",
+		Help:      "Transfer transactions re-run after a serialization failure or deadlock.",
+	})
+
+	TransferRetriesExhausted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "transfer",
+		Name:      "retries_exhausted_total",
+		Help:      "Transfers that still conflicted after the last allowed attempt.",
+	})
+
+	BatchSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "batch",
+		Name:      "rows",
+		Help:      "Rows per transfer batch.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 10), // 1 .. ~262k
+	})
+
+	BatchDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "batch",
+		Name:      "duration_seconds",
+		Help:      "Wall time to process a transfer batch.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 4, 10), // 10ms .. ~45min
+	})
+
+	WebhookAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "webhook",
+		Name:      "attempts_total",
+		Help:      "Webhook delivery attempts by result: delivered, retry or failed.",
+	}, []string{"result"})
+
+	LiveSubscriptions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "live",
+		Name:      "subscriptions",
+		Help:      "Open live transaction event streams.",
+	})
+	LiveSubscriptionsDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "live",
+		Name:      "subscriptions_dropped_total",
+		Help:      "Live event streams closed because the client fell behind.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests, HTTPDuration,
+		GRPCRequests, GRPCDuration,
+		TransfersTotal, SerializationFailures,
+		TransferRetries, TransferRetriesExhausted,
+		BatchSize, BatchDuration,
+		WebhookAttempts,
+		LiveSubscriptions, LiveSubscriptionsDropped,
+	)
+}
+
+// RegisterDBStats exports the connection pool statistics of db
+// (sql.DB.Stats) as minibank_go_sql_* metrics labelled db_name="postgres".
+func RegisterDBStats(db *sql.DB) error {
+	return prometheus.WrapRegistererWithPrefix(namespace+"_", Registry).
+		Register(collectors.NewDBStatsCollector(db, "postgres"))
+}
+
+// Handler serves Registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
@@ -3,6 +3,14 @@
 // The models are used in the repository layer to interact with the database.
 package model
 
+import (
+	"math"
+	"time"
+)
+
+// Currency is the currency of every account.
+const Currency = "AUD"
+
 type Company struct {
 	ID   int64  `json:"company_id"`
 	Name string `json:"company_name"`
@@ -16,10 +24,138 @@ type Account struct {
 }
 
 type Transaction struct {
-	ID        int64   `json:"tx_id"`
-	Source    int64   `json:"source_account_id"`
-	Target    int64   `json:"target_account_id"`
-	Amount    float64 `json:"transfer_amount"`
-	Error     *string `json:"error,omitempty"`
-	CreatedAt string  `json:"created_at"`
+	ID        int64     `json:"tx_id"`
+	Source    int64     `json:"source_account_id"`
+	Target    int64     `json:"target_account_id"`
+	Amount    float64   `json:"transfer_amount"`
+	Error     *string   `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Reference *string   `json:"reference,omitempty"`
+	Memo      *string   `json:"memo,omitempty"`
+	ValueDate *string   `json:"value_date,omitempty"`
+}
+
+// ImportProfile is a company's saved CSV dialect for transfer uploads; see
+// package csvimport for the meaning of each setting.
+type ImportProfile struct {
+	ID                 int64  `json:"profile_id"`
+	Company            int64  `json:"company_id"`
+	Name               string `json:"name"`
+	Delimiter          string `json:"delimiter"`
+	Header             string `json:"header"`
+	SourceColumn       string `json:"source_column"`
+	TargetColumn       string `json:"target_column"`
+	AmountColumn       string `json:"amount_column"`
+	ReferenceColumn    string `json:"reference_column"`
+	MemoColumn         string `json:"memo_column"`
+	ValueDateColumn    string `json:"value_date_column"`
+	DecimalSeparator   string `json:"decimal_separator"`
+	ThousandsSeparator string `json:"thousands_separator"`
+	Encoding           string `json:"encoding"`
+}
+
+// Statement is an account's settled transfers over [From, To), between its
+// balances at either end. Declined transfers are left out.
+type Statement struct {
+	Account     Account          `json:"account"`
+	CompanyName string           `json:"company_name"`
+	From        time.Time        `json:"from"`
+	To          time.Time        `json:"to"`
+	Opening     float64          `json:"opening_balance"`
+	Closing     float64          `json:"closing_balance"`
+	Entries     []StatementEntry `json:"entries"`
+}
+
+// StatementEntry is one settled transfer as seen from the statement's
+// account: a credit has a positive Amount, a debit a negative one. Balance
+// is the account's balance once the transfer settled.
+type StatementEntry struct {
+	TxID         int64     `json:"tx_id"`
+	BookedAt     time.Time `json:"booked_at"`
+	Amount       float64   `json:"amount"`
+	Balance      float64   `json:"balance"`
+	Counterparty string    `json:"counterparty_account_number"`
+	Reference    *string   `json:"reference,omitempty"`
+	Memo         *string   `json:"memo,omitempty"`
+	ValueDate    *string   `json:"value_date,omitempty"`
+}
+
+// AccountBalance is an account's balance at a point in time.
+type AccountBalance struct {
+	Account int64     `json:"account_id"`
+	At      time.Time `json:"at"`
+	Balance float64   `json:"balance"`
 }
+
+// Webhook event types.
+const (
+	EventTransferSettled  = "transfer.settled"
+	EventTransferDeclined = "transfer.declined"
+	EventBatchCompleted   = "batch.completed"
+	EventLowBalance       = "account.low_balance"
+)
+
+// EventTypes lists every webhook event type.
+var EventTypes = []string{EventTransferSettled, EventTransferDeclined, EventBatchCompleted, EventLowBalance}
+
+// Webhook is a company's subscription to events, delivered to URL and
+// signed with Secret. An account.low_balance event is raised when a debit
+// takes an account of the company from at least LowBalanceThreshold to
+// below it.
+type Webhook struct {
+	ID                  int64     `json:"webhook_id"`
+	Company             int64     `json:"company_id"`
+	URL                 string    `json:"url"`
+	Events              []string  `json:"events"`
+	LowBalanceThreshold *float64  `json:"low_balance_threshold,omitempty"`
+	Secret              string    `json:"secret,omitempty"` // only shown when created
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// Webhook delivery statuses.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is one event's delivery to one webhook and the outcome of
+// its latest attempt.
+type WebhookDelivery struct {
+	ID             int64      `json:"delivery_id"`
+	Webhook        int64      `json:"webhook_id"`
+	Event          int64      `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at,omitempty"`
+	ResponseStatus *int       `json:"response_status,omitempty"`
+	LastError      *string    `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// TransactionEvent is a committed transfer, or decline, as streamed live to
+// the companies whose accounts it touched. Type is EventTransferSettled or
+// EventTransferDeclined.
+type TransactionEvent struct {
+	ID            int64     `json:"tx_id"`
+	Type          string    `json:"type"`
+	SourceCompany int64     `json:"source_company_id"`
+	TargetCompany int64     `json:"target_company_id"`
+	Source        int64     `json:"source_account_id"`
+	Target        int64     `json:"target_account_id"`
+	SourceNumber  string    `json:"source_account_number"`
+	TargetNumber  string    `json:"target_account_number"`
+	Amount        float64   `json:"transfer_amount"`
+	Error         *string   `json:"error,omitempty"`
+	Reference     *string   `json:"reference,omitempty"`
+	Memo          *string   `json:"memo,omitempty"`
+	ValueDate     *string   `json:"value_date,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Cents converts an amount, which the database keeps to two decimal places,
+// to a whole number of cents for exact arithmetic.
+func Cents(amount float64) int64 { return int64(math.Round(amount * 100)) }
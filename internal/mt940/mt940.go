@@ -0,0 +1,213 @@
+// Package mt940 writes SWIFT MT940 customer statements, the end-of-day
+// format older treasury systems ingest. Only the text block is written:
+// each message is a run of tagged fields ended by a line holding "-", with
+// CRLF line endings.
+package mt940
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/token-cjg/minibank/internal/model"
+)
+
+// Field limits of the SWIFT standard.
+const (
+	maxMessageLen  = 2000 // characters in a message, including line ends
+	maxRefLen      = 16
+	narrativeLines = 6
+	narrativeWidth = 65
+	nonRef         = "NONREF"
+)
+
+// Number is the statement number of a statement starting on day: the day of
+// the year, so a day's statement keeps its number however often it is
+// generated.
+func Number(day time.Time) int { return day.YearDay() }
+
+// Encode writes the statements one after another. A statement too long for
+// one message continues in further messages with the same statement number
+// and the next sequence number, each closing with an intermediate balance
+// (:62M:) that the next opens with (:60M:).
+func Encode(sts []model.Statement) []byte {
+	var b bytes.Buffer
+	for _, st := range sts {
+		writeStatement(&b, st)
+	}
+	return b.Bytes()
+}
+
+// message is one MT940 message being built.
+type message struct {
+	lines []string
+	size  int
+}
+
+func (m *message) add(lines ...string) {
+	for _, l := range lines {
+		m.lines = append(m.lines, l)
+		m.size += len(l) + 2
+	}
+}
+
+func (m *message) writeTo(b *bytes.Buffer) {
+	for _, l := range m.lines {
+		b.WriteString(l)
+		b.WriteString("\r\n")
+	}
+	b.WriteString("-\r\n")
+}
+
+func writeStatement(b *bytes.Buffer, st model.Statement) {
+	day := st.From.UTC()
+	number := Number(day)
+	balance := model.Cents(st.Opening)
+	seq := 1
+	open := func(tag string) *message {
+		m := &message{}
+		m.add(
+			":20:"+statementRef(st.Account.Number, day),
+			":25:"+st.Account.Number,
+			fmt.Sprintf(":28C:%05d/%03d", number, seq),
+			":"+tag+":"+balanceField(balance, day),
+		)
+		return m
+	}
+
+	m := open("60F")
+	closing := len(":62F:") + len(balanceField(model.Cents(st.Closing), day)) + 2
+	for _, e := range st.Entries {
+		lines := entryLines(e)
+		size := 0
+		for _, l := range lines {
+			size += len(l) + 2
+		}
+		// Leave room for the closing balance and the terminating "-".
+		if len(m.lines) > 4 && m.size+size+closing+3 > maxMessageLen {
+			m.add(":62M:" + balanceField(balance, day))
+			m.writeTo(b)
+			seq++
+			m = open("60M")
+		}
+		m.add(lines...)
+		balance += model.Cents(e.Amount)
+	}
+	m.add(
+		":62F:"+balanceField(model.Cents(st.Closing), day),
+		":64:"+balanceField(model.Cents(st.Closing), day),
+	)
+	m.writeTo(b)
+}
+
+// statementRef is the sender's reference of a statement, field 20: the day
+// and the end of the account number, which fit in 16 characters.
+func statementRef(account string, day time.Time) string {
+	if len(account) > maxRefLen-7 {
+		account = account[len(account)-(maxRefLen-7):]
+	}
+	return day.Format("060102") + "-" + account
+}
+
+// balanceField is the body of a balance field: credit or debit mark, date,
+// currency and amount.
+func balanceField(cents int64, day time.Time) string {
+	return mark(cents) + day.Format("060102") + model.Currency + amount(cents)
+}
+
+// entryLines renders a settled transfer as a statement line, field 61, and
+// its information to the account owner, field 86. The statement line
+// carries the transfer's reference, or NONREF, and minibank's transaction
+// id; field 86 the reference in full, the counterparty account and the memo.
+func entryLines(e model.StatementEntry) []string {
+	cents := model.Cents(e.Amount)
+	booked := e.BookedAt.UTC()
+	value := booked
+	if e.ValueDate != nil {
+		if d, err := time.Parse(time.DateOnly, *e.ValueDate); err == nil {
+			value = d
+		}
+	}
+	ref := nonRef
+	if e.Reference != nil {
+		if r := reference(*e.Reference); r != "" {
+			ref = r
+		}
+	}
+	line := ":61:" + value.Format("060102") + booked.Format("0102") + mark(cents) +
+		amount(cents) + "NTRF" + ref + "//" + strconv.FormatInt(e.TxID, 10)
+
+	// Slashes would be read as code words, so values have none.
+	var info []string
+	if e.Reference != nil {
+		info = append(info, "/EREF/"+strings.ReplaceAll(sanitize(*e.Reference), "/", "-"))
+	}
+	info = append(info, "/ACCT/"+e.Counterparty)
+	if e.Memo != nil {
+		info = append(info, "/REMI/"+strings.ReplaceAll(sanitize(*e.Memo), "/", "-"))
+	}
+	return append([]string{line}, narrative(strings.Join(info, ""))...)
+}
+
+// narrative wraps s into the lines of field 86, dropping what does not fit.
+func narrative(s string) []string {
+	var lines []string
+	for i := 0; len(s) > 0 && i < narrativeLines; i++ {
+		n := min(len(s), narrativeWidth)
+		lines = append(lines, lineStart(s[:n]))
+		s = s[n:]
+	}
+	if len(lines) > 0 {
+		lines[0] = ":86:" + lines[0]
+	}
+	return lines
+}
+
+// reference fits a transfer reference into the 16 characters of field 61,
+// which may not contain "//" or start or end with "/".
+func reference(s string) string {
+	s = strings.ReplaceAll(sanitize(s), "/", "-")
+	if len(s) > maxRefLen {
+		s = s[:maxRefLen]
+	}
+	return strings.TrimSpace(s)
+}
+
+// sanitize replaces characters outside the SWIFT X character set with
+// spaces.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			strings.ContainsRune("/-?:().,'+ ", r):
+			return r
+		}
+		return ' '
+	}, s)
+}
+
+// lineStart replaces a leading ':' or '-', which would read as a new field
+// or the end of the message, with '.'.
+func lineStart(line string) string {
+	if strings.HasPrefix(line, ":") || strings.HasPrefix(line, "-") {
+		return "." + line[1:]
+	}
+	return line
+}
+
+func mark(cents int64) string {
+	if cents < 0 {
+		return "D"
+	}
+	return "C"
+}
+
+// amount writes cents as an MT amount: no sign, a decimal comma.
+func amount(cents int64) string {
+	if cents < 0 {
+		cents = -cents
+	}
+	return fmt.Sprintf("%d,%02d", cents/100, cents%100)
+}
@@ -0,0 +1,89 @@
+package mt940_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/token-cjg/minibank/internal/model"
+	"github.com/token-cjg/minibank/internal/mt940"
+	"github.com/token-cjg/minibank/internal/testutil/golden"
+)
+
+func ptr(s string) *string { return &s }
+
+var day = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+// statements are a day on two accounts of one company: a debit with every
+// detail, some awkward characters, and a credit with none.
+func statements() []model.Statement {
+	return []model.Statement{{
+		Account: model.Account{ID: 1, Company: 1, Number: "1000000000000000"},
+		From:    day, To: day.AddDate(0, 0, 1),
+		Opening: 1000, Closing: 925.5,
+		Entries: []model.StatementEntry{{
+			TxID:         7,
+			BookedAt:     day.Add(9 * time.Hour),
+			Amount:       -100,
+			Counterparty: "1000000000000001",
+			Reference:    ptr("INV/2024/1001-MARCH"),
+			Memo:         ptr("-Rent for März; see contract #42 for the details of this long memo line"),
+			ValueDate:    ptr("2024-02-29"),
+		}, {
+			TxID:         9,
+			BookedAt:     day.Add(14 * time.Hour),
+			Amount:       25.5,
+			Counterparty: "1000000000000002",
+		}},
+	}, {
+		Account: model.Account{ID: 2, Company: 1, Number: "1000000000000001"},
+		From:    day, To: day.AddDate(0, 0, 1),
+		Opening: 50, Closing: 150,
+		Entries: []model.StatementEntry{{
+			TxID:         7,
+			BookedAt:     day.Add(9 * time.Hour),
+			Amount:       100,
+			Counterparty: "1000000000000000",
+			Reference:    ptr("INV/2024/1001-MARCH"),
+		}},
+	}}
+}
+
+func TestEncode(t *testing.T) {
+	golden.Assert(t, "statements.mt940", mt940.Encode(statements()))
+}
+
+// TestEncode_Paginated checks that a statement too long for one message is
+// split into numbered messages joined by intermediate balances.
+func TestEncode_Paginated(t *testing.T) {
+	st := statements()[1]
+	st.Entries = nil
+	for i := range 40 {
+		st.Entries = append(st.Entries, model.StatementEntry{
+			TxID:         int64(100 + i),
+			BookedAt:     day.Add(time.Duration(i) * time.Minute),
+			Amount:       2.5,
+			Counterparty: "1000000000000000",
+			Reference:    ptr(fmt.Sprintf("REF-%d", i)),
+		})
+	}
+	st.Closing = st.Opening + 100
+	out := mt940.Encode([]model.Statement{st})
+	golden.Assert(t, "paginated.mt940", out)
+
+	for i, msg := range strings.Split(strings.TrimSuffix(string(out), "-\r\n"), "-\r\n") {
+		if len(msg) > 2000 {
+			t.Errorf("message %d is %d characters", i+1, len(msg))
+		}
+		if !strings.Contains(msg, fmt.Sprintf(":28C:00061/%03d", i+1)) {
+			t.Errorf("message %d is not numbered %d:\n%s", i+1, i+1, msg)
+		}
+	}
+}
+
+func TestNumber(t *testing.T) {
+	if n := mt940.Number(time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC)); n != 366 {
+		t.Errorf("Number = %d, want 366", n)
+	}
+}
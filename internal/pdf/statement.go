@@ -0,0 +1,197 @@
+// Package pdf renders printable account statements. It uses fpdf, which is
+// pure Go, with the standard Helvetica font so nothing needs installing,
+// and its output depends only on its input: rendering the same statement
+// at the same time gives the same bytes.
+package pdf
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/token-cjg/minibank/internal/model"
+)
+
+// ContentType is the media type of a rendered statement.
+const ContentType = "application/pdf"
+
+// Page layout, in millimetres on A4 portrait.
+const (
+	margin     = 15.0
+	lineHeight = 6.0
+	rowHeight  = 5.5
+)
+
+// columns of the transaction table, which spans the 180 mm between the
+// margins.
+var columns = []struct {
+	title string
+	width float64
+	align string
+}{
+	{"Date", 24, "L"},
+	{"Details", 84, "L"},
+	{"Debit", 24, "R"},
+	{"Credit", 24, "R"},
+	{"Balance", 24, "R"},
+}
+
+// Statement writes st as a PDF to w: a heading with the company, account,
+// period and balances, then the transactions with the balance after each,
+// over as many pages as they need. created is printed in the footer and
+// recorded as the document's creation date.
+func Statement(w io.Writer, st model.Statement, created time.Time) error {
+	doc := fpdf.New("P", "mm", "A4", "")
+	doc.SetCatalogSort(true)
+	doc.SetCreationDate(created.UTC())
+	doc.SetModificationDate(created.UTC())
+	doc.SetMargins(margin, margin, margin)
+	doc.SetAutoPageBreak(true, margin+lineHeight)
+	doc.AliasNbPages("")
+	doc.SetTitle("Statement "+st.Account.Number+" "+period(st), true)
+	doc.SetAuthor("minibank", true)
+	tr := doc.UnicodeTranslatorFromDescriptor("") // cp1252, the core fonts' encoding
+
+	doc.SetHeaderFunc(func() {
+		if doc.PageNo() > 1 {
+			tableHeader(doc)
+		}
+	})
+	doc.SetFooterFunc(func() {
+		doc.SetY(-margin - lineHeight/2)
+		doc.SetFont("Helvetica", "", 8)
+		doc.SetTextColor(110, 110, 110)
+		doc.CellFormat(90, lineHeight, "Generated "+created.UTC().Format("2 January 2006 15:04 MST"),
+			"", 0, "L", false, 0, "")
+		doc.CellFormat(90, lineHeight, fmt.Sprintf("Page %d of {nb}", doc.PageNo()),
+			"", 0, "R", false, 0, "")
+		doc.SetTextColor(0, 0, 0)
+	})
+
+	doc.AddPage()
+	doc.SetFont("Helvetica", "B", 16)
+	doc.CellFormat(0, 10, "Account statement", "", 1, "L", false, 0, "")
+	doc.Ln(2)
+
+	summary := [][2]string{
+		{"Company", tr(st.CompanyName)},
+		{"Account number", st.Account.Number},
+		{"Period", period(st)},
+		{"Currency", model.Currency},
+		{"Opening balance", money(st.Opening)},
+		{"Closing balance", money(st.Closing)},
+	}
+	for _, row := range summary {
+		doc.SetFont("Helvetica", "B", 10)
+		doc.CellFormat(40, lineHeight, row[0], "", 0, "L", false, 0, "")
+		doc.SetFont("Helvetica", "", 10)
+		doc.CellFormat(0, lineHeight, row[1], "", 1, "L", false, 0, "")
+	}
+	doc.Ln(4)
+
+	tableHeader(doc)
+	doc.SetFont("Helvetica", "I", 9)
+	row(doc, []string{st.From.UTC().Format(time.DateOnly), "Opening balance", "", "", money(st.Opening)})
+	doc.SetFont("Helvetica", "", 9)
+	for _, e := range st.Entries {
+		debit, credit := "", money(e.Amount)
+		if e.Amount < 0 {
+			debit, credit = money(-e.Amount), ""
+		}
+		row(doc, []string{e.BookedAt.UTC().Format(time.DateOnly), fit(doc, tr(details(e)), columns[1].width),
+			debit, credit, money(e.Balance)})
+	}
+	doc.SetFont("Helvetica", "I", 9)
+	row(doc, []string{closingDate(st), "Closing balance", "", "", money(st.Closing)})
+
+	if doc.Err() {
+		return doc.Error()
+	}
+	return doc.Output(w)
+}
+
+func tableHeader(doc *fpdf.Fpdf) {
+	doc.SetFont("Helvetica", "B", 9)
+	doc.SetFillColor(230, 230, 230)
+	for _, c := range columns {
+		doc.CellFormat(c.width, rowHeight+1, c.title, "B", 0, c.align, true, 0, "")
+	}
+	doc.Ln(-1)
+	doc.SetFont("Helvetica", "", 9)
+}
+
+func row(doc *fpdf.Fpdf, cells []string) {
+	for i, c := range columns {
+		doc.CellFormat(c.width, rowHeight, cells[i], "", 0, c.align, false, 0, "")
+	}
+	doc.Ln(-1)
+}
+
+// details describes a transfer: its counterparty, reference and memo.
+func details(e model.StatementEntry) string {
+	dir := "From "
+	if e.Amount < 0 {
+		dir = "To "
+	}
+	parts := []string{dir + e.Counterparty}
+	if e.Reference != nil {
+		parts = append(parts, *e.Reference)
+	}
+	if e.Memo != nil {
+		parts = append(parts, *e.Memo)
+	}
+	return strings.Join(parts, " / ")
+}
+
+// fit shortens s with an ellipsis until it fits a column of width w.
+func fit(doc *fpdf.Fpdf, s string, w float64) string {
+	const pad = 2 // cell padding either side
+	if doc.GetStringWidth(s) <= w-pad {
+		return s
+	}
+	ellipsis := "\x85" // … in cp1252
+	for len(s) > 0 && doc.GetStringWidth(s+ellipsis) > w-pad {
+		s = s[:len(s)-1]
+	}
+	return s + ellipsis
+}
+
+// period describes the statement's period: whole UTC days as their first
+// and last dates, anything else as times.
+func period(st model.Statement) string {
+	from, to := st.From.UTC(), st.To.UTC()
+	if from.Equal(from.Truncate(24*time.Hour)) && to.Equal(to.Truncate(24*time.Hour)) && to.After(from) {
+		return from.Format("2 January 2006") + " to " + to.AddDate(0, 0, -1).Format("2 January 2006")
+	}
+	return from.Format("2 January 2006 15:04") + " to " + to.Format("2 January 2006 15:04 MST")
+}
+
+// closingDate is the last day of the statement.
+func closingDate(st model.Statement) string {
+	to := st.To.UTC()
+	if to.Equal(to.Truncate(24*time.Hour)) && to.After(st.From) {
+		to = to.AddDate(0, 0, -1)
+	}
+	return to.Format(time.DateOnly)
+}
+
+// money writes amount with two decimals and thousands separators.
+func money(amount float64) string {
+	c := model.Cents(amount)
+	sign := ""
+	if c < 0 {
+		sign, c = "-", -c
+	}
+	whole := strconv.FormatInt(c/100, 10)
+	var b strings.Builder
+	for i, d := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(d)
+	}
+	return fmt.Sprintf("%s%s.%02d", sign, b.String(), c%100)
+}
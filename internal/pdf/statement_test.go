@@ -0,0 +1,78 @@
+package pdf_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/token-cjg/minibank/internal/model"
+	"github.com/token-cjg/minibank/internal/pdf"
+	"github.com/token-cjg/minibank/internal/testutil/golden"
+)
+
+func ptr(s string) *string { return &s }
+
+var created = time.Date(2024, 4, 1, 2, 0, 0, 0, time.UTC)
+
+// statement is March 2024 on account 1000000000000000 with n transfers,
+// alternately a debit with a reference and memo and a credit with neither.
+func statement(n int) model.Statement {
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	st := model.Statement{
+		Account:     model.Account{ID: 1, Company: 1, Number: "1000000000000000"},
+		CompanyName: "Café Étoile Pty Ltd",
+		From:        from,
+		To:          from.AddDate(0, 1, 0),
+		Opening:     12345.67,
+		Entries:     []model.StatementEntry{},
+	}
+	balance := model.Cents(st.Opening)
+	for i := range n {
+		e := model.StatementEntry{
+			TxID:         int64(i + 1),
+			BookedAt:     from.Add(time.Duration(i) * 7 * time.Hour),
+			Amount:       250.5,
+			Counterparty: "1000000000000002",
+		}
+		if i%2 == 0 {
+			e.Amount = -1000
+			e.Counterparty = "1000000000000001"
+			e.Reference = ptr(fmt.Sprintf("INV-%d", 1000+i))
+			e.Memo = ptr("Invoice for consulting services rendered during the month of March")
+		}
+		balance += model.Cents(e.Amount)
+		e.Balance = float64(balance) / 100
+		st.Entries = append(st.Entries, e)
+	}
+	st.Closing = float64(balance) / 100
+	return st
+}
+
+func render(t *testing.T, st model.Statement) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := pdf.Statement(&buf, st, created); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestStatement(t *testing.T) {
+	golden.Assert(t, "statement.pdf", render(t, statement(3)))
+}
+
+// TestStatement_Pages checks that a long statement runs over several pages.
+func TestStatement_Pages(t *testing.T) {
+	out := render(t, statement(90))
+	if n := bytes.Count(out, []byte("/Type /Page\n")); n < 2 {
+		t.Errorf("%d pages, want several", n)
+	}
+	golden.Assert(t, "pages.pdf", out)
+}
+
+func TestStatement_Deterministic(t *testing.T) {
+	if a, b := render(t, statement(3)), render(t, statement(3)); !bytes.Equal(a, b) {
+		t.Error("rendering the same statement twice gave different PDFs")
+	}
+}
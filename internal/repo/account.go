@@ -2,6 +2,8 @@ package repo
 
 import (
 	"context"
+	"strconv"
+	"strings"
 
 	"github.com/token-cjg/minibank/internal/model"
 )
@@ -12,7 +14,7 @@ func (r *Repo) CreateAccount(ctx context.Context, companyID int64, balance float
 		`INSERT INTO account (company_id, account_balance) VALUES ($1, $2)
                 RETURNING account_id, company_id, account_number, account_balance`,
 		companyID, balance).Scan(&a.ID, &a.Company, &a.Number, &a.Balance)
-	return a, err
+	return a, classify(err)
 }
 
 func (r *Repo) ListAccountsByCompany(ctx context.Context, companyID int64) ([]model.Account, error) {
@@ -34,10 +36,113 @@ func (r *Repo) ListAccountsByCompany(ctx context.Context, companyID int64) ([]mo
 	return accs, rows.Err()
 }
 
+// ListAccountsByCompanies returns a page of accounts for each of the given
+// companies in one query: up to limit of each company's accounts with an id
+// above after, in id order. Companies without such accounts are missing
+// from the map.
+func (r *Repo) ListAccountsByCompanies(ctx context.Context, companyIDs []int64, after int64, limit int) (map[int64][]model.Account, error) {
+	byCompany := make(map[int64][]model.Account, len(companyIDs))
+	if len(companyIDs) == 0 {
+		return byCompany, nil
+	}
+	ids, args := idValues(companyIDs, after, limit)
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT a.account_id, a.company_id, a.account_number, a.account_balance
+		   FROM (VALUES `+ids+`) AS c(id)
+		  CROSS JOIN LATERAL (
+		        SELECT account_id, company_id, account_number, account_balance
+		          FROM account
+		         WHERE company_id = c.id AND account_id > $1
+		         ORDER BY account_id
+		         LIMIT $2) a
+		  ORDER BY c.id, a.account_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a model.Account
+		if err := rows.Scan(&a.ID, &a.Company, &a.Number, &a.Balance); err != nil {
+			return nil, err
+		}
+		byCompany[a.Company] = append(byCompany[a.Company], a)
+	}
+	return byCompany, rows.Err()
+}
+
 func (r *Repo) GetAccountByID(ctx context.Context, accountID int64) (model.Account, error) {
 	var a model.Account
 	err := r.db.QueryRowContext(ctx,
 		`SELECT account_id, company_id, account_number, account_balance FROM account WHERE account_id=$1`,
 		accountID).Scan(&a.ID, &a.Company, &a.Number, &a.Balance)
-	return a, err
+	return a, classify(err)
+}
+
+// GetCompanyAccount returns the account only if it belongs to companyID, so
+// callers addressing accounts through a company path cannot reach accounts
+// owned by someone else. ErrNotFound is returned otherwise.
+func (r *Repo) GetCompanyAccount(ctx context.Context, companyID, accountID int64) (model.Account, error) {
+	var a model.Account
+	err := r.db.QueryRowContext(ctx,
+		`SELECT account_id, company_id, account_number, account_balance FROM account WHERE company_id=$1 AND account_id=$2`,
+		companyID, accountID).Scan(&a.ID, &a.Company, &a.Number, &a.Balance)
+	return a, classify(err)
+}
+
+// GetAccountByNumber looks an account up by its public account number, which
+// is how transfers address accounts.
+func (r *Repo) GetAccountByNumber(ctx context.Context, number int64) (model.Account, error) {
+	var a model.Account
+	err := r.db.QueryRowContext(ctx,
+		`SELECT account_id, company_id, account_number, account_balance FROM account WHERE account_number=$1`,
+		number).Scan(&a.ID, &a.Company, &a.Number, &a.Balance)
+	return a, classify(err)
+}
+
+// AccountsOutsideCompany returns those of the given account numbers that
+// exist but belong to a company other than companyID. Unknown numbers are
+// not reported; transfers decline them as usual.
+func (r *Repo) AccountsOutsideCompany(ctx context.Context, companyID int64, numbers []int64) ([]int64, error) {
+	if len(numbers) == 0 {
+		return nil, nil
+	}
+	args := make([]any, 0, len(numbers)+1)
+	args = append(args, companyID)
+	placeholders := make([]string, len(numbers))
+	for i, n := range numbers {
+		args = append(args, n)
+		placeholders[i] = "$" + strconv.Itoa(i+2)
+	}
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT account_number FROM account WHERE company_id <> $1 AND account_number IN (`+
+			strings.Join(placeholders, ",")+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var foreign []int64
+	for rows.Next() {
+		var n int64
+		if err := rows.Scan(&n); err != nil {
+			return nil, err
+		}
+		foreign = append(foreign, n)
+	}
+	return foreign, rows.Err()
+}
+
+// idValues renders ids as the rows of a VALUES list of BIGINT placeholders
+// numbered after those of the leading args, and returns it with all the
+// query's arguments.
+func idValues(ids []int64, leading ...any) (string, []any) {
+	args := make([]any, 0, len(leading)+len(ids))
+	args = append(args, leading...)
+	rows := make([]string, len(ids))
+	for i, id := range ids {
+		args = append(args, id)
+		rows[i] = "($" + strconv.Itoa(len(leading)+i+1) + "::BIGINT)"
+	}
+	return strings.Join(rows, ", "), args
 }
@@ -144,3 +144,29 @@ func TestGetAccountByID(t *testing.T) {
 		t.Errorf("unfulfilled expectations: %v", err)
 	}
 }
+
+func TestListAccountsByCompanies(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock DB: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`FROM \(VALUES \(\$3::BIGINT\), \(\$4::BIGINT\)\) AS c\(id\)\s+CROSS JOIN LATERAL`).
+		WithArgs(int64(0), 2, int64(1), int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"account_id", "company_id", "account_number", "account_balance"}).
+			AddRow(10, 1, "1000000000000000", 100.0).
+			AddRow(11, 1, "1000000000000001", 0.0).
+			AddRow(20, 2, "1000000000000002", 5.0))
+
+	byCompany, err := repo.New(db).ListAccountsByCompanies(context.Background(), []int64{1, 2}, 0, 2)
+	if err != nil {
+		t.Fatalf("ListAccountsByCompanies: %v", err)
+	}
+	if len(byCompany[1]) != 2 || byCompany[1][1].ID != 11 || len(byCompany[2]) != 1 || byCompany[2][0].Balance != 5 {
+		t.Errorf("accounts %+v", byCompany)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
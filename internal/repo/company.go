@@ -11,7 +11,7 @@ func (r *Repo) CreateCompany(ctx context.Context, name string) (model.Company, e
 	err := r.db.QueryRowContext(ctx,
 		`INSERT INTO company (company_name) VALUES ($1) RETURNING company_id, company_name`,
 		name).Scan(&c.ID, &c.Name)
-	return c, err
+	return c, classify(err)
 }
 
 func (r *Repo) ListCompanies(ctx context.Context) ([]model.Company, error) {
@@ -32,10 +32,32 @@ func (r *Repo) ListCompanies(ctx context.Context) ([]model.Company, error) {
 	return list, rows.Err()
 }
 
+// ListCompaniesAfter returns up to limit companies with an id above after,
+// in id order, so callers can page through them.
+func (r *Repo) ListCompaniesAfter(ctx context.Context, after int64, limit int) ([]model.Company, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT company_id, company_name FROM company WHERE company_id > $1 ORDER BY company_id LIMIT $2`,
+		after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []model.Company{}
+	for rows.Next() {
+		var c model.Company
+		if err := rows.Scan(&c.ID, &c.Name); err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
+
 func (r *Repo) GetCompanyByID(ctx context.Context, companyID int64) (model.Company, error) {
 	var c model.Company
 	err := r.db.QueryRowContext(ctx,
 		`SELECT company_id, company_name FROM company WHERE company_id=$1`,
 		companyID).Scan(&c.ID, &c.Name)
-	return c, err
+	return c, classify(err)
 }
@@ -0,0 +1,29 @@
+package repo
+
+// Partition exposes partition to the external tests.
+var Partition = partition
+
+// LedgerAccount and Settle expose the bulk engine's in-memory settlement.
+type LedgerAccount = ledgerAccount
+
+func NewLedgerAccount(id, balanceCents int64) *LedgerAccount {
+	return &ledgerAccount{id: id, balance: balanceCents}
+}
+
+func (a *LedgerAccount) Balance() int64 { return a.balance }
+
+// SettledOutcomes runs settle and returns each row's outcome and message.
+func SettledOutcomes(txns []TransferInput, accounts map[int64]*LedgerAccount) ([]Outcome, []string) {
+	rows := settle(txns, accounts)
+	outs, msgs := make([]Outcome, len(rows)), make([]string, len(rows))
+	for i, r := range rows {
+		outs[i] = r.outcome
+		if r.errMsg != nil {
+			msgs[i] = *r.errMsg
+		}
+	}
+	return outs, msgs
+}
+
+// TransferEvents exposes the statement tail the transfer engines share.
+const TransferEvents = transferEvents
@@ -0,0 +1,25 @@
+package repo
+
+import "context"
+
+// Ping checks that a database connection can be established.
+func (r *Repo) Ping(ctx context.Context) error { return r.db.PingContext(ctx) }
+
+// AppliedMigrations returns the migration versions recorded by cmd/migrate.
+func (r *Repo) AppliedMigrations(ctx context.Context) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT version FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
@@ -0,0 +1,92 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/token-cjg/minibank/internal/model"
+)
+
+const importProfileColumns = `profile_id, company_id, profile_name, delimiter, header,
+	source_column, target_column, amount_column,
+	reference_column, memo_column, value_date_column,
+	decimal_separator, thousands_separator, encoding`
+
+type scanner interface{ Scan(...any) error }
+
+func scanImportProfile(s scanner) (model.ImportProfile, error) {
+	var p model.ImportProfile
+	err := s.Scan(&p.ID, &p.Company, &p.Name, &p.Delimiter, &p.Header,
+		&p.SourceColumn, &p.TargetColumn, &p.AmountColumn,
+		&p.ReferenceColumn, &p.MemoColumn, &p.ValueDateColumn,
+		&p.DecimalSeparator, &p.ThousandsSeparator, &p.Encoding)
+	return p, err
+}
+
+// PutImportProfile creates the company's profile named p.Name, or replaces
+// it if it exists.
+func (r *Repo) PutImportProfile(ctx context.Context, p model.ImportProfile) (model.ImportProfile, error) {
+	out, err := scanImportProfile(r.db.QueryRowContext(ctx,
+		`INSERT INTO import_profile (company_id, profile_name, delimiter, header,
+		        source_column, target_column, amount_column,
+		        reference_column, memo_column, value_date_column,
+		        decimal_separator, thousands_separator, encoding)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		 ON CONFLICT (company_id, profile_name) DO UPDATE SET
+		        delimiter = EXCLUDED.delimiter,
+		        header = EXCLUDED.header,
+		        source_column = EXCLUDED.source_column,
+		        target_column = EXCLUDED.target_column,
+		        amount_column = EXCLUDED.amount_column,
+		        reference_column = EXCLUDED.reference_column,
+		        memo_column = EXCLUDED.memo_column,
+		        value_date_column = EXCLUDED.value_date_column,
+		        decimal_separator = EXCLUDED.decimal_separator,
+		        thousands_separator = EXCLUDED.thousands_separator,
+		        encoding = EXCLUDED.encoding
+		 RETURNING `+importProfileColumns,
+		p.Company, p.Name, p.Delimiter, p.Header,
+		p.SourceColumn, p.TargetColumn, p.AmountColumn,
+		p.ReferenceColumn, p.MemoColumn, p.ValueDateColumn,
+		p.DecimalSeparator, p.ThousandsSeparator, p.Encoding))
+	return out, classify(err)
+}
+
+func (r *Repo) ListImportProfiles(ctx context.Context, companyID int64) ([]model.ImportProfile, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+importProfileColumns+` FROM import_profile WHERE company_id=$1 ORDER BY profile_name`,
+		companyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []model.ImportProfile{}
+	for rows.Next() {
+		p, err := scanImportProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+func (r *Repo) GetImportProfile(ctx context.Context, companyID int64, name string) (model.ImportProfile, error) {
+	p, err := scanImportProfile(r.db.QueryRowContext(ctx,
+		`SELECT `+importProfileColumns+` FROM import_profile WHERE company_id=$1 AND profile_name=$2`,
+		companyID, name))
+	return p, classify(err)
+}
+
+func (r *Repo) DeleteImportProfile(ctx context.Context, companyID int64, name string) error {
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM import_profile WHERE company_id=$1 AND profile_name=$2`, companyID, name)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return classify(sql.ErrNoRows)
+	}
+	return nil
+}
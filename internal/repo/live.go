@@ -0,0 +1,123 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/token-cjg/minibank/internal/model"
+)
+
+// TxChannel is the Postgres notification channel transfers announce each
+// transaction row on, with a model.TransactionEvent as the payload.
+const TxChannel = "minibank_transactions"
+
+// txEventObject builds a model.TransactionEvent as JSON from a transaction
+// row tx and its source and target accounts s and d. Notifications and
+// TransactionEventsSince both use it, so a resumed stream reads the same as
+// a live one.
+const txEventObject = `jsonb_build_object(
+	               'tx_id', tx.tx_id,
+	               'type', CASE WHEN tx.error IS NULL THEN 'transfer.settled' ELSE 'transfer.declined' END,
+	               'source_company_id', s.company_id,
+	               'target_company_id', d.company_id,
+	               'source_account_id', s.account_id,
+	               'target_account_id', d.account_id,
+	               'source_account_number', s.account_number::TEXT,
+	               'target_account_number', d.account_number::TEXT,
+	               'transfer_amount', tx.transfer_amount,
+	               'error', tx.error,
+	               'reference', tx.reference,
+	               'memo', tx.memo,
+	               'value_date', tx.value_date,
+	               'created_at', tx.created_at)`
+
+// listenPing is how long Listen waits without a notification before it
+// checks the connection is still alive.
+const listenPing = 30 * time.Second
+
+// Listen takes a connection from the pool, listens on TxChannel and calls
+// notify with each transaction event as its transfer commits, until ctx is
+// done or the connection fails; it always returns an error saying which.
+// ready is called once the connection is listening: transactions that
+// commit before then are not seen.
+func (r *Repo) Listen(ctx context.Context, ready func(), notify func(model.TransactionEvent)) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(dc any) error {
+		pc, err := pgxConn(dc)
+		if err != nil {
+			return err
+		}
+		if _, err := pc.Exec(ctx, "LISTEN "+TxChannel); err != nil {
+			return err
+		}
+		// the connection goes back to the pool afterwards
+		defer pc.Exec(context.Background(), "UNLISTEN *")
+		ready()
+
+		for {
+			waitCtx, cancel := context.WithTimeout(ctx, listenPing)
+			n, err := pc.WaitForNotification(waitCtx)
+			cancel()
+			switch {
+			case errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil:
+				if err := pc.Ping(ctx); err != nil {
+					return err
+				}
+				continue
+			case err != nil:
+				return err
+			}
+
+			var ev model.TransactionEvent
+			if err := json.Unmarshal([]byte(n.Payload), &ev); err != nil {
+				slog.WarnContext(ctx, "malformed transaction notification", "payload", n.Payload, "err", err)
+				continue
+			}
+			notify(ev)
+		}
+	})
+}
+
+// TransactionEventsSince returns, oldest first, up to limit transaction
+// events after tx_id afterID for companyID: settled transfers into or out
+// of its accounts and declined debits of them. With accountID non-zero only
+// those touching that account are returned.
+func (r *Repo) TransactionEventsSince(ctx context.Context, companyID, accountID, afterID int64, limit int) ([]model.TransactionEvent, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+txEventObject+`
+		   FROM transaction tx
+		   JOIN account s ON s.account_id = tx.source_account_id
+		   JOIN account d ON d.account_id = tx.target_account_id
+		  WHERE tx.tx_id > $3
+		    AND ((s.company_id = $1 AND ($2::BIGINT = 0 OR s.account_id = $2))
+		      OR (tx.error IS NULL AND d.company_id = $1 AND ($2::BIGINT = 0 OR d.account_id = $2)))
+		  ORDER BY tx.tx_id
+		  LIMIT $4`,
+		companyID, accountID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []model.TransactionEvent
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var ev model.TransactionEvent
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			return nil, err
+		}
+		list = append(list, ev)
+	}
+	return list, rows.Err()
+}
@@ -6,11 +6,84 @@ package repo
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
-type Repo struct{ db *sql.DB }
+type Repo struct {
+	db          *sql.DB
+	retry       RetryPolicy
+	concurrency int
+	bulkMinRows int
+}
+
+// Option customises a Repo built by New.
+type Option func(*Repo)
+
+// WithRetry sets how transfers retry serialization failures and deadlocks.
+func WithRetry(p RetryPolicy) Option {
+	return func(r *Repo) { r.retry = p }
+}
+
+// WithConcurrency lets BatchTransfer run up to n independent rows at once.
+// The default, 1, runs batches strictly row by row.
+func WithConcurrency(n int) Option {
+	return func(r *Repo) { r.concurrency = n }
+}
+
+// WithBulkThreshold makes BatchTransfer settle batches of at least n rows
+// with the set-based bulk engine, in a single all-or-nothing transaction.
+// It needs the pgx driver. 0, the default, never uses it.
+func WithBulkThreshold(n int) Option {
+	return func(r *Repo) { r.bulkMinRows = n }
+}
 
-func New(db *sql.DB) *Repo { return &Repo{db} }
+func New(db *sql.DB, opts ...Option) *Repo {
+	r := &Repo{db: db, retry: DefaultRetryPolicy, concurrency: 1}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
 
 // ErrInsufficient is a sentinel error for insufficient balance
 var ErrInsufficient = errors.New("insufficient balance")
+
+// Sentinel errors callers can match with errors.Is to tell client mistakes
+// apart from database failures.
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrDuplicate = errors.New("already exists")
+	ErrInvalid   = errors.New("invalid value")
+)
+
+// Postgres SQLSTATE codes translated by classify.
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+	pgCheckViolation      = "23514"
+)
+
+// classify translates driver errors into the package sentinels, wrapping the
+// original so it is still available for logging. Other errors pass through.
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case pgUniqueViolation:
+			return fmt.Errorf("%w: %w", ErrDuplicate, err)
+		case pgForeignKeyViolation:
+			return fmt.Errorf("%w: %w", ErrNotFound, err)
+		case pgCheckViolation:
+			return fmt.Errorf("%w: %w", ErrInvalid, err)
+		}
+	}
+	return err
+}
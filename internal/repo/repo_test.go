@@ -1,9 +1,12 @@
 package repo_test
 
 import (
+	"context"
+	"errors"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/token-cjg/minibank/internal/repo"
 )
 
@@ -26,3 +29,34 @@ func TestNewRepo(t *testing.T) {
 		t.Errorf("expected ErrInsufficient message to be %q, got %q", expectedMsg, repo.ErrInsufficient.Error())
 	}
 }
+
+func TestErrorClassification(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"unique", &pgconn.PgError{Code: "23505"}, repo.ErrDuplicate},
+		{"foreign key", &pgconn.PgError{Code: "23503"}, repo.ErrNotFound},
+		{"check", &pgconn.PgError{Code: "23514"}, repo.ErrInvalid},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+			if err != nil {
+				t.Fatalf("failed to open sqlmock: %v", err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery(`INSERT INTO company`).WillReturnError(tc.err)
+			_, err = repo.New(db).CreateCompany(context.Background(), "Acme Corp")
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("got %v, want %v", err, tc.want)
+			}
+			var pgErr *pgconn.PgError
+			if !errors.As(err, &pgErr) {
+				t.Fatalf("original error lost: %v", err)
+			}
+		})
+	}
+}
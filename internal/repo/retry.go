@@ -0,0 +1,91 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/token-cjg/minibank/internal/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrConflict marks a transfer that kept losing serialization conflicts or
+// deadlocks after every retry. The client can safely resubmit it.
+var ErrConflict = errors.New("concurrent update conflict")
+
+// RetryPolicy bounds how Transfer retries transactions that Postgres
+// aborted with a serialization failure or deadlock.
+type RetryPolicy struct {
+	MaxAttempts int           // total attempts including the first; 1 disables retries
+	BaseDelay   time.Duration // backoff before the second attempt
+	MaxDelay    time.Duration // cap on any single backoff
+}
+
+// DefaultRetryPolicy is used by New unless WithRetry overrides it.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 5, BaseDelay: 10 * time.Millisecond, MaxDelay: 500 * time.Millisecond}
+
+// backoff returns the delay before attempt n+1 (n >= 1): exponential in n,
+// capped at MaxDelay, with "full jitter" so contending transactions spread
+// out instead of colliding again.
+func (p RetryPolicy) backoff(n int) time.Duration {
+	d := p.BaseDelay << (n - 1)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d) + 1
+}
+
+// retrying calls fn until it succeeds, fails for a reason other than a
+// serialization failure or deadlock, or runs out of attempts. fn must run
+// a whole transaction, so that a failed attempt leaves nothing behind. It
+// returns the number of attempts made.
+func (r *Repo) retrying(ctx context.Context, fn func() error) (int, error) {
+	maxAttempts := max(r.retry.MaxAttempts, 1)
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !isRetryable(err) {
+			return attempt, err
+		}
+		metrics.SerializationFailures.Inc()
+		if attempt == maxAttempts {
+			metrics.TransferRetriesExhausted.Inc()
+			return attempt, fmt.Errorf("%w: gave up after %d attempts: %w", ErrConflict, attempt, err)
+		}
+		delay := r.retry.backoff(attempt)
+		trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+			attribute.Int("transfer.attempt", attempt), attribute.String("error", err.Error())))
+		slog.DebugContext(ctx, "retrying transfer", "attempt", attempt, "delay", delay, "err", err)
+		metrics.TransferRetries.Inc()
+		if err := sleep(ctx, delay); err != nil {
+			return attempt, err
+		}
+	}
+}
+
+// isRetryable reports whether err is a serialization failure or deadlock,
+// after which the whole transaction can be run again.
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) &&
+		(pgErr.Code == pgSerializationFailure || pgErr.Code == pgDeadlockDetected)
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,138 @@
+package repo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/token-cjg/minibank/internal/metrics"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+var fastRetry = repo.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Microsecond, MaxDelay: time.Millisecond}
+
+func TestTransfer_RetriesSerializationFailure(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	defer db.Close()
+	r := repo.New(db, repo.WithRetry(fastRetry))
+
+	// first attempt loses the lock race and is rolled back
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT account_number, account_id, account_balance.*FOR UPDATE`).
+		WithArgs(int64(1000000000000000), int64(1000000000000001)).
+		WillReturnError(&pgconn.PgError{Code: "40001"})
+	mock.ExpectRollback()
+
+	// second attempt settles
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT account_number, account_id, account_balance.*FOR UPDATE`).
+		WithArgs(int64(1000000000000000), int64(1000000000000001)).
+		WillReturnRows(sqlmock.NewRows([]string{"account_number", "account_id", "account_balance"}).
+			AddRow(int64(1000000000000000), 1, 100.0).
+			AddRow(int64(1000000000000001), 2, 0.0))
+	mock.ExpectExec(`account_balance - \$1`).WithArgs(10.0, int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`account_balance \+ \$1`).WithArgs(10.0, int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO transaction`).WithArgs(int64(1), int64(2), 10.0, nil, nil, nil, nil).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	retries := testutil.ToFloat64(metrics.TransferRetries)
+	if err := r.Transfer(context.Background(), 1000000000000000, 1000000000000001, 10); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.TransferRetries) - retries; got != 1 {
+		t.Errorf("retries counter moved by %v, want 1", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// A decline whose commit hits a serialization failure is rolled back, so
+// only the retried attempt's decline row and metric are recorded.
+func TestTransfer_DeclineRecordedOnceAcrossRetries(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	defer db.Close()
+	r := repo.New(db, repo.WithRetry(fastRetry))
+
+	msg := "tx declined, source account not found: 1000000000000000"
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FOR UPDATE`).WillReturnRows(sqlmock.NewRows([]string{"account_number", "account_id", "account_balance"}))
+	mock.ExpectExec(`INSERT INTO transaction`).WithArgs(nil, nil, 10.0, &msg, nil, nil, nil).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit().WillReturnError(&pgconn.PgError{Code: "40001"})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FOR UPDATE`).WillReturnRows(sqlmock.NewRows([]string{"account_number", "account_id", "account_balance"}))
+	mock.ExpectExec(`INSERT INTO transaction`).WithArgs(nil, nil, 10.0, &msg, nil, nil, nil).WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+
+	declined := metrics.TransfersTotal.WithLabelValues(string(repo.DeclinedUnknownAccount))
+	before := testutil.ToFloat64(declined)
+	if err := r.Transfer(context.Background(), 1000000000000000, 1000000000000001, 10); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if got := testutil.ToFloat64(declined) - before; got != 1 {
+		t.Errorf("declined counter moved by %v, want 1", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestBatchTransfer_GivesUpAfterMaxAttempts(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	defer db.Close()
+	r := repo.New(db, repo.WithRetry(fastRetry))
+
+	for range fastRetry.MaxAttempts {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FOR UPDATE`).WillReturnError(&pgconn.PgError{Code: "40P01"})
+		mock.ExpectRollback()
+	}
+
+	exhausted := testutil.ToFloat64(metrics.TransferRetriesExhausted)
+	berr := r.BatchTransfer(context.Background(), []repo.TransferInput{
+		{Source: 1000000000000000, Target: 1000000000000001, Amount: 10},
+	})
+	if berr == nil || berr.Row != 0 || !errors.Is(berr.Err, repo.ErrConflict) {
+		t.Fatalf("BatchTransfer = %+v, want ErrConflict on row 0", berr)
+	}
+	if got := testutil.ToFloat64(metrics.TransferRetriesExhausted) - exhausted; got != 1 {
+		t.Errorf("exhausted counter moved by %v, want 1", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestTransfer_OtherErrorsAreNotRetried(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	defer db.Close()
+	r := repo.New(db, repo.WithRetry(fastRetry))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FOR UPDATE`).WillReturnError(&pgconn.PgError{Code: "23514"})
+	mock.ExpectRollback()
+
+	if err := r.Transfer(context.Background(), 1000000000000000, 1000000000000001, 10); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
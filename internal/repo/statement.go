@@ -0,0 +1,106 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/token-cjg/minibank/internal/model"
+)
+
+// Statement returns the settled transfers of companyID's account accountID
+// created in [from, to), with its balances at from and at to and after each
+// transfer. A balance at a past time is the current balance less the
+// settled transfers since, so both queries read one snapshot. ErrNotFound
+// is returned if the account does not exist or belongs to another company.
+func (r *Repo) Statement(ctx context.Context, companyID, accountID int64, from, to time.Time) (model.Statement, error) {
+	st := model.Statement{From: from, To: to, Entries: []model.StatementEntry{}}
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return st, err
+	}
+	defer tx.Rollback()
+
+	a := &st.Account
+	err = tx.QueryRowContext(ctx,
+		`SELECT a.account_id, a.company_id, a.account_number, a.account_balance, c.company_name,
+		        a.account_balance - COALESCE(SUM(e.amount) FILTER (WHERE e.created_at >= $3), 0),
+		        a.account_balance - COALESCE(SUM(e.amount) FILTER (WHERE e.created_at >= $4), 0)
+		   FROM account a
+		   JOIN company c ON c.company_id = a.company_id
+		   LEFT JOIN (
+		        SELECT target_account_id AS account_id, transfer_amount AS amount, created_at
+		          FROM transaction
+		         WHERE target_account_id = $2 AND error IS NULL AND created_at >= $3
+		        UNION ALL
+		        SELECT source_account_id, -transfer_amount, created_at
+		          FROM transaction
+		         WHERE source_account_id = $2 AND error IS NULL AND created_at >= $3
+		        ) e ON e.account_id = a.account_id
+		  WHERE a.company_id = $1 AND a.account_id = $2
+		  GROUP BY a.account_id, c.company_name`,
+		companyID, accountID, from, to).
+		Scan(&a.ID, &a.Company, &a.Number, &a.Balance, &st.CompanyName, &st.Opening, &st.Closing)
+	if err != nil {
+		return st, classify(err)
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT e.tx_id, e.created_at, e.amount, c.account_number,
+		        e.reference, e.memo, e.value_date::text
+		   FROM (
+		        SELECT tx_id, created_at, transfer_amount AS amount,
+		               source_account_id AS counterparty, reference, memo, value_date
+		          FROM transaction
+		         WHERE target_account_id = $1 AND error IS NULL
+		           AND created_at >= $2 AND created_at < $3
+		        UNION ALL
+		        SELECT tx_id, created_at, -transfer_amount,
+		               target_account_id, reference, memo, value_date
+		          FROM transaction
+		         WHERE source_account_id = $1 AND error IS NULL
+		           AND created_at >= $2 AND created_at < $3
+		        ) e
+		   JOIN account c ON c.account_id = e.counterparty
+		  ORDER BY e.created_at, e.tx_id, e.amount`,
+		accountID, from, to)
+	if err != nil {
+		return st, err
+	}
+	defer rows.Close()
+	balance := model.Cents(st.Opening)
+	for rows.Next() {
+		var e model.StatementEntry
+		if err := rows.Scan(&e.TxID, &e.BookedAt, &e.Amount, &e.Counterparty,
+			&e.Reference, &e.Memo, &e.ValueDate); err != nil {
+			return st, err
+		}
+		balance += model.Cents(e.Amount)
+		e.Balance = float64(balance) / 100
+		st.Entries = append(st.Entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return st, err
+	}
+	return st, tx.Commit()
+}
+
+// BalanceAt returns the balance of companyID's account accountID at time at:
+// its current balance less the transfers settled since, which the partial
+// indexes of migration 003 sum without visiting the table. ErrNotFound is
+// returned if the account does not exist or belongs to another company.
+func (r *Repo) BalanceAt(ctx context.Context, companyID, accountID int64, at time.Time) (model.AccountBalance, error) {
+	b := model.AccountBalance{Account: accountID, At: at}
+	err := r.db.QueryRowContext(ctx,
+		`SELECT a.account_balance
+		        - COALESCE((SELECT SUM(transfer_amount) FROM transaction
+		                     WHERE target_account_id = a.account_id AND error IS NULL
+		                       AND created_at >= $3), 0)
+		        + COALESCE((SELECT SUM(transfer_amount) FROM transaction
+		                     WHERE source_account_id = a.account_id AND error IS NULL
+		                       AND created_at >= $3), 0)
+		   FROM account a
+		  WHERE a.company_id = $1 AND a.account_id = $2`,
+		companyID, accountID, at).Scan(&b.Balance)
+	return b, classify(err)
+}
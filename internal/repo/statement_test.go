@@ -0,0 +1,109 @@
+package repo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+func TestStatement(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock DB: %v", err)
+	}
+	defer db.Close()
+
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+	booked := from.Add(9 * time.Hour)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT a.account_id, .* FROM account a\s+JOIN company c .* error IS NULL .* WHERE a.company_id = \$1 AND a.account_id = \$2`).
+		WithArgs(int64(1), int64(10), from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"account_id", "company_id", "account_number",
+			"account_balance", "company_name", "opening", "closing"}).
+			AddRow(10, 1, "1000000000000000", 900.0, "Acme", 1000.0, 925.0))
+	mock.ExpectQuery(`SELECT e.tx_id, .* error IS NULL .* UNION ALL .* ORDER BY e.created_at, e.tx_id`).
+		WithArgs(int64(10), from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"tx_id", "created_at", "amount", "account_number",
+			"reference", "memo", "value_date"}).
+			AddRow(7, booked, -100.0, "1000000000000001", "INV-1", "rent", "2024-03-01").
+			AddRow(8, booked.Add(time.Hour), 25.0, "1000000000000002", nil, nil, nil))
+	mock.ExpectCommit()
+
+	st, err := repo.New(db).Statement(context.Background(), 1, 10, from, to)
+	if err != nil {
+		t.Fatalf("Statement: %v", err)
+	}
+	if st.Account.Number != "1000000000000000" || st.CompanyName != "Acme" ||
+		st.Opening != 1000 || st.Closing != 925 {
+		t.Errorf("statement %+v", st)
+	}
+	if len(st.Entries) != 2 {
+		t.Fatalf("%d entries", len(st.Entries))
+	}
+	debit, credit := st.Entries[0], st.Entries[1]
+	if debit.TxID != 7 || debit.Amount != -100 || debit.Counterparty != "1000000000000001" ||
+		*debit.Reference != "INV-1" || *debit.ValueDate != "2024-03-01" || !debit.BookedAt.Equal(booked) {
+		t.Errorf("debit %+v", debit)
+	}
+	if debit.Balance != 900 {
+		t.Errorf("balance after debit %v, want 900", debit.Balance)
+	}
+	if credit.Amount != 25 || credit.Balance != 925 || credit.Reference != nil || credit.ValueDate != nil {
+		t.Errorf("credit %+v", credit)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestStatement_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock DB: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT a.account_id`).
+		WillReturnRows(sqlmock.NewRows([]string{"account_id"}))
+	mock.ExpectRollback()
+
+	now := time.Now()
+	_, err = repo.New(db).Statement(context.Background(), 2, 10, now, now)
+	if !errors.Is(err, repo.ErrNotFound) {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestBalanceAt(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock DB: %v", err)
+	}
+	defer db.Close()
+
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT a.account_balance\s+- COALESCE\(\(SELECT SUM\(transfer_amount\) FROM transaction\s+WHERE target_account_id = a.account_id AND error IS NULL`).
+		WithArgs(int64(1), int64(10), at).
+		WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(412.5))
+
+	b, err := repo.New(db).BalanceAt(context.Background(), 1, 10, at)
+	if err != nil {
+		t.Fatalf("BalanceAt: %v", err)
+	}
+	if b.Account != 10 || !b.At.Equal(at) || b.Balance != 412.5 {
+		t.Errorf("balance %+v", b)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package repo
+
+import (
+	"context"
+	"math"
+
+	"github.com/token-cjg/minibank/internal/model"
+)
+
+// ListTransactions returns up to limit of an account's transactions with a
+// tx_id below before, newest first: its debits, settled or declined, and
+// its settled credits, so a transfer declined by its sender stays private
+// to the sender as it does on the live streams. A before of 0 starts from
+// the newest. Callers check the account belongs to whoever asks.
+func (r *Repo) ListTransactions(ctx context.Context, accountID, before int64, limit int) ([]model.Transaction, error) {
+	if before <= 0 {
+		before = math.MaxInt64
+	}
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT tx_id, source_account_id, target_account_id, transfer_amount, error,
+		        created_at, reference, memo, value_date::text
+		   FROM transaction
+		  WHERE tx_id < $2
+		    AND (source_account_id = $1 OR (target_account_id = $1 AND error IS NULL))
+		  ORDER BY tx_id DESC
+		  LIMIT $3`,
+		accountID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	txs := []model.Transaction{}
+	for rows.Next() {
+		var t model.Transaction
+		if err := rows.Scan(&t.ID, &t.Source, &t.Target, &t.Amount, &t.Error,
+			&t.CreatedAt, &t.Reference, &t.Memo, &t.ValueDate); err != nil {
+			return nil, err
+		}
+		txs = append(txs, t)
+	}
+	return txs, rows.Err()
+}
+
+// ListTransactionsByAccounts is ListTransactions for many accounts in one
+// query: up to limit of each account's transactions with a tx_id below
+// before, newest first. A transfer between two of the accounts is listed
+// under both. Accounts without such transactions are missing from the map.
+func (r *Repo) ListTransactionsByAccounts(ctx context.Context, accountIDs []int64, before int64, limit int) (map[int64][]model.Transaction, error) {
+	byAccount := make(map[int64][]model.Transaction, len(accountIDs))
+	if len(accountIDs) == 0 {
+		return byAccount, nil
+	}
+	if before <= 0 {
+		before = math.MaxInt64
+	}
+	ids, args := idValues(accountIDs, before, limit)
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT a.id, t.tx_id, t.source_account_id, t.target_account_id, t.transfer_amount, t.error,
+		        t.created_at, t.reference, t.memo, t.value_date::text
+		   FROM (VALUES `+ids+`) AS a(id)
+		  CROSS JOIN LATERAL (
+		        SELECT * FROM transaction
+		         WHERE tx_id < $1
+		           AND (source_account_id = a.id OR (target_account_id = a.id AND error IS NULL))
+		         ORDER BY tx_id DESC
+		         LIMIT $2) t
+		  ORDER BY a.id, t.tx_id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var account int64
+		var t model.Transaction
+		if err := rows.Scan(&account, &t.ID, &t.Source, &t.Target, &t.Amount, &t.Error,
+			&t.CreatedAt, &t.Reference, &t.Memo, &t.ValueDate); err != nil {
+			return nil, err
+		}
+		byAccount[account] = append(byAccount[account], t)
+	}
+	return byAccount, rows.Err()
+}
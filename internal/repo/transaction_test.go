@@ -0,0 +1,87 @@
+package repo_test
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+var transactionCols = []string{"tx_id", "source_account_id", "target_account_id", "transfer_amount", "error",
+	"created_at", "reference", "memo", "value_date"}
+
+func TestListTransactions(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock DB: %v", err)
+	}
+	defer db.Close()
+
+	created := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	declined := "tx declined, insufficient balance"
+	mock.ExpectQuery(`FROM transaction\s+WHERE tx_id < \$2\s+AND \(source_account_id = \$1 OR \(target_account_id = \$1 AND error IS NULL\)\)\s+ORDER BY tx_id DESC`).
+		WithArgs(int64(10), int64(math.MaxInt64), 2).
+		WillReturnRows(sqlmock.NewRows(transactionCols).
+			AddRow(9, 10, 11, 500.0, declined, created.Add(time.Minute), nil, nil, nil).
+			AddRow(8, 12, 10, 25.5, nil, created, "INV-1", "rent", "2024-03-01"))
+
+	txs, err := repo.New(db).ListTransactions(context.Background(), 10, 0, 2)
+	if err != nil {
+		t.Fatalf("ListTransactions: %v", err)
+	}
+	if len(txs) != 2 || txs[0].ID != 9 || *txs[0].Error != declined || txs[0].Reference != nil {
+		t.Fatalf("transactions %+v", txs)
+	}
+	if credit := txs[1]; credit.Amount != 25.5 || !credit.CreatedAt.Equal(created) || *credit.ValueDate != "2024-03-01" {
+		t.Errorf("credit %+v", credit)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestListTransactionsByAccounts(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock DB: %v", err)
+	}
+	defer db.Close()
+
+	created := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`FROM \(VALUES \(\$3::BIGINT\), \(\$4::BIGINT\)\) AS a\(id\)\s+CROSS JOIN LATERAL \(\s+SELECT \* FROM transaction\s+WHERE tx_id < \$1`).
+		WithArgs(int64(42), 5, int64(10), int64(11)).
+		WillReturnRows(sqlmock.NewRows(append([]string{"id"}, transactionCols...)).
+			AddRow(10, 9, 10, 11, 500.0, nil, created, nil, nil, nil).
+			AddRow(11, 9, 10, 11, 500.0, nil, created, nil, nil, nil).
+			AddRow(11, 8, 12, 11, 25.5, nil, created, "INV-1", nil, nil))
+
+	byAccount, err := repo.New(db).ListTransactionsByAccounts(context.Background(), []int64{10, 11}, 42, 5)
+	if err != nil {
+		t.Fatalf("ListTransactionsByAccounts: %v", err)
+	}
+	if len(byAccount[10]) != 1 || len(byAccount[11]) != 2 || byAccount[11][1].ID != 8 || *byAccount[11][1].Reference != "INV-1" {
+		t.Errorf("transactions %+v", byAccount)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestListTransactionsByAccounts_None(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock DB: %v", err)
+	}
+	defer db.Close()
+
+	byAccount, err := repo.New(db).ListTransactionsByAccounts(context.Background(), nil, 0, 5)
+	if err != nil || len(byAccount) != 0 {
+		t.Fatalf("ListTransactionsByAccounts = %v, %v; want an empty map", byAccount, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
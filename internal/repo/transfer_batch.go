@@ -5,35 +5,189 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/token-cjg/minibank/internal/metrics"
+	"github.com/token-cjg/minibank/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type TransferInput struct {
 	Source int64
 	Target int64
 	Amount float64
+
+	// Optional details recorded with the transaction; empty or zero when
+	// the client gave none.
+	Reference string
+	Memo      string
+	ValueDate time.Time
 }
 
 type BatchError struct {
-	Row int   // index in csv of the transaction that failed
+	Row int   // index in csv of the transaction that failed, -1 if no row is to blame
 	Err error // underlying error (e.g. ErrInsufficient, pq error, etc.)
 }
 
+// Outcome says what happened to a single transfer.
+type Outcome string
+
+const (
+	Settled                Outcome = "settled"
+	DeclinedInsufficient   Outcome = "declined_insufficient"
+	DeclinedUnknownAccount Outcome = "declined_unknown_account"
+	Failed                 Outcome = "failed"
+)
+
+// Postgres SQLSTATE codes for transactions that lost a conflict.
+const (
+	pgSerializationFailure = "40001"
+	pgDeadlockDetected     = "40P01"
+)
+
 func (r *Repo) BatchTransfer(ctx context.Context, txns []TransferInput) *BatchError {
+	_, err := r.BatchTransferOutcomes(ctx, txns)
+	return err
+}
+
+// BatchTransferOutcomes is BatchTransfer also reporting each row's outcome,
+// in row order. The outcomes are only complete when the batch succeeded.
+func (r *Repo) BatchTransferOutcomes(ctx context.Context, txns []TransferInput) ([]Outcome, *BatchError) {
+	start := time.Now()
+	defer func() { metrics.BatchDuration.Observe(time.Since(start).Seconds()) }()
+	metrics.BatchSize.Observe(float64(len(txns)))
+
+	ctx, span := tracing.Tracer().Start(ctx, "repo.BatchTransfer",
+		trace.WithAttributes(attribute.Int("batch.rows", len(txns))))
+	defer span.End()
+
+	var failed *BatchError
+	outcomes := make([]Outcome, len(txns))
+	switch {
+	case r.bulkMinRows > 0 && len(txns) >= r.bulkMinRows:
+		span.SetAttributes(attribute.String("batch.mode", "bulk"))
+		failed = r.bulkTransfer(ctx, txns, outcomes)
+	case r.concurrency > 1 && len(txns) > 1:
+		span.SetAttributes(attribute.String("batch.mode", "parallel"))
+		failed = r.batchParallel(ctx, txns, outcomes)
+	default:
+		span.SetAttributes(attribute.String("batch.mode", "serial"))
+		failed = r.batchSerial(ctx, txns, outcomes)
+	}
+	if failed != nil {
+		span.SetAttributes(attribute.Int("batch.failed_row", failed.Row+1))
+		span.SetStatus(codes.Error, failed.Err.Error())
+		slog.ErrorContext(ctx, "transfer batch aborted",
+			"row", failed.Row+1, "rows", len(txns), "err", failed.Err)
+		return outcomes, failed
+	}
+
+	counts := make(map[Outcome]int)
+	seen := make(map[int64]bool)
+	var sources []int64
+	for i, out := range outcomes {
+		counts[out]++
+		if src := txns[i].Source; !seen[src] {
+			seen[src] = true
+			sources = append(sources, src)
+		}
+	}
+	r.batchCompleted(ctx, len(txns), sources, counts)
+	return outcomes, nil
+}
+
+func (r *Repo) batchSerial(ctx context.Context, txns []TransferInput, outcomes []Outcome) *BatchError {
 	for i, t := range txns {
-		if err := r.Transfer(ctx, t.Source, t.Target, t.Amount); err != nil {
-			// only treat *unexpected* DB errors as fatal
-			if !errors.Is(err, ErrInsufficient) {
-				return &BatchError{Row: i, Err: err}
-			}
+		if err := r.batchRow(ctx, i, t, outcomes); err != nil {
+			return &BatchError{Row: i, Err: err}
 		}
 	}
 	return nil
 }
 
+// batchRow runs row i of a batch, storing its outcome in outcomes[i], and
+// returns the error only if it should abort the batch; declines are
+// recorded and are not errors.
+func (r *Repo) batchRow(ctx context.Context, i int, t TransferInput, outcomes []Outcome) error {
+	var err error
+	outcomes[i], err = r.transfer(ctx, i+1, t)
+	// only treat *unexpected* DB errors as fatal
+	if err != nil && !errors.Is(err, ErrInsufficient) {
+		return err
+	}
+	return nil
+}
+
 func (r *Repo) Transfer(ctx context.Context, srcNum, dstNum int64, amount float64) error {
-	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	_, err := r.transfer(ctx, 0, TransferInput{Source: srcNum, Target: dstNum, Amount: amount})
+	return err
+}
+
+// transfer runs Transfer inside its own span, logs declines and records the
+// outcome in metrics. row is the 1-based batch row, or 0 outside a batch.
+func (r *Repo) transfer(ctx context.Context, row int, t TransferInput) (Outcome, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "repo.Transfer")
+	defer span.End()
+	span.SetAttributes(
+		attribute.Int64("transfer.source_account", t.Source),
+		attribute.Int64("transfer.target_account", t.Target),
+		attribute.Float64("transfer.amount", t.Amount),
+	)
+	if row > 0 {
+		span.SetAttributes(attribute.Int("batch.row", row))
+	}
+	if t.Reference != "" {
+		span.SetAttributes(attribute.String("transfer.reference", t.Reference))
+	}
+
+	out, attempts, err := r.transferWithRetry(ctx, t)
+	span.SetAttributes(attribute.Int("transfer.attempts", attempts))
 	if err != nil {
+		out = Failed
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.SetAttributes(attribute.String("transfer.outcome", string(out)))
+	metrics.TransfersTotal.WithLabelValues(string(out)).Inc()
+	if out == DeclinedInsufficient || out == DeclinedUnknownAccount {
+		logDecline(ctx, out, row, t)
+	}
+	return out, err
+}
+
+func logDecline(ctx context.Context, out Outcome, row int, t TransferInput) {
+	attrs := []any{"outcome", out, "row", row, "source", t.Source, "target", t.Target, "amount", t.Amount}
+	if t.Reference != "" {
+		attrs = append(attrs, "reference", t.Reference)
+	}
+	slog.InfoContext(ctx, "transfer declined", attrs...)
+}
+
+// transferWithRetry runs transferTx under the retry policy. Every attempt
+// is its own transaction and an aborted one is rolled back in full,
+// including any decline row it inserted, so a decline is recorded exactly
+// once: by the attempt that commits. It returns the number of attempts made.
+func (r *Repo) transferWithRetry(ctx context.Context, t TransferInput) (Outcome, int, error) {
+	var out Outcome
+	attempts, err := r.retrying(ctx, func() error {
+		var err error
+		out, err = r.transferTx(ctx, t)
 		return err
+	})
+	if err != nil {
+		return Failed, attempts, err
+	}
+	return out, attempts, nil
+}
+
+func (r *Repo) transferTx(ctx context.Context, t TransferInput) (Outcome, error) {
+	srcNum, dstNum, amount := t.Source, t.Target, t.Amount
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return Failed, err
 	}
 	defer tx.Rollback()
 
@@ -42,45 +196,57 @@ func (r *Repo) Transfer(ctx context.Context, srcNum, dstNum int64, amount float6
 		srcBal       float64
 	)
 
-	// lock + fetch source id & balance
-	if err := tx.QueryRowContext(ctx,
-		`SELECT account_id, account_balance
-		FROM account
-		WHERE account_number = $1
-		FOR UPDATE`,
-		srcNum).Scan(&srcID, &srcBal); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			msg := fmt.Sprintf("tx declined, source account not found: %d", srcNum)
-			if err := r.insertTx(ctx, tx, nil, nil, amount, &msg); err != nil {
-				return err
-			}
-			return tx.Commit()
+	// lock both accounts in account_number order, so concurrent transfers
+	// between the same pair cannot deadlock whichever way they run
+	rows, err := tx.QueryContext(ctx,
+		`SELECT account_number, account_id, account_balance
+		   FROM account
+		  WHERE account_number IN ($1, $2)
+		  ORDER BY account_number
+		  FOR UPDATE`,
+		srcNum, dstNum)
+	if err != nil {
+		return Failed, err
+	}
+	var srcFound, dstFound bool
+	for rows.Next() {
+		var (
+			num, id int64
+			bal     float64
+		)
+		if err := rows.Scan(&num, &id, &bal); err != nil {
+			rows.Close()
+			return Failed, err
 		}
-		return err
+		if num == srcNum {
+			srcID, srcBal, srcFound = id, bal, true
+		}
+		if num == dstNum {
+			dstID, dstFound = id, true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Failed, err
 	}
 
-	// fetch target id
-	if err := tx.QueryRowContext(ctx,
-		`SELECT account_id
-		   FROM account
-		  WHERE account_number = $1`,
-		dstNum).Scan(&dstID); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			msg := fmt.Sprintf("tx declined, target account not found: %d", dstNum)
-			if err := r.insertTx(ctx, tx, nil, nil, amount, &msg); err != nil {
-				return err
-			}
-			return tx.Commit()
+	if !srcFound || !dstFound {
+		missing, side := srcNum, "source"
+		if srcFound {
+			missing, side = dstNum, "target"
 		}
-		return err
+		msg := fmt.Sprintf("tx declined, %s account not found: %d", side, missing)
+		if err := r.insertTx(ctx, tx, nil, nil, t, &msg); err != nil {
+			return Failed, err
+		}
+		return DeclinedUnknownAccount, tx.Commit()
 	}
 
 	if srcBal < amount {
 		msg := "tx declined, insufficient balance"
-		if err := r.insertTx(ctx, tx, &srcID, &dstID, amount, &msg); err != nil {
-			return err
+		if err := r.insertTx(ctx, tx, &srcID, &dstID, t, &msg); err != nil {
+			return Failed, err
 		}
-		return tx.Commit()
+		return DeclinedInsufficient, tx.Commit()
 	}
 
 	// debit / credit using account_id
@@ -89,32 +255,57 @@ func (r *Repo) Transfer(ctx context.Context, srcNum, dstNum int64, amount float6
 		    SET account_balance = account_balance - $1
 		  WHERE account_id = $2`,
 		amount, srcID); err != nil {
-		return err
+		return Failed, err
 	}
 	if _, err := tx.ExecContext(ctx,
 		`UPDATE account
 		    SET account_balance = account_balance + $1
 		  WHERE account_id = $2`,
 		amount, dstID); err != nil {
-		return err
+		return Failed, err
 	}
 
-	if err := r.insertTx(ctx, tx, &srcID, &dstID, amount, nil); err != nil {
-		return err
+	if err := r.insertTx(ctx, tx, &srcID, &dstID, t, nil); err != nil {
+		return Failed, err
 	}
-	return tx.Commit()
+	return Settled, tx.Commit()
 }
 
+// insertTx records a transfer, or its decline, and in the same statement
+// the webhook events it raises, so the events commit or roll back with it.
 func (r *Repo) insertTx(ctx context.Context, q execer,
-	srcID, dstID *int64, amount float64, errMsg *string) error {
+	srcID, dstID *int64, t TransferInput, errMsg *string) error {
 	_, err := q.ExecContext(ctx,
-		`INSERT INTO transaction
-             (source_account_id, target_account_id, transfer_amount, error)
-         VALUES ($1,$2,$3,$4)`,
-		srcID, dstID, amount, errMsg)
+		`WITH inserted AS (
+         INSERT INTO transaction
+             (source_account_id, target_account_id, transfer_amount, error,
+              reference, memo, value_date)
+         VALUES ($1,$2,$3,$4,$5,$6,$7)
+         RETURNING *),
+     tx AS (
+         SELECT i.*, a.account_balance AS source_balance
+           FROM inserted i
+           LEFT JOIN account a ON a.account_id = i.source_account_id)`+transferEvents,
+		srcID, dstID, t.Amount, errMsg, nullString(t.Reference), nullString(t.Memo), nullDate(t.ValueDate))
 	return err
 }
 
+// nullString stores an empty string as NULL.
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// nullDate stores the zero time as NULL.
+func nullDate(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
 type execer interface {
 	ExecContext(context.Context, string, ...any) (sql.Result, error)
 }
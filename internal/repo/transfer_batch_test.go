@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"regexp"
+	"slices"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/token-cjg/minibank/internal/metrics"
 	"github.com/token-cjg/minibank/internal/repo"
 )
 
@@ -31,23 +34,17 @@ func TestTransfer_Success(t *testing.T) {
 	// Begin transaction
 	mock.ExpectBegin()
 
-	// Query for source account (with lock)
+	// Lock both accounts in account_number order
 	mock.ExpectQuery(regexp.QuoteMeta(
-		`SELECT account_id, account_balance
+		`SELECT account_number, account_id, account_balance
            FROM account
-          WHERE account_number = $1
+          WHERE account_number IN ($1, $2)
+          ORDER BY account_number
           FOR UPDATE`)).
-		WithArgs(srcNum).
-		WillReturnRows(sqlmock.NewRows([]string{"account_id", "account_balance"}).
-			AddRow(srcID, srcBal))
-	// Query for target account
-	mock.ExpectQuery(regexp.QuoteMeta(
-		`SELECT account_id
-           FROM account
-          WHERE account_number = $1`)).
-		WithArgs(dstNum).
-		WillReturnRows(sqlmock.NewRows([]string{"account_id"}).
-			AddRow(dstID))
+		WithArgs(srcNum, dstNum).
+		WillReturnRows(sqlmock.NewRows([]string{"account_number", "account_id", "account_balance"}).
+			AddRow(srcNum, srcID, srcBal).
+			AddRow(dstNum, dstID, 0.0))
 	// Debit source: update account_balance subtracting amount
 	mock.ExpectExec(regexp.QuoteMeta(
 		`UPDATE account
@@ -65,9 +62,10 @@ func TestTransfer_Success(t *testing.T) {
 	// Insert transaction record without error message (nil)
 	mock.ExpectExec(regexp.QuoteMeta(
 		`INSERT INTO transaction
-             (source_account_id, target_account_id, transfer_amount, error)
-         VALUES ($1,$2,$3,$4)`)).
-		WithArgs(srcID, dstID, amount, nil).
+             (source_account_id, target_account_id, transfer_amount, error,
+              reference, memo, value_date)
+         VALUES ($1,$2,$3,$4,$5,$6,$7)`)).
+		WithArgs(srcID, dstID, amount, nil, nil, nil, nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	// Commit transaction
 	mock.ExpectCommit()
@@ -100,39 +98,40 @@ func TestTransfer_Insufficient(t *testing.T) {
 	srcBal := 100.0
 
 	mock.ExpectBegin()
-	// Query for source account
+	// Lock both accounts in account_number order
 	mock.ExpectQuery(regexp.QuoteMeta(
-		`SELECT account_id, account_balance
+		`SELECT account_number, account_id, account_balance
            FROM account
-          WHERE account_number = $1
+          WHERE account_number IN ($1, $2)
+          ORDER BY account_number
           FOR UPDATE`)).
-		WithArgs(srcNum).
-		WillReturnRows(sqlmock.NewRows([]string{"account_id", "account_balance"}).
-			AddRow(srcID, srcBal))
-	// Query for target account
-	mock.ExpectQuery(regexp.QuoteMeta(
-		`SELECT account_id
-           FROM account
-          WHERE account_number = $1`)).
-		WithArgs(dstNum).
-		WillReturnRows(sqlmock.NewRows([]string{"account_id"}).
-			AddRow(dstID))
+		WithArgs(srcNum, dstNum).
+		WillReturnRows(sqlmock.NewRows([]string{"account_number", "account_id", "account_balance"}).
+			AddRow(srcNum, srcID, srcBal).
+			AddRow(dstNum, dstID, 0.0))
 	// In insufficient scenario, an insert occurs with an error message.
 	// Note: Since sqlmock compares pointer equality for non-basic types,
 	// construct the expected argument as a pointer.
 	msg := "tx declined, insufficient balance"
 	mock.ExpectExec(regexp.QuoteMeta(
 		`INSERT INTO transaction
-             (source_account_id, target_account_id, transfer_amount, error)
-         VALUES ($1,$2,$3,$4)`)).
-		WithArgs(srcID, dstID, amount, &msg).
+             (source_account_id, target_account_id, transfer_amount, error,
+              reference, memo, value_date)
+         VALUES ($1,$2,$3,$4,$5,$6,$7)`)).
+		WithArgs(srcID, dstID, amount, &msg, nil, nil, nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	// Commit transaction (even though balance insufficient, Transfer commits)
 	mock.ExpectCommit()
 
+	declined := metrics.TransfersTotal.WithLabelValues(string(repo.DeclinedInsufficient))
+	before := testutil.ToFloat64(declined)
+
 	if err := r.Transfer(ctx, srcNum, dstNum, amount); err != nil {
 		t.Fatalf("unexpected error during Transfer (insufficient case): %v", err)
 	}
+	if got := testutil.ToFloat64(declined) - before; got != 1 {
+		t.Errorf("declined_insufficient counter moved by %v, want 1", got)
+	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("unfulfilled expectations in Transfer_Insufficient: %v", err)
@@ -160,21 +159,17 @@ func TestBatchTransfer_Fatal(t *testing.T) {
 	srcBal1 := 100.0
 
 	mock.ExpectBegin()
+	// Lock both accounts in account_number order
 	mock.ExpectQuery(regexp.QuoteMeta(
-		`SELECT account_id, account_balance
+		`SELECT account_number, account_id, account_balance
            FROM account
-          WHERE account_number = $1
+          WHERE account_number IN ($1, $2)
+          ORDER BY account_number
           FOR UPDATE`)).
-		WithArgs(srcNum1).
-		WillReturnRows(sqlmock.NewRows([]string{"account_id", "account_balance"}).
-			AddRow(srcID1, srcBal1))
-	mock.ExpectQuery(regexp.QuoteMeta(
-		`SELECT account_id
-           FROM account
-          WHERE account_number = $1`)).
-		WithArgs(dstNum1).
-		WillReturnRows(sqlmock.NewRows([]string{"account_id"}).
-			AddRow(dstID1))
+		WithArgs(srcNum1, dstNum1).
+		WillReturnRows(sqlmock.NewRows([]string{"account_number", "account_id", "account_balance"}).
+			AddRow(srcNum1, srcID1, srcBal1).
+			AddRow(dstNum1, dstID1, 0.0))
 	mock.ExpectExec(regexp.QuoteMeta(
 		`UPDATE account
             SET account_balance = account_balance - $1
@@ -189,35 +184,28 @@ func TestBatchTransfer_Fatal(t *testing.T) {
 		WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectExec(regexp.QuoteMeta(
 		`INSERT INTO transaction
-             (source_account_id, target_account_id, transfer_amount, error)
-         VALUES ($1,$2,$3,$4)`)).
-		WithArgs(srcID1, dstID1, amount1, nil).
+             (source_account_id, target_account_id, transfer_amount, error,
+              reference, memo, value_date)
+         VALUES ($1,$2,$3,$4,$5,$6,$7)`)).
+		WithArgs(srcID1, dstID1, amount1, nil, nil, nil, nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
-	// Second transfer: unexpected error during target account query.
+	// Second transfer: unexpected error while locking the accounts.
 	srcNum2 := int64(1000000000000002)
 	dstNum2 := int64(1000000000000003)
 	amount2 := 75.0
-	srcID2 := int64(3)
-	srcBal2 := 200.0
 	expErr := errors.New("unexpected error")
 
 	mock.ExpectBegin()
+	// Simulate an unexpected error while locking the accounts.
 	mock.ExpectQuery(regexp.QuoteMeta(
-		`SELECT account_id, account_balance
+		`SELECT account_number, account_id, account_balance
            FROM account
-          WHERE account_number = $1
+          WHERE account_number IN ($1, $2)
+          ORDER BY account_number
           FOR UPDATE`)).
-		WithArgs(srcNum2).
-		WillReturnRows(sqlmock.NewRows([]string{"account_id", "account_balance"}).
-			AddRow(srcID2, srcBal2))
-	// For target query, simulate an unexpected error.
-	mock.ExpectQuery(regexp.QuoteMeta(
-		`SELECT account_id
-           FROM account
-          WHERE account_number = $1`)).
-		WithArgs(dstNum2).
+		WithArgs(srcNum2, dstNum2).
 		WillReturnError(expErr)
 	// Expect rollback due to error.
 	mock.ExpectRollback()
@@ -244,3 +232,44 @@ func TestBatchTransfer_Fatal(t *testing.T) {
 		t.Errorf("unfulfilled expectations in BatchTransfer: %v", err)
 	}
 }
+
+func TestBatchTransferOutcomes(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	srcNum, dstNum := int64(1000000000000000), int64(1000000000000001)
+	lock := func(srcBal float64) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FOR UPDATE`).
+			WithArgs(srcNum, dstNum).
+			WillReturnRows(sqlmock.NewRows([]string{"account_number", "account_id", "account_balance"}).
+				AddRow(srcNum, 1, srcBal).
+				AddRow(dstNum, 2, 0.0))
+	}
+	lock(100.0)
+	mock.ExpectExec(`UPDATE account`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE account`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO transaction`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	lock(40.0)
+	mock.ExpectExec(`INSERT INTO transaction`).WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(`INSERT INTO webhook_event`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	outcomes, berr := repo.New(db).BatchTransferOutcomes(context.Background(), []repo.TransferInput{
+		{Source: srcNum, Target: dstNum, Amount: 60},
+		{Source: srcNum, Target: dstNum, Amount: 60},
+	})
+	if berr != nil {
+		t.Fatalf("BatchTransferOutcomes: %v", berr.Err)
+	}
+	if want := []repo.Outcome{repo.Settled, repo.DeclinedInsufficient}; !slices.Equal(outcomes, want) {
+		t.Errorf("outcomes %v, want %v", outcomes, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
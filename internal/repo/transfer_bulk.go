@@ -0,0 +1,249 @@
+package repo
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/token-cjg/minibank/internal/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errNotPgx is returned by the bulk engine when the pool is not backed by
+// the pgx driver, which it needs for COPY.
+var errNotPgx = errors.New("bulk transfers need the pgx driver")
+
+// ledgerAccount is an account as the bulk engine sees it while settling a
+// batch: its id and running balance in cents.
+type ledgerAccount struct {
+	id      int64
+	balance int64
+}
+
+// settledRow is the effect of one batch row, ready to be written to the
+// transaction table. Amounts are in cents; srcBalance is the source
+// account's balance once the row has been applied.
+type settledRow struct {
+	outcome      Outcome
+	srcID, dstID *int64
+	amount       int64
+	errMsg       *string
+	srcBalance   int64
+}
+
+// settle applies txns in CSV order to accounts, keyed by account number,
+// exactly as transferTx would one row at a time: an unknown source or
+// target declines with no account ids, a short balance declines with both,
+// and anything else debits the source and credits the target. It updates
+// the balances in accounts and returns one settledRow per input row.
+func settle(txns []TransferInput, accounts map[int64]*ledgerAccount) []settledRow {
+	out := make([]settledRow, len(txns))
+	for i, t := range txns {
+		amount := cents(t.Amount)
+		src, dst := accounts[t.Source], accounts[t.Target]
+		switch {
+		case src == nil:
+			msg := fmt.Sprintf("tx declined, source account not found: %d", t.Source)
+			out[i] = settledRow{outcome: DeclinedUnknownAccount, amount: amount, errMsg: &msg}
+		case dst == nil:
+			msg := fmt.Sprintf("tx declined, target account not found: %d", t.Target)
+			out[i] = settledRow{outcome: DeclinedUnknownAccount, amount: amount, errMsg: &msg}
+		case src.balance < amount:
+			msg := "tx declined, insufficient balance"
+			out[i] = settledRow{outcome: DeclinedInsufficient, srcID: &src.id, dstID: &dst.id, amount: amount,
+				errMsg: &msg, srcBalance: src.balance}
+		default:
+			src.balance -= amount
+			dst.balance += amount
+			out[i] = settledRow{outcome: Settled, srcID: &src.id, dstID: &dst.id, amount: amount,
+				srcBalance: src.balance}
+		}
+	}
+	return out
+}
+
+// cents converts an amount validated to at most two decimal places.
+func cents(amount float64) int64 { return int64(math.Round(amount * 100)) }
+
+func numericCents(c int64) pgtype.Numeric {
+	return pgtype.Numeric{Int: big.NewInt(c), Exp: -2, Valid: true}
+}
+
+// bulkTransfer settles a whole batch in one transaction: the rows are
+// copied into a staging table, every account they name is locked once in
+// account_number order, balances and declines are computed in memory in CSV
+// order, and the new balances, transaction rows and the webhook events they
+// raise are written in bulk.
+// Unlike the row-by-row path the batch is all or nothing, so on error no
+// row has been applied and the BatchError has Row -1. Each row's outcome is
+// stored in outcomes.
+func (r *Repo) bulkTransfer(ctx context.Context, txns []TransferInput, outcomes []Outcome) *BatchError {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return &BatchError{Row: -1, Err: err}
+	}
+	defer conn.Close()
+
+	var results []settledRow
+	attempts, err := r.retrying(ctx, func() error {
+		return conn.Raw(func(dc any) error {
+			pc, err := pgxConn(dc)
+			if err != nil {
+				return err
+			}
+			results, err = bulkTx(ctx, pc, txns)
+			return err
+		})
+	})
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("batch.attempts", attempts))
+	if err != nil {
+		return &BatchError{Row: -1, Err: err}
+	}
+
+	counts := make(map[Outcome]int)
+	for i, res := range results {
+		outcomes[i] = res.outcome
+		counts[res.outcome]++
+		if res.outcome != Settled {
+			logDecline(ctx, res.outcome, i+1, txns[i])
+		}
+	}
+	for out, n := range counts {
+		metrics.TransfersTotal.WithLabelValues(string(out)).Add(float64(n))
+	}
+	return nil
+}
+
+// pgxConn digs the pgx connection out of a database/sql driver connection,
+// unwrapping instrumentation such as otelsql on the way.
+func pgxConn(dc any) (*pgx.Conn, error) {
+	for {
+		switch c := dc.(type) {
+		case *stdlib.Conn:
+			return c.Conn(), nil
+		case interface{ Raw() driver.Conn }:
+			dc = c.Raw()
+		default:
+			return nil, fmt.Errorf("%w, got %T", errNotPgx, dc)
+		}
+	}
+}
+
+func bulkTx(ctx context.Context, conn *pgx.Conn, txns []TransferInput) ([]settledRow, error) {
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx,
+		`CREATE TEMP TABLE transfer_staging (
+		    row_no BIGINT NOT NULL,
+		    source BIGINT NOT NULL,
+		    target BIGINT NOT NULL
+		 ) ON COMMIT DROP`); err != nil {
+		return nil, err
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"transfer_staging"},
+		[]string{"row_no", "source", "target"},
+		pgx.CopyFromSlice(len(txns), func(i int) ([]any, error) {
+			return []any{int64(i), txns[i].Source, txns[i].Target}, nil
+		})); err != nil {
+		return nil, fmt.Errorf("copy batch: %w", err)
+	}
+
+	// lock every account the batch names, once, lowest account_number first
+	rows, err := tx.Query(ctx,
+		`SELECT account_number, account_id, (account_balance * 100)::BIGINT
+		   FROM account
+		  WHERE account_number IN (SELECT source FROM transfer_staging
+		                           UNION
+		                           SELECT target FROM transfer_staging)
+		  ORDER BY account_number
+		  FOR UPDATE OF account`)
+	if err != nil {
+		return nil, err
+	}
+	accounts := make(map[int64]*ledgerAccount)
+	var num int64
+	var acc ledgerAccount
+	if _, err := pgx.ForEachRow(rows, []any{&num, &acc.id, &acc.balance}, func() error {
+		a := acc
+		accounts[num] = &a
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	before := make(map[int64]int64, len(accounts))
+	for _, a := range accounts {
+		before[a.id] = a.balance
+	}
+	results := settle(txns, accounts)
+
+	var ids, deltas []int64
+	for _, a := range accounts {
+		if d := a.balance - before[a.id]; d != 0 {
+			ids = append(ids, a.id)
+			deltas = append(deltas, d)
+		}
+	}
+	if len(ids) > 0 {
+		if _, err := tx.Exec(ctx,
+			`UPDATE account
+			    SET account_balance = account_balance + v.delta::NUMERIC / 100
+			   FROM unnest($1::BIGINT[], $2::BIGINT[]) AS v(id, delta)
+			  WHERE account.account_id = v.id`,
+			ids, deltas); err != nil {
+			return nil, err
+		}
+	}
+
+	// COPY cannot return the ids it assigns, so take them from the sequence
+	// first; the events below need them
+	rows, err = tx.Query(ctx,
+		`SELECT nextval(pg_get_serial_sequence('transaction', 'tx_id'))
+		   FROM generate_series(1, $1)`, len(txns))
+	if err != nil {
+		return nil, err
+	}
+	txIDs, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(txIDs)
+
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"transaction"},
+		[]string{"tx_id", "source_account_id", "target_account_id", "transfer_amount", "error",
+			"reference", "memo", "value_date"},
+		pgx.CopyFromSlice(len(results), func(i int) ([]any, error) {
+			res, t := results[i], txns[i]
+			return []any{txIDs[i], res.srcID, res.dstID, numericCents(res.amount), res.errMsg,
+				nullString(t.Reference), nullString(t.Memo), nullDate(t.ValueDate)}, nil
+		})); err != nil {
+		return nil, fmt.Errorf("copy transactions: %w", err)
+	}
+
+	balances := make([]int64, len(results))
+	for i, res := range results {
+		balances[i] = res.srcBalance
+	}
+	if _, err := tx.Exec(ctx,
+		`WITH tx AS (
+		    SELECT t.*, v.balance::NUMERIC / 100 AS source_balance
+		      FROM unnest($1::BIGINT[], $2::BIGINT[]) AS v(tx_id, balance)
+		      JOIN transaction t ON t.tx_id = v.tx_id)`+transferEvents,
+		txIDs, balances); err != nil {
+		return nil, fmt.Errorf("record events: %w", err)
+	}
+
+	return results, tx.Commit(ctx)
+}
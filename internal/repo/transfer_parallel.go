@@ -0,0 +1,106 @@
+package repo
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// batchParallel runs a batch on up to r.concurrency connections. Rows are
+// partitioned so that any two rows touching a common account land in the
+// same partition; each partition runs serially in CSV order and partitions
+// run concurrently. Since partitions share no account, every row sees the
+// same balances it would have seen in a serial run.
+//
+// On a fatal error no further rows are started at or after the failing
+// row, and the lowest failing row is reported. Rows in other partitions
+// that were already running, or that come earlier in the file, still
+// complete, so unlike a serial run some rows after the reported one may
+// have been applied.
+func (r *Repo) batchParallel(ctx context.Context, txns []TransferInput, outcomes []Outcome) *BatchError {
+	parts := partition(txns)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("batch.partitions", len(parts)))
+
+	var (
+		mu     sync.Mutex
+		failed *BatchError
+	)
+	// stopped reports whether row i comes at or after a row that failed.
+	stopped := func(i int) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return failed != nil && i >= failed.Row
+	}
+
+	work := make(chan []int)
+	var wg sync.WaitGroup
+	for range min(r.concurrency, len(parts)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rows := range work {
+				for _, i := range rows {
+					if stopped(i) {
+						break
+					}
+					if err := r.batchRow(ctx, i, txns[i], outcomes); err != nil {
+						mu.Lock()
+						if failed == nil || i < failed.Row {
+							failed = &BatchError{Row: i, Err: err}
+						}
+						mu.Unlock()
+						break
+					}
+				}
+			}
+		}()
+	}
+	for _, p := range parts {
+		if stopped(p[0]) {
+			continue
+		}
+		work <- p
+	}
+	close(work)
+	wg.Wait()
+	return failed
+}
+
+// partition groups the row indexes of txns into connected components of the
+// "shares an account" relation. Indexes within a partition are in CSV order
+// and partitions are ordered by their first row.
+func partition(txns []TransferInput) [][]int {
+	parent := make(map[int64]int64, 2*len(txns))
+	var find func(int64) int64
+	find = func(a int64) int64 {
+		p, ok := parent[a]
+		if !ok || p == a {
+			parent[a] = a
+			return a
+		}
+		root := find(p)
+		parent[a] = root
+		return root
+	}
+	for _, t := range txns {
+		if a, b := find(t.Source), find(t.Target); a != b {
+			parent[a] = b
+		}
+	}
+
+	index := make(map[int64]int)
+	var parts [][]int
+	for i, t := range txns {
+		root := find(t.Source)
+		n, ok := index[root]
+		if !ok {
+			n = len(parts)
+			index[root] = n
+			parts = append(parts, nil)
+		}
+		parts[n] = append(parts[n], i)
+	}
+	return parts
+}
@@ -0,0 +1,100 @@
+package repo_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+func TestPartition(t *testing.T) {
+	txns := []repo.TransferInput{
+		{Source: 1, Target: 2}, // 0
+		{Source: 3, Target: 4}, // 1
+		{Source: 5, Target: 1}, // 2 joins 0 through account 1
+		{Source: 6, Target: 6}, // 3
+		{Source: 4, Target: 7}, // 4 joins 1 through account 4
+		{Source: 7, Target: 2}, // 5 merges {0,2} and {1,4}
+		{Source: 8, Target: 9}, // 6
+	}
+	want := [][]int{{0, 1, 2, 4, 5}, {3}, {6}}
+	if got := repo.Partition(txns); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Partition = %v, want %v", got, want)
+	}
+}
+
+// expectSettle expects one settled transfer of amount from src to dst.
+func expectSettle(mock sqlmock.Sqlmock, src, dst, srcID, dstID int64, amount float64) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT account_number, account_id, account_balance.*FOR UPDATE`).
+		WithArgs(src, dst).
+		WillReturnRows(sqlmock.NewRows([]string{"account_number", "account_id", "account_balance"}).
+			AddRow(src, srcID, 1000.0).
+			AddRow(dst, dstID, 0.0))
+	mock.ExpectExec(`account_balance - \$1`).WithArgs(amount, srcID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`account_balance \+ \$1`).WithArgs(amount, dstID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO transaction`).WithArgs(srcID, dstID, amount, nil, nil, nil, nil).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+}
+
+func TestBatchTransfer_Parallel(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	defer db.Close()
+	// rows run on several goroutines, so expectations match in any order
+	mock.MatchExpectationsInOrder(false)
+	r := repo.New(db, repo.WithConcurrency(4))
+
+	expectSettle(mock, 100, 200, 1, 2, 10)
+	expectSettle(mock, 300, 400, 3, 4, 20)
+	expectSettle(mock, 200, 500, 2, 5, 30)
+	expectSettle(mock, 600, 700, 6, 7, 40)
+
+	berr := r.BatchTransfer(context.Background(), []repo.TransferInput{
+		{Source: 100, Target: 200, Amount: 10},
+		{Source: 300, Target: 400, Amount: 20},
+		{Source: 200, Target: 500, Amount: 30},
+		{Source: 600, Target: 700, Amount: 40},
+	})
+	if berr != nil {
+		t.Fatalf("BatchTransfer: row %d: %v", berr.Row, berr.Err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// A fatal error stops the rest of its partition: row 2 shares account 200
+// with the failing row 1 and must not run, while row 0 still settles.
+func TestBatchTransfer_ParallelStopsPartitionOnError(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+	r := repo.New(db, repo.WithConcurrency(2))
+
+	expErr := errors.New("connection reset")
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FOR UPDATE`).WithArgs(int64(100), int64(200)).WillReturnError(expErr)
+	mock.ExpectRollback()
+	expectSettle(mock, 300, 400, 3, 4, 20)
+
+	berr := r.BatchTransfer(context.Background(), []repo.TransferInput{
+		{Source: 300, Target: 400, Amount: 20},
+		{Source: 100, Target: 200, Amount: 10},
+		{Source: 200, Target: 500, Amount: 30},
+	})
+	if berr == nil || berr.Row != 1 || !errors.Is(berr.Err, expErr) {
+		t.Fatalf("BatchTransfer = %+v, want row 1 failure", berr)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
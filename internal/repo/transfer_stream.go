@@ -0,0 +1,171 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/token-cjg/minibank/internal/metrics"
+	"github.com/token-cjg/minibank/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// RowResult is what happened to one row of a streamed batch.
+type RowResult struct {
+	Row     int // 1-based
+	Input   TransferInput
+	Outcome Outcome
+	Err     error // set when the row failed and stopped the stream
+}
+
+// TransferStream runs transfers as next produces them and hands each
+// result to emit, in row order. It never holds more than the configured
+// concurrency's worth of rows: when emit is slow, TransferStream stops
+// calling next until results drain, so a slow reader at either end
+// throttles the whole pipeline instead of growing a buffer.
+//
+// A row starts only once every earlier row touching one of its accounts has
+// finished, so results match a serial run. next returns io.EOF at the end
+// of input; any other error from next, an error from emit, or a row that
+// fails stops the stream: no further rows are read, rows already running
+// finish and are emitted, and the first such error is returned. A stream
+// that reaches the end of its input raises batch.completed, like a batch.
+func (r *Repo) TransferStream(ctx context.Context, next func() (TransferInput, error), emit func(RowResult) error) error {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(ctx, "repo.TransferStream")
+	defer span.End()
+
+	window := max(r.concurrency, 1)
+	slots := make(chan struct{}, window)    // rows started but not yet emitted
+	results := make(chan RowResult, window) // never blocks: at most window rows are out
+	emitted := make(chan struct{})
+
+	var (
+		mu      sync.Mutex
+		free    = sync.NewCond(&mu)
+		busy    = make(map[int64]bool) // accounts touched by a running row
+		stopErr error
+		counts  = make(map[Outcome]int)
+		sources []int64 // distinct, for batch.completed
+		seen    = make(map[int64]bool)
+	)
+	stop := func(err error) {
+		mu.Lock()
+		if stopErr == nil {
+			stopErr = err
+		}
+		mu.Unlock()
+	}
+	stopped := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return stopErr != nil
+	}
+
+	// emitter: put results back in row order and release their slots
+	go func() {
+		pending := make(map[int]RowResult, window)
+		nextRow := 1
+		var emitErr error
+		for res := range results {
+			pending[res.Row] = res
+			for {
+				res, ok := pending[nextRow]
+				if !ok {
+					break
+				}
+				delete(pending, nextRow)
+				nextRow++
+				// rows finishing after a stop were still applied, so they
+				// are reported too; only a failed emit silences the rest
+				if emitErr == nil {
+					if emitErr = emit(res); emitErr != nil {
+						stop(emitErr)
+					}
+				}
+				<-slots
+			}
+		}
+		close(emitted)
+	}()
+
+	var wg sync.WaitGroup
+	rows := 0
+	for !stopped() {
+		t, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			stop(err)
+			break
+		}
+		slots <- struct{}{}
+		if stopped() {
+			// a row failed while this one waited for a slot
+			<-slots
+			break
+		}
+		rows++
+
+		mu.Lock()
+		for busy[t.Source] || busy[t.Target] {
+			free.Wait()
+		}
+		busy[t.Source], busy[t.Target] = true, true
+		if !seen[t.Source] {
+			seen[t.Source] = true
+			sources = append(sources, t.Source)
+		}
+		mu.Unlock()
+
+		wg.Add(1)
+		go func(row int, t TransferInput) {
+			defer wg.Done()
+			res := RowResult{Row: row, Input: t}
+			res.Outcome, res.Err = r.transfer(ctx, row, t)
+			if errors.Is(res.Err, ErrInsufficient) {
+				res.Err = nil
+			}
+			if res.Err != nil {
+				stop(&StreamError{Row: row, Err: res.Err})
+			}
+			mu.Lock()
+			counts[res.Outcome]++
+			delete(busy, t.Source)
+			delete(busy, t.Target)
+			free.Broadcast()
+			mu.Unlock()
+			results <- res
+		}(rows, t)
+	}
+	wg.Wait()
+	close(results)
+	<-emitted
+
+	metrics.BatchSize.Observe(float64(rows))
+	metrics.BatchDuration.Observe(time.Since(start).Seconds())
+	span.SetAttributes(attribute.Int("batch.rows", rows))
+	if stopErr == nil {
+		r.batchCompleted(ctx, rows, sources, counts)
+	}
+	if serr, ok := stopErr.(*StreamError); ok {
+		span.SetAttributes(attribute.Int("batch.failed_row", serr.Row))
+		span.SetStatus(codes.Error, serr.Error())
+		slog.ErrorContext(ctx, "transfer stream aborted", "row", serr.Row, "rows", rows, "err", serr.Err)
+	}
+	return stopErr
+}
+
+// StreamError is returned by TransferStream when a row failed.
+type StreamError struct {
+	Row int // 1-based
+	Err error
+}
+
+func (e *StreamError) Error() string { return e.Err.Error() }
+func (e *StreamError) Unwrap() error { return e.Err }
@@ -0,0 +1,125 @@
+package repo_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+// feed returns a next function for TransferStream that yields txns, then
+// io.EOF.
+func feed(txns ...repo.TransferInput) func() (repo.TransferInput, error) {
+	return func() (repo.TransferInput, error) {
+		if len(txns) == 0 {
+			return repo.TransferInput{}, io.EOF
+		}
+		t := txns[0]
+		txns = txns[1:]
+		return t, nil
+	}
+}
+
+func TestTransferStream_EmitsInRowOrder(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+	r := repo.New(db, repo.WithConcurrency(3))
+
+	expectSettle(mock, 100, 200, 1, 2, 10)
+	expectSettle(mock, 300, 400, 3, 4, 20)
+	expectSettle(mock, 200, 500, 2, 5, 30)
+	expectSettle(mock, 600, 700, 6, 7, 40)
+
+	var got []int
+	err = r.TransferStream(context.Background(), feed(
+		repo.TransferInput{Source: 100, Target: 200, Amount: 10},
+		repo.TransferInput{Source: 300, Target: 400, Amount: 20},
+		repo.TransferInput{Source: 200, Target: 500, Amount: 30},
+		repo.TransferInput{Source: 600, Target: 700, Amount: 40},
+	), func(res repo.RowResult) error {
+		if res.Outcome != repo.Settled || res.Err != nil {
+			t.Errorf("row %d: %s %v", res.Row, res.Outcome, res.Err)
+		}
+		got = append(got, res.Row)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("TransferStream: %v", err)
+	}
+	if len(got) != 4 || got[0] != 1 || got[1] != 2 || got[2] != 3 || got[3] != 4 {
+		t.Errorf("rows emitted as %v, want [1 2 3 4]", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestTransferStream_StopsOnFailedRow(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	defer db.Close()
+	r := repo.New(db)
+
+	expErr := errors.New("connection reset")
+	expectSettle(mock, 100, 200, 1, 2, 10)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FOR UPDATE`).WillReturnError(expErr)
+	mock.ExpectRollback()
+
+	var emitted []repo.RowResult
+	err = r.TransferStream(context.Background(), feed(
+		repo.TransferInput{Source: 100, Target: 200, Amount: 10},
+		repo.TransferInput{Source: 300, Target: 400, Amount: 20},
+		repo.TransferInput{Source: 500, Target: 600, Amount: 30}, // never read
+	), func(res repo.RowResult) error {
+		emitted = append(emitted, res)
+		return nil
+	})
+	var serr *repo.StreamError
+	if !errors.As(err, &serr) || serr.Row != 2 || !errors.Is(err, expErr) {
+		t.Fatalf("TransferStream = %v, want StreamError on row 2", err)
+	}
+	if len(emitted) != 2 || emitted[1].Err == nil {
+		t.Errorf("emitted %+v, want row 1 and failed row 2", emitted)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestTransferStream_ReadErrorStops(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	defer db.Close()
+	r := repo.New(db)
+
+	expectSettle(mock, 100, 200, 1, 2, 10)
+	readErr := errors.New("bad csv")
+	calls := 0
+	next := func() (repo.TransferInput, error) {
+		calls++
+		if calls == 1 {
+			return repo.TransferInput{Source: 100, Target: 200, Amount: 10}, nil
+		}
+		return repo.TransferInput{}, readErr
+	}
+	rows := 0
+	err = r.TransferStream(context.Background(), next, func(repo.RowResult) error { rows++; return nil })
+	if !errors.Is(err, readErr) || rows != 1 {
+		t.Fatalf("TransferStream = %v after %d rows, want read error after 1", err, rows)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
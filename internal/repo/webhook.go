@@ -0,0 +1,361 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/token-cjg/minibank/internal/model"
+)
+
+// transferEvents completes a statement that starts with a CTE named tx
+// holding newly written transaction rows, each with the source account's
+// balance after it as source_balance. It records, in the same statement,
+// the webhook events the rows raise for companies subscribed to them:
+// transfer.settled for the companies on either side, transfer.declined for
+// the source company, and account.low_balance, addressed to the one
+// subscription, when a debit takes the source account across that
+// subscription's threshold. It also notifies TxChannel of each row, which
+// Postgres delivers to listeners once the transaction commits. Declines
+// naming an unknown account have no company to tell.
+const transferEvents = `,
+	parties AS (
+	    SELECT tx.tx_id, tx.error, tx.transfer_amount, tx.source_balance,
+	           s.company_id AS source_company, d.company_id AS target_company,
+	           s.account_number AS source_number,
+	           ` + txEventObject + ` AS event,
+	           jsonb_build_object(
+	               'tx_id', tx.tx_id,
+	               'source_account_number', s.account_number,
+	               'target_account_number', d.account_number,
+	               'amount', tx.transfer_amount,
+	               'error', tx.error,
+	               'reference', tx.reference,
+	               'memo', tx.memo,
+	               'value_date', tx.value_date,
+	               'created_at', tx.created_at) AS payload
+	      FROM tx
+	      JOIN account s ON s.account_id = tx.source_account_id
+	      JOIN account d ON d.account_id = tx.target_account_id
+	),
+	raised AS (
+	    SELECT source_company AS company_id, NULL::INT AS webhook_id,
+	           CASE WHEN error IS NULL THEN 'transfer.settled' ELSE 'transfer.declined' END AS event_type,
+	           payload, tx_id
+	      FROM parties
+	    UNION
+	    SELECT target_company, NULL, 'transfer.settled', payload, tx_id
+	      FROM parties
+	     WHERE error IS NULL
+	    UNION
+	    SELECT p.source_company, w.webhook_id, 'account.low_balance',
+	           jsonb_build_object(
+	               'account_number', p.source_number,
+	               'balance', p.source_balance,
+	               'threshold', w.low_balance_threshold,
+	               'tx_id', p.tx_id),
+	           p.tx_id
+	      FROM parties p
+	      JOIN webhook_subscription w ON w.company_id = p.source_company
+	     WHERE p.error IS NULL
+	       AND 'account.low_balance' = ANY(w.events)
+	       AND p.source_balance < w.low_balance_threshold
+	       AND p.source_balance + p.transfer_amount >= w.low_balance_threshold
+	),
+	recorded AS (
+	    INSERT INTO webhook_event (company_id, webhook_id, event_type, payload)
+	    SELECT company_id, webhook_id, event_type, payload
+	      FROM raised e
+	     WHERE EXISTS (SELECT 1 FROM webhook_subscription w
+	                    WHERE w.company_id = e.company_id AND e.event_type = ANY(w.events))
+	     ORDER BY tx_id, event_type
+	)
+	SELECT pg_notify('` + TxChannel + `', event::TEXT)
+	  FROM parties
+	 ORDER BY tx_id`
+
+// batchCompleted records a batch.completed event for each subscribed
+// company that owns one of the batch's source accounts, given by number.
+// The rows committed one by one, so unlike transfer events this one is
+// written after the fact: a failure is logged rather than returned, since
+// the batch itself went through.
+func (r *Repo) batchCompleted(ctx context.Context, rows int, sources []int64, counts map[Outcome]int) {
+	if rows == 0 {
+		return
+	}
+	payload, _ := json.Marshal(map[string]int{
+		"rows":     rows,
+		"settled":  counts[Settled],
+		"declined": counts[DeclinedInsufficient] + counts[DeclinedUnknownAccount],
+	})
+	args := make([]any, 0, len(sources)+1)
+	args = append(args, string(payload))
+	placeholders := make([]string, len(sources))
+	for i, n := range sources {
+		args = append(args, n)
+		placeholders[i] = "$" + strconv.Itoa(i+2)
+	}
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO webhook_event (company_id, event_type, payload)
+		 SELECT DISTINCT a.company_id, 'batch.completed', $1::JSONB
+		   FROM account a
+		  WHERE a.account_number IN (`+strings.Join(placeholders, ",")+`)
+		    AND EXISTS (SELECT 1 FROM webhook_subscription w
+		                 WHERE w.company_id = a.company_id AND 'batch.completed' = ANY(w.events))`,
+		args...)
+	if err != nil {
+		slog.ErrorContext(ctx, "record batch.completed event", "rows", rows, "err", err)
+	}
+}
+
+const webhookColumns = `webhook_id, company_id, url, array_to_string(events, ','),
+	low_balance_threshold, created_at`
+
+func scanWebhook(s scanner) (model.Webhook, error) {
+	var (
+		w      model.Webhook
+		events string
+	)
+	err := s.Scan(&w.ID, &w.Company, &w.URL, &events, &w.LowBalanceThreshold, &w.CreatedAt)
+	w.Events = strings.Split(events, ",")
+	return w, err
+}
+
+// CreateWebhook subscribes w.Company to w.Events, delivered to w.URL and
+// signed with w.Secret. The secret is returned only here.
+func (r *Repo) CreateWebhook(ctx context.Context, w model.Webhook) (model.Webhook, error) {
+	out, err := scanWebhook(r.db.QueryRowContext(ctx,
+		`INSERT INTO webhook_subscription (company_id, url, secret, events, low_balance_threshold)
+		 VALUES ($1, $2, $3, string_to_array($4, ','), $5)
+		 RETURNING `+webhookColumns,
+		w.Company, w.URL, w.Secret, strings.Join(w.Events, ","), w.LowBalanceThreshold))
+	out.Secret = w.Secret
+	return out, classify(err)
+}
+
+func (r *Repo) ListWebhooks(ctx context.Context, companyID int64) ([]model.Webhook, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+webhookColumns+` FROM webhook_subscription WHERE company_id=$1 ORDER BY webhook_id`,
+		companyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []model.Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, w)
+	}
+	return list, rows.Err()
+}
+
+func (r *Repo) GetWebhook(ctx context.Context, companyID, webhookID int64) (model.Webhook, error) {
+	w, err := scanWebhook(r.db.QueryRowContext(ctx,
+		`SELECT `+webhookColumns+` FROM webhook_subscription WHERE company_id=$1 AND webhook_id=$2`,
+		companyID, webhookID))
+	return w, classify(err)
+}
+
+// DeleteWebhook unsubscribes the webhook and drops its delivery log.
+func (r *Repo) DeleteWebhook(ctx context.Context, companyID, webhookID int64) error {
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM webhook_subscription WHERE company_id=$1 AND webhook_id=$2`, companyID, webhookID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return classify(sql.ErrNoRows)
+	}
+	return nil
+}
+
+const deliveryColumns = `d.delivery_id, d.webhook_id, d.event_id, e.event_type, d.status, d.attempts,
+	d.next_attempt_at, d.last_attempt_at, d.response_status, d.last_error, d.delivered_at, d.created_at`
+
+func scanDelivery(s scanner) (model.WebhookDelivery, error) {
+	var (
+		d    model.WebhookDelivery
+		next time.Time
+	)
+	err := s.Scan(&d.ID, &d.Webhook, &d.Event, &d.EventType, &d.Status, &d.Attempts,
+		&next, &d.LastAttemptAt, &d.ResponseStatus, &d.LastError, &d.DeliveredAt, &d.CreatedAt)
+	if d.Status == model.DeliveryPending {
+		d.NextAttemptAt = &next
+	}
+	return d, err
+}
+
+// ListDeliveries returns the delivery log of companyID's webhook, newest
+// first, at most limit entries.
+func (r *Repo) ListDeliveries(ctx context.Context, companyID, webhookID int64, limit int) ([]model.WebhookDelivery, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+deliveryColumns+`
+		   FROM webhook_delivery d
+		   JOIN webhook_event e ON e.event_id = d.event_id
+		   JOIN webhook_subscription w ON w.webhook_id = d.webhook_id
+		  WHERE w.company_id = $1 AND d.webhook_id = $2
+		  ORDER BY d.delivery_id DESC
+		  LIMIT $3`,
+		companyID, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []model.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
+
+// Redeliver queues a delivery of companyID's webhook to be sent again now,
+// whatever became of it, with a fresh round of attempts.
+func (r *Repo) Redeliver(ctx context.Context, companyID, webhookID, deliveryID int64) (model.WebhookDelivery, error) {
+	d, err := scanDelivery(r.db.QueryRowContext(ctx,
+		`WITH redone AS (
+		    UPDATE webhook_delivery d
+		       SET status = 'pending', attempts = 0, next_attempt_at = now()
+		      FROM webhook_subscription w
+		     WHERE w.webhook_id = d.webhook_id AND w.company_id = $1
+		       AND d.webhook_id = $2 AND d.delivery_id = $3
+		 RETURNING d.*)
+		 SELECT `+deliveryColumns+`
+		   FROM redone d JOIN webhook_event e ON e.event_id = d.event_id`,
+		companyID, webhookID, deliveryID))
+	return d, classify(err)
+}
+
+// DispatchEvents fans up to limit undispatched events out to a delivery for
+// each subscription that wants them, and returns how many it dispatched.
+// Events are claimed with SKIP LOCKED, so several servers can dispatch at
+// once without sending an event twice.
+func (r *Repo) DispatchEvents(ctx context.Context, limit int) (int, error) {
+	res, err := r.db.ExecContext(ctx,
+		`WITH due AS (
+		    SELECT event_id, company_id, webhook_id, event_type
+		      FROM webhook_event
+		     WHERE dispatched_at IS NULL
+		     ORDER BY event_id
+		     LIMIT $1
+		       FOR UPDATE SKIP LOCKED),
+		 fanned AS (
+		    INSERT INTO webhook_delivery (webhook_id, event_id)
+		    SELECT w.webhook_id, e.event_id
+		      FROM due e
+		      JOIN webhook_subscription w
+		        ON w.company_id = e.company_id AND e.event_type = ANY(w.events)
+		       AND (e.webhook_id IS NULL OR e.webhook_id = w.webhook_id)
+		    ON CONFLICT (webhook_id, event_id) DO NOTHING)
+		 UPDATE webhook_event SET dispatched_at = now()
+		  WHERE event_id IN (SELECT event_id FROM due)`,
+		limit)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// DueDelivery is a delivery claimed by ClaimDeliveries, with what it takes
+// to send it.
+type DueDelivery struct {
+	ID        int64
+	Webhook   int64
+	Attempts  int // made so far
+	URL       string
+	Secret    string
+	Event     int64
+	EventType string
+	Company   int64
+	CreatedAt time.Time
+	Payload   json.RawMessage
+}
+
+// ClaimDeliveries claims up to limit pending deliveries that are due,
+// oldest first, by pushing their next attempt lease into the future: if
+// the claimer dies before recording an attempt, the delivery comes due again
+// once the lease runs out.
+func (r *Repo) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]DueDelivery, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`UPDATE webhook_delivery d
+		    SET next_attempt_at = now() + $2::BIGINT * INTERVAL '1 millisecond'
+		   FROM webhook_subscription w, webhook_event e
+		  WHERE d.delivery_id IN (
+		            SELECT delivery_id
+		              FROM webhook_delivery
+		             WHERE status = 'pending' AND next_attempt_at <= now()
+		             ORDER BY next_attempt_at
+		             LIMIT $1
+		               FOR UPDATE SKIP LOCKED)
+		    AND w.webhook_id = d.webhook_id AND e.event_id = d.event_id
+		RETURNING d.delivery_id, d.webhook_id, d.attempts, w.url, w.secret,
+		          e.event_id, e.event_type, e.company_id, e.created_at, e.payload`,
+		limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []DueDelivery
+	for rows.Next() {
+		var d DueDelivery
+		var payload []byte
+		if err := rows.Scan(&d.ID, &d.Webhook, &d.Attempts, &d.URL, &d.Secret,
+			&d.Event, &d.EventType, &d.Company, &d.CreatedAt, &payload); err != nil {
+			return nil, err
+		}
+		d.Payload = payload
+		due = append(due, d)
+	}
+	return due, rows.Err()
+}
+
+// Attempt is the outcome of sending a delivery once.
+type Attempt struct {
+	ResponseStatus int // 0 if there was no response
+	Err            string
+	Delivered      bool
+	// RetryIn is when to try again after a failure; 0 gives up and marks
+	// the delivery failed.
+	RetryIn time.Duration
+}
+
+// RecordAttempt writes the outcome of an attempt to the delivery log.
+func (r *Repo) RecordAttempt(ctx context.Context, deliveryID int64, a Attempt) error {
+	status := model.DeliveryPending
+	switch {
+	case a.Delivered:
+		status = model.DeliveryDelivered
+	case a.RetryIn <= 0:
+		status = model.DeliveryFailed
+	}
+	var respStatus *int
+	if a.ResponseStatus != 0 {
+		respStatus = &a.ResponseStatus
+	}
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE webhook_delivery
+		    SET attempts = attempts + 1,
+		        last_attempt_at = now(),
+		        response_status = $2,
+		        last_error = $3,
+		        status = $4::TEXT,
+		        delivered_at = CASE WHEN $4::TEXT = 'delivered' THEN now() END,
+		        next_attempt_at = now() + $5::BIGINT * INTERVAL '1 millisecond'
+		  WHERE delivery_id = $1`,
+		deliveryID, respStatus, nullString(a.Err), status, a.RetryIn.Milliseconds())
+	return err
+}
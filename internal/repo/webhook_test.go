@@ -0,0 +1,315 @@
+package repo_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/token-cjg/minibank/internal/db"
+	"github.com/token-cjg/minibank/internal/model"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+var webhookCols = []string{"webhook_id", "company_id", "url", "events", "low_balance_threshold", "created_at"}
+
+func TestCreateWebhook(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	threshold := 1000.0
+	created := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`INSERT INTO webhook_subscription (company_id, url, secret, events, low_balance_threshold)
+		 VALUES ($1, $2, $3, string_to_array($4, ','), $5)`)).
+		WithArgs(int64(1), "https://example.com/hooks", "whsec_0123456789abcdef",
+			"transfer.settled,account.low_balance", &threshold).
+		WillReturnRows(sqlmock.NewRows(webhookCols).
+			AddRow(7, 1, "https://example.com/hooks", "transfer.settled,account.low_balance", threshold, created))
+
+	got, err := repo.New(db).CreateWebhook(context.Background(), model.Webhook{
+		Company:             1,
+		URL:                 "https://example.com/hooks",
+		Events:              []string{model.EventTransferSettled, model.EventLowBalance},
+		LowBalanceThreshold: &threshold,
+		Secret:              "whsec_0123456789abcdef",
+	})
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	if got.ID != 7 || len(got.Events) != 2 || got.Events[1] != model.EventLowBalance ||
+		got.Secret != "whsec_0123456789abcdef" || *got.LowBalanceThreshold != threshold {
+		t.Errorf("got %+v", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDeleteWebhook_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`DELETE FROM webhook_subscription WHERE company_id=\$1 AND webhook_id=\$2`).
+		WithArgs(int64(1), int64(9)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := repo.New(db).DeleteWebhook(context.Background(), 1, 9); !errors.Is(err, repo.ErrNotFound) {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDispatchEvents(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`FOR UPDATE SKIP LOCKED.*INSERT INTO webhook_delivery.*ON CONFLICT \(webhook_id, event_id\) DO NOTHING.*UPDATE webhook_event SET dispatched_at = now\(\)`).
+		WithArgs(50).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	n, err := repo.New(db).DispatchEvents(context.Background(), 50)
+	if err != nil || n != 3 {
+		t.Fatalf("DispatchEvents = %d, %v; want 3", n, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestClaimDeliveries(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	created := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`UPDATE webhook_delivery d\s+SET next_attempt_at = now\(\) \+ \$2::BIGINT \* INTERVAL '1 millisecond'.*FOR UPDATE SKIP LOCKED`).
+		WithArgs(10, int64(90000)).
+		WillReturnRows(sqlmock.NewRows([]string{"delivery_id", "webhook_id", "attempts", "url", "secret",
+			"event_id", "event_type", "company_id", "created_at", "payload"}).
+			AddRow(4, 7, 2, "https://example.com/hooks", "s3cret", 11, "transfer.settled", 1, created, []byte(`{"tx_id":5}`)))
+
+	due, err := repo.New(db).ClaimDeliveries(context.Background(), 10, 90*time.Second)
+	if err != nil {
+		t.Fatalf("ClaimDeliveries: %v", err)
+	}
+	if len(due) != 1 || due[0].ID != 4 || due[0].Attempts != 2 || due[0].Event != 11 ||
+		string(due[0].Payload) != `{"tx_id":5}` {
+		t.Fatalf("due = %+v", due)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRecordAttempt(t *testing.T) {
+	cases := []struct {
+		name    string
+		attempt repo.Attempt
+		status  string
+		retryMs int64
+	}{
+		{"delivered", repo.Attempt{ResponseStatus: 204, Delivered: true}, model.DeliveryDelivered, 0},
+		{"retry", repo.Attempt{ResponseStatus: 503, Err: "receiver answered 503", RetryIn: 2 * time.Minute},
+			model.DeliveryPending, 120000},
+		{"give up", repo.Attempt{Err: "connection refused"}, model.DeliveryFailed, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+			if err != nil {
+				t.Fatalf("failed to open sqlmock: %v", err)
+			}
+			defer db.Close()
+
+			var status any
+			if c.attempt.ResponseStatus != 0 {
+				status = &c.attempt.ResponseStatus
+			}
+			var msg any
+			if c.attempt.Err != "" {
+				msg = &c.attempt.Err
+			}
+			mock.ExpectExec(`UPDATE webhook_delivery\s+SET attempts = attempts \+ 1`).
+				WithArgs(int64(4), status, msg, c.status, c.retryMs).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			if err := repo.New(db).RecordAttempt(context.Background(), 4, c.attempt); err != nil {
+				t.Fatalf("RecordAttempt: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestRedeliver_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`WITH redone AS \(\s+UPDATE webhook_delivery d\s+SET status = 'pending', attempts = 0`).
+		WithArgs(int64(1), int64(7), int64(99)).
+		WillReturnRows(sqlmock.NewRows(nil))
+
+	_, err = repo.New(db).Redeliver(context.Background(), 1, 7, 99)
+	if !errors.Is(err, repo.ErrNotFound) {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestBatchTransfer_RecordsBatchCompleted(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	srcNum, dstNum := int64(1000000000000000), int64(1000000000000001)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT account_number, account_id, account_balance`).
+		WithArgs(srcNum, dstNum).
+		WillReturnRows(sqlmock.NewRows([]string{"account_number", "account_id", "account_balance"}).
+			AddRow(srcNum, 1, 10.0).
+			AddRow(dstNum, 2, 0.0))
+	msg := "tx declined, insufficient balance"
+	// the transfer's own events are written, and live listeners notified,
+	// by the same statement as the row
+	mock.ExpectExec(`WITH inserted AS \(\s+INSERT INTO transaction.*INSERT INTO webhook_event.*SELECT pg_notify\('minibank_transactions', event::TEXT\)`).
+		WithArgs(int64(1), int64(2), 50.0, &msg, nil, nil, nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(`INSERT INTO webhook_event \(company_id, event_type, payload\)\s+SELECT DISTINCT a.company_id, 'batch.completed'`).
+		WithArgs(`{"declined":1,"rows":1,"settled":0}`, srcNum).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if berr := repo.New(db).BatchTransfer(context.Background(),
+		[]repo.TransferInput{{Source: srcNum, Target: dstNum, Amount: 50}}); berr != nil {
+		t.Fatalf("BatchTransfer: %v", berr.Err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// The engines append transferEvents to their own WITH list, so each of its
+// CTEs must follow a comma; sqlmock cannot parse the SQL to catch one missing.
+func TestTransferEvents_CTEList(t *testing.T) {
+	cte := regexp.MustCompile(`(?m)^\t(\w+) AS \($`)
+	var names []string
+	for _, m := range cte.FindAllStringSubmatchIndex(repo.TransferEvents, -1) {
+		names = append(names, repo.TransferEvents[m[2]:m[3]])
+		before := strings.TrimRight(repo.TransferEvents[:m[0]], " \t\n")
+		if !strings.HasSuffix(before, ",") {
+			t.Errorf("CTE %s does not follow a comma: ...%s", names[len(names)-1], before[max(0, len(before)-20):])
+		}
+	}
+	if want := []string{"parties", "raised", "recorded"}; !slices.Equal(names, want) {
+		t.Errorf("CTEs = %v, want %v", names, want)
+	}
+}
+
+// TestTransferEvents_Postgres runs the row-by-row and bulk engines, whose
+// statements end in transferEvents, against a real database so Postgres
+// parses and plans them. It runs only when MINIBANK_TEST_DATABASE_URL points
+// at a migrated, disposable database; it adds a company on each run.
+func TestTransferEvents_Postgres(t *testing.T) {
+	dsn := os.Getenv("MINIBANK_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("MINIBANK_TEST_DATABASE_URL not set")
+	}
+	pg, err := db.Open(dsn, db.DefaultPool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pg.Close()
+
+	ctx := context.Background()
+	for _, engine := range []struct {
+		name string
+		opts []repo.Option
+	}{
+		{"rows", nil},
+		{"bulk", []repo.Option{repo.WithBulkThreshold(1)}},
+	} {
+		t.Run(engine.name, func(t *testing.T) {
+			r := repo.New(pg, engine.opts...)
+			company, err := r.CreateCompany(ctx, fmt.Sprintf("events-%s-%d", engine.name, time.Now().UnixNano()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			src, err := r.CreateAccount(ctx, company.ID, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dst, err := r.CreateAccount(ctx, company.ID, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			threshold := 50.0
+			if _, err := r.CreateWebhook(ctx, model.Webhook{
+				Company: company.ID, URL: "https://example.com/hooks", Secret: "whsec_test",
+				Events:              []string{model.EventTransferSettled, model.EventTransferDeclined, model.EventLowBalance},
+				LowBalanceThreshold: &threshold,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			srcNum, _ := strconv.ParseInt(src.Number, 10, 64)
+			dstNum, _ := strconv.ParseInt(dst.Number, 10, 64)
+			// the first row crosses the threshold, the second overdraws
+			if berr := r.BatchTransfer(ctx, []repo.TransferInput{
+				{Source: srcNum, Target: dstNum, Amount: 60},
+				{Source: srcNum, Target: dstNum, Amount: 60},
+			}); berr != nil {
+				t.Fatalf("BatchTransfer: %v", berr.Err)
+			}
+
+			rows, err := pg.QueryContext(ctx,
+				`SELECT event_type FROM webhook_event WHERE company_id = $1 ORDER BY event_type`, company.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+			var got []string
+			for rows.Next() {
+				var e string
+				if err := rows.Scan(&e); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, e)
+			}
+			for _, want := range []string{model.EventLowBalance, model.EventTransferDeclined, model.EventTransferSettled} {
+				if !slices.Contains(got, want) {
+					t.Errorf("events %v, want %s among them", got, want)
+				}
+			}
+		})
+	}
+}
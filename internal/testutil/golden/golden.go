@@ -0,0 +1,38 @@
+// Package golden compares test output with files in the calling package's
+// testdata directory. Run go test with -update to rewrite them.
+package golden
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf8"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// Assert compares got with testdata/name, or rewrites it under -update.
+// Text that differs is printed; binary files are only named.
+func Assert(t testing.TB, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if bytes.Equal(got, want) {
+		return
+	}
+	if utf8.Valid(got) {
+		t.Errorf("%s differs from golden file:\n%s", name, got)
+	} else {
+		t.Errorf("%s differs from golden file", name)
+	}
+}
@@ -0,0 +1,86 @@
+// Package tracing configures OpenTelemetry tracing for the server.
+// The exporter is chosen with the standard OTEL_TRACES_EXPORTER variable:
+// "otlp" sends spans over OTLP/HTTP (OTEL_EXPORTER_OTLP_ENDPOINT, default
+// http://localhost:4318), "stdout" pretty-prints them for local development,
+// and "none" (the default) leaves tracing disabled at near-zero cost.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName is reported as service.name on every span.
+const ServiceName = "minibank"
+
+// Exporter names accepted by Setup.
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Config selects how spans are exported.
+type Config struct {
+	Exporter string    // one of the Exporter* names
+	Stdout   io.Writer // destination for ExporterStdout; os.Stdout if nil
+}
+
+// ConfigFromEnv reads the exporter from OTEL_TRACES_EXPORTER.
+func ConfigFromEnv() Config {
+	exp := os.Getenv("OTEL_TRACES_EXPORTER")
+	if exp == "" {
+		exp = ExporterNone
+	}
+	return Config{Exporter: exp}
+}
+
+// Tracer returns the minibank tracer from the global provider. It is a no-op
+// until Setup installs a real provider, so packages may call it freely.
+func Tracer() trace.Tracer { return otel.Tracer(ServiceName) }
+
+// Setup installs the global tracer provider and W3C trace-context
+// propagator. The returned function flushes and stops the exporter.
+func Setup(ctx context.Context, cfg Config) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exp sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		exp, err = otlptracehttp.New(ctx)
+	case ExporterStdout:
+		w := cfg.Stdout
+		if w == nil {
+			w = os.Stdout
+		}
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(w), stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q (want none, otlp or stdout)", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create %s exporter: %w", cfg.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
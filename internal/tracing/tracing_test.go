@@ -0,0 +1,52 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/token-cjg/minibank/internal/tracing"
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetup_Stdout(t *testing.T) {
+	prev := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(prev)
+
+	var buf bytes.Buffer
+	shutdown, err := tracing.Setup(context.Background(),
+		tracing.Config{Exporter: tracing.ExporterStdout, Stdout: &buf})
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+
+	_, span := tracing.Tracer().Start(context.Background(), "unit-test-span")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), "unit-test-span") {
+		t.Fatalf("span not exported: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), tracing.ServiceName) {
+		t.Fatalf("service name missing: %s", buf.String())
+	}
+}
+
+func TestSetup_None(t *testing.T) {
+	shutdown, err := tracing.Setup(context.Background(), tracing.Config{Exporter: tracing.ExporterNone})
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+}
+
+func TestSetup_UnknownExporter(t *testing.T) {
+	if _, err := tracing.Setup(context.Background(), tracing.Config{Exporter: "zipkin"}); err == nil {
+		t.Fatal("expected error for unknown exporter")
+	}
+}
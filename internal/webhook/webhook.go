@@ -0,0 +1,307 @@
+// Package webhook delivers the events in the webhook outbox to the URLs
+// companies subscribe with. Transfers write events in their own database
+// transaction (see repo.DispatchEvents); a Dispatcher, which may run on
+// every server at once, fans them out to deliveries and POSTs each one,
+// signed with the subscription's secret, retrying failures with
+// exponential backoff until the Policy gives up.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/token-cjg/minibank/internal/metrics"
+	"github.com/token-cjg/minibank/internal/repo"
+)
+
+// Headers of a delivery. The signature header is
+//
+//	Minibank-Signature: t=1711929600,v1=<hex HMAC-SHA256 of "1711929600.<body>">
+//
+// keyed with the subscription's secret. Receivers should recompute it over
+// the raw body and reject old timestamps to stop replays.
+const (
+	SignatureHeader = "Minibank-Signature"
+	EventHeader     = "Minibank-Event"
+	DeliveryHeader  = "Minibank-Delivery"
+)
+
+// Envelope is the JSON body of a delivery. Redeliveries of an event carry
+// the same envelope, so ID identifies duplicates.
+type Envelope struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CompanyID int64           `json:"company_id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Sign returns the signature header for body sent at t.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + mac(secret, ts, body)
+}
+
+func mac(secret, ts string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(ts + "."))
+	m.Write(body)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// ErrSignature is returned by Verify for a missing, malformed, wrong or
+// expired signature.
+var ErrSignature = errors.New("bad webhook signature")
+
+// Verify checks a signature header against body, as a receiver would,
+// rejecting signatures made more than tolerance before now.
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return fmt.Errorf("%w: malformed header", ErrSignature)
+	}
+	if now.Sub(time.Unix(sec, 0)) > tolerance {
+		return fmt.Errorf("%w: too old", ErrSignature)
+	}
+	if !hmac.Equal([]byte(sig), []byte(mac(secret, ts, body))) {
+		return fmt.Errorf("%w: mismatch", ErrSignature)
+	}
+	return nil
+}
+
+// Policy says how often and how patiently a delivery is retried.
+type Policy struct {
+	MaxAttempts int           // total attempts before a delivery fails
+	BaseDelay   time.Duration // wait after the first failure
+	MaxDelay    time.Duration // cap on any single wait
+}
+
+// DefaultPolicy retries for about a day: 1m, 2m, 4m ... capped at 6h.
+var DefaultPolicy = Policy{MaxAttempts: 12, BaseDelay: time.Minute, MaxDelay: 6 * time.Hour}
+
+// Delay is the wait after failed attempt n (n >= 1): BaseDelay doubled for
+// each earlier failure, capped at MaxDelay.
+func (p Policy) Delay(n int) time.Duration {
+	d := p.BaseDelay << (n - 1)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// Dispatcher moves events from the outbox to subscribers.
+type Dispatcher struct {
+	Repo   *repo.Repo
+	Client *http.Client
+	Policy Policy
+	// Interval is how often the outbox is polled.
+	Interval time.Duration
+	// Batch bounds the events fanned out and deliveries sent per query;
+	// the deliveries of a batch are sent concurrently.
+	Batch int
+	// Now is the clock signatures are made with.
+	Now func() time.Time
+}
+
+// New returns a Dispatcher with a client that gives up on a receiver after
+// timeout. The client only connects to public addresses, checked once a
+// receiver's name is resolved so DNS cannot point it back inside the
+// network, does not follow redirects and ignores proxy settings.
+func New(rep *repo.Repo, policy Policy, interval, timeout time.Duration) *Dispatcher {
+	dialer := &net.Dialer{Timeout: timeout, Control: dialControl}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &Dispatcher{
+		Repo: rep,
+		Client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		Policy:   policy,
+		Interval: interval,
+		Batch:    50,
+		Now:      time.Now,
+	}
+}
+
+// ErrForbiddenAddr is returned for a delivery to an address AllowedAddr
+// refuses.
+var ErrForbiddenAddr = errors.New("webhook receiver address is not public")
+
+// reserved are special-purpose IPv4 ranges netip has no predicate for.
+var reserved = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),   // reserved, and broadcast
+}
+
+// AllowedAddr reports whether a webhook may be delivered to addr: not
+// loopback, private (RFC 1918 or unique local), link-local, multicast,
+// unspecified or otherwise reserved.
+func AllowedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsMulticast() {
+		return false
+	}
+	for _, p := range reserved {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// dialControl refuses connections to addresses AllowedAddr refuses.
+func dialControl(network, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !AllowedAddr(ap.Addr()) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddr, ap.Addr())
+	}
+	return nil
+}
+
+// Run polls the outbox every Interval until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	t := time.NewTicker(d.Interval)
+	defer t.Stop()
+	for {
+		if err := d.Tick(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "webhook dispatch", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Tick fans out every undispatched event, then sends one batch of due
+// deliveries and records how each went.
+func (d *Dispatcher) Tick(ctx context.Context) error {
+	for {
+		n, err := d.Repo.DispatchEvents(ctx, d.Batch)
+		if err != nil {
+			return fmt.Errorf("dispatch events: %w", err)
+		}
+		if n < d.Batch {
+			break
+		}
+	}
+
+	// a claimed delivery comes due again if this server dies before
+	// recording the attempt; leave the client time to give up first
+	lease := 2*d.Client.Timeout + time.Minute
+	due, err := d.Repo.ClaimDeliveries(ctx, d.Batch, lease)
+	if err != nil {
+		return fmt.Errorf("claim deliveries: %w", err)
+	}
+	var wg sync.WaitGroup
+	for _, dd := range due {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a := d.send(ctx, dd)
+			if err := d.Repo.RecordAttempt(ctx, dd.ID, a); err != nil {
+				slog.ErrorContext(ctx, "record webhook attempt", "delivery", dd.ID, "err", err)
+			}
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// send POSTs one delivery and says how it went and when to try again.
+func (d *Dispatcher) send(ctx context.Context, dd repo.DueDelivery) repo.Attempt {
+	body, err := json.Marshal(Envelope{
+		ID: dd.Event, Type: dd.EventType, CompanyID: dd.Company, CreatedAt: dd.CreatedAt, Data: dd.Payload,
+	})
+	var a repo.Attempt
+	if err == nil {
+		a, err = d.post(ctx, dd, body)
+	}
+	if err != nil {
+		a.Err = err.Error()
+	}
+
+	attempt := dd.Attempts + 1
+	result := "delivered"
+	switch {
+	case a.Delivered:
+	case attempt >= d.Policy.MaxAttempts:
+		result = "failed"
+	default:
+		result = "retry"
+		a.RetryIn = d.Policy.Delay(attempt)
+	}
+	metrics.WebhookAttempts.WithLabelValues(result).Inc()
+	slog.DebugContext(ctx, "webhook attempt", "delivery", dd.ID, "event", dd.EventType,
+		"attempt", attempt, "result", result, "status", a.ResponseStatus, "err", a.Err)
+	return a
+}
+
+func (d *Dispatcher) post(ctx context.Context, dd repo.DueDelivery, body []byte) (repo.Attempt, error) {
+	var a repo.Attempt
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dd.URL, bytes.NewReader(body))
+	if err != nil {
+		return a, err
+	}
+	if req.URL.Scheme != "https" {
+		return a, errors.New("webhook URL is not https")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "minibank-webhooks/1")
+	req.Header.Set(EventHeader, dd.EventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(dd.ID, 10))
+	req.Header.Set(SignatureHeader, Sign(dd.Secret, d.Now(), body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return a, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // let the connection be reused
+
+	a.ResponseStatus = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return a, fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	a.Delivered = true
+	return a, nil
+}
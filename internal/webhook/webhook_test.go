@@ -0,0 +1,165 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/token-cjg/minibank/internal/repo"
+	"github.com/token-cjg/minibank/internal/webhook"
+)
+
+func TestSignVerify(t *testing.T) {
+	now := time.Unix(1711929600, 0)
+	body := []byte(`{"id":1}`)
+	sig := webhook.Sign("s3cret", now, body)
+
+	if err := webhook.Verify("s3cret", sig, body, now.Add(time.Minute), 5*time.Minute); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	for name, err := range map[string]error{
+		"wrong secret": webhook.Verify("other", sig, body, now, 5*time.Minute),
+		"altered body": webhook.Verify("s3cret", sig, []byte(`{"id":2}`), now, 5*time.Minute),
+		"too old":      webhook.Verify("s3cret", sig, body, now.Add(time.Hour), 5*time.Minute),
+		"malformed":    webhook.Verify("s3cret", "v1=abc", body, now, 5*time.Minute),
+	} {
+		if !errors.Is(err, webhook.ErrSignature) {
+			t.Errorf("%s: err = %v, want ErrSignature", name, err)
+		}
+	}
+}
+
+func TestPolicyDelay(t *testing.T) {
+	p := webhook.Policy{MaxAttempts: 12, BaseDelay: time.Minute, MaxDelay: time.Hour}
+	for n, want := range map[int]time.Duration{
+		1: time.Minute, 2: 2 * time.Minute, 4: 8 * time.Minute, 7: time.Hour, 80: time.Hour,
+	} {
+		if got := p.Delay(n); got != want {
+			t.Errorf("Delay(%d) = %v, want %v", n, got, want)
+		}
+	}
+}
+
+var dueCols = []string{"delivery_id", "webhook_id", "attempts", "url", "secret",
+	"event_id", "event_type", "company_id", "created_at", "payload"}
+
+func TestTick(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	ok := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, body = r, must(io.ReadAll(r.Body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ok.Close()
+	down := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+
+	created := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectExec(`UPDATE webhook_event SET dispatched_at`).
+		WithArgs(50).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery(`UPDATE webhook_delivery d\s+SET next_attempt_at`).
+		WithArgs(50, int64(80000)).
+		WillReturnRows(sqlmock.NewRows(dueCols).
+			AddRow(1, 7, 0, ok.URL, "s3cret", 11, "transfer.settled", 3, created, []byte(`{"tx_id":5}`)).
+			AddRow(2, 8, 2, down.URL, "other", 11, "transfer.settled", 3, created, []byte(`{"tx_id":5}`)))
+	status204, status503 := 204, 503
+	answered := "receiver answered 503 Service Unavailable"
+	mock.ExpectExec(`UPDATE webhook_delivery\s+SET attempts = attempts \+ 1`).
+		WithArgs(int64(1), &status204, nil, "delivered", int64(0)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE webhook_delivery\s+SET attempts = attempts \+ 1`).
+		WithArgs(int64(2), &status503, &answered, "pending", int64(4*time.Minute/time.Millisecond)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	d := webhook.New(repo.New(db), webhook.Policy{MaxAttempts: 5, BaseDelay: time.Minute, MaxDelay: time.Hour},
+		time.Second, 10*time.Second)
+	now := time.Unix(1711929600, 0)
+	d.Now = func() time.Time { return now }
+	// the test receivers listen on loopback, which New's client refuses
+	d.Client = ok.Client()
+	d.Client.Timeout = 10 * time.Second
+
+	if err := d.Tick(context.Background()); err != nil {
+		t.Fatalf("Tick: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+
+	if got == nil {
+		t.Fatal("receiver was not called")
+	}
+	if got.Header.Get(webhook.EventHeader) != "transfer.settled" || got.Header.Get(webhook.DeliveryHeader) != "1" {
+		t.Errorf("headers %v", got.Header)
+	}
+	if err := webhook.Verify("s3cret", got.Header.Get(webhook.SignatureHeader), body, now, time.Minute); err != nil {
+		t.Errorf("signature: %v", err)
+	}
+	var env webhook.Envelope
+	if err := json.Unmarshal(body, &env); err != nil || env.ID != 11 || env.CompanyID != 3 ||
+		string(env.Data) != `{"tx_id":5}` {
+		t.Errorf("envelope %s (%v)", body, err)
+	}
+}
+
+func TestNew_RefusesPrivateReceivers(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://example.com/", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	d := webhook.New(nil, webhook.DefaultPolicy, time.Second, time.Second)
+	_, err := d.Client.Get(srv.URL)
+	if !errors.Is(err, webhook.ErrForbiddenAddr) {
+		t.Fatalf("err %v, want ErrForbiddenAddr", err)
+	}
+
+	// a receiver that passes the check does not get to redirect the client
+	client := srv.Client()
+	client.CheckRedirect = d.Client.CheckRedirect
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("status %d, want the redirect itself", resp.StatusCode)
+	}
+}
+
+func TestAllowedAddr(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.216.34": true, "2606:2800:220:1::1": true,
+		"127.0.0.1": false, "10.1.2.3": false, "172.16.0.1": false, "192.168.1.1": false,
+		"169.254.169.254": false, "100.64.0.1": false, "0.0.0.0": false, "255.255.255.255": false,
+		"::1": false, "fe80::1": false, "fd00::1": false, "::ffff:127.0.0.1": false, "::": false,
+	} {
+		if got := webhook.AllowedAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("AllowedAddr(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
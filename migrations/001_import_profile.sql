@@ -0,0 +1,18 @@
+-- Saved CSV dialects for transfer uploads, one set per company.
+
+CREATE TABLE IF NOT EXISTS import_profile (
+  profile_id          SERIAL PRIMARY KEY,
+  company_id          INT NOT NULL
+                       REFERENCES company(company_id) ON DELETE CASCADE,
+  profile_name        TEXT NOT NULL,
+  delimiter           TEXT NOT NULL DEFAULT ',',
+  header              TEXT NOT NULL DEFAULT 'auto'
+                       CHECK (header IN ('auto', 'present', 'absent')),
+  source_column       TEXT NOT NULL DEFAULT '1',
+  target_column       TEXT NOT NULL DEFAULT '2',
+  amount_column       TEXT NOT NULL DEFAULT '3',
+  decimal_separator   TEXT NOT NULL DEFAULT '.',
+  thousands_separator TEXT NOT NULL DEFAULT '',
+  encoding            TEXT NOT NULL DEFAULT 'utf-8',
+  UNIQUE (company_id, profile_name)
+);
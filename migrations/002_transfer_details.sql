@@ -0,0 +1,7 @@
+-- Optional details a client can send with each transfer. reference is the
+-- client's own id for the transfer; value_date is the date it should take
+-- effect, recorded as given.
+ALTER TABLE transaction
+  ADD COLUMN IF NOT EXISTS reference  TEXT NULL,
+  ADD COLUMN IF NOT EXISTS memo       TEXT NULL,
+  ADD COLUMN IF NOT EXISTS value_date DATE NULL;
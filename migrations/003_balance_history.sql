@@ -0,0 +1,14 @@
+-- Indexes for balances as of a past time and statements over a period.
+-- Both sum or list an account's settled transfers from some time onwards,
+-- so each side of a transfer is indexed by account and time, carrying the
+-- amount so the sums need not visit the table.
+
+CREATE INDEX IF NOT EXISTS idx_transaction_source_settled
+        ON transaction(source_account_id, created_at)
+        INCLUDE (transfer_amount)
+        WHERE error IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_transaction_target_settled
+        ON transaction(target_account_id, created_at)
+        INCLUDE (transfer_amount)
+        WHERE error IS NULL;
@@ -0,0 +1,60 @@
+-- Webhooks. A transfer writes the events its companies subscribe to into
+-- webhook_event in the same database transaction as the transfer itself,
+-- so an event exists if and only if its transfer committed. The dispatcher
+-- fans each event out to one webhook_delivery per matching subscription and
+-- delivers those, retrying failures with backoff; the deliveries double as
+-- the delivery log.
+
+CREATE TABLE IF NOT EXISTS webhook_subscription (
+  webhook_id            SERIAL PRIMARY KEY,
+  company_id            INT NOT NULL
+                         REFERENCES company(company_id) ON DELETE CASCADE,
+  url                   TEXT NOT NULL,
+  secret                TEXT NOT NULL,
+  events                TEXT[] NOT NULL CHECK (cardinality(events) > 0),
+  low_balance_threshold NUMERIC(18,2) NULL,
+  created_at            TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_subscription_company
+        ON webhook_subscription(company_id);
+
+-- The outbox. webhook_id is set for events meant for one subscription only,
+-- such as a low balance crossing that subscription's threshold.
+CREATE TABLE IF NOT EXISTS webhook_event (
+  event_id      BIGSERIAL PRIMARY KEY,
+  company_id    INT NOT NULL
+                 REFERENCES company(company_id) ON DELETE CASCADE,
+  webhook_id    INT NULL
+                 REFERENCES webhook_subscription(webhook_id) ON DELETE CASCADE,
+  event_type    TEXT NOT NULL,
+  payload       JSONB NOT NULL,
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+  dispatched_at TIMESTAMPTZ NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_event_undispatched
+        ON webhook_event(event_id)
+        WHERE dispatched_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS webhook_delivery (
+  delivery_id     BIGSERIAL PRIMARY KEY,
+  webhook_id      INT NOT NULL
+                   REFERENCES webhook_subscription(webhook_id) ON DELETE CASCADE,
+  event_id        BIGINT NOT NULL
+                   REFERENCES webhook_event(event_id) ON DELETE CASCADE,
+  status          TEXT NOT NULL DEFAULT 'pending'
+                   CHECK (status IN ('pending', 'delivered', 'failed')),
+  attempts        INT NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_attempt_at TIMESTAMPTZ NULL,
+  response_status INT NULL,
+  last_error      TEXT NULL,
+  delivered_at    TIMESTAMPTZ NULL,
+  created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_due
+        ON webhook_delivery(next_attempt_at)
+        WHERE status = 'pending';
@@ -0,0 +1,6 @@
+-- Import profile columns holding a transfer's optional details; empty when
+-- the profile does not map one.
+ALTER TABLE import_profile
+  ADD COLUMN IF NOT EXISTS reference_column  TEXT NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS memo_column       TEXT NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS value_date_column TEXT NOT NULL DEFAULT '';
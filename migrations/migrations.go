@@ -0,0 +1,27 @@
+// Package migrations embeds the SQL schema migrations so the server can tell
+// whether the database it talks to has all of them applied.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// Versions lists the migration file names in the order cmd/migrate applies
+// them; each is recorded in the schema_migrations table once applied.
+func Versions() []string {
+	entries, _ := fs.ReadDir(files, ".")
+	var out []string
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".sql") {
+			out = append(out, e.Name())
+		}
+	}
+	sort.Strings(out)
+	return out
+}
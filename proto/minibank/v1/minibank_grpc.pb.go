@@ -0,0 +1,595 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: minibank/v1/minibank.proto
+
+// minibank.v1 is the gRPC API of minibank, served next to the REST API and
+// backed by the same database. Amounts are decimal strings such as "100.50",
+// with at most two decimal places, so they pass through exactly.
+
+package minibankv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Minibank_CreateCompany_FullMethodName      = "/minibank.v1.Minibank/CreateCompany"
+	Minibank_GetCompany_FullMethodName         = "/minibank.v1.Minibank/GetCompany"
+	Minibank_ListCompanies_FullMethodName      = "/minibank.v1.Minibank/ListCompanies"
+	Minibank_CreateAccount_FullMethodName      = "/minibank.v1.Minibank/CreateAccount"
+	Minibank_GetAccount_FullMethodName         = "/minibank.v1.Minibank/GetAccount"
+	Minibank_GetAccountByNumber_FullMethodName = "/minibank.v1.Minibank/GetAccountByNumber"
+	Minibank_ListAccounts_FullMethodName       = "/minibank.v1.Minibank/ListAccounts"
+	Minibank_CreateTransfer_FullMethodName     = "/minibank.v1.Minibank/CreateTransfer"
+	Minibank_BatchTransfer_FullMethodName      = "/minibank.v1.Minibank/BatchTransfer"
+	Minibank_Transfer_FullMethodName           = "/minibank.v1.Minibank/Transfer"
+	Minibank_ListTransactions_FullMethodName   = "/minibank.v1.Minibank/ListTransactions"
+	Minibank_GetBalance_FullMethodName         = "/minibank.v1.Minibank/GetBalance"
+)
+
+// MinibankClient is the client API for Minibank service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Minibank manages companies and their accounts and moves money between
+// accounts.
+//
+// Over mutual TLS, a verified client certificate mapped to a company
+// authenticates the transfer RPCs, exactly as it does POST /transfer: they
+// may then only debit that company's accounts, and a certificate that is
+// not mapped to a company is refused with PERMISSION_DENIED. Calls without
+// a client certificate are unauthenticated. The x-request-id metadata key is read and
+// echoed in the response header, as X-Request-ID is over HTTP.
+//
+// Errors carry the usual status codes: NOT_FOUND for a missing company or
+// account, ALREADY_EXISTS for a duplicate company name, INVALID_ARGUMENT with
+// a google.rpc.BadRequest detail naming each invalid field, and ABORTED for
+// a transfer that kept conflicting with concurrent ones and may be retried.
+type MinibankClient interface {
+	CreateCompany(ctx context.Context, in *CreateCompanyRequest, opts ...grpc.CallOption) (*Company, error)
+	GetCompany(ctx context.Context, in *GetCompanyRequest, opts ...grpc.CallOption) (*Company, error)
+	ListCompanies(ctx context.Context, in *ListCompaniesRequest, opts ...grpc.CallOption) (*ListCompaniesResponse, error)
+	CreateAccount(ctx context.Context, in *CreateAccountRequest, opts ...grpc.CallOption) (*Account, error)
+	GetAccount(ctx context.Context, in *GetAccountRequest, opts ...grpc.CallOption) (*Account, error)
+	GetAccountByNumber(ctx context.Context, in *GetAccountByNumberRequest, opts ...grpc.CallOption) (*Account, error)
+	ListAccounts(ctx context.Context, in *ListAccountsRequest, opts ...grpc.CallOption) (*ListAccountsResponse, error)
+	// CreateTransfer runs one transfer. A declined transfer is not an error;
+	// its result says why it was declined.
+	CreateTransfer(ctx context.Context, in *TransferRequest, opts ...grpc.CallOption) (*TransferResult, error)
+	// BatchTransfer runs the transfers the client streams as one batch, as
+	// POST /transfer runs an uploaded file, once the client closes its side.
+	// Every row is validated, and checked against the authenticated company,
+	// before any runs. If a row fails the error names it; the rows before it
+	// were applied, unless the server settles batches this large in bulk, in
+	// which case none were.
+	BatchTransfer(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[TransferRequest, BatchTransferResponse], error)
+	// Transfer runs transfers as the client streams them and streams back one
+	// result per row, in row order, like an NDJSON upload to POST /transfer.
+	// Rows sharing an account run in order; others may run concurrently, with
+	// the same results as a serial run. A row that is invalid, forbidden or
+	// fails ends the call with an error naming the row; every row the client
+	// got a result for was applied.
+	Transfer(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[TransferRequest, TransferResult], error)
+	// ListTransactions pages through an account's transactions, newest
+	// first: its debits, settled or declined, and its settled credits.
+	ListTransactions(ctx context.Context, in *ListTransactionsRequest, opts ...grpc.CallOption) (*ListTransactionsResponse, error)
+	// GetBalance returns an account's balance at a past moment, or now.
+	GetBalance(ctx context.Context, in *GetBalanceRequest, opts ...grpc.CallOption) (*Balance, error)
+}
+
+type minibankClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMinibankClient(cc grpc.ClientConnInterface) MinibankClient {
+	return &minibankClient{cc}
+}
+
+func (c *minibankClient) CreateCompany(ctx context.Context, in *CreateCompanyRequest, opts ...grpc.CallOption) (*Company, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Company)
+	err := c.cc.Invoke(ctx, Minibank_CreateCompany_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *minibankClient) GetCompany(ctx context.Context, in *GetCompanyRequest, opts ...grpc.CallOption) (*Company, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Company)
+	err := c.cc.Invoke(ctx, Minibank_GetCompany_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *minibankClient) ListCompanies(ctx context.Context, in *ListCompaniesRequest, opts ...grpc.CallOption) (*ListCompaniesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListCompaniesResponse)
+	err := c.cc.Invoke(ctx, Minibank_ListCompanies_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *minibankClient) CreateAccount(ctx context.Context, in *CreateAccountRequest, opts ...grpc.CallOption) (*Account, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Account)
+	err := c.cc.Invoke(ctx, Minibank_CreateAccount_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *minibankClient) GetAccount(ctx context.Context, in *GetAccountRequest, opts ...grpc.CallOption) (*Account, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Account)
+	err := c.cc.Invoke(ctx, Minibank_GetAccount_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *minibankClient) GetAccountByNumber(ctx context.Context, in *GetAccountByNumberRequest, opts ...grpc.CallOption) (*Account, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Account)
+	err := c.cc.Invoke(ctx, Minibank_GetAccountByNumber_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *minibankClient) ListAccounts(ctx context.Context, in *ListAccountsRequest, opts ...grpc.CallOption) (*ListAccountsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListAccountsResponse)
+	err := c.cc.Invoke(ctx, Minibank_ListAccounts_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *minibankClient) CreateTransfer(ctx context.Context, in *TransferRequest, opts ...grpc.CallOption) (*TransferResult, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TransferResult)
+	err := c.cc.Invoke(ctx, Minibank_CreateTransfer_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *minibankClient) BatchTransfer(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[TransferRequest, BatchTransferResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Minibank_ServiceDesc.Streams[0], Minibank_BatchTransfer_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[TransferRequest, BatchTransferResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Minibank_BatchTransferClient = grpc.ClientStreamingClient[TransferRequest, BatchTransferResponse]
+
+func (c *minibankClient) Transfer(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[TransferRequest, TransferResult], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Minibank_ServiceDesc.Streams[1], Minibank_Transfer_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[TransferRequest, TransferResult]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Minibank_TransferClient = grpc.BidiStreamingClient[TransferRequest, TransferResult]
+
+func (c *minibankClient) ListTransactions(ctx context.Context, in *ListTransactionsRequest, opts ...grpc.CallOption) (*ListTransactionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListTransactionsResponse)
+	err := c.cc.Invoke(ctx, Minibank_ListTransactions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *minibankClient) GetBalance(ctx context.Context, in *GetBalanceRequest, opts ...grpc.CallOption) (*Balance, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Balance)
+	err := c.cc.Invoke(ctx, Minibank_GetBalance_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MinibankServer is the server API for Minibank service.
+// All implementations must embed UnimplementedMinibankServer
+// for forward compatibility.
+//
+// Minibank manages companies and their accounts and moves money between
+// accounts.
+//
+// Over mutual TLS, a verified client certificate mapped to a company
+// authenticates the transfer RPCs, exactly as it does POST /transfer: they
+// may then only debit that company's accounts, and a certificate that is
+// not mapped to a company is refused with PERMISSION_DENIED. Calls without
+// a client certificate are unauthenticated. The x-request-id metadata key is read and
+// echoed in the response header, as X-Request-ID is over HTTP.
+//
+// Errors carry the usual status codes: NOT_FOUND for a missing company or
+// account, ALREADY_EXISTS for a duplicate company name, INVALID_ARGUMENT with
+// a google.rpc.BadRequest detail naming each invalid field, and ABORTED for
+// a transfer that kept conflicting with concurrent ones and may be retried.
+type MinibankServer interface {
+	CreateCompany(context.Context, *CreateCompanyRequest) (*Company, error)
+	GetCompany(context.Context, *GetCompanyRequest) (*Company, error)
+	ListCompanies(context.Context, *ListCompaniesRequest) (*ListCompaniesResponse, error)
+	CreateAccount(context.Context, *CreateAccountRequest) (*Account, error)
+	GetAccount(context.Context, *GetAccountRequest) (*Account, error)
+	GetAccountByNumber(context.Context, *GetAccountByNumberRequest) (*Account, error)
+	ListAccounts(context.Context, *ListAccountsRequest) (*ListAccountsResponse, error)
+	// CreateTransfer runs one transfer. A declined transfer is not an error;
+	// its result says why it was declined.
+	CreateTransfer(context.Context, *TransferRequest) (*TransferResult, error)
+	// BatchTransfer runs the transfers the client streams as one batch, as
+	// POST /transfer runs an uploaded file, once the client closes its side.
+	// Every row is validated, and checked against the authenticated company,
+	// before any runs. If a row fails the error names it; the rows before it
+	// were applied, unless the server settles batches this large in bulk, in
+	// which case none were.
+	BatchTransfer(grpc.ClientStreamingServer[TransferRequest, BatchTransferResponse]) error
+	// Transfer runs transfers as the client streams them and streams back one
+	// result per row, in row order, like an NDJSON upload to POST /transfer.
+	// Rows sharing an account run in order; others may run concurrently, with
+	// the same results as a serial run. A row that is invalid, forbidden or
+	// fails ends the call with an error naming the row; every row the client
+	// got a result for was applied.
+	Transfer(grpc.BidiStreamingServer[TransferRequest, TransferResult]) error
+	// ListTransactions pages through an account's transactions, newest
+	// first: its debits, settled or declined, and its settled credits.
+	ListTransactions(context.Context, *ListTransactionsRequest) (*ListTransactionsResponse, error)
+	// GetBalance returns an account's balance at a past moment, or now.
+	GetBalance(context.Context, *GetBalanceRequest) (*Balance, error)
+	mustEmbedUnimplementedMinibankServer()
+}
+
+// UnimplementedMinibankServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedMinibankServer struct{}
+
+func (UnimplementedMinibankServer) CreateCompany(context.Context, *CreateCompanyRequest) (*Company, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateCompany not implemented")
+}
+func (UnimplementedMinibankServer) GetCompany(context.Context, *GetCompanyRequest) (*Company, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCompany not implemented")
+}
+func (UnimplementedMinibankServer) ListCompanies(context.Context, *ListCompaniesRequest) (*ListCompaniesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListCompanies not implemented")
+}
+func (UnimplementedMinibankServer) CreateAccount(context.Context, *CreateAccountRequest) (*Account, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateAccount not implemented")
+}
+func (UnimplementedMinibankServer) GetAccount(context.Context, *GetAccountRequest) (*Account, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAccount not implemented")
+}
+func (UnimplementedMinibankServer) GetAccountByNumber(context.Context, *GetAccountByNumberRequest) (*Account, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAccountByNumber not implemented")
+}
+func (UnimplementedMinibankServer) ListAccounts(context.Context, *ListAccountsRequest) (*ListAccountsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAccounts not implemented")
+}
+func (UnimplementedMinibankServer) CreateTransfer(context.Context, *TransferRequest) (*TransferResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateTransfer not implemented")
+}
+func (UnimplementedMinibankServer) BatchTransfer(grpc.ClientStreamingServer[TransferRequest, BatchTransferResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method BatchTransfer not implemented")
+}
+func (UnimplementedMinibankServer) Transfer(grpc.BidiStreamingServer[TransferRequest, TransferResult]) error {
+	return status.Errorf(codes.Unimplemented, "method Transfer not implemented")
+}
+func (UnimplementedMinibankServer) ListTransactions(context.Context, *ListTransactionsRequest) (*ListTransactionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTransactions not implemented")
+}
+func (UnimplementedMinibankServer) GetBalance(context.Context, *GetBalanceRequest) (*Balance, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBalance not implemented")
+}
+func (UnimplementedMinibankServer) mustEmbedUnimplementedMinibankServer() {}
+func (UnimplementedMinibankServer) testEmbeddedByValue()                  {}
+
+// UnsafeMinibankServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MinibankServer will
+// result in compilation errors.
+type UnsafeMinibankServer interface {
+	mustEmbedUnimplementedMinibankServer()
+}
+
+func RegisterMinibankServer(s grpc.ServiceRegistrar, srv MinibankServer) {
+	// If the following call pancis, it indicates UnimplementedMinibankServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Minibank_ServiceDesc, srv)
+}
+
+func _Minibank_CreateCompany_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateCompanyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MinibankServer).CreateCompany(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Minibank_CreateCompany_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MinibankServer).CreateCompany(ctx, req.(*CreateCompanyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Minibank_GetCompany_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCompanyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MinibankServer).GetCompany(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Minibank_GetCompany_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MinibankServer).GetCompany(ctx, req.(*GetCompanyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Minibank_ListCompanies_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListCompaniesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MinibankServer).ListCompanies(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Minibank_ListCompanies_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MinibankServer).ListCompanies(ctx, req.(*ListCompaniesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Minibank_CreateAccount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateAccountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MinibankServer).CreateAccount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Minibank_CreateAccount_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MinibankServer).CreateAccount(ctx, req.(*CreateAccountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Minibank_GetAccount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAccountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MinibankServer).GetAccount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Minibank_GetAccount_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MinibankServer).GetAccount(ctx, req.(*GetAccountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Minibank_GetAccountByNumber_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAccountByNumberRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MinibankServer).GetAccountByNumber(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Minibank_GetAccountByNumber_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MinibankServer).GetAccountByNumber(ctx, req.(*GetAccountByNumberRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Minibank_ListAccounts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAccountsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MinibankServer).ListAccounts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Minibank_ListAccounts_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MinibankServer).ListAccounts(ctx, req.(*ListAccountsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Minibank_CreateTransfer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TransferRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MinibankServer).CreateTransfer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Minibank_CreateTransfer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MinibankServer).CreateTransfer(ctx, req.(*TransferRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Minibank_BatchTransfer_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MinibankServer).BatchTransfer(&grpc.GenericServerStream[TransferRequest, BatchTransferResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Minibank_BatchTransferServer = grpc.ClientStreamingServer[TransferRequest, BatchTransferResponse]
+
+func _Minibank_Transfer_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MinibankServer).Transfer(&grpc.GenericServerStream[TransferRequest, TransferResult]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Minibank_TransferServer = grpc.BidiStreamingServer[TransferRequest, TransferResult]
+
+func _Minibank_ListTransactions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTransactionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MinibankServer).ListTransactions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Minibank_ListTransactions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MinibankServer).ListTransactions(ctx, req.(*ListTransactionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Minibank_GetBalance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBalanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MinibankServer).GetBalance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Minibank_GetBalance_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MinibankServer).GetBalance(ctx, req.(*GetBalanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Minibank_ServiceDesc is the grpc.ServiceDesc for Minibank service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Minibank_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "minibank.v1.Minibank",
+	HandlerType: (*MinibankServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateCompany",
+			Handler:    _Minibank_CreateCompany_Handler,
+		},
+		{
+			MethodName: "GetCompany",
+			Handler:    _Minibank_GetCompany_Handler,
+		},
+		{
+			MethodName: "ListCompanies",
+			Handler:    _Minibank_ListCompanies_Handler,
+		},
+		{
+			MethodName: "CreateAccount",
+			Handler:    _Minibank_CreateAccount_Handler,
+		},
+		{
+			MethodName: "GetAccount",
+			Handler:    _Minibank_GetAccount_Handler,
+		},
+		{
+			MethodName: "GetAccountByNumber",
+			Handler:    _Minibank_GetAccountByNumber_Handler,
+		},
+		{
+			MethodName: "ListAccounts",
+			Handler:    _Minibank_ListAccounts_Handler,
+		},
+		{
+			MethodName: "CreateTransfer",
+			Handler:    _Minibank_CreateTransfer_Handler,
+		},
+		{
+			MethodName: "ListTransactions",
+			Handler:    _Minibank_ListTransactions_Handler,
+		},
+		{
+			MethodName: "GetBalance",
+			Handler:    _Minibank_GetBalance_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "BatchTransfer",
+			Handler:       _Minibank_BatchTransfer_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Transfer",
+			Handler:       _Minibank_Transfer_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "minibank/v1/minibank.proto",
+}